@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrProductNotFound se devuelve cuando el catálogo no tiene el producto o está inactivo
+var ErrProductNotFound = errors.New("product not found in catalog")
+
+// Decimal acepta los montos como número o como texto; node-postgres serializa
+// las columnas DECIMAL como cadenas.
+type Decimal float64
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*d = 0
+		return nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return err
+	}
+	*d = Decimal(value)
+	return nil
+}
+
+// Product es la vista del producto que expone el servicio de catálogo (Node)
+type Product struct {
+	ID            int      `json:"id_producto"`
+	Nombre        string   `json:"nombre"`
+	Modelo        string   `json:"modelo"`
+	PrecioCompra  Decimal  `json:"precio_compra"`
+	PrecioVenta   Decimal  `json:"precio_venta"`
+	SKU           string   `json:"sku"`
+	CodigoBarras  string   `json:"codigo_barras"`
+	IDMarca       int      `json:"id_marca"`
+	MarcaNombre   string   `json:"marca_nombre"`
+	IVAPorcentaje *Decimal `json:"iva_porcentaje"` // nil si el producto no tiene IVA asignado
+}
+
+// LegacyStock es la existencia de un producto en la tabla inventario del
+// catálogo, de antes de que el inventario se llevara en este servicio
+type LegacyStock struct {
+	ProductID int     `json:"id_producto"`
+	Cantidad  Decimal `json:"cantidad"` // SUM() llega como texto
+}
+
+// Client consulta productos en la API de catálogo
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// GetProduct obtiene el producto activo con el ID indicado
+func (c *Client) GetProduct(ctx context.Context, productID string) (Product, error) {
+	var product Product
+	err := c.get(ctx, "/products/"+productID, &product)
+	if err == errNotFound {
+		return product, ErrProductNotFound
+	}
+	return product, err
+}
+
+// ListLegacyStock obtiene las existencias de la tabla inventario del catálogo
+func (c *Client) ListLegacyStock(ctx context.Context) ([]LegacyStock, error) {
+	var stock []LegacyStock
+	err := c.get(ctx, "/inventory", &stock)
+	if err == errNotFound {
+		return nil, fmt.Errorf("catalog has no inventory endpoint")
+	}
+	return stock, err
+}
+
+// UpdatePurchasePrice guarda en el catálogo el costo de compra del producto
+func (c *Client) UpdatePurchasePrice(ctx context.Context, productID string, cost float64) error {
+	body, err := json.Marshal(map[string]float64{"precio_compra": cost})
+	if err != nil {
+		return err
+	}
+
+	var product Product
+	err = c.do(ctx, http.MethodPut, "/products/"+productID, bytes.NewReader(body), &product)
+	if err == errNotFound {
+		return ErrProductNotFound
+	}
+	return err
+}
+
+var errNotFound = errors.New("not found")
+
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	return c.do(ctx, http.MethodGet, path, nil, v)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("catalog responded with status %d", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
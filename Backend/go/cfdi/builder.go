@@ -0,0 +1,269 @@
+package cfdi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Issuer contiene los datos fiscales del emisor y los valores por defecto de
+// los conceptos facturados.
+type Issuer struct {
+	RFC              string
+	Nombre           string
+	RegimenFiscal    string
+	LugarExpedicion  string // código postal
+	Serie            string
+	ClaveProdServ    string
+	ClaveUnidad      string
+	PricesIncludeTax bool
+}
+
+// Customer son los datos fiscales del receptor
+type Customer struct {
+	RFC             string `json:"rfc"`
+	Nombre          string `json:"nombre"`
+	DomicilioFiscal string `json:"domicilioFiscal"` // código postal
+	RegimenFiscal   string `json:"regimenFiscal"`
+	UsoCFDI         string `json:"usoCFDI"`
+}
+
+// Line es un concepto a facturar con el precio cobrado y su tasa de IVA
+type Line struct {
+	ID          string
+	Description string
+	Quantity    int
+	UnitPrice   float64
+	TaxRate     float64 // 0.16 para IVA general
+}
+
+var (
+	rfcPattern = regexp.MustCompile(`^[A-ZÑ&]{3,4}[0-9]{6}[A-Z0-9]{3}$`)
+	cpPattern  = regexp.MustCompile(`^[0-9]{5}$`)
+
+	usosCFDI = set("G01", "G02", "G03", "I01", "I02", "I03", "I04", "I05", "I06", "I07", "I08",
+		"D01", "D02", "D03", "D04", "D05", "D06", "D07", "D08", "D09", "D10", "S01", "CP01", "CN01")
+	formasPago = set("01", "02", "03", "04", "05", "06", "08", "12", "13", "14", "15", "17",
+		"23", "24", "25", "26", "27", "28", "29", "30", "31", "99")
+	regimenesFiscales = set("601", "603", "605", "606", "607", "608", "610", "611", "612", "614",
+		"615", "616", "620", "621", "622", "623", "624", "625", "626")
+	periodicidades = set("01", "02", "03", "04", "05")
+)
+
+func set(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
+
+// Validate revisa los datos fiscales del receptor contra los catálogos del SAT
+func (c Customer) Validate() error {
+	if !rfcPattern.MatchString(c.RFC) {
+		return errors.New("invalid RFC")
+	}
+	if c.RFC == RFCPublicoGeneral {
+		return errors.New("use the global invoice for sales to the general public")
+	}
+	if c.Nombre == "" {
+		return errors.New("customer name is required")
+	}
+	if !cpPattern.MatchString(c.DomicilioFiscal) {
+		return errors.New("fiscal address must be a 5 digit postal code")
+	}
+	if !regimenesFiscales[c.RegimenFiscal] {
+		return errors.New("invalid fiscal regime")
+	}
+	if !usosCFDI[c.UsoCFDI] {
+		return errors.New("invalid CFDI usage code")
+	}
+	return nil
+}
+
+// ValidatePayment revisa forma y método de pago (PPD exige forma de pago 99)
+func ValidatePayment(formaPago, metodoPago string) error {
+	if !formasPago[formaPago] {
+		return errors.New("invalid payment form")
+	}
+	switch metodoPago {
+	case "PUE":
+		if formaPago == "99" {
+			return errors.New("payment form 99 requires payment method PPD")
+		}
+	case "PPD":
+		if formaPago != "99" {
+			return errors.New("payment method PPD requires payment form 99")
+		}
+	default:
+		return errors.New("invalid payment method")
+	}
+	return nil
+}
+
+// BuildInvoice arma el comprobante de ingreso de una venta para un cliente
+func (i Issuer) BuildInvoice(folio string, customer Customer, formaPago, metodoPago string, lines []Line, fecha time.Time) (*Comprobante, error) {
+	if err := customer.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ValidatePayment(formaPago, metodoPago); err != nil {
+		return nil, err
+	}
+
+	c := i.newComprobante(folio, fecha)
+	c.FormaPago = formaPago
+	c.MetodoPago = metodoPago
+	c.Receptor = Receptor{
+		Rfc:                     customer.RFC,
+		Nombre:                  customer.Nombre,
+		DomicilioFiscalReceptor: customer.DomicilioFiscal,
+		RegimenFiscalReceptor:   customer.RegimenFiscal,
+		UsoCFDI:                 customer.UsoCFDI,
+	}
+
+	if err := i.addConceptos(c, lines, i.ClaveProdServ, i.ClaveUnidad); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// BuildGlobalInvoice arma la factura global de las ventas al público en general
+// del periodo. Cada venta es un concepto con clave 01010101 y unidad ACT.
+func (i Issuer) BuildGlobalInvoice(folio, periodicidad string, month time.Month, year int, formaPago string, lines []Line, fecha time.Time) (*Comprobante, error) {
+	if !periodicidades[periodicidad] {
+		return nil, errors.New("invalid periodicity")
+	}
+	if err := ValidatePayment(formaPago, "PUE"); err != nil {
+		return nil, err
+	}
+
+	c := i.newComprobante(folio, fecha)
+	c.FormaPago = formaPago
+	c.MetodoPago = "PUE"
+	c.InformacionGlobal = &InformacionGlobal{
+		Periodicidad: periodicidad,
+		Meses:        fmt.Sprintf("%02d", int(month)),
+		Año:          strconv.Itoa(year),
+	}
+	c.Receptor = Receptor{
+		Rfc:                     RFCPublicoGeneral,
+		Nombre:                  NombrePublicoGeneral,
+		DomicilioFiscalReceptor: i.LugarExpedicion,
+		RegimenFiscalReceptor:   "616",
+		UsoCFDI:                 "S01",
+	}
+
+	if err := i.addConceptos(c, lines, "01010101", "ACT"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (i Issuer) newComprobante(folio string, fecha time.Time) *Comprobante {
+	return &Comprobante{
+		XmlnsCfdi:         Namespace,
+		XmlnsXsi:          "http://www.w3.org/2001/XMLSchema-instance",
+		XsiSchemaLocation: SchemaLocation,
+		Version:           Version,
+		Serie:             i.Serie,
+		Folio:             folio,
+		Fecha:             fecha.Format("2006-01-02T15:04:05"),
+		Moneda:            "MXN",
+		TipoDeComprobante: "I",
+		Exportacion:       "01",
+		LugarExpedicion:   i.LugarExpedicion,
+		Emisor: Emisor{
+			Rfc:           i.RFC,
+			Nombre:        i.Nombre,
+			RegimenFiscal: i.RegimenFiscal,
+		},
+	}
+}
+
+// addConceptos agrega los conceptos con su IVA trasladado y calcula subtotal,
+// impuestos y total del comprobante.
+func (i Issuer) addConceptos(c *Comprobante, lines []Line, claveProdServ, claveUnidad string) error {
+	if len(lines) == 0 {
+		return errors.New("comprobante must contain at least one concepto")
+	}
+
+	type taxKey struct{ rate string }
+	bases := make(map[taxKey]float64)
+	taxes := make(map[taxKey]float64)
+
+	subTotal, totalTax := 0.0, 0.0
+	for _, line := range lines {
+		if line.Quantity <= 0 || line.UnitPrice <= 0 {
+			return errors.New("conceptos must have positive quantity and price")
+		}
+
+		valorUnitario := line.UnitPrice
+		if i.PricesIncludeTax {
+			valorUnitario = round(line.UnitPrice/(1+line.TaxRate), 6)
+		}
+		importe := round(valorUnitario*float64(line.Quantity), 2)
+		tax := round(importe*line.TaxRate, 2)
+
+		rate := fmt.Sprintf("%.6f", line.TaxRate)
+		traslado := Traslado{
+			Base:       money(importe),
+			Impuesto:   "002", // IVA
+			TipoFactor: "Tasa",
+			TasaOCuota: rate,
+			Importe:    money(tax),
+		}
+
+		c.Conceptos = append(c.Conceptos, Concepto{
+			ClaveProdServ:    claveProdServ,
+			NoIdentificacion: line.ID,
+			Cantidad:         strconv.Itoa(line.Quantity),
+			ClaveUnidad:      claveUnidad,
+			Descripcion:      line.Description,
+			ValorUnitario:    strconv.FormatFloat(valorUnitario, 'f', -1, 64),
+			Importe:          money(importe),
+			ObjetoImp:        "02",
+			Impuestos:        &ConceptoImpuestos{Traslados: []Traslado{traslado}},
+		})
+
+		key := taxKey{rate}
+		bases[key] += importe
+		taxes[key] += tax
+		subTotal += importe
+		totalTax += tax
+	}
+
+	// Resumen de traslados por tasa en orden estable
+	var keys []taxKey
+	for k := range bases {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool { return keys[a].rate > keys[b].rate })
+
+	c.Impuestos = &Impuestos{TotalImpuestosTrasladados: money(totalTax)}
+	for _, k := range keys {
+		c.Impuestos.Traslados = append(c.Impuestos.Traslados, Traslado{
+			Base:       money(bases[k]),
+			Impuesto:   "002",
+			TipoFactor: "Tasa",
+			TasaOCuota: k.rate,
+			Importe:    money(taxes[k]),
+		})
+	}
+
+	c.SubTotal = money(subTotal)
+	c.Total = money(round(subTotal, 2) + round(totalTax, 2))
+	return nil
+}
+
+func round(value float64, decimals int) float64 {
+	factor := math.Pow(10, float64(decimals))
+	return math.Round(value*factor) / factor
+}
+
+func money(value float64) string {
+	return strconv.FormatFloat(round(value, 2), 'f', 2, 64)
+}
@@ -0,0 +1,134 @@
+package cfdi
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+var testIssuer = Issuer{
+	RFC:              "EKU9003173C9",
+	Nombre:           "ESCUELA KEMPER URGATE",
+	RegimenFiscal:    "601",
+	LugarExpedicion:  "42501",
+	Serie:            "A",
+	ClaveProdServ:    "43191501",
+	ClaveUnidad:      "H87",
+	PricesIncludeTax: true,
+}
+
+var testCustomer = Customer{
+	RFC:             "URE180429TM6",
+	Nombre:          "UNIVERSIDAD ROBOTICA ESPAÑOLA",
+	DomicilioFiscal: "86991",
+	RegimenFiscal:   "601",
+	UsoCFDI:         "G03",
+}
+
+var testFecha = time.Date(2024, time.March, 5, 10, 30, 0, 0, time.UTC)
+
+// testInvoice arma la factura del fixture: dos partidas al 16% y una exenta
+// de tasa 0, con precios que ya incluyen el IVA
+func testInvoice(t *testing.T) *Comprobante {
+	t.Helper()
+	c, err := testIssuer.BuildInvoice("1001", testCustomer, "01", "PUE", []Line{
+		{ID: "p1", Description: "Café  molido", Quantity: 2, UnitPrice: 116, TaxRate: 0.16},
+		{ID: "p2", Description: "Taza", Quantity: 1, UnitPrice: 58, TaxRate: 0.16},
+		{ID: "p3", Description: "Libro", Quantity: 3, UnitPrice: 100, TaxRate: 0},
+	}, testFecha)
+	if err != nil {
+		t.Fatalf("BuildInvoice() error: %v", err)
+	}
+	return c
+}
+
+func TestBuildInvoiceTotals(t *testing.T) {
+	c := testInvoice(t)
+
+	if c.SubTotal != "550.00" || c.Total != "590.00" || c.Impuestos.TotalImpuestosTrasladados != "40.00" {
+		t.Errorf("SubTotal = %s, Total = %s, taxes = %s; want 550.00, 590.00, 40.00",
+			c.SubTotal, c.Total, c.Impuestos.TotalImpuestosTrasladados)
+	}
+	if got := c.Conceptos[0].ValorUnitario; got != "100" {
+		t.Errorf("ValorUnitario = %s, want 100 (price without tax)", got)
+	}
+
+	// Un traslado por tasa, la mayor primero
+	traslados := c.Impuestos.Traslados
+	if len(traslados) != 2 {
+		t.Fatalf("traslados = %+v, want one per rate", traslados)
+	}
+	if traslados[0].TasaOCuota != "0.160000" || traslados[0].Base != "250.00" || traslados[0].Importe != "40.00" {
+		t.Errorf("16%% traslado = %+v", traslados[0])
+	}
+	if traslados[1].TasaOCuota != "0.000000" || traslados[1].Base != "300.00" || traslados[1].Importe != "0.00" {
+		t.Errorf("0%% traslado = %+v", traslados[1])
+	}
+}
+
+func TestBuildInvoiceXML(t *testing.T) {
+	data, err := testInvoice(t).Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+
+	want, err := os.ReadFile("testdata/invoice.xml")
+	if err != nil {
+		t.Fatalf("reading fixture: %v", err)
+	}
+	if string(data) != string(want) {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestBuildInvoiceRejectsInvalidData(t *testing.T) {
+	lines := []Line{{Description: "Taza", Quantity: 1, UnitPrice: 58, TaxRate: 0.16}}
+
+	publico := testCustomer
+	publico.RFC = RFCPublicoGeneral
+	badCP := testCustomer
+	badCP.DomicilioFiscal = "869"
+
+	tests := []struct {
+		name       string
+		customer   Customer
+		formaPago  string
+		metodoPago string
+		lines      []Line
+	}{
+		{"general public", publico, "01", "PUE", lines},
+		{"postal code", badCP, "01", "PUE", lines},
+		{"PPD without form 99", testCustomer, "01", "PPD", lines},
+		{"PUE with form 99", testCustomer, "99", "PUE", lines},
+		{"no lines", testCustomer, "01", "PUE", nil},
+		{"zero price", testCustomer, "01", "PUE", []Line{{Quantity: 1, TaxRate: 0.16}}},
+	}
+	for _, tt := range tests {
+		if _, err := testIssuer.BuildInvoice("1", tt.customer, tt.formaPago, tt.metodoPago, tt.lines, testFecha); err == nil {
+			t.Errorf("%s: BuildInvoice() = nil error", tt.name)
+		}
+	}
+}
+
+func TestBuildGlobalInvoice(t *testing.T) {
+	c, err := testIssuer.BuildGlobalInvoice("G1", "04", time.February, 2024, "01", []Line{
+		{ID: "venta-1", Description: "Venta", Quantity: 1, UnitPrice: 116, TaxRate: 0.16},
+	}, testFecha)
+	if err != nil {
+		t.Fatalf("BuildGlobalInvoice() error: %v", err)
+	}
+
+	if c.Receptor.Rfc != RFCPublicoGeneral || c.Receptor.UsoCFDI != "S01" || c.Receptor.DomicilioFiscalReceptor != testIssuer.LugarExpedicion {
+		t.Errorf("Receptor = %+v", c.Receptor)
+	}
+	if g := c.InformacionGlobal; g == nil || g.Periodicidad != "04" || g.Meses != "02" || g.Año != "2024" {
+		t.Errorf("InformacionGlobal = %+v", g)
+	}
+	if concepto := c.Conceptos[0]; concepto.ClaveProdServ != "01010101" || concepto.ClaveUnidad != "ACT" {
+		t.Errorf("Concepto = %+v", concepto)
+	}
+
+	if _, err := testIssuer.BuildGlobalInvoice("G1", "09", time.February, 2024, "01", nil, testFecha); err == nil {
+		t.Error("BuildGlobalInvoice() with an invalid periodicity = nil error")
+	}
+}
@@ -0,0 +1,91 @@
+package cfdi
+
+import "strings"
+
+// CadenaOriginal arma la cadena original del comprobante siguiendo el orden de
+// la transformación XSLT publicada por el SAT para CFDI 4.0: los atributos se
+// separan con "|", los opcionales vacíos se omiten y la cadena inicia y termina
+// con "||".
+func CadenaOriginal(c *Comprobante) string {
+	var b cadenaBuilder
+
+	b.add(c.Version)
+	b.add(c.Serie)
+	b.add(c.Folio)
+	b.add(c.Fecha)
+	b.add(c.FormaPago)
+	b.add(c.NoCertificado)
+	b.add(c.CondicionesDePago)
+	b.add(c.SubTotal)
+	b.add(c.Descuento)
+	b.add(c.Moneda)
+	b.add(c.TipoCambio)
+	b.add(c.Total)
+	b.add(c.TipoDeComprobante)
+	b.add(c.Exportacion)
+	b.add(c.MetodoPago)
+	b.add(c.LugarExpedicion)
+
+	if g := c.InformacionGlobal; g != nil {
+		b.add(g.Periodicidad)
+		b.add(g.Meses)
+		b.add(g.Año)
+	}
+
+	b.add(c.Emisor.Rfc)
+	b.add(c.Emisor.Nombre)
+	b.add(c.Emisor.RegimenFiscal)
+
+	b.add(c.Receptor.Rfc)
+	b.add(c.Receptor.Nombre)
+	b.add(c.Receptor.DomicilioFiscalReceptor)
+	b.add(c.Receptor.RegimenFiscalReceptor)
+	b.add(c.Receptor.UsoCFDI)
+
+	for _, concepto := range c.Conceptos {
+		b.add(concepto.ClaveProdServ)
+		b.add(concepto.NoIdentificacion)
+		b.add(concepto.Cantidad)
+		b.add(concepto.ClaveUnidad)
+		b.add(concepto.Unidad)
+		b.add(concepto.Descripcion)
+		b.add(concepto.ValorUnitario)
+		b.add(concepto.Importe)
+		b.add(concepto.ObjetoImp)
+
+		if concepto.Impuestos != nil {
+			for _, t := range concepto.Impuestos.Traslados {
+				b.addTraslado(t)
+			}
+		}
+	}
+
+	if c.Impuestos != nil {
+		for _, t := range c.Impuestos.Traslados {
+			b.addTraslado(t)
+		}
+		b.add(c.Impuestos.TotalImpuestosTrasladados)
+	}
+
+	return "||" + strings.Join(b.values, "|") + "||"
+}
+
+type cadenaBuilder struct {
+	values []string
+}
+
+// add normaliza los espacios del valor y lo agrega si no está vacío
+func (b *cadenaBuilder) add(value string) {
+	value = strings.Join(strings.Fields(value), " ")
+	if value != "" {
+		b.values = append(b.values, value)
+	}
+}
+
+func (b *cadenaBuilder) addTraslado(t Traslado) {
+	b.add(t.Base)
+	b.add(t.Impuesto)
+	b.add(t.TipoFactor)
+	b.add(t.TasaOCuota)
+	b.add(t.Importe)
+}
@@ -0,0 +1,45 @@
+package cfdi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCadenaOriginal(t *testing.T) {
+	// Los espacios repetidos de la descripción se reducen a uno y los
+	// atributos opcionales vacíos (Descuento, Unidad) no aparecen
+	want := "||4.0|A|1001|2024-03-05T10:30:00|01|550.00|MXN|590.00|I|01|PUE|42501" +
+		"|EKU9003173C9|ESCUELA KEMPER URGATE|601" +
+		"|URE180429TM6|UNIVERSIDAD ROBOTICA ESPAÑOLA|86991|601|G03" +
+		"|43191501|p1|2|H87|Café molido|100|200.00|02|200.00|002|Tasa|0.160000|32.00" +
+		"|43191501|p2|1|H87|Taza|50|50.00|02|50.00|002|Tasa|0.160000|8.00" +
+		"|43191501|p3|3|H87|Libro|100|300.00|02|300.00|002|Tasa|0.000000|0.00" +
+		"|250.00|002|Tasa|0.160000|40.00|300.00|002|Tasa|0.000000|0.00|40.00||"
+
+	if got := CadenaOriginal(testInvoice(t)); got != want {
+		t.Errorf("CadenaOriginal() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCadenaOriginalGlobalInvoice(t *testing.T) {
+	c, err := testIssuer.BuildGlobalInvoice("G1", "04", time.February, 2024, "01", []Line{
+		{ID: "venta-1", Description: "Venta", Quantity: 1, UnitPrice: 116, TaxRate: 0.16},
+	}, testFecha)
+	if err != nil {
+		t.Fatalf("BuildGlobalInvoice() error: %v", err)
+	}
+	c.NoCertificado = "30001000000500003416"
+
+	// InformacionGlobal va después de LugarExpedicion y el número de
+	// certificado después de la forma de pago
+	want := "||4.0|A|G1|2024-03-05T10:30:00|01|30001000000500003416|100.00|MXN|116.00|I|01|PUE|42501" +
+		"|04|02|2024" +
+		"|EKU9003173C9|ESCUELA KEMPER URGATE|601" +
+		"|XAXX010101000|PUBLICO EN GENERAL|42501|616|S01" +
+		"|01010101|venta-1|1|ACT|Venta|100|100.00|02|100.00|002|Tasa|0.160000|16.00" +
+		"|100.00|002|Tasa|0.160000|16.00|16.00||"
+
+	if got := CadenaOriginal(c); got != want {
+		t.Errorf("CadenaOriginal() =\n%s\nwant\n%s", got, want)
+	}
+}
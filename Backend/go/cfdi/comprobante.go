@@ -0,0 +1,106 @@
+// Package cfdi genera, sella y timbra comprobantes fiscales digitales (CFDI 4.0)
+// del SAT a partir de las ventas registradas.
+package cfdi
+
+import "encoding/xml"
+
+const (
+	Version        = "4.0"
+	Namespace      = "http://www.sat.gob.mx/cfd/4"
+	SchemaLocation = "http://www.sat.gob.mx/cfd/4 http://www.sat.gob.mx/sitio_internet/cfd/4/cfdv40.xsd"
+
+	// Receptor genérico para la factura global de ventas al público en general
+	RFCPublicoGeneral    = "XAXX010101000"
+	NombrePublicoGeneral = "PUBLICO EN GENERAL"
+)
+
+type Comprobante struct {
+	XMLName           xml.Name `xml:"cfdi:Comprobante"`
+	XmlnsCfdi         string   `xml:"xmlns:cfdi,attr"`
+	XmlnsXsi          string   `xml:"xmlns:xsi,attr"`
+	XsiSchemaLocation string   `xml:"xsi:schemaLocation,attr"`
+
+	Version           string `xml:"Version,attr"`
+	Serie             string `xml:"Serie,attr,omitempty"`
+	Folio             string `xml:"Folio,attr,omitempty"`
+	Fecha             string `xml:"Fecha,attr"`
+	Sello             string `xml:"Sello,attr"`
+	FormaPago         string `xml:"FormaPago,attr,omitempty"`
+	NoCertificado     string `xml:"NoCertificado,attr"`
+	Certificado       string `xml:"Certificado,attr"`
+	CondicionesDePago string `xml:"CondicionesDePago,attr,omitempty"`
+	SubTotal          string `xml:"SubTotal,attr"`
+	Descuento         string `xml:"Descuento,attr,omitempty"`
+	Moneda            string `xml:"Moneda,attr"`
+	TipoCambio        string `xml:"TipoCambio,attr,omitempty"`
+	Total             string `xml:"Total,attr"`
+	TipoDeComprobante string `xml:"TipoDeComprobante,attr"`
+	Exportacion       string `xml:"Exportacion,attr"`
+	MetodoPago        string `xml:"MetodoPago,attr,omitempty"`
+	LugarExpedicion   string `xml:"LugarExpedicion,attr"`
+
+	InformacionGlobal *InformacionGlobal `xml:"cfdi:InformacionGlobal,omitempty"`
+	Emisor            Emisor             `xml:"cfdi:Emisor"`
+	Receptor          Receptor           `xml:"cfdi:Receptor"`
+	Conceptos         []Concepto         `xml:"cfdi:Conceptos>cfdi:Concepto"`
+	Impuestos         *Impuestos         `xml:"cfdi:Impuestos,omitempty"`
+}
+
+type InformacionGlobal struct {
+	Periodicidad string `xml:"Periodicidad,attr"`
+	Meses        string `xml:"Meses,attr"`
+	Año          string `xml:"Año,attr"`
+}
+
+type Emisor struct {
+	Rfc           string `xml:"Rfc,attr"`
+	Nombre        string `xml:"Nombre,attr"`
+	RegimenFiscal string `xml:"RegimenFiscal,attr"`
+}
+
+type Receptor struct {
+	Rfc                     string `xml:"Rfc,attr"`
+	Nombre                  string `xml:"Nombre,attr"`
+	DomicilioFiscalReceptor string `xml:"DomicilioFiscalReceptor,attr"`
+	RegimenFiscalReceptor   string `xml:"RegimenFiscalReceptor,attr"`
+	UsoCFDI                 string `xml:"UsoCFDI,attr"`
+}
+
+type Concepto struct {
+	ClaveProdServ    string             `xml:"ClaveProdServ,attr"`
+	NoIdentificacion string             `xml:"NoIdentificacion,attr,omitempty"`
+	Cantidad         string             `xml:"Cantidad,attr"`
+	ClaveUnidad      string             `xml:"ClaveUnidad,attr"`
+	Unidad           string             `xml:"Unidad,attr,omitempty"`
+	Descripcion      string             `xml:"Descripcion,attr"`
+	ValorUnitario    string             `xml:"ValorUnitario,attr"`
+	Importe          string             `xml:"Importe,attr"`
+	ObjetoImp        string             `xml:"ObjetoImp,attr"`
+	Impuestos        *ConceptoImpuestos `xml:"cfdi:Impuestos,omitempty"`
+}
+
+type ConceptoImpuestos struct {
+	Traslados []Traslado `xml:"cfdi:Traslados>cfdi:Traslado"`
+}
+
+type Traslado struct {
+	Base       string `xml:"Base,attr"`
+	Impuesto   string `xml:"Impuesto,attr"`
+	TipoFactor string `xml:"TipoFactor,attr"`
+	TasaOCuota string `xml:"TasaOCuota,attr,omitempty"`
+	Importe    string `xml:"Importe,attr,omitempty"`
+}
+
+type Impuestos struct {
+	TotalImpuestosTrasladados string     `xml:"TotalImpuestosTrasladados,attr,omitempty"`
+	Traslados                 []Traslado `xml:"cfdi:Traslados>cfdi:Traslado"`
+}
+
+// Marshal serializa el comprobante con la declaración XML en UTF-8
+func (c *Comprobante) Marshal() ([]byte, error) {
+	body, err := xml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
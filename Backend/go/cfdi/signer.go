@@ -0,0 +1,90 @@
+package cfdi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+)
+
+// Signer sella comprobantes con el Certificado de Sello Digital (CSD) del emisor
+type Signer struct {
+	certificate   *x509.Certificate
+	key           *rsa.PrivateKey
+	noCertificado string
+}
+
+// LoadSigner lee el certificado (.cer, DER) y la llave privada (.key, PKCS#8
+// cifrado en DER) tal como los entrega el SAT.
+func LoadSigner(certPath, keyPath, password string) (*Signer, error) {
+	certDER, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CSD certificate: %w", err)
+	}
+
+	keyDER, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading CSD key: %w", err)
+	}
+
+	certificate, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CSD certificate: %w", err)
+	}
+
+	key, err := pkcs8.ParsePKCS8PrivateKeyRSA(keyDER, []byte(password))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting CSD key: %w", err)
+	}
+
+	return NewSigner(certificate, key)
+}
+
+// NewSigner crea un Signer a partir de un certificado y su llave ya cargados
+func NewSigner(certificate *x509.Certificate, key *rsa.PrivateKey) (*Signer, error) {
+	public, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok || public.N.Cmp(key.N) != 0 {
+		return nil, errors.New("CSD key does not match certificate")
+	}
+
+	return &Signer{
+		certificate:   certificate,
+		key:           key,
+		noCertificado: noCertificado(certificate),
+	}, nil
+}
+
+// Sign asigna certificado y número de certificado al comprobante, calcula la
+// cadena original y guarda el sello (RSA-SHA256 en base64).
+func (s *Signer) Sign(c *Comprobante) error {
+	c.NoCertificado = s.noCertificado
+	c.Certificado = base64.StdEncoding.EncodeToString(s.certificate.Raw)
+
+	digest := sha256.Sum256([]byte(CadenaOriginal(c)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return err
+	}
+
+	c.Sello = base64.StdEncoding.EncodeToString(signature)
+	return nil
+}
+
+// noCertificado obtiene el número de 20 dígitos del CSD. El SAT lo codifica en
+// el número de serie como los bytes ASCII de cada dígito.
+func noCertificado(certificate *x509.Certificate) string {
+	serial := certificate.SerialNumber.Bytes()
+	for _, b := range serial {
+		if b < '0' || b > '9' {
+			return certificate.SerialNumber.String()
+		}
+	}
+	return string(serial)
+}
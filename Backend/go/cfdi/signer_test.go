@@ -0,0 +1,116 @@
+package cfdi
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/youmark/pkcs8"
+)
+
+// testCSD genera un certificado autofirmado cuyo número de serie son los
+// dígitos ASCII de noCertificado, como los del SAT
+func testCSD(t *testing.T, noCertificado string) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: new(big.Int).SetBytes([]byte(noCertificado)),
+		Subject:      pkix.Name{CommonName: testIssuer.Nombre},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parsing certificate: %v", err)
+	}
+	return certificate, key
+}
+
+func TestSignerSign(t *testing.T) {
+	certificate, key := testCSD(t, "30001000000500003416")
+	signer, err := NewSigner(certificate, key)
+	if err != nil {
+		t.Fatalf("NewSigner() error: %v", err)
+	}
+
+	c := testInvoice(t)
+	if err := signer.Sign(c); err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+
+	if c.NoCertificado != "30001000000500003416" {
+		t.Errorf("NoCertificado = %q, want the serial digits", c.NoCertificado)
+	}
+	if c.Certificado != base64.StdEncoding.EncodeToString(certificate.Raw) {
+		t.Error("Certificado is not the base64 of the certificate")
+	}
+
+	// El sello cubre la cadena original que ya incluye el número de certificado
+	signature, err := base64.StdEncoding.DecodeString(c.Sello)
+	if err != nil {
+		t.Fatalf("decoding Sello: %v", err)
+	}
+	digest := sha256.Sum256([]byte(CadenaOriginal(c)))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+		t.Errorf("Sello does not verify against the cadena original: %v", err)
+	}
+
+	// Cualquier cambio al comprobante invalida el sello
+	c.Total = "1.00"
+	digest = sha256.Sum256([]byte(CadenaOriginal(c)))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature); err == nil {
+		t.Error("Sello still verifies after changing the total")
+	}
+}
+
+func TestNewSignerRejectsMismatchedKey(t *testing.T) {
+	certificate, _ := testCSD(t, "30001000000500003416")
+	_, other := testCSD(t, "30001000000500003417")
+	if _, err := NewSigner(certificate, other); err == nil {
+		t.Error("NewSigner() with another key = nil error")
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	certificate, key := testCSD(t, "30001000000500003416")
+	keyDER, err := pkcs8.ConvertPrivateKeyToPKCS8(key, []byte("12345678a"))
+	if err != nil {
+		t.Fatalf("encrypting key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "csd.cer"), filepath.Join(dir, "csd.key")
+	if err := os.WriteFile(certPath, certificate.Raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyDER, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := LoadSigner(certPath, keyPath, "12345678a")
+	if err != nil {
+		t.Fatalf("LoadSigner() error: %v", err)
+	}
+	if signer.noCertificado != "30001000000500003416" {
+		t.Errorf("noCertificado = %q", signer.noCertificado)
+	}
+	if _, err := LoadSigner(certPath, keyPath, "wrong"); err == nil {
+		t.Error("LoadSigner() with a wrong password = nil error")
+	}
+}
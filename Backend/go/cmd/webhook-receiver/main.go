@@ -0,0 +1,77 @@
+// webhook-receiver es un receptor local para probar los webhooks: verifica la
+// firma de cada entrega y la imprime.
+//
+//	WEBHOOK_SECRET=<secreto> go run ./cmd/webhook-receiver -addr :9090
+//
+// Con -fail N responde 500 a las primeras N entregas para probar los reintentos.
+package main
+
+import (
+	"auth-service/webhooks"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "dirección en la que escucha")
+	fail := flag.Int("fail", 0, "entregas iniciales que se responden con 500")
+	maxAge := flag.Duration("max-age", 5*time.Minute, "antigüedad máxima aceptada de la firma")
+	flag.Parse()
+
+	secret := os.Getenv("WEBHOOK_SECRET")
+	if secret == "" {
+		log.Println("WEBHOOK_SECRET not set, signatures will not be verified")
+	}
+
+	var mu sync.Mutex
+	remainingFailures := *fail
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid body", http.StatusBadRequest)
+			return
+		}
+
+		event := r.Header.Get(webhooks.HeaderEvent)
+		delivery := r.Header.Get(webhooks.HeaderDelivery)
+
+		if secret != "" {
+			timestamp, err := strconv.ParseInt(r.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+			if err != nil || time.Since(time.Unix(timestamp, 0)) > *maxAge {
+				log.Printf("✗ %s %s: missing or stale timestamp", event, delivery)
+				http.Error(w, "Stale timestamp", http.StatusUnauthorized)
+				return
+			}
+			if !webhooks.Verify(secret, timestamp, body, r.Header.Get(webhooks.HeaderSignature)) {
+				log.Printf("✗ %s %s: invalid signature", event, delivery)
+				http.Error(w, "Invalid signature", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		mu.Lock()
+		failNow := remainingFailures > 0
+		if failNow {
+			remainingFailures--
+		}
+		mu.Unlock()
+		if failNow {
+			log.Printf("… %s %s: simulated failure", event, delivery)
+			http.Error(w, "Simulated failure", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("✓ %s %s: %s", event, delivery, body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Webhook receiver listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
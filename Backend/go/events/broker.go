@@ -0,0 +1,150 @@
+package events
+
+import (
+	"auth-service/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tipos de evento de venta
+const (
+	SaleCreated   = "sale.created"
+	SaleUpdated   = "sale.updated"
+	SaleCancelled = "sale.cancelled"
+)
+
+// SaleEvent es un cambio en una venta. Sale viene vacío cuando el origen sólo
+// conoce el ID (una venta eliminada sin imagen previa en el change stream).
+type SaleEvent struct {
+	ID          string       `json:"id"`
+	Type        string       `json:"type"`
+	SaleID      string       `json:"saleId"`
+	SellerID    string       `json:"sellerId,omitempty"`
+	StoreID     string       `json:"storeId,omitempty"`
+	Status      string       `json:"status,omitempty"`
+	TotalAmount float64      `json:"totalAmount"`
+	Sale        *models.Sale `json:"sale,omitempty"`
+	Timestamp   int64        `json:"timestamp"`
+
+	seq uint64
+}
+
+// Broker reparte los eventos de venta a los suscriptores conectados y guarda
+// los últimos para que un cliente que se reconecta retome desde su último ID.
+// Los IDs llevan el arranque del proceso ("<epoch>-<seq>"): un ID de otro
+// arranque ya no se puede retomar.
+type Broker struct {
+	mu           sync.Mutex
+	epoch        string
+	seq          uint64
+	history      []SaleEvent
+	historySize  int
+	subscribers  map[chan SaleEvent]struct{}
+	changeStream bool
+}
+
+func NewBroker(historySize int) *Broker {
+	return &Broker{
+		epoch:       strconv.FormatInt(time.Now().Unix(), 36),
+		historySize: historySize,
+		subscribers: make(map[chan SaleEvent]struct{}),
+	}
+}
+
+// Notify publica un evento que llega del outbox. Se ignora mientras el change
+// stream de MongoDB esté activo, porque él ya reporta el cambio.
+func (b *Broker) Notify(eventType string, sale models.Sale) {
+	b.mu.Lock()
+	external := b.changeStream
+	b.mu.Unlock()
+	if external {
+		return
+	}
+	b.publish(newSaleEvent(eventType, sale.ID.Hex(), &sale))
+}
+
+func newSaleEvent(eventType, saleID string, sale *models.Sale) SaleEvent {
+	event := SaleEvent{Type: eventType, SaleID: saleID, Sale: sale, Timestamp: time.Now().Unix()}
+	if sale != nil {
+		event.SellerID = sale.SellerID
+		event.StoreID = sale.StoreID
+		event.Status = sale.Status
+		event.TotalAmount = sale.TotalAmount
+	}
+	return event
+}
+
+func (b *Broker) publish(event SaleEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.seq = b.seq
+	event.ID = fmt.Sprintf("%s-%d", b.epoch, b.seq)
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Un cliente que no alcanza a leer se desconecta; al volver retoma
+			// desde su último ID
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registra un suscriptor. Con lastEventID devuelve además los
+// eventos posteriores que siguen en memoria; resumed es false si ese ID ya no
+// se puede retomar y el cliente debe recargar sus datos.
+func (b *Broker) Subscribe(lastEventID string) (events <-chan SaleEvent, backlog []SaleEvent, resumed bool, cancel func()) {
+	ch := make(chan SaleEvent, 64)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	resumed = true
+	if lastEventID != "" {
+		resumed = false
+		epoch, seqText, found := strings.Cut(lastEventID, "-")
+		if seq, err := strconv.ParseUint(seqText, 10, 64); found && err == nil && epoch == b.epoch && seq <= b.seq {
+			oldest := b.seq + 1
+			if len(b.history) > 0 {
+				oldest = b.history[0].seq
+			}
+			if seq+1 >= oldest {
+				resumed = true
+				for _, event := range b.history {
+					if event.seq > seq {
+						backlog = append(backlog, event)
+					}
+				}
+			}
+		}
+	}
+
+	b.subscribers[ch] = struct{}{}
+	cancel = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return ch, backlog, resumed, cancel
+}
+
+func (b *Broker) setChangeStream(active bool) {
+	b.mu.Lock()
+	b.changeStream = active
+	b.mu.Unlock()
+}
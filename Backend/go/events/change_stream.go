@@ -0,0 +1,101 @@
+package events
+
+import (
+	"auth-service/models"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeEvent son los campos que se leen de un evento del change stream
+type changeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument             *models.Sale `bson:"fullDocument"`
+	FullDocumentBeforeChange *models.Sale `bson:"fullDocumentBeforeChange"`
+}
+
+// WatchSales alimenta el broker con el change stream de la colección de
+// ventas. Un MongoDB standalone no tiene change streams: en ese caso, o si el
+// stream se cae, el broker usa los eventos que publican los handlers y se
+// reintenta cada retry.
+func (b *Broker) WatchSales(ctx context.Context, sales *mongo.Collection, retry time.Duration) {
+	go func() {
+		var resumeToken bson.Raw
+		for {
+			err := b.watch(ctx, sales, &resumeToken)
+			b.setChangeStream(false)
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Sales change stream unavailable, using in-process events: %v", err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+		}
+	}()
+}
+
+func (b *Broker) watch(ctx context.Context, sales *mongo.Collection, resumeToken *bson.Raw) error {
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetFullDocumentBeforeChange(options.WhenAvailable)
+	if *resumeToken != nil {
+		opts.SetResumeAfter(*resumeToken)
+	}
+
+	stream, err := sales.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(ctx)
+
+	b.setChangeStream(true)
+	log.Println("📡 Streaming sale events from MongoDB change stream")
+
+	for stream.Next(ctx) {
+		var change changeEvent
+		if err := stream.Decode(&change); err != nil {
+			log.Printf("Error decoding sale change: %v", err)
+			continue
+		}
+		*resumeToken = stream.ResumeToken()
+
+		if event, ok := saleEventFromChange(change); ok {
+			b.publish(event)
+		}
+	}
+	return stream.Err()
+}
+
+// saleEventFromChange traduce el cambio en la colección al evento de venta
+func saleEventFromChange(change changeEvent) (SaleEvent, bool) {
+	saleID := change.DocumentKey.ID.Hex()
+
+	switch change.OperationType {
+	case "insert":
+		return newSaleEvent(SaleCreated, saleID, change.FullDocument), true
+	case "update", "replace":
+		if change.FullDocument == nil {
+			return SaleEvent{}, false // la venta ya se eliminó
+		}
+		eventType := SaleUpdated
+		if change.FullDocument.Status == models.SaleCanceled || change.FullDocument.Status == models.SaleExpired {
+			eventType = SaleCancelled
+		}
+		return newSaleEvent(eventType, saleID, change.FullDocument), true
+	case "delete":
+		return newSaleEvent(SaleCancelled, saleID, change.FullDocumentBeforeChange), true
+	}
+	return SaleEvent{}, false
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"auth-service/models"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSaleEventFromChange(t *testing.T) {
+	sale := models.Sale{ID: primitive.NewObjectID(), SellerID: "ana@example.com", StoreID: "centro", Status: models.SaleCompleted, TotalAmount: 90}
+	canceled := sale
+	canceled.Status = models.SaleCanceled
+
+	change := func(operation string, full, before *models.Sale) changeEvent {
+		c := changeEvent{OperationType: operation, FullDocument: full, FullDocumentBeforeChange: before}
+		c.DocumentKey.ID = sale.ID
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		change changeEvent
+		want   string
+		seller string
+	}{
+		{"insert", change("insert", &sale, nil), SaleCreated, sale.SellerID},
+		{"update", change("update", &sale, nil), SaleUpdated, sale.SellerID},
+		{"canceled by update", change("update", &canceled, nil), SaleCancelled, sale.SellerID},
+		{"delete with the pre-image", change("delete", nil, &sale), SaleCancelled, sale.SellerID},
+		{"delete without the pre-image", change("delete", nil, nil), SaleCancelled, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := saleEventFromChange(tt.change)
+			if !ok {
+				t.Fatal("saleEventFromChange() ignored the change")
+			}
+			if event.Type != tt.want || event.SaleID != sale.ID.Hex() || event.SellerID != tt.seller {
+				t.Errorf("event = %+v, want %s for seller %q", event, tt.want, tt.seller)
+			}
+			if tt.seller != "" && event.StoreID != sale.StoreID {
+				t.Errorf("StoreID = %q, want %q", event.StoreID, sale.StoreID)
+			}
+		})
+	}
+
+	// Una actualización de una venta ya eliminada no tiene documento
+	if _, ok := saleEventFromChange(change("update", nil, nil)); ok {
+		t.Error("saleEventFromChange() published an update without the sale")
+	}
+}
@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/services"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ApprovalPolicy define qué operaciones de venta necesitan autorización de un
+// gerente (un usuario cuyo rol tiene el permiso approve_sales).
+type ApprovalPolicy struct {
+	RefundThreshold float64       // devoluciones mayores a este monto
+	DiscountPercent float64       // descuentos mayores a este porcentaje del ticket
+	TTL             time.Duration // vigencia de una aprobación de la cola
+	// Usuarios y roles contra los que se validan los permisos y las
+	// credenciales del gerente
+	Users *services.UserService
+	Roles *services.RoleService
+}
+
+// approvalScope es la operación concreta que se quiere autorizar
+type approvalScope struct {
+	Operation string
+	SaleID    string
+	Amount    float64
+}
+
+// approvalGrant es una autorización ya verificada que todavía no se registra.
+// Se consume dentro de la unidad de trabajo de la operación (ver withApproval)
+// para que una operación que falla no gaste la aprobación.
+type approvalGrant struct {
+	id          primitive.ObjectID
+	scope       approvalScope
+	mode        string
+	requestedBy string
+	approvedBy  string
+	queued      bson.M // filtro de la aprobación de la cola que se consume
+}
+
+// authorize verifica la autorización de un gerente para la operación. Se
+// acepta, en este orden: que quien ejecuta tenga el permiso, una aprobación de
+// la cola (encabezado X-Approval-Id) o las credenciales del gerente en los
+// encabezados X-Manager-Email y X-Manager-Password. La autorización se registra
+// en sale_approvals al consumirla con withApproval. Si no se autoriza devuelve
+// un requestError con la respuesta.
+func (p ApprovalPolicy) authorize(ctx context.Context, r *http.Request, db *mongo.Database, scope approvalScope) (*approvalGrant, error) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userID := claims["sub"].(string)
+	approvals := db.Collection("sale_approvals")
+	now := time.Now().Unix()
+
+	canApprove, err := p.Roles.HasPermission(ctx, claims["role"].(string), models.PermissionApproveSales)
+	if err != nil {
+		return nil, fmt.Errorf("checking permissions: %w", err)
+	}
+	if canApprove {
+		return &approvalGrant{id: primitive.NewObjectID(), scope: scope, mode: models.ApprovalModeSelf, requestedBy: userID, approvedBy: userID}, nil
+	}
+
+	// Aprobación previa de la cola: se consume una sola vez
+	if approvalID := r.Header.Get("X-Approval-Id"); approvalID != "" {
+		id, err := primitive.ObjectIDFromHex(approvalID)
+		if err != nil {
+			return nil, &requestError{status: http.StatusBadRequest, message: "Invalid approval ID"}
+		}
+
+		filter := bson.M{
+			"_id":         id,
+			"status":      models.ApprovalApproved,
+			"operation":   scope.Operation,
+			"requestedBy": userID,
+			"expiresAt":   bson.M{"$gt": now},
+		}
+		if scope.SaleID != "" {
+			filter["saleId"] = scope.SaleID
+		} else {
+			filter["saleId"] = bson.M{"$exists": false}
+		}
+		if scope.Amount > 0 {
+			filter["amount"] = bson.M{"$gte": scope.Amount}
+		}
+
+		var approval models.SaleApproval
+		err = approvals.FindOne(ctx, filter).Decode(&approval)
+		if err == mongo.ErrNoDocuments {
+			return nil, errApprovalUnavailable
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching approval: %w", err)
+		}
+
+		return &approvalGrant{id: id, scope: scope, mode: models.ApprovalModeQueued, requestedBy: userID, approvedBy: approval.DecidedBy, queued: filter}, nil
+	}
+
+	// Autorización en línea con las credenciales del gerente
+	managerEmail := r.Header.Get("X-Manager-Email")
+	if managerEmail == "" {
+		return nil, &requestError{status: http.StatusForbidden, message: "Manager approval required for this operation"}
+	}
+
+	manager, role, err := p.Users.Authenticate(ctx, managerEmail, r.Header.Get("X-Manager-Password"))
+	if err == services.ErrInvalidCredentials {
+		return nil, &requestError{status: http.StatusForbidden, message: "Invalid manager credentials"}
+	}
+	if err != nil && err != store.ErrNotFound {
+		return nil, fmt.Errorf("fetching manager: %w", err)
+	}
+	allowed := false
+	for _, permission := range role.Permissions {
+		if permission == models.PermissionApproveSales {
+			allowed = true
+		}
+	}
+	if !allowed || manager.Email == userID {
+		return nil, &requestError{status: http.StatusForbidden, message: "User cannot approve this operation"}
+	}
+
+	return &approvalGrant{id: primitive.NewObjectID(), scope: scope, mode: models.ApprovalModeInline, requestedBy: userID, approvedBy: manager.Email}, nil
+}
+
+// errApprovalUnavailable se devuelve cuando la aprobación de la cola ya no
+// sirve, también si otra operación la consumió entre la revisión y el registro
+var errApprovalUnavailable = &requestError{
+	status:  http.StatusForbidden,
+	message: "Approval not found, expired, already used or not valid for this operation",
+}
+
+// withApproval envuelve el cuerpo de una unidad de trabajo para consumir la
+// autorización en ella. Sin grant (la operación no la necesitaba) devuelve fn.
+func withApproval(db *mongo.Database, grant *approvalGrant, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	if grant == nil {
+		return fn
+	}
+	return func(ctx context.Context) error {
+		if err := grant.consume(ctx, db); err != nil {
+			return err
+		}
+		if err := fn(ctx); err != nil {
+			compensate(ctx, "releasing approval", func() error { return grant.release(ctx, db) })
+			return err
+		}
+		return nil
+	}
+}
+
+// consume marca como usada la aprobación de la cola o registra la que se
+// concedió en el momento
+func (g *approvalGrant) consume(ctx context.Context, db *mongo.Database) error {
+	approvals := db.Collection("sale_approvals")
+	now := time.Now().Unix()
+
+	if g.queued != nil {
+		result, err := approvals.UpdateOne(ctx, g.queued, bson.M{"$set": bson.M{"status": models.ApprovalUsed, "usedAt": now}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return errApprovalUnavailable
+		}
+		log.Printf("Approval %s (%s) used by %s, approved by %s", g.id.Hex(), g.scope.Operation, g.requestedBy, g.approvedBy)
+		return nil
+	}
+
+	_, err := approvals.InsertOne(ctx, models.SaleApproval{
+		ID:          g.id,
+		Operation:   g.scope.Operation,
+		SaleID:      g.scope.SaleID,
+		Amount:      g.scope.Amount,
+		Mode:        g.mode,
+		Status:      models.ApprovalUsed,
+		RequestedBy: g.requestedBy,
+		RequestedAt: now,
+		DecidedBy:   g.approvedBy,
+		DecidedAt:   now,
+		UsedAt:      now,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Approval %s (%s) granted to %s by %s", g.id.Hex(), g.scope.Operation, g.requestedBy, g.approvedBy)
+	return nil
+}
+
+// release deshace consume cuando la operación falló sin transacción: la
+// aprobación de la cola vuelve a quedar vigente y la concedida en el momento
+// se borra
+func (g *approvalGrant) release(ctx context.Context, db *mongo.Database) error {
+	approvals := db.Collection("sale_approvals")
+	if g.queued != nil {
+		_, err := approvals.UpdateOne(
+			ctx,
+			bson.M{"_id": g.id, "status": models.ApprovalUsed},
+			bson.M{"$set": bson.M{"status": models.ApprovalApproved}, "$unset": bson.M{"usedAt": ""}},
+		)
+		return err
+	}
+	_, err := approvals.DeleteOne(ctx, bson.M{"_id": g.id})
+	return err
+}
+
+// ApprovalHandler maneja la cola de solicitudes de autorización
+type ApprovalHandler struct {
+	collection *mongo.Collection
+	policy     ApprovalPolicy
+}
+
+func NewApprovalHandler(collection *mongo.Collection, policy ApprovalPolicy) *ApprovalHandler {
+	return &ApprovalHandler{collection: collection, policy: policy}
+}
+
+type approvalRequest struct {
+	Operation string  `json:"operation"`
+	SaleID    string  `json:"saleId,omitempty"`
+	Amount    float64 `json:"amount,omitempty"`
+	Reason    string  `json:"reason"`
+}
+
+// RequestApproval deja una solicitud pendiente para que un gerente la revise
+func (h *ApprovalHandler) RequestApproval(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var req approvalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Operation {
+	case models.ApprovalEditSale, models.ApprovalCancelSale, models.ApprovalRefund, models.ApprovalDiscount, models.ApprovalIssueStoredValue:
+	default:
+		http.Error(w, "Operation must be edit_sale, cancel_sale, refund, discount or issue_stored_value", http.StatusBadRequest)
+		return
+	}
+	// El saldo a favor o la tarjeta pueden emitirse sin venta y el descuento es
+	// de una venta nueva
+	if req.SaleID != "" || req.Operation == models.ApprovalEditSale || req.Operation == models.ApprovalCancelSale {
+		if _, err := primitive.ObjectIDFromHex(req.SaleID); err != nil {
+			http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Operation == models.ApprovalDiscount {
+		req.SaleID = ""
+	}
+	if (req.Operation == models.ApprovalRefund || req.Operation == models.ApprovalDiscount || req.Operation == models.ApprovalIssueStoredValue) && req.Amount <= 0 {
+		http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	approval := models.SaleApproval{
+		ID:          primitive.NewObjectID(),
+		Operation:   req.Operation,
+		SaleID:      req.SaleID,
+		Amount:      roundMoney(req.Amount),
+		Reason:      req.Reason,
+		Mode:        models.ApprovalModeQueued,
+		Status:      models.ApprovalPending,
+		RequestedBy: claims["sub"].(string),
+		RequestedAt: time.Now().Unix(),
+	}
+	if _, err := h.collection.InsertOne(context.Background(), approval); err != nil {
+		log.Printf("Error creating approval request: %v", err)
+		http.Error(w, "Error creating approval request", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(approval)
+}
+
+// ListApprovals lista las solicitudes (?status=). Un gerente ve todas; los
+// demás sólo las suyas.
+func (h *ApprovalHandler) ListApprovals(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	ctx := context.Background()
+	canApprove, err := h.policy.Roles.HasPermission(ctx, claims["role"].(string), models.PermissionApproveSales)
+	if err != nil {
+		log.Printf("Error checking permissions: %v", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return
+	}
+
+	filter := bson.M{}
+	if !canApprove {
+		filter["requestedBy"] = claims["sub"].(string)
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := h.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"requestedAt": -1}))
+	if err != nil {
+		log.Printf("Error fetching approvals: %v", err)
+		http.Error(w, "Error fetching approvals", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	approvals := []models.SaleApproval{}
+	if err := cursor.All(ctx, &approvals); err != nil {
+		log.Printf("Error reading approvals: %v", err)
+		http.Error(w, "Error reading approvals", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approvals)
+}
+
+// ApproveRequest aprueba una solicitud pendiente; queda vigente durante el TTL
+// de la política para que el solicitante repita la operación.
+func (h *ApprovalHandler) ApproveRequest(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, models.ApprovalApproved)
+}
+
+// RejectRequest rechaza una solicitud pendiente
+func (h *ApprovalHandler) RejectRequest(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, models.ApprovalRejected)
+}
+
+func (h *ApprovalHandler) decide(w http.ResponseWriter, r *http.Request, status string) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	managerID := claims["sub"].(string)
+
+	ctx := context.Background()
+	canApprove, err := h.policy.Roles.HasPermission(ctx, claims["role"].(string), models.PermissionApproveSales)
+	if err != nil {
+		log.Printf("Error checking permissions: %v", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return
+	}
+	if !canApprove {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	approvalID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid approval ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	set := bson.M{"status": status, "decidedBy": managerID, "decidedAt": now.Unix(), "note": req.Note}
+	if status == models.ApprovalApproved {
+		set["expiresAt"] = now.Add(h.policy.TTL).Unix()
+	}
+
+	// Nadie decide sobre sus propias solicitudes
+	var approval models.SaleApproval
+	err = h.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": approvalID, "status": models.ApprovalPending, "requestedBy": bson.M{"$ne": managerID}},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&approval)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Approval request not found, already decided or requested by you", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error deciding approval: %v", err)
+		http.Error(w, "Error updating approval", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Approval %s (%s) %s by %s", approval.ID.Hex(), approval.Operation, status, managerID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approval)
+}
@@ -1,83 +1,48 @@
 package handlers
 
 import (
-    "auth-service/models"
-    "context"
+    "auth-service/services"
     "encoding/json"
     "net/http"
     "os"
     "time"
 
     "github.com/golang-jwt/jwt/v5"
-    "go.mongodb.org/mongo-driver/bson"
-    "go.mongodb.org/mongo-driver/mongo"
-    "golang.org/x/crypto/bcrypt"
 )
 
+// RegistrationPolicy decide si /register está abierto. Con el registro
+// abierto todos reciben Role y el role_name del cuerpo se ignora; el resto de
+// las altas pasan por un administrador o una invitación.
+type RegistrationPolicy struct {
+    Open bool
+    Role string
+}
+
 type AuthHandler struct {
-    collection *mongo.Collection
+    users        *services.UserService
+    registration RegistrationPolicy
 }
 
-func NewAuthHandler(collection *mongo.Collection) *AuthHandler {
-    return &AuthHandler{collection: collection}
+func NewAuthHandler(users *services.UserService, registration RegistrationPolicy) *AuthHandler {
+    return &AuthHandler{users: users, registration: registration}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-    var newUser struct {
-        Name     string `json:"name"`
-        Email    string `json:"email"`
-        Password string `json:"password"`
-        RoleName string `json:"role_name"`
-    }
-    
-    if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-        http.Error(w, "Invalid request body", http.StatusBadRequest)
-        return
-    }
-
-    // Buscar el rol por nombre
-    rolesCollection := h.collection.Database().Collection("roles")
-    var role models.Role
-    err := rolesCollection.FindOne(context.Background(), bson.M{"name": newUser.RoleName}).Decode(&role)
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            http.Error(w, "Invalid role", http.StatusBadRequest)
-        } else {
-            http.Error(w, "Database error", http.StatusInternalServerError)
-        }
-        return
-    }
-
-    // Check if user exists
-    existingUser := models.User{}
-    err = h.collection.FindOne(context.Background(), bson.M{"email": newUser.Email}).Decode(&existingUser)
-    if err == nil {
-        http.Error(w, "User already exists", http.StatusConflict)
-        return
-    } else if err != mongo.ErrNoDocuments {
-        http.Error(w, "Database error", http.StatusInternalServerError)
+    if !h.registration.Open {
+        http.Error(w, "Self-registration is disabled", http.StatusForbidden)
         return
     }
 
-    // Hash password
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
-    if err != nil {
-        http.Error(w, "Error creating user", http.StatusInternalServerError)
+    var newUser services.NewUser
+    if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
+        http.Error(w, "Invalid request body", http.StatusBadRequest)
         return
     }
+    // El rol lo fija la configuración, no quien se registra
+    newUser.RoleName = h.registration.Role
 
-    // Crear objeto completo de usuario
-    user := models.User{
-        Name:     newUser.Name,
-        Email:    newUser.Email,
-        Password: string(hashedPassword),
-        RoleID:   role.ID,
-    }
-
-    // Insert user
-    _, err = h.collection.InsertOne(context.Background(), user)
-    if err != nil {
-        http.Error(w, "Error creating user", http.StatusInternalServerError)
+    if _, err := h.users.Create(r.Context(), newUser); err != nil {
+        writeServiceError(w, err, "Database error")
         return
     }
 
@@ -96,31 +61,10 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Find user
-    var user models.User
-    ctx := context.Background()
-    err := h.collection.FindOne(ctx, bson.M{"email": credentials.Email}).Decode(&user)
-    if err != nil {
-        if err == mongo.ErrNoDocuments {
-            http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-        } else {
-            http.Error(w, "Database error", http.StatusInternalServerError)
-        }
-        return
-    }
-
-    // Verify password
-    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(credentials.Password)); err != nil {
-        http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-        return
-    }
-
-    // Obtener detalles del rol
-    rolesCollection := h.collection.Database().Collection("roles")
-    var role models.Role
-    err = rolesCollection.FindOne(ctx, bson.M{"_id": user.RoleID}).Decode(&role)
+    // Validar credenciales y obtener el rol
+    user, role, err := h.users.Authenticate(r.Context(), credentials.Email, credentials.Password)
     if err != nil {
-        http.Error(w, "Error retrieving role", http.StatusInternalServerError)
+        writeServiceError(w, err, "Database error")
         return
     }
 
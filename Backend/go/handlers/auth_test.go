@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"auth-service/services"
+	"auth-service/webhooks"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// openRegistration abre /register con el rol vendedor
+var openRegistration = RegistrationPolicy{Open: true, Role: "vendedor"}
+
+func TestRegisterDisabledByDefault(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	h := NewAuthHandler(env.users, RegistrationPolicy{})
+
+	w := serve(h.Register, newRequest(t, "POST", "/register", services.NewUser{
+		Name: "Ana", Email: "ana@example.com", Password: "secret", RoleName: "vendedor",
+	}, nil))
+	expectStatus(t, w, http.StatusForbidden)
+
+	if users, _ := env.store.Users().List(context.Background()); len(users) != 0 {
+		t.Errorf("stored users = %d, want 0", len(users))
+	}
+}
+
+func TestRegisterCreatesUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addRole(t, "admin", "manage_users")
+	h := NewAuthHandler(env.users, openRegistration)
+
+	// El rol del cuerpo se ignora: todos reciben el rol configurado
+	w := serve(h.Register, newRequest(t, "POST", "/register", services.NewUser{
+		Name: "Ana", Email: "ana@example.com", Password: "secret", RoleName: "admin",
+	}, nil))
+	expectStatus(t, w, http.StatusCreated)
+
+	user, err := env.store.Users().GetByEmail(context.Background(), "ana@example.com")
+	if err != nil {
+		t.Fatalf("user was not stored: %v", err)
+	}
+	if user.Password == "secret" || !strings.HasPrefix(user.Password, "$2") {
+		t.Errorf("password was not hashed: %q", user.Password)
+	}
+
+	hooks := env.store.Webhooks()
+	if len(hooks) != 1 || hooks[0].Event != webhooks.EventUserCreated {
+		t.Fatalf("webhooks = %+v, want one %s", hooks, webhooks.EventUserCreated)
+	}
+	if view, ok := hooks[0].Data.(services.UserView); !ok || view.Role != "vendedor" {
+		t.Errorf("webhook data = %+v, want user with role vendedor", hooks[0].Data)
+	}
+}
+
+func TestRegisterRejectsInvalidRequests(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewAuthHandler(env.users, openRegistration)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"missing fields", services.NewUser{Email: "luis@example.com", RoleName: "vendedor"}, http.StatusBadRequest},
+		{"existing email", services.NewUser{Name: "Otra", Email: "ana@example.com", Password: "secret", RoleName: "vendedor"}, http.StatusConflict},
+		{"existing email in another case", services.NewUser{Name: "Otra", Email: " ANA@Example.com ", Password: "secret", RoleName: "vendedor"}, http.StatusConflict},
+		{"malformed body", "not an object", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.Register, newRequest(t, "POST", "/register", tt.body, nil))
+			expectStatus(t, w, tt.status)
+		})
+	}
+
+	users, _ := env.store.Users().List(context.Background())
+	if len(users) != 1 {
+		t.Errorf("stored users = %d, want 1", len(users))
+	}
+}
+
+func TestRegisterConcurrentSameEmail(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	h := NewAuthHandler(env.users, openRegistration)
+
+	emails := []string{"ana@example.com", "ANA@example.com", " Ana@Example.com", "ana@EXAMPLE.com "}
+	statuses := make(chan int, len(emails))
+	var wg sync.WaitGroup
+	for _, email := range emails {
+		wg.Add(1)
+		go func(email string) {
+			defer wg.Done()
+			w := serve(h.Register, newRequest(t, "POST", "/register", services.NewUser{
+				Name: "Ana", Email: email, Password: "secret", RoleName: "vendedor",
+			}, nil))
+			statuses <- w.Code
+		}(email)
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("status = %d, want %d or %d", status, http.StatusCreated, http.StatusConflict)
+		}
+	}
+	if created != 1 {
+		t.Errorf("created = %d, want 1", created)
+	}
+	if _, err := env.store.Users().GetByEmail(context.Background(), "ana@example.com"); err != nil {
+		t.Errorf("user was not stored with the normalized email: %v", err)
+	}
+}
+
+func TestLoginIssuesToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	env := newTestEnv(t)
+	env.addRole(t, "consultor")
+	env.addUser(t, "Eva", "eva@example.com", "secret", "consultor")
+	h := NewAuthHandler(env.users, RegistrationPolicy{})
+
+	w := serve(h.Login, newRequest(t, "POST", "/login", map[string]string{"email": " Eva@Example.com", "password": "secret"}, nil))
+	expectStatus(t, w, http.StatusOK)
+
+	var body struct {
+		Token string `json:"token"`
+	}
+	decodeBody(t, w, &body)
+
+	token, err := jwt.Parse(body.Token, func(*jwt.Token) (interface{}, error) { return []byte("test-secret"), nil })
+	if err != nil || !token.Valid {
+		t.Fatalf("invalid token: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["sub"] != "eva@example.com" || claims["role"] != "consultor" {
+		t.Errorf("claims = %v", claims)
+	}
+}
+
+func TestLoginRejectsBadCredentials(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewAuthHandler(env.users, RegistrationPolicy{})
+
+	for _, credentials := range []map[string]string{
+		{"email": "ana@example.com", "password": "wrong"},
+		{"email": "nadie@example.com", "password": "secret"},
+	} {
+		w := serve(h.Login, newRequest(t, "POST", "/login", credentials, nil))
+		expectStatus(t, w, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const commissionRulesID = "default"
+
+// CommissionHandler calcula las comisiones de los vendedores y administra el
+// cierre de pago de cada mes.
+type CommissionHandler struct {
+	db      *mongo.Database
+	store   store.Store
+	catalog *catalog.Client
+}
+
+func NewCommissionHandler(db *mongo.Database, s store.Store, catalogClient *catalog.Client) *CommissionHandler {
+	return &CommissionHandler{db: db, store: s, catalog: catalogClient}
+}
+
+// GetRules devuelve las reglas de comisión vigentes
+func (h *CommissionHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := loadCommissionRules(context.Background(), h.db)
+	if err != nil {
+		log.Printf("Error fetching commission rules: %v", err)
+		http.Error(w, "Error fetching commission rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// UpdateRules reemplaza las reglas de comisión; los periodos cerrados no cambian
+func (h *CommissionHandler) UpdateRules(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var rules models.CommissionRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	percents := []float64{rules.DefaultPercent}
+	for _, m := range []map[string]float64{rules.ProductPercents, rules.BrandPercents, rules.CategoryPercents} {
+		for _, percent := range m {
+			percents = append(percents, percent)
+		}
+	}
+	for _, tier := range rules.Tiers {
+		if tier.MinVolume < 0 {
+			http.Error(w, "Tier volume cannot be negative", http.StatusBadRequest)
+			return
+		}
+		percents = append(percents, tier.BonusPercent)
+	}
+	for _, percent := range percents {
+		if percent < 0 || percent > 100 {
+			http.Error(w, "Percentages must be between 0 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if rules.ProductPercents == nil {
+		rules.ProductPercents = map[string]float64{}
+	}
+	if rules.BrandPercents == nil {
+		rules.BrandPercents = map[string]float64{}
+	}
+	if rules.CategoryPercents == nil {
+		rules.CategoryPercents = map[string]float64{}
+	}
+	if rules.Tiers == nil {
+		rules.Tiers = []models.CommissionTier{}
+	}
+	sort.Slice(rules.Tiers, func(i, j int) bool { return rules.Tiers[i].MinVolume < rules.Tiers[j].MinVolume })
+
+	rules.ID = commissionRulesID
+	rules.UpdatedBy = claims["sub"].(string)
+	rules.UpdatedAt = time.Now().Unix()
+
+	_, err := h.db.Collection("commission_rules").ReplaceOne(
+		context.Background(),
+		bson.M{"_id": rules.ID},
+		rules,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error saving commission rules: %v", err)
+		http.Error(w, "Error saving commission rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// GetCommissionReport devuelve las comisiones por vendedor de un mes
+// (?period=YYYY-MM, por defecto el actual). Los vendedores sólo ven la suya;
+// con detail=true se incluye el desglose por venta.
+func (h *CommissionHandler) GetCommissionReport(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "consultor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = time.Now().Format("2006-01")
+	}
+	start, end, err := monthRange(period)
+	if err != nil {
+		http.Error(w, "Invalid period format (use YYYY-MM)", http.StatusBadRequest)
+		return
+	}
+
+	sellerID := ""
+	if userRole == "vendedor" {
+		sellerID = claims["sub"].(string)
+	}
+
+	ctx := context.Background()
+	status := "open"
+	var sellers []models.SellerCommission
+	var closed models.CommissionPeriod
+	err = h.db.Collection("commission_periods").FindOne(ctx, bson.M{"_id": period}).Decode(&closed)
+	switch err {
+	case nil:
+		status = "closed"
+		sellers = closed.Sellers
+	case mongo.ErrNoDocuments:
+		sellers, err = h.computeCommissions(ctx, start, end)
+		if err != nil {
+			log.Printf("Error computing commissions: %v", err)
+			http.Error(w, "Error computing commissions", http.StatusInternalServerError)
+			return
+		}
+	default:
+		log.Printf("Error fetching commission period: %v", err)
+		http.Error(w, "Error fetching commission period", http.StatusInternalServerError)
+		return
+	}
+
+	detail := r.URL.Query().Get("detail") == "true"
+	report := []models.SellerCommission{}
+	total := 0.0
+	for _, seller := range sellers {
+		if sellerID != "" && seller.SellerID != sellerID {
+			continue
+		}
+		if !detail {
+			seller.Lines = nil
+			seller.Adjustments = nil
+		}
+		report = append(report, seller)
+		total += seller.Total
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":  period,
+		"status":  status,
+		"start":   start.Unix(),
+		"end":     end.Unix(),
+		"total":   roundMoney(total),
+		"sellers": report,
+	})
+}
+
+// ClosePeriod congela las comisiones de un mes ya terminado para su pago. Las
+// devoluciones posteriores se descuentan en el periodo abierto.
+func (h *CommissionHandler) ClosePeriod(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	period := mux.Vars(r)["period"]
+	start, end, err := monthRange(period)
+	if err != nil {
+		http.Error(w, "Invalid period format (use YYYY-MM)", http.StatusBadRequest)
+		return
+	}
+	if end.After(time.Now()) {
+		http.Error(w, "Period has not ended yet", http.StatusConflict)
+		return
+	}
+
+	ctx := context.Background()
+	sellers, err := h.computeCommissions(ctx, start, end)
+	if err != nil {
+		log.Printf("Error computing commissions: %v", err)
+		http.Error(w, "Error computing commissions", http.StatusInternalServerError)
+		return
+	}
+
+	closed := models.CommissionPeriod{
+		ID:       period,
+		Start:    start.Unix(),
+		End:      end.Unix(),
+		Sellers:  sellers,
+		ClosedBy: claims["sub"].(string),
+		ClosedAt: time.Now().Unix(),
+	}
+	for _, seller := range sellers {
+		closed.Total += seller.Total
+	}
+	closed.Total = roundMoney(closed.Total)
+
+	if _, err := h.db.Collection("commission_periods").InsertOne(ctx, closed); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			http.Error(w, "Period is already closed", http.StatusConflict)
+			return
+		}
+		log.Printf("Error closing commission period: %v", err)
+		http.Error(w, "Error closing period", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(closed)
+}
+
+// computeCommissions calcula la comisión de cada vendedor con las ventas
+// completadas del periodo y los descuentos por devoluciones registrados en él.
+func (h *CommissionHandler) computeCommissions(ctx context.Context, start, end time.Time) ([]models.SellerCommission, error) {
+	rules, err := loadCommissionRules(ctx, h.db)
+	if err != nil {
+		return nil, err
+	}
+
+	sales, err := h.store.Sales().List(ctx, store.SaleFilter{
+		Status:      models.SaleCompleted,
+		From:        start.Unix(),
+		To:          end.Unix(),
+		OldestFirst: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := h.db.Collection("commission_adjustments").Find(ctx, bson.M{"timestamp": bson.M{"$gte": start.Unix(), "$lt": end.Unix()}})
+	if err != nil {
+		return nil, err
+	}
+	var adjustments []models.CommissionAdjustment
+	if err = cursor.All(ctx, &adjustments); err != nil {
+		return nil, err
+	}
+
+	percents, err := h.productPercents(ctx, rules, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	return commissionsFor(sales, adjustments, percents, rules.Tiers), nil
+}
+
+// commissionsFor reparte las ventas y ajustes del periodo por vendedor con el
+// porcentaje de cada producto y el bono del escalón alcanzado por su volumen
+func commissionsFor(sales []models.Sale, adjustments []models.CommissionAdjustment, percents map[string]float64, tiers []models.CommissionTier) []models.SellerCommission {
+	// Comisión base por venta; el bono por volumen se suma al conocer el total del mes
+	bySeller := make(map[string]*models.SellerCommission)
+	baseCommission := make(map[string]float64)
+	for _, sale := range sales {
+		seller, ok := bySeller[sale.SellerID]
+		if !ok {
+			seller = &models.SellerCommission{SellerID: sale.SellerID}
+			bySeller[sale.SellerID] = seller
+		}
+		seller.SellerName = sale.SellerName
+		seller.SalesCount++
+		seller.Volume += sale.TotalAmount
+
+		factor := 1.0
+		if sale.Discount > 0 {
+			factor = sale.TotalAmount / (sale.TotalAmount + sale.Discount)
+		}
+		base := 0.0
+		for _, item := range sale.Items {
+			base += item.Subtotal * factor * percents[item.ProductID] / 100
+		}
+		baseCommission[sale.ID.Hex()] = base
+	}
+
+	for _, seller := range bySeller {
+		seller.Volume = roundMoney(seller.Volume)
+		for _, tier := range tiers {
+			if seller.Volume >= tier.MinVolume {
+				seller.BonusPercent = tier.BonusPercent
+			}
+		}
+	}
+
+	for _, sale := range sales {
+		seller := bySeller[sale.SellerID]
+		commission := roundMoney(baseCommission[sale.ID.Hex()] + sale.TotalAmount*seller.BonusPercent/100)
+		seller.Lines = append(seller.Lines, models.CommissionLine{
+			SaleID:     sale.ID.Hex(),
+			Timestamp:  sale.Timestamp,
+			Amount:     sale.TotalAmount,
+			Commission: commission,
+		})
+		seller.Commission += commission
+	}
+
+	for _, adjustment := range adjustments {
+		seller, ok := bySeller[adjustment.SellerID]
+		if !ok {
+			seller = &models.SellerCommission{SellerID: adjustment.SellerID}
+			bySeller[adjustment.SellerID] = seller
+		}
+		seller.Adjustments = append(seller.Adjustments, adjustment)
+		seller.Clawbacks += adjustment.Amount
+	}
+
+	result := make([]models.SellerCommission, 0, len(bySeller))
+	for _, seller := range bySeller {
+		seller.Commission = roundMoney(seller.Commission)
+		seller.Clawbacks = roundMoney(seller.Clawbacks)
+		seller.Total = roundMoney(seller.Commission + seller.Clawbacks)
+		result = append(result, *seller)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].SellerID < result[j].SellerID })
+
+	return result
+}
+
+// productPercents resuelve el porcentaje de comisión de cada producto vendido
+func (h *CommissionHandler) productPercents(ctx context.Context, rules models.CommissionRules, sales []models.Sale) (map[string]float64, error) {
+	percents := make(map[string]float64)
+	var pending []string
+	for _, sale := range sales {
+		for _, item := range sale.Items {
+			if _, ok := percents[item.ProductID]; ok {
+				continue
+			}
+			if percent, ok := rules.ProductPercents[item.ProductID]; ok {
+				percents[item.ProductID] = percent
+				continue
+			}
+			percents[item.ProductID] = rules.DefaultPercent
+			pending = append(pending, item.ProductID)
+		}
+	}
+
+	// Categoría según el inventario
+	categories := make(map[string]string)
+	if len(rules.CategoryPercents) > 0 && len(pending) > 0 {
+		cursor, err := h.db.Collection("inventory").Find(ctx, bson.M{"productId": bson.M{"$in": pending}})
+		if err != nil {
+			return nil, err
+		}
+		var items []models.InventoryItem
+		if err = cursor.All(ctx, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			categories[item.ProductID] = item.Category
+		}
+	}
+
+	for _, productID := range pending {
+		if len(rules.BrandPercents) > 0 && h.catalog != nil {
+			product, err := h.catalog.GetProduct(ctx, productID)
+			if err != nil && err != catalog.ErrProductNotFound {
+				log.Printf("Error fetching brand for product %s: %v", productID, err)
+			}
+			if err == nil {
+				if percent, ok := rules.BrandPercents[strconv.Itoa(product.IDMarca)]; ok {
+					percents[productID] = percent
+					continue
+				}
+			}
+		}
+		if percent, ok := rules.CategoryPercents[categories[productID]]; ok {
+			percents[productID] = percent
+		}
+	}
+
+	return percents, nil
+}
+
+func loadCommissionRules(ctx context.Context, db *mongo.Database) (models.CommissionRules, error) {
+	var rules models.CommissionRules
+	err := db.Collection("commission_rules").FindOne(ctx, bson.M{"_id": commissionRulesID}).Decode(&rules)
+	if err == mongo.ErrNoDocuments {
+		return models.CommissionRules{
+			ID:               commissionRulesID,
+			ProductPercents:  map[string]float64{},
+			BrandPercents:    map[string]float64{},
+			CategoryPercents: map[string]float64{},
+			Tiers:            []models.CommissionTier{},
+		}, nil
+	}
+	return rules, err
+}
+
+func monthRange(period string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// clawbackCommission ajusta la comisión pagada por una venta cuyo periodo ya
+// se cerró a lo que corresponde a su nuevo total (0 si la venta se eliminó),
+// descontando los ajustes previos. Si el periodo sigue abierto no hace falta:
+// el reporte se recalcula con la venta como quedó.
+func clawbackCommission(ctx context.Context, db *mongo.Database, sale models.Sale, newAmount float64, userID, reason string) error {
+	var closed models.CommissionPeriod
+	err := db.Collection("commission_periods").FindOne(ctx, bson.M{
+		"start": bson.M{"$lte": sale.Timestamp},
+		"end":   bson.M{"$gt": sale.Timestamp},
+	}).Decode(&closed)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	saleID := sale.ID.Hex()
+	for _, seller := range closed.Sellers {
+		if seller.SellerID != sale.SellerID {
+			continue
+		}
+		for _, line := range seller.Lines {
+			if line.SaleID != saleID || line.Commission == 0 || line.Amount == 0 {
+				continue
+			}
+
+			// Comisión ya pagada menos lo descontado por ediciones anteriores
+			cursor, err := db.Collection("commission_adjustments").Find(ctx, bson.M{"saleId": saleID, "sourcePeriod": closed.ID})
+			if err != nil {
+				return err
+			}
+			var previous []models.CommissionAdjustment
+			if err := cursor.All(ctx, &previous); err != nil {
+				return err
+			}
+			paid := line.Commission
+			for _, adjustment := range previous {
+				paid += adjustment.Amount
+			}
+
+			// La comisión se ajusta en proporción al total de la venta
+			amount := roundMoney(line.Commission*newAmount/line.Amount - paid)
+			if amount == 0 {
+				return nil
+			}
+
+			_, err = db.Collection("commission_adjustments").InsertOne(ctx, models.CommissionAdjustment{
+				ID:           primitive.NewObjectID(),
+				SellerID:     sale.SellerID,
+				SaleID:       saleID,
+				Amount:       amount,
+				Reason:       reason,
+				SourcePeriod: closed.ID,
+				CreatedBy:    userID,
+				Timestamp:    time.Now().Unix(),
+			})
+			return err
+		}
+	}
+	return nil
+}
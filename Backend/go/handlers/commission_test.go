@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func commissionSale(seller string, timestamp int64, total, discount float64, items ...models.SaleItem) models.Sale {
+	return models.Sale{
+		ID:          primitive.NewObjectID(),
+		SellerID:    seller,
+		SellerName:  "Vendedor " + seller,
+		Timestamp:   timestamp,
+		Items:       items,
+		TotalAmount: total,
+		Discount:    discount,
+		Status:      models.SaleCompleted,
+	}
+}
+
+func TestCommissionsFor(t *testing.T) {
+	single := commissionSale("a", 100, 100, 0, models.SaleItem{ProductID: "p1", Subtotal: 100})
+	discounted := commissionSale("a", 100, 150, 50, models.SaleItem{ProductID: "p1", Subtotal: 200})
+	mixed := commissionSale("a", 100, 300, 0,
+		models.SaleItem{ProductID: "p1", Subtotal: 100},
+		models.SaleItem{ProductID: "p2", Subtotal: 200},
+	)
+	big := commissionSale("a", 100, 600, 0, models.SaleItem{ProductID: "p3", Subtotal: 600})
+	second := commissionSale("a", 200, 400, 0, models.SaleItem{ProductID: "p3", Subtotal: 400})
+	small := commissionSale("b", 150, 100, 0, models.SaleItem{ProductID: "p3", Subtotal: 100})
+	clawback := models.CommissionAdjustment{SellerID: "a", SaleID: "old", Amount: -2}
+	orphan := models.CommissionAdjustment{SellerID: "c", SaleID: "old", Amount: -3.5}
+
+	percents := map[string]float64{"p1": 5, "p2": 10, "p3": 0}
+	tiers := []models.CommissionTier{{MinVolume: 500, BonusPercent: 1}, {MinVolume: 1000, BonusPercent: 2}}
+
+	line := func(sale models.Sale, commission float64) models.CommissionLine {
+		return models.CommissionLine{SaleID: sale.ID.Hex(), Timestamp: sale.Timestamp, Amount: sale.TotalAmount, Commission: commission}
+	}
+
+	tests := []struct {
+		name        string
+		sales       []models.Sale
+		adjustments []models.CommissionAdjustment
+		tiers       []models.CommissionTier
+		want        []models.SellerCommission
+	}{
+		{
+			name: "no sales",
+			want: []models.SellerCommission{},
+		},
+		{
+			name:  "product percent",
+			sales: []models.Sale{single},
+			want: []models.SellerCommission{{
+				SellerID: "a", SellerName: "Vendedor a", SalesCount: 1, Volume: 100,
+				Commission: 5, Total: 5,
+				Lines: []models.CommissionLine{line(single, 5)},
+			}},
+		},
+		{
+			name:  "discount is prorated over the items",
+			sales: []models.Sale{discounted},
+			want: []models.SellerCommission{{
+				SellerID: "a", SellerName: "Vendedor a", SalesCount: 1, Volume: 150,
+				Commission: 7.5, Total: 7.5,
+				Lines: []models.CommissionLine{line(discounted, 7.5)},
+			}},
+		},
+		{
+			name:  "percent per item",
+			sales: []models.Sale{mixed},
+			want: []models.SellerCommission{{
+				SellerID: "a", SellerName: "Vendedor a", SalesCount: 1, Volume: 300,
+				Commission: 25, Total: 25,
+				Lines: []models.CommissionLine{line(mixed, 25)},
+			}},
+		},
+		{
+			name:  "highest tier reached applies to every sale",
+			sales: []models.Sale{big, small, second},
+			tiers: tiers,
+			want: []models.SellerCommission{
+				{
+					SellerID: "a", SellerName: "Vendedor a", SalesCount: 2, Volume: 1000, BonusPercent: 2,
+					Commission: 20, Total: 20,
+					Lines: []models.CommissionLine{line(big, 12), line(second, 8)},
+				},
+				{
+					SellerID: "b", SellerName: "Vendedor b", SalesCount: 1, Volume: 100,
+					Lines: []models.CommissionLine{line(small, 0)},
+				},
+			},
+		},
+		{
+			name:        "clawbacks reduce the total",
+			sales:       []models.Sale{single},
+			adjustments: []models.CommissionAdjustment{clawback, orphan},
+			want: []models.SellerCommission{
+				{
+					SellerID: "a", SellerName: "Vendedor a", SalesCount: 1, Volume: 100,
+					Commission: 5, Clawbacks: -2, Total: 3,
+					Lines:       []models.CommissionLine{line(single, 5)},
+					Adjustments: []models.CommissionAdjustment{clawback},
+				},
+				{
+					SellerID: "c", Clawbacks: -3.5, Total: -3.5,
+					Adjustments: []models.CommissionAdjustment{orphan},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := commissionsFor(tt.sales, tt.adjustments, percents, tt.tiers)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commissionsFor() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CustomerHandler maneja los clientes del programa de puntos
+type CustomerHandler struct {
+	collection *mongo.Collection
+}
+
+func NewCustomerHandler(collection *mongo.Collection) *CustomerHandler {
+	return &CustomerHandler{collection: collection}
+}
+
+// CreateCustomer registra un cliente con saldo de puntos en cero
+func (h *CustomerHandler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	customer.Name = strings.TrimSpace(customer.Name)
+	if customer.Name == "" {
+		http.Error(w, "Customer name is required", http.StatusBadRequest)
+		return
+	}
+	if customer.Email == "" && customer.Phone == "" {
+		http.Error(w, "Email or phone is required", http.StatusBadRequest)
+		return
+	}
+
+	customer.ID = primitive.NewObjectID()
+	customer.Email = strings.ToLower(strings.TrimSpace(customer.Email))
+	customer.PointsBalance = 0
+	customer.CreatedAt = time.Now().Unix()
+
+	if _, err := h.collection.InsertOne(context.Background(), customer); err != nil {
+		log.Printf("Error inserting customer: %v", err)
+		http.Error(w, "Error creating customer", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(customer)
+}
+
+// ListCustomers busca clientes por nombre, correo o teléfono (?q=)
+func (h *CustomerHandler) ListCustomers(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$or"] = []bson.M{
+			{"name": pattern},
+			{"email": pattern},
+			{"phone": pattern},
+		}
+	}
+
+	ctx := context.Background()
+	cursor, err := h.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"name": 1}).SetLimit(50))
+	if err != nil {
+		log.Printf("Error fetching customers: %v", err)
+		http.Error(w, "Error fetching customers", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	customers := []models.Customer{}
+	if err = cursor.All(ctx, &customers); err != nil {
+		http.Error(w, "Error reading customers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customers)
+}
+
+// GetCustomer devuelve un cliente con su saldo de puntos
+func (h *CustomerHandler) GetCustomer(w http.ResponseWriter, r *http.Request) {
+	customer, ok := h.findCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(customer)
+}
+
+// GetPointsLedger devuelve los movimientos de puntos del cliente
+func (h *CustomerHandler) GetPointsLedger(w http.ResponseWriter, r *http.Request) {
+	customer, ok := h.findCustomer(w, r)
+	if !ok {
+		return
+	}
+
+	limit, err := queryInt(r, "limit", 100)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := h.collection.Database().Collection("loyalty_transactions").Find(
+		ctx,
+		bson.M{"customerId": customer.ID},
+		options.Find().SetSort(bson.M{"timestamp": -1}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		log.Printf("Error fetching loyalty transactions: %v", err)
+		http.Error(w, "Error fetching points ledger", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []models.LoyaltyTransaction{}
+	if err = cursor.All(ctx, &transactions); err != nil {
+		http.Error(w, "Error reading points ledger", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"customer":     customer,
+		"transactions": transactions,
+	})
+}
+
+func (h *CustomerHandler) findCustomer(w http.ResponseWriter, r *http.Request) (models.Customer, bool) {
+	var customer models.Customer
+
+	customerID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return customer, false
+	}
+
+	err = h.collection.FindOne(context.Background(), bson.M{"_id": customerID}).Decode(&customer)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+			return customer, false
+		}
+		log.Printf("Error fetching customer: %v", err)
+		http.Error(w, "Error fetching customer", http.StatusInternalServerError)
+		return customer, false
+	}
+
+	return customer, true
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"auth-service/events"
+	"auth-service/models"
+	"auth-service/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// EventsHandler transmite los eventos de venta por server-sent events
+type EventsHandler struct {
+	roles  *services.RoleService
+	broker *events.Broker
+}
+
+func NewEventsHandler(roles *services.RoleService, broker *events.Broker) *EventsHandler {
+	return &EventsHandler{roles: roles, broker: broker}
+}
+
+// StreamSales envía los eventos sale.created, sale.updated y sale.cancelled,
+// filtrados por ?storeId= y ?sellerId=. Con el permiso view_sales se reciben
+// los de todos los vendedores; un vendedor sólo recibe los suyos. Un cliente
+// que se reconecta con Last-Event-ID (o ?lastEventId=) recibe lo que se
+// perdió; si ya no está en memoria recibe un evento "reset".
+func (h *EventsHandler) StreamSales(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	canViewAll, err := h.roles.HasPermission(r.Context(), userRole, models.PermissionViewSales)
+	if err != nil {
+		log.Printf("Error checking permissions: %v", err)
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		return
+	}
+	if userRole != "vendedor" && !canViewAll {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	storeID := query.Get("storeId")
+	sellerID := query.Get("sellerId")
+	if !canViewAll {
+		sellerID = claims["sub"].(string)
+	}
+
+	// Sin vendedor conocido (venta eliminada sin imagen previa) el evento sólo
+	// llega a quien no filtra
+	matches := func(event events.SaleEvent) bool {
+		if sellerID != "" && event.SellerID != sellerID {
+			return false
+		}
+		if storeID != "" && event.StoreID != storeID {
+			return false
+		}
+		return true
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+	stream, backlog, resumed, cancel := h.broker.Subscribe(lastEventID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !resumed {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range backlog {
+		if matches(event) {
+			writeSaleEvent(w, event)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(25 * time.Second)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case event, ok := <-stream:
+			if !ok {
+				return // el broker desconectó al cliente por lento
+			}
+			if matches(event) {
+				writeSaleEvent(w, event)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeSaleEvent(w http.ResponseWriter, event events.SaleEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding sale event: %v", err)
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/services"
+	"auth-service/store"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testEnv reúne el store en memoria y los servicios que usan los handlers
+type testEnv struct {
+	store   *store.Memory
+	users   *services.UserService
+	roles   *services.RoleService
+	sales   *services.SaleService
+	invites *services.InviteService
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	st := store.NewMemory()
+	roles := services.NewRoleService(st)
+	return &testEnv{
+		store:   st,
+		users:   services.NewUserService(st),
+		roles:   roles,
+		sales:   services.NewSaleService(st, roles),
+		invites: services.NewInviteService(st, time.Hour),
+	}
+}
+
+func (e *testEnv) addRole(t *testing.T, name string, permissions ...string) models.Role {
+	t.Helper()
+	role := models.Role{ID: primitive.NewObjectID(), Name: name, Permissions: permissions}
+	if err := e.store.Roles().Insert(context.Background(), role); err != nil {
+		t.Fatalf("inserting role: %v", err)
+	}
+	return role
+}
+
+func (e *testEnv) addUser(t *testing.T, name, email, password, roleName string) services.UserView {
+	t.Helper()
+	user, err := e.users.Create(context.Background(), services.NewUser{Name: name, Email: email, Password: password, RoleName: roleName})
+	if err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+// newRequest arma una solicitud con cuerpo JSON (si body no es nil) y
+// variables de ruta
+func newRequest(t *testing.T, method, target string, body interface{}, vars map[string]string) *http.Request {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	r := httptest.NewRequest(method, target, reader)
+	if vars != nil {
+		r = mux.SetURLVars(r, vars)
+	}
+	return r
+}
+
+// withToken agrega al contexto el token que deja middleware.AuthMiddleware
+func withToken(r *http.Request, email, role string) *http.Request {
+	token := &jwt.Token{Claims: jwt.MapClaims{"sub": email, "role": role}, Valid: true}
+	return r.WithContext(context.WithValue(r.Context(), "token", token))
+}
+
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d (body %q)", w.Code, status, w.Body.String())
+	}
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatalf("decoding response %q: %v", w.Body.String(), err)
+	}
+}
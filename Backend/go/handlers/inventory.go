@@ -0,0 +1,740 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"auth-service/uow"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errInsufficientStock = errors.New("insufficient stock")
+	errUntrackedProduct  = errors.New("product has no inventory record")
+)
+
+// InventoryHandler lleva las existencias de los productos. Es el único lugar
+// donde cambian: cada cambio queda como movimiento en el kárdex.
+type InventoryHandler struct {
+	collection *mongo.Collection
+	store      store.Store
+	catalog    *catalog.Client
+}
+
+func NewInventoryHandler(collection *mongo.Collection, s store.Store, catalogClient *catalog.Client) *InventoryHandler {
+	return &InventoryHandler{collection: collection, store: s, catalog: catalogClient}
+}
+
+// ListInventory lista la existencia de cada producto con inventario
+func (h *InventoryHandler) ListInventory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	cursor, err := h.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"productName": 1}))
+	if err != nil {
+		log.Printf("Error fetching inventory: %v", err)
+		http.Error(w, "Error fetching inventory", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.InventoryItem{}
+	if err := cursor.All(ctx, &items); err != nil {
+		log.Printf("Error reading inventory: %v", err)
+		http.Error(w, "Error reading inventory", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// SetStockLevels define el stock mínimo y máximo de un producto
+func (h *InventoryHandler) SetStockLevels(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	productID := params["productId"]
+
+	var levels struct {
+		MinStock int `json:"minStock"`
+		MaxStock int `json:"maxStock"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&levels); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if levels.MinStock < 0 || levels.MaxStock < 0 {
+		http.Error(w, "Stock levels cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if levels.MaxStock > 0 && levels.MaxStock < levels.MinStock {
+		http.Error(w, "Maximum stock must be greater than minimum stock", http.StatusBadRequest)
+		return
+	}
+
+	var item models.InventoryItem
+	err := h.collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"productId": productID},
+		bson.M{"$set": bson.M{
+			"minStock":  levels.MinStock,
+			"maxStock":  levels.MaxStock,
+			"updatedAt": time.Now().Unix(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&item)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Product has no inventory record", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating stock levels: %v", err)
+		http.Error(w, "Error updating stock levels", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// UpdateInventoryItem actualiza ubicación, categoría y código de barras de un producto
+func (h *InventoryHandler) UpdateInventoryItem(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	productID := params["productId"]
+
+	var details struct {
+		Location string `json:"location"`
+		Category string `json:"category"`
+		Barcode  string `json:"barcode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&details); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var item models.InventoryItem
+	err := h.collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"productId": productID},
+		bson.M{"$set": bson.M{
+			"location":  details.Location,
+			"category":  details.Category,
+			"barcode":   details.Barcode,
+			"updatedAt": time.Now().Unix(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&item)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Product has no inventory record", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error updating inventory item: %v", err)
+		http.Error(w, "Error updating inventory item", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
+
+// GetAlerts lista las alertas de stock bajo; por defecto sólo las abiertas
+func (h *InventoryHandler) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "admin" && userRole != "consultor" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.AlertOpen
+	}
+
+	alertsCollection := h.collection.Database().Collection("inventory_alerts")
+	cursor, err := alertsCollection.Find(
+		context.Background(),
+		bson.M{"status": status},
+		options.Find().SetSort(bson.M{"createdAt": -1}),
+	)
+	if err != nil {
+		log.Printf("Error fetching inventory alerts: %v", err)
+		http.Error(w, "Error fetching alerts", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	alerts := []models.InventoryAlert{}
+	if err = cursor.All(context.Background(), &alerts); err != nil {
+		http.Error(w, "Error reading alerts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// GetReorderSuggestions calcula cuánto pedir de cada producto a partir de la
+// velocidad de venta de los últimos días y sus niveles de stock.
+func (h *InventoryHandler) GetReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "admin" && userRole != "consultor" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	// Días de historial para la velocidad de venta y días de cobertura deseados
+	lookbackDays, err := queryInt(r, "days", 30)
+	if err != nil || lookbackDays <= 0 {
+		http.Error(w, "Invalid days parameter", http.StatusBadRequest)
+		return
+	}
+	coverDays, err := queryInt(r, "coverDays", 30)
+	if err != nil || coverDays <= 0 {
+		http.Error(w, "Invalid coverDays parameter", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	since := time.Now().AddDate(0, 0, -lookbackDays).Unix()
+
+	sales, err := h.store.Sales().List(ctx, store.SaleFilter{Status: models.SaleCompleted, From: since})
+	if err != nil {
+		log.Printf("Error fetching sales for velocity: %v", err)
+		http.Error(w, "Error calculating sales velocity", http.StatusInternalServerError)
+		return
+	}
+
+	unitsSold := make(map[string]int)
+	for _, sale := range sales {
+		for _, item := range sale.Items {
+			unitsSold[item.ProductID] += item.Quantity
+		}
+	}
+
+	inventoryCursor, err := h.collection.Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Error fetching inventory: %v", err)
+		http.Error(w, "Error fetching inventory", http.StatusInternalServerError)
+		return
+	}
+	defer inventoryCursor.Close(ctx)
+
+	var items []models.InventoryItem
+	if err = inventoryCursor.All(ctx, &items); err != nil {
+		http.Error(w, "Error reading inventory", http.StatusInternalServerError)
+		return
+	}
+
+	type suggestion struct {
+		ProductID         string  `json:"productId"`
+		ProductName       string  `json:"productName"`
+		Quantity          int     `json:"quantity"`
+		MinStock          int     `json:"minStock"`
+		MaxStock          int     `json:"maxStock"`
+		UnitsSold         int     `json:"unitsSold"`
+		DailyVelocity     float64 `json:"dailyVelocity"`
+		DaysOfStock       float64 `json:"daysOfStock"`
+		SuggestedQuantity int     `json:"suggestedQuantity"`
+		EstimatedCost     float64 `json:"estimatedCost"`
+	}
+
+	suggestions := []suggestion{}
+	for _, item := range items {
+		velocity := float64(unitsSold[item.ProductID]) / float64(lookbackDays)
+
+		daysOfStock := -1.0
+		if velocity > 0 {
+			daysOfStock = float64(item.Quantity) / velocity
+		}
+
+		// Se repone hasta el máximo configurado o, si no hay, hasta cubrir los días pedidos
+		target := item.MaxStock
+		if target == 0 {
+			target = int(math.Ceil(velocity * float64(coverDays)))
+		}
+
+		belowMin := item.MinStock > 0 && item.Quantity < item.MinStock
+		runningOut := velocity > 0 && daysOfStock < float64(coverDays)
+		if !belowMin && !runningOut {
+			continue
+		}
+
+		suggested := target - item.Quantity
+		if suggested <= 0 {
+			continue
+		}
+
+		suggestions = append(suggestions, suggestion{
+			ProductID:         item.ProductID,
+			ProductName:       item.ProductName,
+			Quantity:          item.Quantity,
+			MinStock:          item.MinStock,
+			MaxStock:          item.MaxStock,
+			UnitsSold:         unitsSold[item.ProductID],
+			DailyVelocity:     velocity,
+			DaysOfStock:       daysOfStock,
+			SuggestedQuantity: suggested,
+			EstimatedCost:     float64(suggested) * item.PrecioCompra,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(suggestions); err != nil {
+		log.Printf("Error encoding report response: %v", err)
+	}
+}
+
+// CreateAdjustment registra un ajuste manual de existencias con su motivo
+func (h *InventoryHandler) CreateAdjustment(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	params := mux.Vars(r)
+	productID := params["productId"]
+
+	var req struct {
+		Quantity int    `json:"quantity"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Quantity == 0 {
+		http.Error(w, "Quantity cannot be zero", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	movement, err := applyMovement(context.Background(), h.collection.Database(), models.InventoryMovement{
+		ProductID: productID,
+		Type:      models.MovementAdjustment,
+		Quantity:  req.Quantity,
+		Reason:    req.Reason,
+		Reference: models.MovementReference{Type: "manual"},
+		UserID:    claims["sub"].(string),
+	}, true)
+	if err != nil {
+		switch err {
+		case errUntrackedProduct:
+			http.Error(w, "Product has no inventory record", http.StatusNotFound)
+		case errInsufficientStock:
+			http.Error(w, "Adjustment would leave negative stock", http.StatusConflict)
+		default:
+			log.Printf("Error applying adjustment: %v", err)
+			http.Error(w, "Error applying adjustment", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+// GetMovements devuelve el kárdex de un producto en orden cronológico
+func (h *InventoryHandler) GetMovements(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "admin" && userRole != "consultor" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	params := mux.Vars(r)
+	filter := bson.M{"productId": params["productId"]}
+
+	startDateStr := r.URL.Query().Get("start")
+	endDateStr := r.URL.Query().Get("end")
+	if startDateStr != "" && endDateStr != "" {
+		startDate, err := time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			http.Error(w, "Invalid start date format (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+
+		endDate, err := time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			http.Error(w, "Invalid end date format (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+
+		filter["timestamp"] = bson.M{
+			"$gte": startDate.Unix(),
+			"$lt":  endDate.Add(24 * time.Hour).Unix(),
+		}
+	}
+
+	movementsCollection := h.collection.Database().Collection("inventory_movements")
+	cursor, err := movementsCollection.Find(
+		context.Background(),
+		filter,
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		log.Printf("Error fetching movements: %v", err)
+		http.Error(w, "Error fetching movements", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	movements := []models.InventoryMovement{}
+	if err = cursor.All(context.Background(), &movements); err != nil {
+		http.Error(w, "Error reading movements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// ImportLegacyInventory trae al kárdex las existencias que el catálogo
+// guardaba en su tabla inventario. Sólo se importan los productos que aún no
+// tienen registro aquí, así que se puede correr más de una vez.
+func (h *InventoryHandler) ImportLegacyInventory(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	ctx := context.Background()
+	stock, err := h.catalog.ListLegacyStock(ctx)
+	if err != nil {
+		log.Printf("Error fetching legacy inventory: %v", err)
+		http.Error(w, "Error fetching inventory from catalog", http.StatusBadGateway)
+		return
+	}
+
+	db := h.collection.Database()
+	imported, skipped := 0, 0
+	for _, legacy := range stock {
+		productID := strconv.Itoa(legacy.ProductID)
+		created := false
+		err := uow.Run(ctx, db, func(ctx context.Context) error {
+			created = false
+			count, err := h.collection.CountDocuments(ctx, bson.M{"productId": productID})
+			if err != nil || count > 0 {
+				return err
+			}
+			_, err = applyMovement(ctx, db, models.InventoryMovement{
+				ProductID: productID,
+				Type:      models.MovementAdjustment,
+				Quantity:  int(math.Round(float64(legacy.Cantidad))),
+				Reason:    "Existencia importada del catálogo",
+				Reference: models.MovementReference{Type: "import"},
+				UserID:    claims["sub"].(string),
+			}, false)
+			created = err == nil
+			return err
+		})
+		if err != nil {
+			log.Printf("Error importing inventory for product %s: %v", productID, err)
+			http.Error(w, "Error importing inventory", http.StatusInternalServerError)
+			return
+		}
+		if created {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+
+	log.Printf("Imported legacy inventory: %d products, %d already tracked", imported, skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"imported": imported, "skipped": skipped})
+}
+
+// ReconcileInventory compara la existencia de cada producto contra la suma de
+// sus movimientos y reporta las diferencias.
+func (h *InventoryHandler) ReconcileInventory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	movementsCollection := h.collection.Database().Collection("inventory_movements")
+	cursor, err := movementsCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$productId", "quantity": bson.M{"$sum": "$quantity"}}}},
+	})
+	if err != nil {
+		log.Printf("Error aggregating movements: %v", err)
+		http.Error(w, "Error aggregating movements", http.StatusInternalServerError)
+		return
+	}
+
+	var totals []struct {
+		ProductID string `bson:"_id"`
+		Quantity  int    `bson:"quantity"`
+	}
+	if err = cursor.All(ctx, &totals); err != nil {
+		http.Error(w, "Error reading movements", http.StatusInternalServerError)
+		return
+	}
+
+	ledger := make(map[string]int)
+	for _, t := range totals {
+		ledger[t.ProductID] = t.Quantity
+	}
+
+	inventoryCursor, err := h.collection.Find(ctx, bson.M{})
+	if err != nil {
+		http.Error(w, "Error fetching inventory", http.StatusInternalServerError)
+		return
+	}
+	defer inventoryCursor.Close(ctx)
+
+	var items []models.InventoryItem
+	if err = inventoryCursor.All(ctx, &items); err != nil {
+		http.Error(w, "Error reading inventory", http.StatusInternalServerError)
+		return
+	}
+
+	type discrepancy struct {
+		ProductID      string `json:"productId"`
+		ProductName    string `json:"productName"`
+		Quantity       int    `json:"quantity"`
+		LedgerQuantity int    `json:"ledgerQuantity"`
+		Difference     int    `json:"difference"`
+	}
+
+	discrepancies := []discrepancy{}
+	for _, item := range items {
+		if ledger[item.ProductID] == item.Quantity {
+			continue
+		}
+		discrepancies = append(discrepancies, discrepancy{
+			ProductID:      item.ProductID,
+			ProductName:    item.ProductName,
+			Quantity:       item.Quantity,
+			LedgerQuantity: ledger[item.ProductID],
+			Difference:     item.Quantity - ledger[item.ProductID],
+		})
+	}
+
+	response := struct {
+		ProductsChecked int           `json:"productsChecked"`
+		Discrepancies   []discrepancy `json:"discrepancies"`
+	}{
+		ProductsChecked: len(items),
+		Discrepancies:   discrepancies,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// queryInt lee un parámetro entero de la URL con valor por defecto
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// receiveStock suma unidades recibidas al inventario del producto, recalcula
+// su precio de compra según el método de costeo configurado y registra el
+// movimiento de entrada.
+func receiveStock(ctx context.Context, db *mongo.Database, movement models.InventoryMovement, productName string, unitCost float64, costingMethod string) error {
+	// El costo se calcula con la existencia leída en la misma unidad de trabajo
+	return uow.Run(ctx, db, func(ctx context.Context) error {
+		inventory := db.Collection("inventory")
+
+		var current models.InventoryItem
+		err := inventory.FindOne(ctx, bson.M{"productId": movement.ProductID}).Decode(&current)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		tracked := err == nil
+
+		newCost := unitCost
+		if costingMethod == models.CostingWeightedAverage && current.Quantity > 0 {
+			newCost = (float64(current.Quantity)*current.PrecioCompra + float64(movement.Quantity)*unitCost) /
+				float64(current.Quantity+movement.Quantity)
+		}
+
+		_, err = inventory.UpdateOne(
+			ctx,
+			bson.M{"productId": movement.ProductID},
+			bson.M{
+				"$set": bson.M{
+					"productName":  productName,
+					"precioCompra": newCost,
+				},
+				"$setOnInsert": bson.M{"quantity": 0, "location": "Almacén principal"},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+
+		movement.Type = models.MovementReceipt
+		if _, err := applyMovement(ctx, db, movement, false); err != nil {
+			return err
+		}
+
+		// El catálogo recibe el costo nuevo desde el outbox (ver CatalogCostSink)
+		if tracked && current.PrecioCompra == newCost {
+			return nil
+		}
+		return outbox.Write(ctx, db, outbox.ProductCostUpdated, movement.ProductID, productCostChange{
+			ProductID:    movement.ProductID,
+			PrecioCompra: newCost,
+		})
+	})
+}
+
+// productCostChange es el payload del evento product.cost_updated
+type productCostChange struct {
+	ProductID    string  `json:"productId"`
+	PrecioCompra float64 `json:"precioCompra"`
+}
+
+// consumeSaleStock descuenta las existencias de los productos vendidos. Si un
+// producto no tiene registro de inventario (errUntrackedProduct) o no alcanza
+// (errInsufficientStock) la venta se rechaza. Dentro de una transacción lo ya
+// descontado se deshace al abortarla; sin ella se regresa al inventario.
+func consumeSaleStock(ctx context.Context, db *mongo.Database, saleID string, items []models.SaleItem, userID string) error {
+	var applied []models.SaleItem
+	for productID, quantity := range quantitiesByProduct(items) {
+		_, err := applyMovement(ctx, db, models.InventoryMovement{
+			ProductID: productID,
+			Type:      models.MovementSale,
+			Quantity:  -quantity,
+			Reference: models.MovementReference{Type: "sale", ID: saleID},
+			UserID:    userID,
+		}, true)
+		if err != nil {
+			compensate(ctx, "restoring stock", func() error {
+				return restoreSaleStock(ctx, db, saleID, applied, userID, "Venta no registrada")
+			})
+			return err
+		}
+		applied = append(applied, models.SaleItem{ProductID: productID, Quantity: quantity})
+	}
+	return nil
+}
+
+// restoreSaleStock regresa al inventario las unidades de una venta cancelada
+func restoreSaleStock(ctx context.Context, db *mongo.Database, saleID string, items []models.SaleItem, userID, reason string) error {
+	for productID, quantity := range quantitiesByProduct(items) {
+		_, err := applyMovement(ctx, db, models.InventoryMovement{
+			ProductID: productID,
+			Type:      models.MovementRefund,
+			Quantity:  quantity,
+			Reason:    reason,
+			Reference: models.MovementReference{Type: "sale", ID: saleID},
+			UserID:    userID,
+		}, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adjustSaleStock aplica la diferencia de unidades entre dos versiones de una venta
+func adjustSaleStock(ctx context.Context, db *mongo.Database, saleID string, oldItems, newItems []models.SaleItem, userID string) error {
+	before := quantitiesByProduct(oldItems)
+	after := quantitiesByProduct(newItems)
+
+	var added, returned []models.SaleItem
+	for productID, quantity := range after {
+		if diff := quantity - before[productID]; diff > 0 {
+			added = append(added, models.SaleItem{ProductID: productID, Quantity: diff})
+		}
+	}
+	for productID, quantity := range before {
+		if diff := quantity - after[productID]; diff > 0 {
+			returned = append(returned, models.SaleItem{ProductID: productID, Quantity: diff})
+		}
+	}
+
+	if err := consumeSaleStock(ctx, db, saleID, added, userID); err != nil {
+		return err
+	}
+	return restoreSaleStock(ctx, db, saleID, returned, userID, "Venta modificada")
+}
+
+func quantitiesByProduct(items []models.SaleItem) map[string]int {
+	quantities := make(map[string]int)
+	for _, item := range items {
+		quantities[item.ProductID] += item.Quantity
+	}
+	return quantities
+}
+
+// applyMovement suma la cantidad del movimiento a la existencia del producto y
+// lo registra en el historial con el saldo resultante. Con requireStock no se
+// permite que la existencia quede negativa y una salida de un producto sin
+// registro de inventario es errUntrackedProduct; en los demás casos el
+// registro se crea si no existe.
+func applyMovement(ctx context.Context, db *mongo.Database, movement models.InventoryMovement, requireStock bool) (models.InventoryMovement, error) {
+	inventory := db.Collection("inventory")
+
+	filter := bson.M{"productId": movement.ProductID}
+	update := bson.M{
+		"$inc": bson.M{"quantity": movement.Quantity},
+		"$set": bson.M{"updatedAt": time.Now().Unix()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if requireStock && movement.Quantity < 0 {
+		filter["quantity"] = bson.M{"$gte": -movement.Quantity}
+	} else {
+		update["$setOnInsert"] = bson.M{"location": "Almacén principal"}
+		opts.SetUpsert(true)
+	}
+
+	// La existencia y su movimiento se escriben juntos
+	err := uow.Run(ctx, db, func(ctx context.Context) error {
+		var item models.InventoryItem
+		err := inventory.FindOneAndUpdate(ctx, filter, update, opts).Decode(&item)
+		if err == mongo.ErrNoDocuments {
+			// Distinguir entre producto sin inventario y existencia insuficiente
+			count, countErr := inventory.CountDocuments(ctx, bson.M{"productId": movement.ProductID})
+			if countErr != nil {
+				return countErr
+			}
+			if count == 0 {
+				return errUntrackedProduct
+			}
+			return errInsufficientStock
+		}
+		if err != nil {
+			return err
+		}
+
+		movement.ID = primitive.NewObjectID()
+		movement.BalanceAfter = item.Quantity
+		if movement.Timestamp == 0 {
+			movement.Timestamp = time.Now().Unix()
+		}
+
+		_, err = db.Collection("inventory_movements").InsertOne(ctx, movement)
+		return err
+	})
+	return movement, err
+}
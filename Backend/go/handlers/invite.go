@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"auth-service/services"
+	"encoding/json"
+	"net/http"
+)
+
+type InviteHandler struct {
+	invites *services.InviteService
+}
+
+func NewInviteHandler(invites *services.InviteService) *InviteHandler {
+	return &InviteHandler{invites: invites}
+}
+
+// CreateInvite emite una invitación ligada a un correo y un rol. El token va
+// sólo en esta respuesta; el administrador lo hace llegar al invitado.
+func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+	var input services.NewInvite
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.invites.Issue(r.Context(), input, viewerFromRequest(r).Email)
+	if err != nil {
+		writeServiceError(w, err, "Error creating invite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(invite)
+}
+
+// AcceptInvite da de alta al invitado con la contraseña que elige
+func (h *InviteHandler) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	var input services.AcceptInvite
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.invites.Accept(r.Context(), input)
+	if err != nil {
+		writeServiceError(w, err, "Error accepting invite")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
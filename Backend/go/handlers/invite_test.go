@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"auth-service/services"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestInviteFlow(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "consultor")
+	h := NewInviteHandler(env.invites)
+
+	w := serve(h.CreateInvite, withToken(newRequest(t, "POST", "/admin/invites", services.NewInvite{Email: " Luis@Example.com", RoleName: "consultor"}, nil), "admin@example.com", "admin"))
+	expectStatus(t, w, http.StatusCreated)
+	var invite services.IssuedInvite
+	decodeBody(t, w, &invite)
+	if invite.Token == "" || invite.Email != "luis@example.com" || invite.Role != "consultor" {
+		t.Fatalf("invite = %+v", invite)
+	}
+
+	accept := services.AcceptInvite{Token: invite.Token, Name: "Luis", Password: "secret"}
+	w = serve(h.AcceptInvite, newRequest(t, "POST", "/invites/accept", accept, nil))
+	expectStatus(t, w, http.StatusCreated)
+	var user services.UserView
+	decodeBody(t, w, &user)
+	if user.Email != "luis@example.com" || user.Role != "consultor" {
+		t.Errorf("user = %+v", user)
+	}
+	if _, _, err := env.users.Authenticate(context.Background(), "luis@example.com", "secret"); err != nil {
+		t.Errorf("invitee cannot log in: %v", err)
+	}
+
+	// Un token sirve una sola vez
+	accept.Name = "Otro"
+	w = serve(h.AcceptInvite, newRequest(t, "POST", "/invites/accept", accept, nil))
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestCreateInviteRejectsInvalidRequests(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewInviteHandler(env.invites)
+
+	tests := []struct {
+		name   string
+		body   interface{}
+		status int
+	}{
+		{"missing role", services.NewInvite{Email: "luis@example.com"}, http.StatusBadRequest},
+		{"unknown role", services.NewInvite{Email: "luis@example.com", RoleName: "gerente"}, http.StatusBadRequest},
+		{"existing user", services.NewInvite{Email: "ANA@example.com", RoleName: "vendedor"}, http.StatusConflict},
+		{"malformed body", "not an object", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.CreateInvite, withToken(newRequest(t, "POST", "/admin/invites", tt.body, nil), "admin@example.com", "admin"))
+			expectStatus(t, w, tt.status)
+		})
+	}
+}
+
+func TestAcceptInviteRejectsInvalidInvites(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	ctx := context.Background()
+
+	expired, err := services.NewInviteService(env.store, -time.Minute).Issue(ctx, services.NewInvite{Email: "luis@example.com", RoleName: "vendedor"}, "admin@example.com")
+	if err != nil {
+		t.Fatalf("issuing invite: %v", err)
+	}
+	taken, err := env.invites.Issue(ctx, services.NewInvite{Email: "eva@example.com", RoleName: "vendedor"}, "admin@example.com")
+	if err != nil {
+		t.Fatalf("issuing invite: %v", err)
+	}
+	// El correo se dio de alta por otro medio después de la invitación
+	env.addUser(t, "Eva", "eva@example.com", "secret", "vendedor")
+	h := NewInviteHandler(env.invites)
+
+	tests := []struct {
+		name   string
+		body   services.AcceptInvite
+		status int
+	}{
+		{"missing password", services.AcceptInvite{Token: taken.Token, Name: "Eva"}, http.StatusBadRequest},
+		{"unknown token", services.AcceptInvite{Token: "nope", Name: "Luis", Password: "secret"}, http.StatusNotFound},
+		{"expired", services.AcceptInvite{Token: expired.Token, Name: "Luis", Password: "secret"}, http.StatusNotFound},
+		{"email taken", services.AcceptInvite{Token: taken.Token, Name: "Eva", Password: "secret"}, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(h.AcceptInvite, newRequest(t, "POST", "/invites/accept", tt.body, nil))
+			expectStatus(t, w, tt.status)
+		})
+	}
+
+	users, _ := env.store.Users().List(ctx)
+	if len(users) != 1 {
+		t.Errorf("stored users = %d, want 1", len(users))
+	}
+}
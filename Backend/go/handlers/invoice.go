@@ -0,0 +1,494 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/cfdi"
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// InvoiceHandler genera las facturas electrónicas (CFDI 4.0) de las ventas
+type InvoiceHandler struct {
+	db             *mongo.Database
+	store          store.Store
+	issuer         cfdi.Issuer
+	signer         *cfdi.Signer
+	pac            cfdi.PAC
+	catalog        *catalog.Client
+	defaultTaxRate float64
+}
+
+func NewInvoiceHandler(db *mongo.Database, s store.Store, issuer cfdi.Issuer, signer *cfdi.Signer, pac cfdi.PAC, catalogClient *catalog.Client, defaultTaxRate float64) *InvoiceHandler {
+	return &InvoiceHandler{
+		db:             db,
+		store:          s,
+		issuer:         issuer,
+		signer:         signer,
+		pac:            pac,
+		catalog:        catalogClient,
+		defaultTaxRate: defaultTaxRate,
+	}
+}
+
+type invoiceRequest struct {
+	Customer   cfdi.Customer `json:"customer"`
+	FormaPago  string        `json:"formaPago"`
+	MetodoPago string        `json:"metodoPago"`
+}
+
+// CreateInvoice timbra la factura de una venta completada con los datos
+// fiscales del cliente y la guarda en la venta.
+func (h *InvoiceHandler) CreateInvoice(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if h.signer == nil {
+		http.Error(w, "Electronic invoicing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := mux.Vars(r)
+	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	var req invoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MetodoPago == "" {
+		req.MetodoPago = "PUE"
+	}
+
+	if err := req.Customer.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := cfdi.ValidatePayment(req.FormaPago, req.MetodoPago); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	sale, err := h.store.Sales().Get(ctx, saleID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching sale: %v", err)
+		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
+		return
+	}
+
+	if userRole == "vendedor" && sale.SellerID != claims["sub"].(string) {
+		http.Error(w, "Cannot invoice this sale", http.StatusForbidden)
+		return
+	}
+	if sale.Status != models.SaleCompleted {
+		http.Error(w, "Only completed sales can be invoiced", http.StatusConflict)
+		return
+	}
+
+	lines, err := h.saleLines(ctx, sale)
+	if err != nil {
+		log.Printf("Error fetching tax rates: %v", err)
+		http.Error(w, "Error fetching product tax rates", http.StatusBadGateway)
+		return
+	}
+
+	// Apartar la venta para que no se facture dos veces
+	pending := &models.SaleInvoice{Status: models.InvoicePending}
+	err = h.store.Sales().SetInvoice(ctx, saleID, pending, nil)
+	if err == store.ErrConflict {
+		http.Error(w, "Sale was already invoiced", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reserving sale for invoice: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	release := func() {
+		if err := h.store.Sales().SetInvoice(ctx, saleID, nil, pending); err != nil {
+			log.Printf("Error releasing sale %s: %v", saleID.Hex(), err)
+		}
+	}
+
+	folio, err := nextFolio(ctx, h.db, "invoice")
+	if err != nil {
+		release()
+		log.Printf("Error assigning folio: %v", err)
+		http.Error(w, "Error creating invoice", http.StatusInternalServerError)
+		return
+	}
+
+	comprobante, err := h.issuer.BuildInvoice(folio, req.Customer, req.FormaPago, req.MetodoPago, lines, time.Now())
+	if err != nil {
+		release()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stamp, err := h.signAndStamp(ctx, comprobante)
+	if err != nil {
+		release()
+		log.Printf("Error stamping invoice for sale %s: %v", saleID.Hex(), err)
+		http.Error(w, "Error stamping invoice", http.StatusBadGateway)
+		return
+	}
+
+	invoice := models.SaleInvoice{
+		Status:      models.InvoiceStamped,
+		UUID:        stamp.UUID,
+		Serie:       comprobante.Serie,
+		Folio:       comprobante.Folio,
+		ReceptorRFC: req.Customer.RFC,
+		XML:         string(stamp.XML),
+		StampedAt:   time.Now().Unix(),
+	}
+	if err := h.store.Sales().SetInvoice(ctx, saleID, &invoice, pending); err != nil {
+		// El CFDI ya está timbrado; se registra el UUID para poder recuperarlo
+		log.Printf("Error saving invoice %s for sale %s: %v", stamp.UUID, saleID.Hex(), err)
+		http.Error(w, "Invoice was stamped but could not be saved", http.StatusInternalServerError)
+		return
+	}
+
+	sale.Invoice = &invoice
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sale)
+}
+
+// GetInvoiceXML descarga el XML timbrado de la venta (o de su factura global)
+func (h *InvoiceHandler) GetInvoiceXML(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	params := mux.Vars(r)
+	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	sale, err := h.store.Sales().Get(ctx, saleID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
+		return
+	}
+
+	if userRole != "admin" && sale.SellerID != claims["sub"].(string) {
+		http.Error(w, "Cannot access this sale", http.StatusForbidden)
+		return
+	}
+	if sale.Invoice == nil || sale.Invoice.Status != models.InvoiceStamped {
+		http.Error(w, "Sale has no invoice", http.StatusNotFound)
+		return
+	}
+
+	xmlContent := sale.Invoice.XML
+	if sale.Invoice.Global && sale.Invoice.GlobalInvoiceID != nil {
+		var global models.GlobalInvoice
+		err := h.db.Collection("global_invoices").FindOne(ctx, bson.M{"_id": *sale.Invoice.GlobalInvoiceID}).Decode(&global)
+		if err != nil {
+			http.Error(w, "Error fetching global invoice", http.StatusInternalServerError)
+			return
+		}
+		xmlContent = global.XML
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+sale.Invoice.UUID+".xml\"")
+	w.Write([]byte(xmlContent))
+}
+
+// CreateGlobalInvoice timbra la factura global de las ventas completadas del
+// periodo que no se facturaron a un cliente.
+func (h *InvoiceHandler) CreateGlobalInvoice(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	if h.signer == nil {
+		http.Error(w, "Electronic invoicing is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req struct {
+		Start        string `json:"start"`
+		End          string `json:"end"`
+		Periodicidad string `json:"periodicidad"`
+		FormaPago    string `json:"formaPago"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.FormaPago == "" {
+		req.FormaPago = "01"
+	}
+
+	startDate, err := time.ParseInLocation("2006-01-02", req.Start, time.Local)
+	if err != nil {
+		http.Error(w, "Invalid start date format (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	endDate, err := time.ParseInLocation("2006-01-02", req.End, time.Local)
+	if err != nil {
+		http.Error(w, "Invalid end date format (use YYYY-MM-DD)", http.StatusBadRequest)
+		return
+	}
+	endDate = endDate.Add(24 * time.Hour)
+
+	ctx := context.Background()
+	sales, err := h.store.Sales().List(ctx, store.SaleFilter{
+		Status:      models.SaleCompleted,
+		Uninvoiced:  true,
+		From:        startDate.Unix(),
+		To:          endDate.Unix(),
+		OldestFirst: true,
+	})
+	if err != nil {
+		log.Printf("Error fetching sales for global invoice: %v", err)
+		http.Error(w, "Error fetching sales", http.StatusInternalServerError)
+		return
+	}
+
+	if len(sales) == 0 {
+		http.Error(w, "No uninvoiced sales in this period", http.StatusBadRequest)
+		return
+	}
+
+	var lines []cfdi.Line
+	var saleIDs []primitive.ObjectID
+	for _, sale := range sales {
+		saleLines, err := h.saleLines(ctx, sale)
+		if err != nil {
+			log.Printf("Error fetching tax rates: %v", err)
+			http.Error(w, "Error fetching product tax rates", http.StatusBadGateway)
+			return
+		}
+		lines = append(lines, globalLines(sale, saleLines)...)
+		saleIDs = append(saleIDs, sale.ID)
+	}
+
+	globalID := primitive.NewObjectID()
+
+	// Apartar las ventas juntas; si alguna ya se facturó mientras tanto no se
+	// aparta ninguna
+	pending := &models.SaleInvoice{Status: models.InvoicePending, Global: true, GlobalInvoiceID: &globalID}
+	err = h.setInvoices(ctx, saleIDs, pending, nil)
+	if err == store.ErrConflict {
+		http.Error(w, "Some sales were invoiced concurrently, retry", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reserving sales for global invoice: %v", err)
+		http.Error(w, "Error creating global invoice", http.StatusInternalServerError)
+		return
+	}
+
+	release := func() {
+		if err := h.setInvoices(ctx, saleIDs, nil, pending); err != nil {
+			log.Printf("Error releasing sales for global invoice %s: %v", globalID.Hex(), err)
+		}
+	}
+
+	folio, err := nextFolio(ctx, h.db, "invoice")
+	if err != nil {
+		release()
+		log.Printf("Error assigning folio: %v", err)
+		http.Error(w, "Error creating global invoice", http.StatusInternalServerError)
+		return
+	}
+
+	comprobante, err := h.issuer.BuildGlobalInvoice(folio, req.Periodicidad, startDate.Month(), startDate.Year(), req.FormaPago, lines, time.Now())
+	if err != nil {
+		release()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stamp, err := h.signAndStamp(ctx, comprobante)
+	if err != nil {
+		release()
+		log.Printf("Error stamping global invoice: %v", err)
+		http.Error(w, "Error stamping invoice", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now().Unix()
+	global := models.GlobalInvoice{
+		ID:           globalID,
+		UUID:         stamp.UUID,
+		Serie:        comprobante.Serie,
+		Folio:        comprobante.Folio,
+		XML:          string(stamp.XML),
+		Periodicidad: req.Periodicidad,
+		Start:        startDate.Unix(),
+		End:          endDate.Unix(),
+		SaleIDs:      saleIDs,
+		Total:        comprobante.Total,
+		CreatedBy:    claims["sub"].(string),
+		StampedAt:    now,
+	}
+
+	if _, err := h.db.Collection("global_invoices").InsertOne(ctx, global); err != nil {
+		log.Printf("Error saving global invoice %s: %v", stamp.UUID, err)
+		http.Error(w, "Invoice was stamped but could not be saved", http.StatusInternalServerError)
+		return
+	}
+
+	stamped := &models.SaleInvoice{
+		Status:          models.InvoiceStamped,
+		UUID:            stamp.UUID,
+		Serie:           comprobante.Serie,
+		Folio:           comprobante.Folio,
+		Global:          true,
+		GlobalInvoiceID: &globalID,
+		StampedAt:       now,
+	}
+	if err := h.setInvoices(ctx, saleIDs, stamped, pending); err != nil {
+		log.Printf("Error marking sales for global invoice %s: %v", stamp.UUID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(global)
+}
+
+// setInvoices cambia la factura de las ventas en una sola unidad de trabajo:
+// si alguna ya no tiene previous (ErrConflict) no cambia ninguna
+func (h *InvoiceHandler) setInvoices(ctx context.Context, saleIDs []primitive.ObjectID, invoice, previous *models.SaleInvoice) error {
+	return h.store.Atomic(ctx, func(ctx context.Context) error {
+		for _, id := range saleIDs {
+			if err := h.store.Sales().SetInvoice(ctx, id, invoice, previous); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// signAndStamp sella el comprobante con el CSD y lo envía al PAC
+func (h *InvoiceHandler) signAndStamp(ctx context.Context, comprobante *cfdi.Comprobante) (cfdi.Stamp, error) {
+	if err := h.signer.Sign(comprobante); err != nil {
+		return cfdi.Stamp{}, err
+	}
+
+	signed, err := comprobante.Marshal()
+	if err != nil {
+		return cfdi.Stamp{}, err
+	}
+
+	return h.pac.Stamp(ctx, signed)
+}
+
+// saleLines convierte las partidas de la venta en conceptos con la tasa de IVA
+// de cada producto según el catálogo.
+func (h *InvoiceHandler) saleLines(ctx context.Context, sale models.Sale) ([]cfdi.Line, error) {
+	rates := make(map[string]float64)
+	var lines []cfdi.Line
+
+	// El descuento por puntos se reparte entre las partidas
+	factor := 1.0
+	if sale.Discount > 0 {
+		factor = sale.TotalAmount / (sale.TotalAmount + sale.Discount)
+	}
+
+	for _, item := range sale.Items {
+		rate, ok := rates[item.ProductID]
+		if !ok {
+			rate = h.defaultTaxRate
+			product, err := h.catalog.GetProduct(ctx, item.ProductID)
+			if err != nil && err != catalog.ErrProductNotFound {
+				return nil, err
+			}
+			if err == nil && product.IVAPorcentaje != nil {
+				rate = float64(*product.IVAPorcentaje) / 100
+			}
+			rates[item.ProductID] = rate
+		}
+
+		lines = append(lines, cfdi.Line{
+			ID:          item.ProductID,
+			Description: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice * factor,
+			TaxRate:     rate,
+		})
+	}
+
+	return lines, nil
+}
+
+// globalLines agrupa una venta en un concepto por tasa de IVA, identificado
+// con el ID de la venta como lo pide la factura global.
+func globalLines(sale models.Sale, lines []cfdi.Line) []cfdi.Line {
+	byRate := make(map[float64]float64)
+	var order []float64
+	for _, line := range lines {
+		if _, ok := byRate[line.TaxRate]; !ok {
+			order = append(order, line.TaxRate)
+		}
+		byRate[line.TaxRate] += line.UnitPrice * float64(line.Quantity)
+	}
+
+	var grouped []cfdi.Line
+	for _, rate := range order {
+		grouped = append(grouped, cfdi.Line{
+			ID:          sale.ID.Hex(),
+			Description: "Venta",
+			Quantity:    1,
+			UnitPrice:   roundMoney(byRate[rate]),
+			TaxRate:     rate,
+		})
+	}
+	return grouped
+}
+
+// nextFolio asigna el siguiente folio consecutivo de la serie indicada
+func nextFolio(ctx context.Context, db *mongo.Database, name string) (string, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := db.Collection("counters").FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"value": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(counter.Value, 10), nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"auth-service/cfdi"
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetInvoiceXML(t *testing.T) {
+	env := newTestEnv(t)
+	handler := NewInvoiceHandler(nil, env.store, cfdi.Issuer{}, nil, nil, nil, 0.16)
+
+	invoiced := models.Sale{
+		ID: primitive.NewObjectID(), SellerID: "ana@example.com", Status: models.SaleCompleted,
+		Invoice: &models.SaleInvoice{Status: models.InvoiceStamped, UUID: "uuid-1", XML: "<cfdi:Comprobante/>"},
+	}
+	plain := models.Sale{ID: primitive.NewObjectID(), SellerID: "ana@example.com", Status: models.SaleCompleted}
+	env.store.AddSale(invoiced)
+	env.store.AddSale(plain)
+
+	download := func(id, email, role string) *http.Request {
+		r := newRequest(t, http.MethodGet, "/sales/"+id+"/invoice.xml", nil, map[string]string{"id": id})
+		return withToken(r, email, role)
+	}
+
+	w := serve(handler.GetInvoiceXML, download(invoiced.ID.Hex(), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusOK)
+	if w.Body.String() != "<cfdi:Comprobante/>" {
+		t.Errorf("body = %q, want the stamped XML", w.Body.String())
+	}
+	expectStatus(t, serve(handler.GetInvoiceXML, download(invoiced.ID.Hex(), "luis@example.com", "vendedor")), http.StatusForbidden)
+	expectStatus(t, serve(handler.GetInvoiceXML, download(plain.ID.Hex(), "ana@example.com", "vendedor")), http.StatusNotFound)
+	expectStatus(t, serve(handler.GetInvoiceXML, download(primitive.NewObjectID().Hex(), "ana@example.com", "admin")), http.StatusNotFound)
+}
+
+func TestSetInvoicesReservesAllOrNone(t *testing.T) {
+	env := newTestEnv(t)
+	handler := NewInvoiceHandler(nil, env.store, cfdi.Issuer{}, nil, nil, nil, 0.16)
+	ctx := context.Background()
+
+	free := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleCompleted}
+	taken := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleCompleted, Invoice: &models.SaleInvoice{Status: models.InvoicePending}}
+	env.store.AddSale(free)
+	env.store.AddSale(taken)
+
+	globalID := primitive.NewObjectID()
+	pending := &models.SaleInvoice{Status: models.InvoicePending, Global: true, GlobalInvoiceID: &globalID}
+	if err := handler.setInvoices(ctx, []primitive.ObjectID{free.ID, taken.ID}, pending, nil); err != store.ErrConflict {
+		t.Fatalf("setInvoices() = %v, want ErrConflict", err)
+	}
+	if sale, _ := env.store.Sales().Get(ctx, free.ID); sale.Invoice != nil {
+		t.Errorf("free sale was reserved: %+v", sale.Invoice)
+	}
+
+	if err := handler.setInvoices(ctx, []primitive.ObjectID{free.ID}, pending, nil); err != nil {
+		t.Fatalf("setInvoices() error: %v", err)
+	}
+	if sale, _ := env.store.Sales().Get(ctx, free.ID); sale.Invoice == nil || *sale.Invoice.GlobalInvoiceID != globalID {
+		t.Errorf("invoice = %+v, want the pending global invoice", sale.Invoice)
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LayawayHandler maneja los apartados: ventas que reservan la mercancía y se
+// liquidan con pagos parciales.
+type LayawayHandler struct {
+	db             *mongo.Database
+	store          store.Store
+	forfeitPercent float64
+	approvals      ApprovalPolicy
+}
+
+func NewLayawayHandler(db *mongo.Database, s store.Store, forfeitPercent float64, approvals ApprovalPolicy) *LayawayHandler {
+	return &LayawayHandler{db: db, store: s, forfeitPercent: forfeitPercent, approvals: approvals}
+}
+
+type layawayRequest struct {
+	Items         []saleRequestItem `json:"items"`
+	Deposit       float64           `json:"deposit"`
+	PaymentMethod string            `json:"paymentMethod"`
+	RegisterID    string            `json:"registerId,omitempty"`
+	StoreID       string            `json:"storeId,omitempty"`
+}
+
+type paymentRequest struct {
+	Amount float64 `json:"amount"`
+	Method string  `json:"method"`
+}
+
+// CreateLayaway registra un apartado con su anticipo y reserva las existencias
+func (h *LayawayHandler) CreateLayaway(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	userRole, ok := claims["role"].(string)
+	if !ok || userRole != "vendedor" {
+		http.Error(w, "Only sellers can create layaways", http.StatusForbidden)
+		return
+	}
+
+	sellerID, ok := claims["sub"].(string)
+	if !ok {
+		http.Error(w, "Invalid seller information", http.StatusBadRequest)
+		return
+	}
+
+	sellerName, ok := claims["name"].(string)
+	if !ok {
+		sellerName = "Unknown"
+	}
+
+	var req layawayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Sale must contain at least one item", http.StatusBadRequest)
+		return
+	}
+
+	saleItems, totalAmount, err := buildSaleItems(req.Items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Deposit <= 0 {
+		http.Error(w, "Deposit must be greater than 0", http.StatusBadRequest)
+		return
+	}
+	if req.Deposit >= totalAmount {
+		http.Error(w, "Deposit covers the full amount; create a regular sale instead", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	sale := models.Sale{
+		ID:          primitive.NewObjectID(),
+		Items:       saleItems,
+		TotalAmount: totalAmount,
+		SellerID:    sellerID,
+		SellerName:  sellerName,
+		Timestamp:   now,
+		Status:      models.SaleLayaway,
+		RegisterID:  req.RegisterID,
+		StoreID:     req.StoreID,
+		Payments: []models.SalePayment{{
+			Amount:     req.Deposit,
+			Method:     req.PaymentMethod,
+			ReceivedBy: sellerID,
+			Timestamp:  now,
+		}},
+		AmountPaid: req.Deposit,
+		Balance:    roundMoney(totalAmount - req.Deposit),
+	}
+
+	// Reservar la mercancía para que no se venda a otro cliente y registrar el
+	// apartado en una sola unidad de trabajo
+	ctx := context.Background()
+	db := h.db
+	err = h.store.Atomic(ctx, func(ctx context.Context) error {
+		if err := consumeSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID); err != nil {
+			return err
+		}
+		if err := h.store.Sales().Insert(ctx, sale); err != nil {
+			compensate(ctx, "restoring stock", func() error {
+				return restoreSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID, "Apartado no registrado")
+			})
+			return err
+		}
+		return writeSaleEvents(ctx, db, sale, outbox.SaleCreated)
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error creating layaway")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sale)
+}
+
+// AddPayment abona al saldo de un apartado; al liquidarse la venta se completa
+func (h *LayawayHandler) AddPayment(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" {
+		http.Error(w, "Only sellers can register payments", http.StatusForbidden)
+		return
+	}
+
+	sale, ok := h.findLayaway(w, r)
+	if !ok {
+		return
+	}
+
+	var req paymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, "Payment amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+	if roundMoney(req.Amount) > sale.Balance {
+		http.Error(w, "Payment exceeds outstanding balance", http.StatusBadRequest)
+		return
+	}
+
+	openSale := sale
+	now := time.Now().Unix()
+	payment := models.SalePayment{
+		Amount:     req.Amount,
+		Method:     req.Method,
+		ReceivedBy: claims["sub"].(string),
+		Timestamp:  now,
+	}
+
+	sale.Payments = append(sale.Payments, payment)
+	sale.AmountPaid = roundMoney(sale.AmountPaid + req.Amount)
+	sale.Balance = roundMoney(sale.TotalAmount - sale.AmountPaid)
+
+	if sale.Balance <= 0 {
+		// Liquidado: la venta cuenta en reportes a partir de este momento
+		sale.Status = models.SaleCompleted
+		sale.Timestamp = now
+	}
+
+	eventTypes := []string{outbox.SaleUpdated}
+	if sale.Status == models.SaleCompleted {
+		eventTypes = append(eventTypes, outbox.SaleCompleted)
+	}
+
+	err := h.store.Atomic(context.Background(), func(ctx context.Context) error {
+		// Update compara lo abonado: dos pagos simultáneos no exceden el total
+		err := h.store.Sales().Update(ctx, sale, openSale)
+		if err == store.ErrConflict {
+			return &requestError{status: http.StatusConflict, message: "Layaway was modified concurrently, retry the payment"}
+		}
+		if err != nil {
+			return err
+		}
+		return writeSaleEvents(ctx, h.db, sale, eventTypes...)
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error registering payment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sale)
+}
+
+// CancelLayaway cancela un apartado abandonado: regresa la mercancía y retiene
+// el porcentaje de penalización configurado sobre lo abonado.
+func (h *LayawayHandler) CancelLayaway(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	sale, ok := h.findLayaway(w, r)
+	if !ok {
+		return
+	}
+
+	forfeited := roundMoney(math.Min(sale.AmountPaid, sale.TotalAmount*h.forfeitPercent/100))
+	refund := roundMoney(sale.AmountPaid - forfeited)
+
+	ctx := context.Background()
+	var grant *approvalGrant
+	if h.approvals.RefundThreshold > 0 && refund > h.approvals.RefundThreshold {
+		var err error
+		if grant, err = h.approvals.authorize(ctx, r, h.db, approvalScope{Operation: models.ApprovalRefund, SaleID: sale.ID.Hex(), Amount: refund}); err != nil {
+			writeUnitError(w, err, "Error checking approval")
+			return
+		}
+	}
+
+	openSale := sale
+	sale.Status = models.SaleCanceled
+	sale.Forfeited = forfeited
+	sale.RefundAmount = refund
+
+	eventTypes := []string{outbox.SaleCancelled}
+	if refund > 0 {
+		eventTypes = append(eventTypes, outbox.SaleRefunded)
+	}
+
+	db := h.db
+	err := h.store.Atomic(ctx, withApproval(db, grant, func(ctx context.Context) error {
+		err := h.store.Sales().Update(ctx, sale, openSale)
+		if err == store.ErrConflict {
+			return &requestError{status: http.StatusConflict, message: "Layaway is no longer open"}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := restoreSaleStock(ctx, db, openSale.ID.Hex(), openSale.Items, claims["sub"].(string), "Apartado cancelado"); err != nil {
+			return err
+		}
+		return writeSaleEvents(ctx, db, sale, eventTypes...)
+	}))
+	if err != nil {
+		writeUnitError(w, err, "Error canceling layaway")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sale)
+}
+
+// GetLayawayReport lista los apartados abiertos con su saldo pendiente
+func (h *LayawayHandler) GetLayawayReport(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "consultor" && userRole != "admin" {
+		http.Error(w, "Only consultants and admins can generate reports", http.StatusForbidden)
+		return
+	}
+
+	sales, err := h.store.Sales().List(context.Background(), store.SaleFilter{Status: models.SaleLayaway, OldestFirst: true})
+	if err != nil {
+		log.Printf("Error fetching layaways for report: %v", err)
+		http.Error(w, "Error fetching layaways", http.StatusInternalServerError)
+		return
+	}
+
+	type outstanding struct {
+		ID                   primitive.ObjectID `json:"id"`
+		SellerName           string             `json:"sellerName"`
+		TotalAmount          float64            `json:"totalAmount"`
+		AmountPaid           float64            `json:"amountPaid"`
+		Balance              float64            `json:"balance"`
+		CreatedAt            int64              `json:"createdAt"`
+		LastPaymentAt        int64              `json:"lastPaymentAt"`
+		DaysSinceLastPayment int                `json:"daysSinceLastPayment"`
+	}
+
+	response := struct {
+		TotalLayaways int           `json:"totalLayaways"`
+		TotalBalance  float64       `json:"totalBalance"`
+		TotalPaid     float64       `json:"totalPaid"`
+		Layaways      []outstanding `json:"layaways"`
+	}{Layaways: []outstanding{}}
+
+	now := time.Now()
+	for _, sale := range sales {
+		entry := outstanding{
+			ID:          sale.ID,
+			SellerName:  sale.SellerName,
+			TotalAmount: sale.TotalAmount,
+			AmountPaid:  sale.AmountPaid,
+			Balance:     sale.Balance,
+			CreatedAt:   sale.Timestamp,
+		}
+		for _, p := range sale.Payments {
+			if p.Timestamp > entry.LastPaymentAt {
+				entry.LastPaymentAt = p.Timestamp
+			}
+		}
+		if entry.LastPaymentAt > 0 {
+			entry.DaysSinceLastPayment = int(now.Sub(time.Unix(entry.LastPaymentAt, 0)).Hours() / 24)
+		}
+
+		response.TotalLayaways++
+		response.TotalBalance += sale.Balance
+		response.TotalPaid += sale.AmountPaid
+		response.Layaways = append(response.Layaways, entry)
+	}
+	response.TotalBalance = roundMoney(response.TotalBalance)
+	response.TotalPaid = roundMoney(response.TotalPaid)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding report response: %v", err)
+	}
+}
+
+// findLayaway obtiene el apartado de la URL y verifica que siga abierto
+func (h *LayawayHandler) findLayaway(w http.ResponseWriter, r *http.Request) (models.Sale, bool) {
+	var sale models.Sale
+
+	params := mux.Vars(r)
+	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return sale, false
+	}
+
+	sale, err = h.store.Sales().Get(context.Background(), saleID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+			return sale, false
+		}
+		log.Printf("Error fetching sale: %v", err)
+		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
+		return sale, false
+	}
+
+	if sale.Status != models.SaleLayaway {
+		http.Error(w, "Sale is not an open layaway", http.StatusConflict)
+		return sale, false
+	}
+
+	return sale, true
+}
+
+// roundMoney redondea a centavos para evitar residuos de punto flotante
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
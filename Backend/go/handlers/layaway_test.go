@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetLayawayReport(t *testing.T) {
+	env := newTestEnv(t)
+	handler := NewLayawayHandler(nil, env.store, 10, ApprovalPolicy{})
+
+	now := time.Now().Unix()
+	open := models.Sale{
+		ID: primitive.NewObjectID(), SellerName: "Ana", Status: models.SaleLayaway, Timestamp: now - 86400*10,
+		TotalAmount: 300, AmountPaid: 100, Balance: 200,
+		Payments: []models.SalePayment{{Amount: 60, Timestamp: now - 86400*10}, {Amount: 40, Timestamp: now - 86400*3}},
+	}
+	other := models.Sale{ID: primitive.NewObjectID(), SellerName: "Luis", Status: models.SaleLayaway, Timestamp: now, TotalAmount: 50, AmountPaid: 20.5, Balance: 29.5}
+	settled := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleCompleted, Timestamp: now, TotalAmount: 80, AmountPaid: 80}
+	for _, sale := range []models.Sale{open, other, settled} {
+		env.store.AddSale(sale)
+	}
+
+	w := serve(handler.GetLayawayReport, withToken(newRequest(t, http.MethodGet, "/layaways/report", nil, nil), "c@example.com", "consultor"))
+	expectStatus(t, w, http.StatusOK)
+
+	var report struct {
+		TotalLayaways int     `json:"totalLayaways"`
+		TotalBalance  float64 `json:"totalBalance"`
+		TotalPaid     float64 `json:"totalPaid"`
+		Layaways      []struct {
+			ID                   primitive.ObjectID `json:"id"`
+			LastPaymentAt        int64              `json:"lastPaymentAt"`
+			DaysSinceLastPayment int                `json:"daysSinceLastPayment"`
+		} `json:"layaways"`
+	}
+	decodeBody(t, w, &report)
+	if report.TotalLayaways != 2 || report.TotalBalance != 229.5 || report.TotalPaid != 120.5 {
+		t.Errorf("totals = %d, %v, %v; want 2, 229.5, 120.5", report.TotalLayaways, report.TotalBalance, report.TotalPaid)
+	}
+	if len(report.Layaways) != 2 || report.Layaways[0].ID != open.ID {
+		t.Fatalf("layaways = %+v, want the oldest first", report.Layaways)
+	}
+	if report.Layaways[0].LastPaymentAt != now-86400*3 || report.Layaways[0].DaysSinceLastPayment != 3 {
+		t.Errorf("last payment = %d (%d days), want the most recent one", report.Layaways[0].LastPaymentAt, report.Layaways[0].DaysSinceLastPayment)
+	}
+
+	w = serve(handler.GetLayawayReport, withToken(newRequest(t, http.MethodGet, "/layaways/report", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusForbidden)
+}
+
+func TestAddPaymentRequiresOpenLayaway(t *testing.T) {
+	env := newTestEnv(t)
+	handler := NewLayawayHandler(nil, env.store, 10, ApprovalPolicy{})
+	settled := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleCompleted, TotalAmount: 80, AmountPaid: 80}
+	env.store.AddSale(settled)
+
+	pay := func(id string) *http.Request {
+		r := newRequest(t, http.MethodPost, "/layaways/"+id+"/payments", paymentRequest{Amount: 10, Method: "cash"}, map[string]string{"id": id})
+		return withToken(r, "ana@example.com", "vendedor")
+	}
+	expectStatus(t, serve(handler.AddPayment, pay(settled.ID.Hex())), http.StatusConflict)
+	expectStatus(t, serve(handler.AddPayment, pay(primitive.NewObjectID().Hex())), http.StatusNotFound)
+}
@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/models"
+	"auth-service/uow"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errCustomerNotFound   = errors.New("customer not found")
+	errInsufficientPoints = errors.New("insufficient loyalty points")
+)
+
+// Reglas vigentes mientras el administrador no configure otras: un punto por
+// cada $10 pagados y cada punto vale $0.10 al redimirlo.
+var defaultLoyaltyRules = models.LoyaltyRules{
+	ID:                 "default",
+	PointsPerUnit:      0.1,
+	ProductMultipliers: map[string]float64{},
+	BrandMultipliers:   map[string]float64{},
+	PointValue:         0.1,
+	ExpiryDays:         365,
+}
+
+// LoyaltyHandler administra las reglas del programa de puntos
+type LoyaltyHandler struct {
+	collection *mongo.Collection
+}
+
+func NewLoyaltyHandler(collection *mongo.Collection) *LoyaltyHandler {
+	return &LoyaltyHandler{collection: collection}
+}
+
+// GetRules devuelve las reglas vigentes del programa de puntos
+func (h *LoyaltyHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := loadLoyaltyRules(context.Background(), h.collection.Database())
+	if err != nil {
+		log.Printf("Error fetching loyalty rules: %v", err)
+		http.Error(w, "Error fetching loyalty rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// UpdateRules reemplaza las reglas del programa de puntos. Los puntos ya
+// ganados conservan su vencimiento original.
+func (h *LoyaltyHandler) UpdateRules(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var rules models.LoyaltyRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if rules.PointsPerUnit < 0 || rules.PointValue < 0 || rules.ExpiryDays < 0 {
+		http.Error(w, "Rule values cannot be negative", http.StatusBadRequest)
+		return
+	}
+	for _, multipliers := range []map[string]float64{rules.ProductMultipliers, rules.BrandMultipliers} {
+		for _, multiplier := range multipliers {
+			if multiplier < 0 {
+				http.Error(w, "Multipliers cannot be negative", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if rules.ProductMultipliers == nil {
+		rules.ProductMultipliers = map[string]float64{}
+	}
+	if rules.BrandMultipliers == nil {
+		rules.BrandMultipliers = map[string]float64{}
+	}
+
+	rules.ID = defaultLoyaltyRules.ID
+	rules.UpdatedBy = claims["sub"].(string)
+	rules.UpdatedAt = time.Now().Unix()
+
+	_, err := h.collection.ReplaceOne(
+		context.Background(),
+		bson.M{"_id": rules.ID},
+		rules,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error saving loyalty rules: %v", err)
+		http.Error(w, "Error saving loyalty rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+func loadLoyaltyRules(ctx context.Context, db *mongo.Database) (models.LoyaltyRules, error) {
+	var rules models.LoyaltyRules
+	err := db.Collection("loyalty_rules").FindOne(ctx, bson.M{"_id": defaultLoyaltyRules.ID}).Decode(&rules)
+	if err == mongo.ErrNoDocuments {
+		return defaultLoyaltyRules, nil
+	}
+	return rules, err
+}
+
+// pointsToRedeem calcula los puntos que se cargan al cliente en una venta:
+// los del descuento solicitado más los usados como forma de pago. También
+// devuelve el monto del descuento.
+func pointsToRedeem(rules models.LoyaltyRules, customerID *primitive.ObjectID, discountPoints int, tenders []tenderRequest) (int, float64, error) {
+	if discountPoints < 0 {
+		return 0, 0, errors.New("Points to redeem must be greater than 0")
+	}
+
+	points := discountPoints
+	usesPoints := discountPoints > 0
+	for _, tender := range tenders {
+		if tender.Method != models.TenderLoyaltyPoints {
+			continue
+		}
+		usesPoints = true
+		if rules.PointValue <= 0 {
+			break
+		}
+
+		tenderPoints := int(math.Round(tender.Amount / rules.PointValue))
+		if math.Abs(float64(tenderPoints)*rules.PointValue-tender.Amount) >= 0.005 {
+			return 0, 0, errors.New("Points payment must be a multiple of the point value")
+		}
+		points += tenderPoints
+	}
+
+	if !usesPoints {
+		return 0, 0, nil
+	}
+	if customerID == nil {
+		return 0, 0, errors.New("A customer is required to redeem points")
+	}
+	if rules.PointValue <= 0 {
+		return 0, 0, errors.New("Point redemption is disabled")
+	}
+
+	return points, roundMoney(float64(discountPoints) * rules.PointValue), nil
+}
+
+// saleBrands obtiene del catálogo la marca de los productos de la venta que
+// no tienen multiplicador propio, sólo si las reglas usan multiplicadores por
+// marca. Se consulta antes de abrir la unidad de trabajo para no mantener la
+// transacción abierta durante las llamadas al catálogo.
+func saleBrands(ctx context.Context, catalogClient *catalog.Client, rules models.LoyaltyRules, items []models.SaleItem) map[string]string {
+	brands := make(map[string]string)
+	if len(rules.BrandMultipliers) == 0 || catalogClient == nil {
+		return brands
+	}
+
+	for _, item := range items {
+		if _, ok := rules.ProductMultipliers[item.ProductID]; ok {
+			continue
+		}
+		if _, ok := brands[item.ProductID]; ok {
+			continue
+		}
+		product, err := catalogClient.GetProduct(ctx, item.ProductID)
+		if err != nil && err != catalog.ErrProductNotFound {
+			log.Printf("Error fetching brand for product %s: %v", item.ProductID, err)
+		}
+		brand := ""
+		if err == nil {
+			brand = strconv.Itoa(product.IDMarca)
+		}
+		brands[item.ProductID] = brand
+	}
+	return brands
+}
+
+// salePointsEarned calcula los puntos que gana el cliente por una venta. Sólo
+// cuenta lo pagado: se excluyen el descuento y lo cubierto con puntos. brands
+// es la marca de cada producto (ver saleBrands).
+func salePointsEarned(rules models.LoyaltyRules, sale models.Sale, brands map[string]string) int {
+	itemsTotal := 0.0
+	for _, item := range sale.Items {
+		itemsTotal += item.Subtotal
+	}
+
+	paid := sale.TotalAmount
+	for _, payment := range sale.Payments {
+		if payment.Method == models.TenderLoyaltyPoints {
+			paid -= payment.Amount
+		}
+	}
+	if itemsTotal <= 0 || paid <= 0 || rules.PointsPerUnit <= 0 {
+		return 0
+	}
+	factor := paid / itemsTotal
+
+	points := 0.0
+	for _, item := range sale.Items {
+		multiplier := 1.0
+		if m, ok := rules.ProductMultipliers[item.ProductID]; ok {
+			multiplier = m
+		} else if m, ok := rules.BrandMultipliers[brands[item.ProductID]]; ok && brands[item.ProductID] != "" {
+			multiplier = m
+		}
+
+		points += item.Subtotal * factor * rules.PointsPerUnit * multiplier
+	}
+
+	return int(math.Floor(points + 1e-9))
+}
+
+// debitPoints descuenta puntos del saldo del cliente. El saldo se valida en el
+// filtro de la actualización para que dos ventas simultáneas no lo excedan.
+func debitPoints(ctx context.Context, db *mongo.Database, customerID primitive.ObjectID, points int, saleID, userID string) error {
+	// El saldo, los lotes y su registro en la bitácora se escriben juntos
+	return uow.Run(ctx, db, func(ctx context.Context) error {
+		customers := db.Collection("customers")
+
+		var customer models.Customer
+		err := customers.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": customerID, "pointsBalance": bson.M{"$gte": points}},
+			bson.M{"$inc": bson.M{"pointsBalance": -points}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&customer)
+		if err == mongo.ErrNoDocuments {
+			count, countErr := customers.CountDocuments(ctx, bson.M{"_id": customerID})
+			if countErr != nil {
+				return countErr
+			}
+			if count == 0 {
+				return errCustomerNotFound
+			}
+			return errInsufficientPoints
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := consumePointLots(ctx, db, customerID, points); err != nil {
+			log.Printf("Error consuming point lots for customer %s: %v", customerID.Hex(), err)
+		}
+
+		err = recordLoyaltyTransaction(ctx, db, models.LoyaltyTransaction{
+			CustomerID:   customerID,
+			Type:         models.LoyaltyRedeem,
+			Points:       -points,
+			BalanceAfter: customer.PointsBalance,
+			SaleID:       saleID,
+			UserID:       userID,
+		})
+		if err != nil {
+			log.Printf("Error recording redemption for customer %s: %v", customerID.Hex(), err)
+		}
+		return nil
+	})
+}
+
+// creditPoints abona puntos al cliente como un lote nuevo con su vencimiento
+func creditPoints(ctx context.Context, db *mongo.Database, rules models.LoyaltyRules, customerID primitive.ObjectID, points int, transactionType, saleID, userID string) error {
+	// El saldo y su registro en la bitácora se escriben juntos
+	return uow.Run(ctx, db, func(ctx context.Context) error {
+		var customer models.Customer
+		err := db.Collection("customers").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": customerID},
+			bson.M{"$inc": bson.M{"pointsBalance": points}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&customer)
+		if err == mongo.ErrNoDocuments {
+			return errCustomerNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		transaction := models.LoyaltyTransaction{
+			CustomerID:   customerID,
+			Type:         transactionType,
+			Points:       points,
+			BalanceAfter: customer.PointsBalance,
+			Remaining:    points,
+			SaleID:       saleID,
+			UserID:       userID,
+		}
+		if rules.ExpiryDays > 0 {
+			transaction.ExpiresAt = time.Now().AddDate(0, 0, rules.ExpiryDays).Unix()
+		}
+
+		if err := recordLoyaltyTransaction(ctx, db, transaction); err != nil {
+			log.Printf("Error recording points for customer %s: %v", customerID.Hex(), err)
+		}
+		return nil
+	})
+}
+
+// reverseSalePoints revierte los puntos de una venta eliminada: retira los
+// ganados (primero del lote de la propia venta) y devuelve los redimidos.
+func reverseSalePoints(ctx context.Context, db *mongo.Database, rules models.LoyaltyRules, sale models.Sale, userID string) error {
+	if sale.CustomerID == nil {
+		return nil
+	}
+	customerID := *sale.CustomerID
+	saleID := sale.ID.Hex()
+
+	if sale.PointsEarned > 0 {
+		// Si el cliente ya gastó esos puntos el saldo puede quedar negativo
+		var customer models.Customer
+		err := db.Collection("customers").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": customerID},
+			bson.M{"$inc": bson.M{"pointsBalance": -sale.PointsEarned}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&customer)
+		if err != nil {
+			return err
+		}
+
+		pending := sale.PointsEarned
+		var lot models.LoyaltyTransaction
+		err = db.Collection("loyalty_transactions").FindOneAndUpdate(
+			ctx,
+			bson.M{"customerId": customerID, "saleId": saleID, "type": models.LoyaltyEarn},
+			bson.M{"$set": bson.M{"remaining": 0}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&lot)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if err == nil {
+			if lot.Remaining > pending {
+				// Conservar lo que sobra del lote
+				if _, err := db.Collection("loyalty_transactions").UpdateOne(ctx, bson.M{"_id": lot.ID}, bson.M{"$inc": bson.M{"remaining": lot.Remaining - pending}}); err != nil {
+					return err
+				}
+				pending = 0
+			} else {
+				pending -= lot.Remaining
+			}
+		}
+		if err := consumePointLots(ctx, db, customerID, pending); err != nil {
+			return err
+		}
+
+		err = recordLoyaltyTransaction(ctx, db, models.LoyaltyTransaction{
+			CustomerID:   customerID,
+			Type:         models.LoyaltyEarnReversal,
+			Points:       -sale.PointsEarned,
+			BalanceAfter: customer.PointsBalance,
+			SaleID:       saleID,
+			UserID:       userID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if sale.PointsRedeemed > 0 {
+		return creditPoints(ctx, db, rules, customerID, sale.PointsRedeemed, models.LoyaltyRedeemReversal, saleID, userID)
+	}
+	return nil
+}
+
+// consumePointLots descuenta puntos de los lotes disponibles del cliente,
+// empezando por los que vencen primero.
+func consumePointLots(ctx context.Context, db *mongo.Database, customerID primitive.ObjectID, points int) error {
+	if points <= 0 {
+		return nil
+	}
+
+	transactions := db.Collection("loyalty_transactions")
+	cursor, err := transactions.Find(
+		ctx,
+		bson.M{"customerId": customerID, "remaining": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "expiresAt", Value: 1}, {Key: "timestamp", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) && points > 0 {
+		var lot models.LoyaltyTransaction
+		if err := cursor.Decode(&lot); err != nil {
+			return err
+		}
+
+		take := lot.Remaining
+		if take > points {
+			take = points
+		}
+		result, err := transactions.UpdateOne(
+			ctx,
+			bson.M{"_id": lot.ID, "remaining": bson.M{"$gte": take}},
+			bson.M{"$inc": bson.M{"remaining": -take}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount > 0 {
+			points -= take
+		}
+	}
+
+	return cursor.Err()
+}
+
+func recordLoyaltyTransaction(ctx context.Context, db *mongo.Database, transaction models.LoyaltyTransaction) error {
+	transaction.ID = primitive.NewObjectID()
+	transaction.Timestamp = time.Now().Unix()
+
+	_, err := db.Collection("loyalty_transactions").InsertOne(ctx, transaction)
+	return err
+}
+
+// writeLoyaltyError traduce los errores de puntos a la respuesta HTTP
+func writeLoyaltyError(w http.ResponseWriter, err error) {
+	switch err {
+	case errCustomerNotFound:
+		http.Error(w, "Customer not found", http.StatusBadRequest)
+	case errInsufficientPoints:
+		http.Error(w, "Customer does not have enough points", http.StatusConflict)
+	default:
+		log.Printf("Error redeeming points: %v", err)
+		http.Error(w, "Error redeeming points", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"testing"
+)
+
+func TestSalePointsEarned(t *testing.T) {
+	rules := models.LoyaltyRules{
+		PointsPerUnit:      0.1,
+		ProductMultipliers: map[string]float64{"p1": 2},
+		BrandMultipliers:   map[string]float64{"7": 3},
+	}
+	sale := models.Sale{
+		Items: []models.SaleItem{
+			{ProductID: "p1", Subtotal: 100}, // multiplicador del producto
+			{ProductID: "p2", Subtotal: 100}, // multiplicador de la marca 7
+			{ProductID: "p3", Subtotal: 100}, // sin marca conocida
+		},
+		TotalAmount: 300,
+	}
+	brands := map[string]string{"p2": "7", "p3": ""}
+
+	if got := salePointsEarned(rules, sale, brands); got != 60 {
+		t.Errorf("salePointsEarned() = %d, want 60", got)
+	}
+
+	// Lo pagado con puntos no genera puntos
+	sale.Payments = []models.SalePayment{{Method: models.TenderLoyaltyPoints, Amount: 150}}
+	if got := salePointsEarned(rules, sale, brands); got != 30 {
+		t.Errorf("salePointsEarned() with points payment = %d, want 30", got)
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxHandler permite revisar los eventos del outbox y reintentar los que
+// agotaron sus intentos
+type OutboxHandler struct {
+	collection *mongo.Collection
+}
+
+func NewOutboxHandler(collection *mongo.Collection) *OutboxHandler {
+	return &OutboxHandler{collection: collection}
+}
+
+// ListEvents lista los eventos más recientes (?status=&type=&limit=)
+func (h *OutboxHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	if status := query.Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if eventType := query.Get("type"); eventType != "" {
+		filter["type"] = eventType
+	}
+
+	limit, err := queryInt(r, "limit", 100)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := h.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		log.Printf("Error fetching outbox events: %v", err)
+		http.Error(w, "Error fetching events", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.OutboxEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		log.Printf("Error reading outbox events: %v", err)
+		http.Error(w, "Error reading events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// RetryEvent vuelve a poner en la cola un evento que agotó sus intentos. Los
+// destinos que ya lo recibieron no se repiten.
+func (h *OutboxHandler) RetryEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	var event models.OutboxEvent
+	err = h.collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": id, "status": models.OutboxFailed},
+		bson.M{"$set": bson.M{"status": models.OutboxPending, "attempts": 0, "nextAttemptAt": time.Now().Unix()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Event not found or not failed", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error retrying outbox event: %v", err)
+		http.Error(w, "Error retrying event", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(event)
+}
+
+// writeSaleEvents guarda los eventos de la venta en el outbox. Se llama dentro
+// de la misma unidad de trabajo que escribe la venta: si el proceso cae después
+// de escribirla, el despachador aún publica los efectos posteriores (puntos,
+// webhooks, SSE).
+func writeSaleEvents(ctx context.Context, db *mongo.Database, sale models.Sale, eventTypes ...string) error {
+	for _, eventType := range eventTypes {
+		var data interface{} = sale
+		if eventType == outbox.SaleRefunded {
+			data = map[string]interface{}{"sale": sale, "amount": refundedAmount(sale)}
+		}
+		if err := outbox.Write(ctx, db, eventType, sale.ID.Hex(), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundedAmount es lo que se devuelve al cliente: el total de una venta
+// completada, lo abonado a un apartado eliminado o, en uno cancelado, lo
+// abonado menos la penalización
+func refundedAmount(sale models.Sale) float64 {
+	switch sale.Status {
+	case models.SaleLayaway:
+		return sale.AmountPaid
+	case models.SaleCanceled:
+		return sale.RefundAmount
+	}
+	return sale.TotalAmount
+}
+
+// LoyaltySink abona los puntos ganados en una venta completada. Antes de abonar
+// revisa que la venta siga completada y que sus puntos no estén ya en la
+// bitácora, porque el outbox puede entregar el mismo evento más de una vez.
+type LoyaltySink struct {
+	db    *mongo.Database
+	store store.Store
+}
+
+func NewLoyaltySink(db *mongo.Database, s store.Store) *LoyaltySink {
+	return &LoyaltySink{db: db, store: s}
+}
+
+func (s *LoyaltySink) Name() string { return "loyalty" }
+
+func (s *LoyaltySink) Handles(eventType string) bool { return eventType == outbox.SaleCompleted }
+
+func (s *LoyaltySink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	var sale models.Sale
+	if err := json.Unmarshal([]byte(event.Payload), &sale); err != nil {
+		return err
+	}
+	if sale.CustomerID == nil || sale.PointsEarned <= 0 {
+		return nil
+	}
+
+	rules, err := loadLoyaltyRules(ctx, s.db)
+	if err != nil {
+		return err
+	}
+
+	// La revisión y el abono van en una unidad de trabajo: dos despachadores
+	// que publican el mismo evento chocan al escribir el saldo del cliente
+	return s.store.Atomic(ctx, func(ctx context.Context) error {
+		// Una venta eliminada antes de publicar el evento ya no abona puntos
+		current, err := s.store.Sales().Get(ctx, sale.ID)
+		if err == store.ErrNotFound || (err == nil && current.Status != models.SaleCompleted) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		credited, err := s.db.Collection("loyalty_transactions").CountDocuments(ctx, bson.M{"saleId": sale.ID.Hex(), "type": models.LoyaltyEarn})
+		if err != nil {
+			return err
+		}
+		if credited > 0 {
+			return nil
+		}
+
+		err = creditPoints(ctx, s.db, rules, *sale.CustomerID, sale.PointsEarned, models.LoyaltyEarn, sale.ID.Hex(), sale.SellerID)
+		if err == errCustomerNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+// CatalogCostSink lleva al catálogo el costo de compra que calculó una
+// recepción. Envía el costo vigente en el inventario y no el del evento, así
+// un reintento atrasado no pisa un costo más reciente.
+type CatalogCostSink struct {
+	db      *mongo.Database
+	catalog *catalog.Client
+}
+
+func NewCatalogCostSink(db *mongo.Database, catalogClient *catalog.Client) *CatalogCostSink {
+	return &CatalogCostSink{db: db, catalog: catalogClient}
+}
+
+func (s *CatalogCostSink) Name() string { return "catalog" }
+
+func (s *CatalogCostSink) Handles(eventType string) bool {
+	return eventType == outbox.ProductCostUpdated
+}
+
+func (s *CatalogCostSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	var change productCostChange
+	if err := json.Unmarshal([]byte(event.Payload), &change); err != nil {
+		return err
+	}
+
+	var item models.InventoryItem
+	err := s.db.Collection("inventory").FindOne(ctx, bson.M{"productId": change.ProductID}).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Un producto que ya no está activo en el catálogo no se actualiza
+	if _, err := s.catalog.GetProduct(ctx, change.ProductID); err != nil {
+		if err == catalog.ErrProductNotFound {
+			return nil
+		}
+		return err
+	}
+
+	err = s.catalog.UpdatePurchasePrice(ctx, change.ProductID, item.PrecioCompra)
+	if err == catalog.ErrProductNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/uow"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type PurchaseOrderHandler struct {
+	collection    *mongo.Collection
+	costingMethod string
+}
+
+func NewPurchaseOrderHandler(collection *mongo.Collection, costingMethod string) *PurchaseOrderHandler {
+	if costingMethod != models.CostingLastCost {
+		costingMethod = models.CostingWeightedAverage
+	}
+	return &PurchaseOrderHandler{collection: collection, costingMethod: costingMethod}
+}
+
+type purchaseOrderRequest struct {
+	SupplierID string                     `json:"supplierId"`
+	Notes      string                     `json:"notes"`
+	Items      []purchaseOrderRequestItem `json:"items"`
+}
+
+type purchaseOrderRequestItem struct {
+	ProductID   string  `json:"productId"`
+	ProductName string  `json:"productName"`
+	Quantity    int     `json:"quantity"`
+	UnitCost    float64 `json:"unitCost"`
+}
+
+type receiveRequest struct {
+	Items []models.GoodsReceiptItem `json:"items"`
+}
+
+// CreatePurchaseOrder registra una orden de compra en estado borrador
+func (h *PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var req purchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	supplierID, err := primitive.ObjectIDFromHex(req.SupplierID)
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Purchase order must contain at least one item", http.StatusBadRequest)
+		return
+	}
+
+	// Validar el proveedor
+	suppliersCollection := h.collection.Database().Collection("suppliers")
+	var supplier models.Supplier
+	err = suppliersCollection.FindOne(context.Background(), bson.M{"_id": supplierID}).Decode(&supplier)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Invalid supplier", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Error validating supplier", http.StatusInternalServerError)
+		return
+	}
+
+	if !supplier.Active {
+		http.Error(w, "Supplier is inactive", http.StatusBadRequest)
+		return
+	}
+
+	items, totalAmount, err := purchaseOrderItems(req.Items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	order := models.PurchaseOrder{
+		ID:           primitive.NewObjectID(),
+		SupplierID:   supplier.ID,
+		SupplierName: supplier.Name,
+		Items:        items,
+		TotalAmount:  totalAmount,
+		Notes:        req.Notes,
+		Status:       models.PurchaseOrderDraft,
+		Receipts:     []models.GoodsReceipt{},
+		CreatedBy:    claims["sub"].(string),
+		CreatedAt:    time.Now().Unix(),
+	}
+
+	if _, err := h.collection.InsertOne(context.Background(), order); err != nil {
+		log.Printf("Error inserting purchase order: %v", err)
+		http.Error(w, "Error creating purchase order", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// purchaseOrderItems valida las partidas de una orden nueva y calcula su total.
+// Cada producto va en una sola partida: la recepción las busca por producto.
+func purchaseOrderItems(requested []purchaseOrderRequestItem) ([]models.PurchaseOrderItem, float64, error) {
+	var items []models.PurchaseOrderItem
+	seen := make(map[string]bool)
+	totalAmount := 0.0
+	for _, item := range requested {
+		if item.ProductID == "" {
+			return nil, 0, errors.New("Product ID is required")
+		}
+		if seen[item.ProductID] {
+			return nil, 0, fmt.Errorf("Product %s appears more than once in the purchase order", item.ProductID)
+		}
+		seen[item.ProductID] = true
+		if item.Quantity <= 0 {
+			return nil, 0, errors.New("Quantity must be greater than 0")
+		}
+		if item.UnitCost <= 0 {
+			return nil, 0, errors.New("Unit cost must be greater than 0")
+		}
+
+		items = append(items, models.PurchaseOrderItem{
+			ProductID:       item.ProductID,
+			ProductName:     item.ProductName,
+			QuantityOrdered: item.Quantity,
+			UnitCost:        item.UnitCost,
+		})
+		totalAmount += item.UnitCost * float64(item.Quantity)
+	}
+	return items, totalAmount, nil
+}
+
+// ListPurchaseOrders lista las órdenes de compra, opcionalmente por estado o proveedor
+func (h *PurchaseOrderHandler) ListPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	if supplier := r.URL.Query().Get("supplierId"); supplier != "" {
+		supplierID, err := primitive.ObjectIDFromHex(supplier)
+		if err != nil {
+			http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+			return
+		}
+		filter["supplierId"] = supplierID
+	}
+
+	cursor, err := h.collection.Find(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error fetching purchase orders: %v", err)
+		http.Error(w, "Error fetching purchase orders", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var orders []models.PurchaseOrder
+	if err = cursor.All(context.Background(), &orders); err != nil {
+		http.Error(w, "Error reading purchase orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetPurchaseOrder obtiene una orden de compra por ID
+func (h *PurchaseOrderHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	order, ok := h.findOrder(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// ApprovePurchaseOrder aprueba una orden en borrador para poder recibirla
+func (h *PurchaseOrderHandler) ApprovePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	order, ok := h.findOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status != models.PurchaseOrderDraft {
+		http.Error(w, "Only draft purchase orders can be approved", http.StatusConflict)
+		return
+	}
+
+	order.Status = models.PurchaseOrderApproved
+	order.ApprovedBy = claims["sub"].(string)
+	order.ApprovedAt = time.Now().Unix()
+
+	result, err := h.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": order.ID, "status": models.PurchaseOrderDraft},
+		bson.M{"$set": bson.M{
+			"status":     order.Status,
+			"approvedBy": order.ApprovedBy,
+			"approvedAt": order.ApprovedAt,
+		}},
+	)
+	if err != nil {
+		log.Printf("Error approving purchase order: %v", err)
+		http.Error(w, "Error approving purchase order", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		http.Error(w, "Purchase order was modified concurrently", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// ReceivePurchaseOrder registra una recepción parcial o total de mercancía,
+// suma las unidades al inventario y actualiza el precio de compra.
+func (h *PurchaseOrderHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	order, ok := h.findOrder(w, r)
+	if !ok {
+		return
+	}
+
+	if order.Status != models.PurchaseOrderApproved && order.Status != models.PurchaseOrderPartiallyReceived {
+		http.Error(w, "Purchase order is not open for receiving", http.StatusConflict)
+		return
+	}
+
+	var req receiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Receipt must contain at least one item", http.StatusBadRequest)
+		return
+	}
+
+	// Validar cantidades contra lo pendiente de cada partida
+	lines := make(map[string]int)
+	for i, item := range order.Items {
+		lines[item.ProductID] = i
+	}
+
+	previousItems := append([]models.PurchaseOrderItem(nil), order.Items...)
+	var receiptItems []models.GoodsReceiptItem
+	for _, item := range req.Items {
+		idx, found := lines[item.ProductID]
+		if !found {
+			http.Error(w, "Product "+item.ProductID+" is not part of this purchase order", http.StatusBadRequest)
+			return
+		}
+		if item.Quantity <= 0 {
+			http.Error(w, "Quantity must be greater than 0", http.StatusBadRequest)
+			return
+		}
+
+		line := &order.Items[idx]
+		if line.QuantityReceived+item.Quantity > line.QuantityOrdered {
+			http.Error(w, "Received quantity exceeds ordered quantity for product "+item.ProductID, http.StatusBadRequest)
+			return
+		}
+
+		// Si no se indica costo se usa el pactado en la orden
+		if item.UnitCost <= 0 {
+			item.UnitCost = line.UnitCost
+		}
+
+		line.QuantityReceived += item.Quantity
+		receiptItems = append(receiptItems, item)
+	}
+
+	previousStatus := order.Status
+	order.Status = models.PurchaseOrderReceived
+	for _, item := range order.Items {
+		if item.QuantityReceived < item.QuantityOrdered {
+			order.Status = models.PurchaseOrderPartiallyReceived
+			break
+		}
+	}
+
+	receipt := models.GoodsReceipt{
+		Items:      receiptItems,
+		ReceivedBy: claims["sub"].(string),
+		ReceivedAt: time.Now().Unix(),
+	}
+	order.Receipts = append(order.Receipts, receipt)
+
+	// La recepción y las existencias que suma se registran juntas
+	ctx := context.Background()
+	db := h.collection.Database()
+	err := uow.Run(ctx, db, func(ctx context.Context) error {
+		result, err := h.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": order.ID, "status": previousStatus, "receipts": bson.M{"$size": len(order.Receipts) - 1}},
+			bson.M{
+				"$set":  bson.M{"items": order.Items, "status": order.Status},
+				"$push": bson.M{"receipts": receipt},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return &requestError{status: http.StatusConflict, message: "Purchase order was modified concurrently"}
+		}
+
+		// Actualizar existencias y costo de cada producto recibido
+		var received []models.GoodsReceiptItem
+		for _, item := range receiptItems {
+			line := order.Items[lines[item.ProductID]]
+			movement := models.InventoryMovement{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Reference: models.MovementReference{Type: "purchase_order", ID: order.ID.Hex()},
+				UserID:    receipt.ReceivedBy,
+				Timestamp: receipt.ReceivedAt,
+			}
+			if err := receiveStock(ctx, db, movement, line.ProductName, item.UnitCost, h.costingMethod); err != nil {
+				compensate(ctx, "reverting purchase order receipt", func() error {
+					return h.revertReceipt(ctx, order.ID, previousStatus, previousItems, received, receipt)
+				})
+				return err
+			}
+			received = append(received, item)
+		}
+		return nil
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error receiving purchase order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
+// revertReceipt deshace una recepción que falló a medias sin transacción:
+// retira las unidades que alcanzó a sumar y regresa la orden a como estaba
+func (h *PurchaseOrderHandler) revertReceipt(ctx context.Context, orderID primitive.ObjectID, status string, items []models.PurchaseOrderItem, received []models.GoodsReceiptItem, receipt models.GoodsReceipt) error {
+	db := h.collection.Database()
+	for _, item := range received {
+		_, err := applyMovement(ctx, db, models.InventoryMovement{
+			ProductID: item.ProductID,
+			Type:      models.MovementAdjustment,
+			Quantity:  -item.Quantity,
+			Reason:    "Recepción no registrada",
+			Reference: models.MovementReference{Type: "purchase_order", ID: orderID.Hex()},
+			UserID:    receipt.ReceivedBy,
+		}, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := h.collection.UpdateOne(ctx, bson.M{"_id": orderID}, bson.M{
+		"$set": bson.M{"items": items, "status": status},
+		"$pop": bson.M{"receipts": 1},
+	})
+	return err
+}
+
+// GetOpenPurchaseOrdersReport resume las órdenes aprobadas con mercancía pendiente
+func (h *PurchaseOrderHandler) GetOpenPurchaseOrdersReport(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "consultor" && userRole != "admin" {
+		http.Error(w, "Only consultants and admins can generate reports", http.StatusForbidden)
+		return
+	}
+
+	filter := bson.M{"status": bson.M{"$in": []string{
+		models.PurchaseOrderApproved,
+		models.PurchaseOrderPartiallyReceived,
+	}}}
+	if supplier := r.URL.Query().Get("supplierId"); supplier != "" {
+		supplierID, err := primitive.ObjectIDFromHex(supplier)
+		if err != nil {
+			http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+			return
+		}
+		filter["supplierId"] = supplierID
+	}
+
+	cursor, err := h.collection.Find(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error fetching purchase orders for report: %v", err)
+		http.Error(w, "Error fetching purchase orders", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var orders []models.PurchaseOrder
+	if err = cursor.All(context.Background(), &orders); err != nil {
+		http.Error(w, "Error reading purchase orders", http.StatusInternalServerError)
+		return
+	}
+
+	type openOrder struct {
+		ID              primitive.ObjectID `json:"id"`
+		SupplierName    string             `json:"supplierName"`
+		Status          string             `json:"status"`
+		CreatedAt       int64              `json:"createdAt"`
+		PendingUnits    int                `json:"pendingUnits"`
+		PendingAmount   float64            `json:"pendingAmount"`
+		ReceivedPercent float64            `json:"receivedPercent"`
+	}
+
+	response := struct {
+		TotalOrders   int         `json:"totalOrders"`
+		PendingUnits  int         `json:"pendingUnits"`
+		PendingAmount float64     `json:"pendingAmount"`
+		Orders        []openOrder `json:"orders"`
+	}{Orders: []openOrder{}}
+
+	for _, order := range orders {
+		entry := openOrder{
+			ID:           order.ID,
+			SupplierName: order.SupplierName,
+			Status:       order.Status,
+			CreatedAt:    order.CreatedAt,
+		}
+
+		ordered, received := 0, 0
+		for _, item := range order.Items {
+			pending := item.QuantityOrdered - item.QuantityReceived
+			entry.PendingUnits += pending
+			entry.PendingAmount += float64(pending) * item.UnitCost
+			ordered += item.QuantityOrdered
+			received += item.QuantityReceived
+		}
+		if ordered > 0 {
+			entry.ReceivedPercent = float64(received) * 100 / float64(ordered)
+		}
+
+		response.TotalOrders++
+		response.PendingUnits += entry.PendingUnits
+		response.PendingAmount += entry.PendingAmount
+		response.Orders = append(response.Orders, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Error encoding report response: %v", err)
+	}
+}
+
+// findOrder obtiene la orden indicada en la URL y responde el error si no existe
+func (h *PurchaseOrderHandler) findOrder(w http.ResponseWriter, r *http.Request) (models.PurchaseOrder, bool) {
+	var order models.PurchaseOrder
+
+	params := mux.Vars(r)
+	orderID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return order, false
+	}
+
+	err = h.collection.FindOne(context.Background(), bson.M{"_id": orderID}).Decode(&order)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Purchase order not found", http.StatusNotFound)
+			return order, false
+		}
+		log.Printf("Error fetching purchase order: %v", err)
+		http.Error(w, "Error fetching purchase order", http.StatusInternalServerError)
+		return order, false
+	}
+
+	return order, true
+}
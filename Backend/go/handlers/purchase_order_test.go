@@ -0,0 +1,31 @@
+package handlers
+
+import "testing"
+
+func TestPurchaseOrderItems(t *testing.T) {
+	items, total, err := purchaseOrderItems([]purchaseOrderRequestItem{
+		{ProductID: "p1", Quantity: 2, UnitCost: 10},
+		{ProductID: "p2", Quantity: 1, UnitCost: 5.5},
+	})
+	if err != nil {
+		t.Fatalf("purchaseOrderItems() error: %v", err)
+	}
+	if len(items) != 2 || items[0].QuantityOrdered != 2 || items[1].UnitCost != 5.5 {
+		t.Errorf("items = %+v", items)
+	}
+	if total != 25.5 {
+		t.Errorf("total = %v, want 25.5", total)
+	}
+
+	invalid := map[string][]purchaseOrderRequestItem{
+		"missing product":  {{Quantity: 1, UnitCost: 1}},
+		"repeated product": {{ProductID: "p1", Quantity: 1, UnitCost: 1}, {ProductID: "p1", Quantity: 3, UnitCost: 1}},
+		"zero quantity":    {{ProductID: "p1", UnitCost: 1}},
+		"zero cost":        {{ProductID: "p1", Quantity: 1}},
+	}
+	for name, requested := range invalid {
+		if _, _, err := purchaseOrderItems(requested); err == nil {
+			t.Errorf("%s: purchaseOrderItems() = nil error", name)
+		}
+	}
+}
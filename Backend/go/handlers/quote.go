@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"auth-service/catalog"
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultQuoteValidityDays = 15
+
+type QuoteHandler struct {
+	collection *mongo.Collection
+	store      store.Store
+	catalog    *catalog.Client
+}
+
+func NewQuoteHandler(collection *mongo.Collection, s store.Store, catalogClient *catalog.Client) *QuoteHandler {
+	return &QuoteHandler{collection: collection, store: s, catalog: catalogClient}
+}
+
+type quoteRequest struct {
+	Items         []saleRequestItem `json:"items"`
+	CustomerName  string            `json:"customerName"`
+	CustomerEmail string            `json:"customerEmail"`
+	Notes         string            `json:"notes"`
+	ValidUntil    string            `json:"validUntil"` // YYYY-MM-DD
+}
+
+type priceChange struct {
+	ProductID    string  `json:"productId"`
+	ProductName  string  `json:"productName"`
+	QuotedPrice  float64 `json:"quotedPrice"`
+	CurrentPrice float64 `json:"currentPrice"`
+}
+
+// CreateQuote registra una cotización para un cliente
+func (h *QuoteHandler) CreateQuote(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	userRole, ok := claims["role"].(string)
+	if !ok || userRole != "vendedor" {
+		http.Error(w, "Only sellers can create quotes", http.StatusForbidden)
+		return
+	}
+
+	sellerName, ok := claims["name"].(string)
+	if !ok {
+		sellerName = "Unknown"
+	}
+
+	var req quoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Items) == 0 {
+		http.Error(w, "Quote must contain at least one item", http.StatusBadRequest)
+		return
+	}
+	if req.CustomerName == "" {
+		http.Error(w, "Customer name is required", http.StatusBadRequest)
+		return
+	}
+
+	items, totalAmount, err := buildSaleItems(req.Items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	validUntil := now.AddDate(0, 0, defaultQuoteValidityDays)
+	if req.ValidUntil != "" {
+		date, err := time.Parse("2006-01-02", req.ValidUntil)
+		if err != nil {
+			http.Error(w, "Invalid validUntil date format (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		// La cotización vale hasta el final del día indicado
+		validUntil = date.Add(24*time.Hour - time.Second)
+		if validUntil.Before(now) {
+			http.Error(w, "Validity date must be in the future", http.StatusBadRequest)
+			return
+		}
+	}
+
+	quote := models.Quote{
+		ID:            primitive.NewObjectID(),
+		Items:         items,
+		TotalAmount:   totalAmount,
+		CustomerName:  req.CustomerName,
+		CustomerEmail: req.CustomerEmail,
+		Notes:         req.Notes,
+		SellerID:      claims["sub"].(string),
+		SellerName:    sellerName,
+		CreatedAt:     now.Unix(),
+		ValidUntil:    validUntil.Unix(),
+		Status:        models.QuoteOpen,
+	}
+
+	if _, err := h.collection.InsertOne(context.Background(), quote); err != nil {
+		log.Printf("Error inserting quote: %v", err)
+		http.Error(w, "Error creating quote", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quote)
+}
+
+// GetQuotes lista las cotizaciones del vendedor autenticado
+func (h *QuoteHandler) GetQuotes(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" {
+		http.Error(w, "Only sellers can view quotes", http.StatusForbidden)
+		return
+	}
+
+	filter := bson.M{"sellerId": claims["sub"].(string)}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := h.collection.Find(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error fetching quotes: %v", err)
+		http.Error(w, "Error fetching quotes", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	quotes := []models.Quote{}
+	if err = cursor.All(context.Background(), &quotes); err != nil {
+		http.Error(w, "Error reading quotes", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotes)
+}
+
+// GetQuote obtiene una cotización del vendedor autenticado
+func (h *QuoteHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.findQuote(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+var quoteTemplate = template.Must(template.New("quote").Funcs(template.FuncMap{
+	"date":  func(ts int64) string { return time.Unix(ts, 0).Format("02/01/2006") },
+	"money": func(amount float64) string { return formatMoney(amount) },
+}).Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>Cotización {{.ID.Hex}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ccc; padding: 6px; text-align: left; }
+td.num, th.num { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Cotización</h1>
+<p>Folio: {{.ID.Hex}}<br>
+Fecha: {{date .CreatedAt}}<br>
+Válida hasta: {{date .ValidUntil}}<br>
+Cliente: {{.CustomerName}}<br>
+Atendió: {{.SellerName}}</p>
+<table>
+<tr><th>Producto</th><th class="num">Cantidad</th><th class="num">Precio unitario</th><th class="num">Importe</th></tr>
+{{range .Items}}<tr><td>{{.ProductName}}</td><td class="num">{{.Quantity}}</td><td class="num">{{money .UnitPrice}}</td><td class="num">{{money .Subtotal}}</td></tr>
+{{end}}<tr><th colspan="3" class="num">Total</th><th class="num">{{money .TotalAmount}}</th></tr>
+</table>
+{{if .Notes}}<p>{{.Notes}}</p>{{end}}
+<p>Precios sujetos a cambio y a disponibilidad al momento de la compra.</p>
+</body>
+</html>
+`))
+
+// PrintQuote devuelve la cotización en HTML listo para imprimir
+func (h *QuoteHandler) PrintQuote(w http.ResponseWriter, r *http.Request) {
+	quote, ok := h.findQuote(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := quoteTemplate.Execute(w, quote); err != nil {
+		log.Printf("Error rendering quote: %v", err)
+	}
+}
+
+// ConvertQuote convierte una cotización vigente en venta. Los precios se
+// validan contra el catálogo y las existencias se descuentan en ese momento;
+// si algún precio cambió se rechaza salvo que se acepten los precios actuales.
+func (h *QuoteHandler) ConvertQuote(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	quote, ok := h.findQuote(w, r)
+	if !ok {
+		return
+	}
+
+	if quote.Status != models.QuoteOpen {
+		http.Error(w, "Quote was already converted", http.StatusConflict)
+		return
+	}
+	if time.Now().Unix() > quote.ValidUntil {
+		http.Error(w, "Quote has expired", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		AcceptPriceChanges bool `json:"acceptPriceChanges"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := context.Background()
+
+	// Revalidar precios contra el catálogo
+	var changes []priceChange
+	var requestItems []saleRequestItem
+	for _, item := range quote.Items {
+		product, err := h.catalog.GetProduct(ctx, item.ProductID)
+		if err != nil {
+			if err == catalog.ErrProductNotFound {
+				http.Error(w, "Product "+item.ProductID+" is no longer available", http.StatusConflict)
+				return
+			}
+			log.Printf("Error fetching product %s from catalog: %v", item.ProductID, err)
+			http.Error(w, "Error validating prices", http.StatusBadGateway)
+			return
+		}
+
+		currentPrice := float64(product.PrecioVenta)
+		if roundMoney(currentPrice) != roundMoney(item.UnitPrice) {
+			changes = append(changes, priceChange{
+				ProductID:    item.ProductID,
+				ProductName:  item.ProductName,
+				QuotedPrice:  item.UnitPrice,
+				CurrentPrice: currentPrice,
+			})
+		}
+
+		requestItems = append(requestItems, saleRequestItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   currentPrice,
+		})
+	}
+
+	if len(changes) > 0 && !req.AcceptPriceChanges {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":        "Prices changed since the quote was issued",
+			"priceChanges": changes,
+		})
+		return
+	}
+
+	saleItems, totalAmount, err := buildSaleItems(requestItems)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	sellerID := claims["sub"].(string)
+	sellerName, ok := claims["name"].(string)
+	if !ok {
+		sellerName = quote.SellerName
+	}
+
+	sale := models.Sale{
+		ID:          primitive.NewObjectID(),
+		Items:       saleItems,
+		TotalAmount: totalAmount,
+		SellerID:    sellerID,
+		SellerName:  sellerName,
+		Timestamp:   time.Now().Unix(),
+		Status:      models.SaleCompleted,
+	}
+
+	db := h.collection.Database()
+	err = h.store.Atomic(ctx, func(ctx context.Context) error {
+		// Marcar la cotización antes de vender para que no se convierta dos veces
+		result, err := h.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": quote.ID, "status": models.QuoteOpen},
+			bson.M{"$set": bson.M{"status": models.QuoteConverted, "saleId": sale.ID}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return &requestError{status: http.StatusConflict, message: "Quote was already converted"}
+		}
+
+		reopenQuote := func() error {
+			_, err := h.collection.UpdateOne(ctx, bson.M{"_id": quote.ID}, bson.M{
+				"$set":   bson.M{"status": models.QuoteOpen},
+				"$unset": bson.M{"saleId": ""},
+			})
+			return err
+		}
+
+		if err := consumeSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID); err != nil {
+			compensate(ctx, "reopening quote "+quote.ID.Hex(), reopenQuote)
+			return err
+		}
+
+		if err := h.store.Sales().Insert(ctx, sale); err != nil {
+			compensate(ctx, "restoring stock", func() error {
+				return restoreSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID, "Venta no registrada")
+			})
+			compensate(ctx, "reopening quote "+quote.ID.Hex(), reopenQuote)
+			return err
+		}
+		return writeSaleEvents(ctx, db, sale, outbox.SaleCreated, outbox.SaleCompleted)
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error converting quote")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sale)
+}
+
+// findQuote obtiene la cotización de la URL si pertenece al vendedor autenticado
+func (h *QuoteHandler) findQuote(w http.ResponseWriter, r *http.Request) (models.Quote, bool) {
+	var quote models.Quote
+
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" {
+		http.Error(w, "Only sellers can access quotes", http.StatusForbidden)
+		return quote, false
+	}
+
+	params := mux.Vars(r)
+	quoteID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
+		return quote, false
+	}
+
+	err = h.collection.FindOne(context.Background(), bson.M{"_id": quoteID}).Decode(&quote)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Quote not found", http.StatusNotFound)
+			return quote, false
+		}
+		log.Printf("Error fetching quote: %v", err)
+		http.Error(w, "Error fetching quote", http.StatusInternalServerError)
+		return quote, false
+	}
+
+	if quote.SellerID != claims["sub"].(string) {
+		http.Error(w, "Cannot access this quote", http.StatusForbidden)
+		return quote, false
+	}
+
+	return quote, true
+}
+
+// formatMoney da formato de moneda con separador de miles: $1,234.50
+func formatMoney(amount float64) string {
+	cents := int64(math.Round(amount * 100))
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+
+	whole := strconv.FormatInt(cents/100, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return fmt.Sprintf("%s$%s.%02d", sign, whole, cents%100)
+}
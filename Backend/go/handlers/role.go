@@ -2,22 +2,20 @@ package handlers
 
 import (
     "auth-service/models"
-    "context"
+    "auth-service/services"
     "encoding/json"
     "net/http"
 
     "github.com/gorilla/mux"
-    "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
-    "go.mongodb.org/mongo-driver/mongo"
 )
 
 type RoleHandler struct {
-    collection *mongo.Collection
+    roles *services.RoleService
 }
 
-func NewRoleHandler(collection *mongo.Collection) *RoleHandler {
-    return &RoleHandler{collection: collection}
+func NewRoleHandler(roles *services.RoleService) *RoleHandler {
+    return &RoleHandler{roles: roles}
 }
 
 func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
@@ -27,35 +25,20 @@ func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Validar datos del rol
-    if role.Name == "" {
-        http.Error(w, "Role name is required", http.StatusBadRequest)
-        return
-    }
-
-    // Insertar rol
-    result, err := h.collection.InsertOne(context.Background(), role)
+    role, err := h.roles.Create(r.Context(), role)
     if err != nil {
-        http.Error(w, "Error creating role", http.StatusInternalServerError)
+        writeServiceError(w, err, "Error creating role")
         return
     }
 
-    role.ID = result.InsertedID.(primitive.ObjectID)
     w.WriteHeader(http.StatusCreated)
     json.NewEncoder(w).Encode(role)
 }
 
 func (h *RoleHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
-    cursor, err := h.collection.Find(context.Background(), bson.M{})
+    roles, err := h.roles.List(r.Context())
     if err != nil {
-        http.Error(w, "Error fetching roles", http.StatusInternalServerError)
-        return
-    }
-    defer cursor.Close(context.Background())
-
-    var roles []models.Role
-    if err = cursor.All(context.Background(), &roles); err != nil {
-        http.Error(w, "Error reading roles", http.StatusInternalServerError)
+        writeServiceError(w, err, "Error fetching roles")
         return
     }
 
@@ -77,18 +60,8 @@ func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Actualizar rol
-    _, err = h.collection.UpdateOne(
-        context.Background(),
-        bson.M{"_id": roleID},
-        bson.M{"$set": bson.M{
-            "name":        updatedRole.Name,
-            "permissions": updatedRole.Permissions,
-        }},
-    )
-
-    if err != nil {
-        http.Error(w, "Error updating role", http.StatusInternalServerError)
+    if err := h.roles.Update(r.Context(), roleID, updatedRole); err != nil {
+        writeServiceError(w, err, "Error updating role")
         return
     }
 
@@ -104,27 +77,8 @@ func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    // Verificar si el rol está en uso
-    usersCollection := h.collection.Database().Collection("users")
-    count, err := usersCollection.CountDocuments(
-        context.Background(),
-        bson.M{"role_id": roleID},
-    )
-
-    if err != nil {
-        http.Error(w, "Database error", http.StatusInternalServerError)
-        return
-    }
-
-    if count > 0 {
-        http.Error(w, "Cannot delete role assigned to users", http.StatusBadRequest)
-        return
-    }
-
-    // Eliminar rol
-    _, err = h.collection.DeleteOne(context.Background(), bson.M{"_id": roleID})
-    if err != nil {
-        http.Error(w, "Error deleting role", http.StatusInternalServerError)
+    if err := h.roles.Delete(r.Context(), roleID); err != nil {
+        writeServiceError(w, err, "Error deleting role")
         return
     }
 
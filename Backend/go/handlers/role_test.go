@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/webhooks"
+	"context"
+	"net/http"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateRole(t *testing.T) {
+	env := newTestEnv(t)
+	h := NewRoleHandler(env.roles)
+
+	w := serve(h.CreateRole, newRequest(t, "POST", "/admin/roles", models.Role{Name: "gerente", Permissions: []string{models.PermissionViewSales}}, nil))
+	expectStatus(t, w, http.StatusCreated)
+	var role models.Role
+	decodeBody(t, w, &role)
+	if role.ID.IsZero() || role.Name != "gerente" {
+		t.Errorf("role = %+v", role)
+	}
+	if _, err := env.store.Roles().Get(context.Background(), role.ID); err != nil {
+		t.Errorf("role was not stored: %v", err)
+	}
+
+	w = serve(h.CreateRole, newRequest(t, "POST", "/admin/roles", models.Role{}, nil))
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestGetRoles(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addRole(t, "admin", models.PermissionManageUsers)
+	h := NewRoleHandler(env.roles)
+
+	w := serve(h.GetRoles, newRequest(t, "GET", "/admin/roles", nil, nil))
+	expectStatus(t, w, http.StatusOK)
+	var roles []models.Role
+	decodeBody(t, w, &roles)
+	if len(roles) != 2 {
+		t.Errorf("roles = %+v, want 2", roles)
+	}
+}
+
+func TestUpdateRole(t *testing.T) {
+	env := newTestEnv(t)
+	role := env.addRole(t, "consultor")
+	h := NewRoleHandler(env.roles)
+
+	body := models.Role{Name: "consultor", Permissions: []string{models.PermissionViewReports}}
+	w := serve(h.UpdateRole, newRequest(t, "PUT", "/admin/roles/"+role.ID.Hex(), body, map[string]string{"id": role.ID.Hex()}))
+	expectStatus(t, w, http.StatusOK)
+
+	stored, _ := env.store.Roles().Get(context.Background(), role.ID)
+	if len(stored.Permissions) != 1 || stored.Permissions[0] != models.PermissionViewReports {
+		t.Errorf("permissions = %v", stored.Permissions)
+	}
+	hooks := env.store.Webhooks()
+	if len(hooks) != 1 || hooks[0].Event != webhooks.EventRoleUpdated {
+		t.Errorf("webhooks = %+v, want one %s", hooks, webhooks.EventRoleUpdated)
+	}
+
+	missing := primitive.NewObjectID().Hex()
+	w = serve(h.UpdateRole, newRequest(t, "PUT", "/admin/roles/"+missing, body, map[string]string{"id": missing}))
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestDeleteRole(t *testing.T) {
+	env := newTestEnv(t)
+	vendedor := env.addRole(t, "vendedor")
+	unused := env.addRole(t, "temporal")
+	env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewRoleHandler(env.roles)
+
+	w := serve(h.DeleteRole, newRequest(t, "DELETE", "/admin/roles/"+vendedor.ID.Hex(), nil, map[string]string{"id": vendedor.ID.Hex()}))
+	expectStatus(t, w, http.StatusBadRequest)
+	if _, err := env.store.Roles().Get(context.Background(), vendedor.ID); err != nil {
+		t.Errorf("role in use was deleted: %v", err)
+	}
+
+	w = serve(h.DeleteRole, newRequest(t, "DELETE", "/admin/roles/"+unused.ID.Hex(), nil, map[string]string{"id": unused.ID.Hex()}))
+	expectStatus(t, w, http.StatusOK)
+
+	w = serve(h.DeleteRole, newRequest(t, "DELETE", "/admin/roles/"+unused.ID.Hex(), nil, map[string]string{"id": unused.ID.Hex()}))
+	expectStatus(t, w, http.StatusNotFound)
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"context"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// saleEffects implementa services.SaleEffects sobre MongoDB para una
+// solicitud: trae las formas de pago, los puntos a redimir y las marcas ya
+// consultadas en el catálogo, y recuerda lo aplicado para deshacerlo sin
+// transacción.
+type saleEffects struct {
+	db      *mongo.Database
+	userID  string
+	request *http.Request
+	policy  ApprovalPolicy
+	// scope regresa la autorización que necesita la operación sobre la venta,
+	// o nil si no necesita ninguna
+	scope func(sale models.Sale) *approvalScope
+
+	rules        models.LoyaltyRules
+	brands       map[string]string
+	tenders      []tenderRequest
+	redeemPoints int
+
+	grant     *approvalGrant
+	charged   *models.Sale
+	restocked []models.Sale // partidas antes y después de Restock
+}
+
+func (h *SalesHandler) newSaleEffects(r *http.Request) *saleEffects {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	return &saleEffects{
+		db:      h.db,
+		userID:  claims["sub"].(string),
+		request: r,
+		policy:  h.approvals,
+	}
+}
+
+func (e *saleEffects) Approve(ctx context.Context, sale models.Sale) error {
+	if e.scope == nil {
+		return nil
+	}
+	scope := e.scope(sale)
+	if scope == nil {
+		return nil
+	}
+
+	grant, err := e.policy.authorize(ctx, e.request, e.db, *scope)
+	if err != nil {
+		return err
+	}
+	if err := grant.consume(ctx, e.db); err != nil {
+		return err
+	}
+	e.grant = grant
+	return nil
+}
+
+func (e *saleEffects) Charge(ctx context.Context, sale *models.Sale) error {
+	if len(e.tenders) > 0 {
+		if err := validateTenders(e.tenders, sale.TotalAmount); err != nil {
+			return &requestError{status: http.StatusBadRequest, message: err.Error()}
+		}
+	}
+
+	saleID := sale.ID.Hex()
+	if err := consumeSaleStock(ctx, e.db, saleID, sale.Items, e.userID); err != nil {
+		return err
+	}
+	restoreStock := func() error {
+		return restoreSaleStock(ctx, e.db, saleID, sale.Items, e.userID, "Pago rechazado")
+	}
+
+	// Los puntos y las formas de pago (tarjetas de regalo y saldo a favor se
+	// cargan aquí)
+	sale.PointsRedeemed = e.redeemPoints
+	if sale.PointsRedeemed > 0 {
+		if err := debitPoints(ctx, e.db, *sale.CustomerID, sale.PointsRedeemed, saleID, e.userID); err != nil {
+			compensate(ctx, "restoring stock", restoreStock)
+			return err
+		}
+	}
+
+	if len(e.tenders) > 0 {
+		payments, err := redeemTenders(ctx, e.db, saleID, e.tenders, e.userID)
+		if err != nil {
+			compensate(ctx, "restoring stock", restoreStock)
+			compensate(ctx, "reversing points", func() error { return reverseSalePoints(ctx, e.db, e.rules, *sale, e.userID) })
+			return err
+		}
+		sale.Payments = payments
+		for _, payment := range payments {
+			sale.AmountPaid += payment.Amount
+		}
+		sale.AmountPaid = roundMoney(sale.AmountPaid)
+	}
+
+	if sale.CustomerID != nil {
+		sale.PointsEarned = salePointsEarned(e.rules, *sale, e.brands)
+	}
+
+	charged := *sale
+	e.charged = &charged
+	return nil
+}
+
+func (e *saleEffects) Restock(ctx context.Context, before, after models.Sale) error {
+	if err := adjustSaleStock(ctx, e.db, before.ID.Hex(), before.Items, after.Items, before.SellerID); err != nil {
+		return err
+	}
+	e.restocked = []models.Sale{before, after}
+	return nil
+}
+
+// Reprice ajusta la comisión si la del periodo de la venta ya se pagó
+func (e *saleEffects) Reprice(ctx context.Context, before, after models.Sale) error {
+	return clawbackCommission(ctx, e.db, before, after.TotalAmount, e.userID, "Venta modificada")
+}
+
+func (e *saleEffects) Reverse(ctx context.Context, sale models.Sale) error {
+	saleID := sale.ID.Hex()
+
+	// Regresar las unidades al inventario (los apartados también las reservan)
+	if sale.Status == models.SaleCompleted || sale.Status == models.SaleLayaway {
+		if err := restoreSaleStock(ctx, e.db, saleID, sale.Items, sale.SellerID, "Venta eliminada"); err != nil {
+			return err
+		}
+	}
+
+	// Devolver el saldo cargado a tarjetas de regalo o saldo a favor
+	if err := refundTenders(ctx, e.db, saleID, sale.Payments, e.userID); err != nil {
+		return err
+	}
+
+	if sale.Status == models.SaleCompleted {
+		if err := clawbackCommission(ctx, e.db, sale, 0, e.userID, "Venta eliminada"); err != nil {
+			return err
+		}
+	}
+
+	// Revertir los puntos ganados y devolver los redimidos. Los ganados los
+	// abona el outbox: si todavía no se abonaron no hay nada que retirar
+	reversed := sale
+	if reversed.PointsEarned > 0 {
+		credited, err := e.db.Collection("loyalty_transactions").CountDocuments(ctx, bson.M{"saleId": saleID, "type": models.LoyaltyEarn})
+		if err != nil {
+			return err
+		}
+		if credited == 0 {
+			reversed.PointsEarned = 0
+		}
+	}
+	if reversed.PointsEarned == 0 && reversed.PointsRedeemed == 0 {
+		return nil
+	}
+	rules, err := loadLoyaltyRules(ctx, e.db)
+	if err != nil {
+		return err
+	}
+	return reverseSalePoints(ctx, e.db, rules, reversed, e.userID)
+}
+
+// Undo regresa el cobro, las existencias y la autorización cuando la unidad
+// de trabajo corre sin transacción; con transacción basta con abortarla
+func (e *saleEffects) Undo(ctx context.Context) {
+	if e.charged != nil {
+		sale := *e.charged
+		saleID := sale.ID.Hex()
+		compensate(ctx, "restoring stock", func() error {
+			return restoreSaleStock(ctx, e.db, saleID, sale.Items, e.userID, "Venta no registrada")
+		})
+		compensate(ctx, "refunding tenders", func() error { return refundTenders(ctx, e.db, saleID, sale.Payments, e.userID) })
+		compensate(ctx, "reversing points", func() error {
+			redeemed := sale
+			redeemed.PointsEarned = 0
+			return reverseSalePoints(ctx, e.db, e.rules, redeemed, e.userID)
+		})
+	}
+	if e.restocked != nil {
+		before, after := e.restocked[0], e.restocked[1]
+		compensate(ctx, "reverting stock for sale "+before.ID.Hex(), func() error {
+			return adjustSaleStock(ctx, e.db, before.ID.Hex(), after.Items, before.Items, before.SellerID)
+		})
+	}
+	if e.grant != nil {
+		compensate(ctx, "releasing approval", func() error { return e.grant.release(ctx, e.db) })
+	}
+	e.grant, e.charged, e.restocked = nil, nil, nil
+}
+
+func (e *saleEffects) Publish(ctx context.Context, sale models.Sale, eventTypes ...string) error {
+	return writeSaleEvents(ctx, e.db, sale, eventTypes...)
+}
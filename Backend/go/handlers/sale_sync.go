@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxSyncBatch limita las ventas por solicitud de sincronización
+const maxSyncBatch = 100
+
+// Resultado de cada venta sincronizada
+const (
+	syncCreated   = "created"
+	syncDuplicate = "duplicate" // ya se había sincronizado; no se vuelve a registrar
+	syncRejected  = "rejected"
+)
+
+// syncSaleRequest es una venta capturada sin conexión. ClientID lo genera la
+// caja y hace que reenviar el lote no duplique ventas.
+type syncSaleRequest struct {
+	ClientID   string            `json:"clientId"`
+	Timestamp  int64             `json:"timestamp"` // hora en que se hizo la venta
+	Items      []saleRequestItem `json:"items"`
+	RegisterID string            `json:"registerId,omitempty"`
+	StoreID    string            `json:"storeId,omitempty"`
+	CustomerID string            `json:"customerId,omitempty"`
+	Payments   []tenderRequest   `json:"payments,omitempty"`
+}
+
+type syncSaleResult struct {
+	ClientID      string `json:"clientId"`
+	Status        string `json:"status"`
+	SaleID        string `json:"saleId,omitempty"`
+	StockConflict bool   `json:"stockConflict,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// SyncSales registra un lote de ventas hechas sin conexión, en el orden
+// recibido, y responde el resultado de cada una. Las ventas ya ocurrieron en
+// tienda, así que la falta de existencias no las rechaza: se registran con
+// stockConflict y el inventario queda negativo hasta conciliarlo.
+func (h *SalesHandler) SyncSales(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	userRole, ok := claims["role"].(string)
+	if !ok || userRole != "vendedor" {
+		http.Error(w, "Only sellers can sync sales", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Sales []syncSaleRequest `json:"sales"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sales) == 0 {
+		http.Error(w, "At least one sale is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Sales) > maxSyncBatch {
+		http.Error(w, "Too many sales in one batch", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	rules, err := loadLoyaltyRules(ctx, h.db)
+	if err != nil {
+		log.Printf("Error fetching loyalty rules: %v", err)
+		http.Error(w, "Error fetching loyalty rules", http.StatusInternalServerError)
+		return
+	}
+
+	sellerID := claims["sub"].(string)
+	sellerName, ok := claims["name"].(string)
+	if !ok {
+		sellerName = "Unknown"
+	}
+
+	results := make([]syncSaleResult, 0, len(req.Sales))
+	for _, offline := range req.Sales {
+		result := h.syncSale(ctx, rules, offline, sellerID, sellerName)
+		if result.Status == syncRejected {
+			log.Printf("Offline sale %s rejected: %s", offline.ClientID, result.Error)
+		}
+		results = append(results, result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+}
+
+// syncSale valida y registra una venta del lote
+func (h *SalesHandler) syncSale(ctx context.Context, rules models.LoyaltyRules, req syncSaleRequest, sellerID, sellerName string) syncSaleResult {
+	result := syncSaleResult{ClientID: req.ClientID, Status: syncRejected}
+	db := h.db
+
+	req.ClientID = strings.TrimSpace(req.ClientID)
+	if req.ClientID == "" || len(req.ClientID) > 100 {
+		result.Error = "A client ID of up to 100 characters is required"
+		return result
+	}
+
+	// Reenvío de una venta ya sincronizada
+	if existing, found, err := h.findSyncedSale(ctx, req.ClientID); err != nil {
+		log.Printf("Error fetching synced sale: %v", err)
+		result.Error = "Error fetching sale"
+		return result
+	} else if found {
+		return duplicateSyncResult(result, existing, sellerID)
+	}
+
+	now := time.Now()
+	if req.Timestamp <= 0 || req.Timestamp > now.Add(5*time.Minute).Unix() {
+		result.Error = "Timestamp is required and cannot be in the future"
+		return result
+	}
+	if len(req.Items) == 0 {
+		result.Error = "Sale must contain at least one item"
+		return result
+	}
+	saleItems, totalAmount, err := buildSaleItems(req.Items)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	for _, payment := range req.Payments {
+		if payment.Method == models.TenderLoyaltyPoints {
+			result.Error = "Points cannot be redeemed on offline sales"
+			return result
+		}
+	}
+	if len(req.Payments) > 0 {
+		if err := validateTenders(req.Payments, totalAmount); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+	}
+
+	var customerID *primitive.ObjectID
+	if req.CustomerID != "" {
+		id, err := primitive.ObjectIDFromHex(req.CustomerID)
+		if err != nil {
+			result.Error = "Invalid customer ID"
+			return result
+		}
+		count, err := db.Collection("customers").CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			log.Printf("Error fetching customer: %v", err)
+			result.Error = "Error fetching customer"
+			return result
+		}
+		if count == 0 {
+			result.Error = "Customer not found"
+			return result
+		}
+		customerID = &id
+	}
+
+	sale := models.Sale{
+		ID:          primitive.NewObjectID(),
+		Items:       saleItems,
+		TotalAmount: totalAmount,
+		SellerID:    sellerID,
+		SellerName:  sellerName,
+		Timestamp:   req.Timestamp,
+		Status:      models.SaleCompleted,
+		RegisterID:  req.RegisterID,
+		StoreID:     req.StoreID,
+		CustomerID:  customerID,
+		ClientID:    req.ClientID,
+		SyncedAt:    now.Unix(),
+	}
+
+	// step indica en qué paso falló la unidad de trabajo, para el mensaje
+	const (
+		stepStock   = "stock"
+		stepPayment = "payment"
+		stepInsert  = "insert"
+	)
+	var step string
+	var brands map[string]string
+	if sale.CustomerID != nil {
+		brands = saleBrands(ctx, h.catalog, rules, sale.Items)
+	}
+	err = h.store.Atomic(ctx, func(ctx context.Context) error {
+		sale.Payments, sale.AmountPaid, sale.PointsEarned, sale.StockConflict = nil, 0, 0, false
+
+		// La mercancía ya salió: sin existencias suficientes se descuenta igual
+		step = stepStock
+		conflict, err := consumeOfflineSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID)
+		if err != nil {
+			return err
+		}
+		sale.StockConflict = conflict
+
+		if len(req.Payments) > 0 {
+			step = stepPayment
+			payments, err := redeemTenders(ctx, db, sale.ID.Hex(), req.Payments, sellerID)
+			if err != nil {
+				compensate(ctx, "restoring stock", func() error {
+					return restoreSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID, "Pago rechazado")
+				})
+				return err
+			}
+			sale.Payments = payments
+			for _, payment := range payments {
+				sale.AmountPaid += payment.Amount
+			}
+			sale.AmountPaid = roundMoney(sale.AmountPaid)
+		}
+
+		if sale.CustomerID != nil {
+			sale.PointsEarned = salePointsEarned(rules, sale, brands)
+		}
+
+		step = stepInsert
+		if err := h.store.Sales().Insert(ctx, sale); err != nil {
+			compensate(ctx, "restoring stock", func() error {
+				return restoreSaleStock(ctx, db, sale.ID.Hex(), sale.Items, sellerID, "Venta no registrada")
+			})
+			compensate(ctx, "refunding tenders", func() error { return refundTenders(ctx, db, sale.ID.Hex(), sale.Payments, sellerID) })
+			return err
+		}
+		return writeSaleEvents(ctx, db, sale, outbox.SaleCreated, outbox.SaleCompleted)
+	})
+	if err != nil {
+		switch step {
+		case stepStock:
+			log.Printf("Error consuming stock: %v", err)
+			result.Error = "Error updating inventory"
+		case stepPayment:
+			result.Error = tenderErrorMessage(err)
+		default:
+			// Otra solicitud sincronizó la misma venta al mismo tiempo
+			if errors.Is(err, store.ErrDuplicate) {
+				if existing, found, findErr := h.findSyncedSale(ctx, req.ClientID); findErr == nil && found {
+					return duplicateSyncResult(result, existing, sellerID)
+				}
+			}
+			log.Printf("Error inserting synced sale: %v", err)
+			result.Error = "Error creating sale in database"
+		}
+		return result
+	}
+
+	result.Status = syncCreated
+	result.SaleID = sale.ID.Hex()
+	result.StockConflict = sale.StockConflict
+	return result
+}
+
+func (h *SalesHandler) findSyncedSale(ctx context.Context, clientID string) (models.Sale, bool, error) {
+	sales, err := h.store.Sales().List(ctx, store.SaleFilter{ClientID: clientID})
+	if err != nil || len(sales) == 0 {
+		return models.Sale{}, false, err
+	}
+	return sales[0], true, nil
+}
+
+func duplicateSyncResult(result syncSaleResult, existing models.Sale, sellerID string) syncSaleResult {
+	if existing.SellerID != sellerID {
+		result.Error = "Client ID already used by another seller"
+		return result
+	}
+	result.Status = syncDuplicate
+	result.SaleID = existing.ID.Hex()
+	result.StockConflict = existing.StockConflict
+	return result
+}
+
+// consumeOfflineSaleStock descuenta las unidades de una venta sin conexión.
+// Un producto sin existencias suficientes o sin registro de inventario se
+// descuenta igual, dejando el inventario negativo, y la venta se marca con
+// conflicto. Si falla, sin transacción se regresa lo ya descontado.
+func consumeOfflineSaleStock(ctx context.Context, db *mongo.Database, saleID string, items []models.SaleItem, userID string) (bool, error) {
+	conflict := false
+	var applied []models.SaleItem
+	for productID, quantity := range quantitiesByProduct(items) {
+		movement := models.InventoryMovement{
+			ProductID: productID,
+			Type:      models.MovementSale,
+			Quantity:  -quantity,
+			Reference: models.MovementReference{Type: "sale", ID: saleID},
+			UserID:    userID,
+		}
+		_, err := applyMovement(ctx, db, movement, true)
+		if err == errInsufficientStock || err == errUntrackedProduct {
+			conflict = true
+			movement.Reason = "Venta sin conexión sin existencias"
+			_, err = applyMovement(ctx, db, movement, false)
+		}
+		if err != nil {
+			compensate(ctx, "restoring stock", func() error {
+				return restoreSaleStock(ctx, db, saleID, applied, userID, "Venta no registrada")
+			})
+			return conflict, err
+		}
+		applied = append(applied, models.SaleItem{ProductID: productID, Quantity: quantity})
+	}
+	return conflict, nil
+}
+
+// tenderErrorMessage traduce los errores de cobro al texto que ve la caja
+func tenderErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errStoredValueNotFound), errors.Is(err, errStoredValueUnavailable), errors.Is(err, errInsufficientBalance):
+		return err.Error()
+	}
+	log.Printf("Error redeeming tenders: %v", err)
+	return "Error processing payment"
+}
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"auth-service/catalog"
 	"auth-service/models"
+	"auth-service/services"
+	"auth-service/store"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
@@ -18,11 +22,15 @@ import (
 )
 
 type SalesHandler struct {
-	collection *mongo.Collection
+	db        *mongo.Database
+	store     store.Store
+	sales     *services.SaleService
+	catalog   *catalog.Client
+	approvals ApprovalPolicy
 }
 
-func NewSalesHandler(collection *mongo.Collection) *SalesHandler {
-	return &SalesHandler{collection: collection}
+func NewSalesHandler(db *mongo.Database, s store.Store, sales *services.SaleService, catalogClient *catalog.Client, approvals ApprovalPolicy) *SalesHandler {
+	return &SalesHandler{db: db, store: s, sales: sales, catalog: catalogClient, approvals: approvals}
 }
 
 type saleRequestItem struct {
@@ -33,32 +41,94 @@ type saleRequestItem struct {
 }
 
 type saleRequest struct {
-	Items []saleRequestItem `json:"items" bson:"items"`
+	Items      []saleRequestItem `json:"items" bson:"items"`
+	Status     string            `json:"status,omitempty" bson:"status,omitempty"` // "held" para dejar el ticket en espera
+	RegisterID string            `json:"registerId,omitempty" bson:"registerId,omitempty"`
+	StoreID    string            `json:"storeId,omitempty" bson:"storeId,omitempty"`
+	Payments   []tenderRequest   `json:"payments,omitempty" bson:"payments,omitempty"`
+	// Programa de puntos: cliente y puntos a usar como descuento
+	CustomerID   string `json:"customerId,omitempty" bson:"customerId,omitempty"`
+	RedeemPoints int    `json:"redeemPoints,omitempty" bson:"redeemPoints,omitempty"`
+	// Motivo de la edición; obligatorio al modificar una venta completada
+	Reason string `json:"reason,omitempty" bson:"reason,omitempty"`
 }
 
-func (h *SalesHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
-	// 1. Verificación de autenticación
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
+// buildSaleItems valida las partidas recibidas y calcula subtotales y total
+func buildSaleItems(items []saleRequestItem) ([]models.SaleItem, float64, error) {
+	var saleItems []models.SaleItem
+	totalAmount := 0.0
 
-	userRole, ok := claims["role"].(string)
-	if !ok || userRole != "vendedor" {
-		http.Error(w, "Only sellers can create sales", http.StatusForbidden)
-		return
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, 0, errors.New("Quantity must be greater than 0")
+		}
+		if item.UnitPrice <= 0 {
+			return nil, 0, errors.New("Unit price must be greater than 0")
+		}
+
+		subtotal := item.UnitPrice * float64(item.Quantity)
+		saleItems = append(saleItems, models.SaleItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Subtotal:    subtotal,
+		})
+		totalAmount += subtotal
 	}
 
-	sellerID, ok := claims["sub"].(string)
-	if !ok {
-		http.Error(w, "Invalid seller information", http.StatusBadRequest)
-		return
+	return saleItems, totalAmount, nil
+}
+
+// figuresParam lee ?figures=original|adjusted; por omisión los reportes usan
+// las cifras ajustadas por las ediciones
+func figuresParam(r *http.Request) (bool, error) {
+	switch r.URL.Query().Get("figures") {
+	case "", "adjusted":
+		return false, nil
+	case "original":
+		return true, nil
+	}
+	return false, errors.New("figures must be original or adjusted")
+}
+
+// loyaltyCustomer valida el cliente indicado en la venta; sin cliente la
+// venta no participa en el programa de puntos.
+func (h *SalesHandler) loyaltyCustomer(ctx context.Context, w http.ResponseWriter, id string) (*primitive.ObjectID, bool) {
+	if id == "" {
+		return nil, true
+	}
+
+	customerID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	count, err := h.db.Collection("customers").CountDocuments(ctx, bson.M{"_id": customerID})
+	if err != nil {
+		log.Printf("Error fetching customer: %v", err)
+		http.Error(w, "Error fetching customer", http.StatusInternalServerError)
+		return nil, false
+	}
+	if count == 0 {
+		http.Error(w, "Customer not found", http.StatusBadRequest)
+		return nil, false
 	}
 
+	return &customerID, true
+}
+
+func (h *SalesHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
 	sellerName, ok := claims["name"].(string)
 	if !ok {
 		sellerName = "Unknown"
 	}
 
-	// 2. Decodificar el cuerpo de la solicitud
+	// 1. Decodificar el cuerpo de la solicitud
 	var req saleRequest
 	body, _ := ioutil.ReadAll(r.Body)
 	log.Printf("Raw request body: %s", string(body)) // Log del cuerpo crudo
@@ -71,65 +141,68 @@ func (h *SalesHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("Parsed request: %+v", req) // Log de la estructura parseada
 
-	// 3. Validar los items
-	if len(req.Items) == 0 {
-		http.Error(w, "Sale must contain at least one item", http.StatusBadRequest)
+	// 2. Validar los items
+	saleItems, totalAmount, err := buildSaleItems(req.Items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var saleItems []models.SaleItem
-	totalAmount := 0.0
-
-	for _, item := range req.Items {
-		if item.Quantity <= 0 {
-			http.Error(w, "Quantity must be greater than 0", http.StatusBadRequest)
-			return
-		}
-		if item.UnitPrice <= 0 {
-			http.Error(w, "Unit price must be greater than 0", http.StatusBadRequest)
-			return
-		}
-
-		subtotal := item.UnitPrice * float64(item.Quantity)
-		saleItems = append(saleItems, models.SaleItem{
-			ProductID:   item.ProductID,
-			ProductName: item.ProductName,
-			Quantity:    item.Quantity,
-			UnitPrice:   item.UnitPrice,
-			Subtotal:    subtotal,
-		})
-
-		totalAmount += subtotal
+	// 3. Cliente del programa de puntos y puntos a redimir
+	ctx := context.Background()
+	customerID, ok := h.loyaltyCustomer(ctx, w, req.CustomerID)
+	if !ok {
+		return
 	}
 
-	// 4. Crear el documento de venta
-	sale := models.Sale{
-		ID:          primitive.NewObjectID(),
-		Items:       saleItems,
-		TotalAmount: totalAmount,
-		SellerID:    sellerID,
-		SellerName:  sellerName,
-		Timestamp:   time.Now().Unix(),
-		Status:      "completed",
+	rules, err := loadLoyaltyRules(ctx, h.db)
+	if err != nil {
+		log.Printf("Error fetching loyalty rules: %v", err)
+		http.Error(w, "Error fetching loyalty rules", http.StatusInternalServerError)
+		return
 	}
 
-	// 5. Insertar en MongoDB
-	result, err := h.collection.InsertOne(context.Background(), sale)
+	redeemPoints, discount, err := pointsToRedeem(rules, customerID, req.RedeemPoints, req.Payments)
 	if err != nil {
-		log.Printf("Error inserting sale: %v", err)
-		http.Error(w, "Error creating sale in database", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// 6. Verificar el resultado
-	if result.InsertedID == nil {
-		log.Println("No InsertedID returned from MongoDB")
-		http.Error(w, "Failed to create sale", http.StatusInternalServerError)
+	effects := h.newSaleEffects(r)
+	effects.rules = rules
+	effects.tenders = req.Payments
+	effects.redeemPoints = redeemPoints
+	if customerID != nil && (req.Status == "" || req.Status == models.SaleCompleted) {
+		effects.brands = saleBrands(ctx, h.catalog, rules, saleItems)
+	}
+	// Un descuento grande necesita autorización de un gerente
+	effects.scope = func(sale models.Sale) *approvalScope {
+		if sale.Discount > 0 && h.approvals.DiscountPercent > 0 && sale.Discount > totalAmount*h.approvals.DiscountPercent/100 {
+			return &approvalScope{Operation: models.ApprovalDiscount, Amount: sale.Discount}
+		}
+		return nil
+	}
+
+	// 4. Registrar la venta: descontar existencias, cobrar y guardarla con sus
+	// eventos en una sola unidad de trabajo
+	sale, err := h.sales.Create(ctx, viewerFromRequest(r), services.NewSale{
+		Items:          saleItems,
+		Status:         req.Status,
+		SellerName:     sellerName,
+		RegisterID:     req.RegisterID,
+		StoreID:        req.StoreID,
+		CustomerID:     customerID,
+		Discount:       discount,
+		PointsRedeemed: redeemPoints,
+		Paid:           len(req.Payments) > 0,
+	}, effects)
+	if err != nil {
+		writeSaleError(w, err, "Error creating sale in database")
 		return
 	}
 
-	// 7. Retornar respuesta
-	sale.ID = result.InsertedID.(primitive.ObjectID)
+	// 5. Retornar respuesta; los puntos ganados, los webhooks y el evento SSE
+	// los publica el despachador del outbox
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(sale); err != nil {
@@ -137,29 +210,20 @@ func (h *SalesHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetSales lista ventas con filtros opcionales sellerId, storeId, status y
+// start/end (YYYY-MM-DD). Con el permiso view_sales se consultan las de todos
+// los vendedores; un vendedor sin él sólo ve las suyas.
 func (h *SalesHandler) GetSales(w http.ResponseWriter, r *http.Request) {
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	userRole := claims["role"].(string)
-
-	if userRole != "vendedor" {
-		http.Error(w, "Only sellers can view sales", http.StatusForbidden)
-		return
-	}
-
-	sellerID := claims["sub"].(string)
-	cursor, err := h.collection.Find(context.Background(), bson.M{"sellerId": sellerID})
+	query := r.URL.Query()
+	sales, err := h.sales.List(r.Context(), viewerFromRequest(r), services.SaleQuery{
+		SellerID: query.Get("sellerId"),
+		StoreID:  query.Get("storeId"),
+		Status:   query.Get("status"),
+		Start:    query.Get("start"),
+		End:      query.Get("end"),
+	})
 	if err != nil {
-		log.Printf("Error fetching sales: %v", err)
-		http.Error(w, "Error fetching sales", http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(context.Background())
-
-	var sales []models.Sale
-	if err = cursor.All(context.Background(), &sales); err != nil {
-		log.Printf("Error reading sales data: %v", err)
-		http.Error(w, "Error reading sales data", http.StatusInternalServerError)
+		writeServiceError(w, err, "Error fetching sales")
 		return
 	}
 
@@ -170,36 +234,15 @@ func (h *SalesHandler) GetSales(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *SalesHandler) GetSale(w http.ResponseWriter, r *http.Request) {
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	userRole := claims["role"].(string)
-
-	if userRole != "vendedor" {
-		http.Error(w, "Only sellers can view sales", http.StatusForbidden)
-		return
-	}
-
-	params := mux.Vars(r)
-	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	saleID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 	if err != nil {
 		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
 		return
 	}
 
-	var sale models.Sale
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": saleID}).Decode(&sale)
+	sale, err := h.sales.Get(r.Context(), viewerFromRequest(r), saleID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Sale not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error fetching sale: %v", err)
-		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
-		return
-	}
-
-	if sale.SellerID != claims["sub"].(string) {
-		http.Error(w, "Cannot access this sale", http.StatusForbidden)
+		writeServiceError(w, err, "Error fetching sale")
 		return
 	}
 
@@ -209,37 +252,31 @@ func (h *SalesHandler) GetSale(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *SalesHandler) UpdateSale(w http.ResponseWriter, r *http.Request) {
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	userRole := claims["role"].(string)
-
-	if userRole != "vendedor" {
-		http.Error(w, "Only sellers can update sales", http.StatusForbidden)
-		return
-	}
-
-	params := mux.Vars(r)
-	saleID, err := primitive.ObjectIDFromHex(params["id"])
+// GetSaleRevisions lista las ediciones de una venta con sus diferencias
+func (h *SalesHandler) GetSaleRevisions(w http.ResponseWriter, r *http.Request) {
+	saleID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 	if err != nil {
 		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
 		return
 	}
 
-	var existingSale models.Sale
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": saleID}).Decode(&existingSale)
+	revisions, err := h.sales.Revisions(r.Context(), viewerFromRequest(r), saleID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Sale not found", http.StatusNotFound)
-			return
-		}
-		log.Printf("Error fetching sale: %v", err)
-		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
+		writeServiceError(w, err, "Error fetching sale revisions")
 		return
 	}
 
-	if existingSale.SellerID != claims["sub"].(string) {
-		http.Error(w, "Cannot update this sale", http.StatusForbidden)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(revisions); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func (h *SalesHandler) UpdateSale(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
 		return
 	}
 
@@ -250,66 +287,37 @@ func (h *SalesHandler) UpdateSale(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validar y calcular nuevos items
-	var saleItems []models.SaleItem
-	totalAmount := 0.0
-
-	for _, item := range req.Items {
-		if item.Quantity <= 0 {
-			http.Error(w, "Quantity must be greater than 0", http.StatusBadRequest)
-			return
-		}
-		if item.UnitPrice <= 0 {
-			http.Error(w, "Unit price must be greater than 0", http.StatusBadRequest)
-			return
-		}
-
-		subtotal := item.UnitPrice * float64(item.Quantity)
-		saleItems = append(saleItems, models.SaleItem{
-			ProductID:   item.ProductID,
-			ProductName: item.ProductName,
-			Quantity:    item.Quantity,
-			UnitPrice:   item.UnitPrice,
-			Subtotal:    subtotal,
-		})
-		totalAmount += subtotal
+	saleItems, _, err := buildSaleItems(req.Items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"items":       saleItems,
-			"totalAmount": totalAmount,
-			"timestamp":   time.Now().Unix(),
-		},
+	// Modificar una venta ya cobrada requiere autorización de un gerente
+	effects := h.newSaleEffects(r)
+	effects.scope = func(sale models.Sale) *approvalScope {
+		if sale.Status == models.SaleCompleted {
+			return &approvalScope{Operation: models.ApprovalEditSale, SaleID: sale.ID.Hex()}
+		}
+		return nil
 	}
 
-	_, err = h.collection.UpdateOne(context.Background(), bson.M{"_id": saleID}, update)
+	updatedSale, err := h.sales.Update(context.Background(), viewerFromRequest(r), saleID, services.SaleEdit{
+		Items:  saleItems,
+		Reason: req.Reason,
+	}, effects)
 	if err != nil {
-		log.Printf("Error updating sale: %v", err)
-		http.Error(w, "Error updating sale", http.StatusInternalServerError)
+		writeSaleError(w, err, "Error updating sale")
 		return
 	}
 
-	// Actualizar el objeto para la respuesta
-	existingSale.Items = saleItems
-	existingSale.TotalAmount = totalAmount
-	existingSale.Timestamp = time.Now().Unix()
-
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(existingSale); err != nil {
+	if err := json.NewEncoder(w).Encode(updatedSale); err != nil {
 		log.Printf("Error encoding response: %v", err)
 	}
 }
 
 func (h *SalesHandler) DeleteSale(w http.ResponseWriter, r *http.Request) {
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	userRole := claims["role"].(string)
-
-	if userRole != "vendedor" {
-		http.Error(w, "Only sellers can delete sales", http.StatusForbidden)
-		return
-	}
-
 	params := mux.Vars(r)
 	saleID, err := primitive.ObjectIDFromHex(params["id"])
 	if err != nil {
@@ -317,107 +325,123 @@ func (h *SalesHandler) DeleteSale(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var sale models.Sale
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": saleID}).Decode(&sale)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Sale not found", http.StatusNotFound)
-			return
+	// Cancelar una venta cobrada o un apartado requiere autorización de un gerente
+	effects := h.newSaleEffects(r)
+	effects.scope = func(sale models.Sale) *approvalScope {
+		if sale.Status == models.SaleCompleted || sale.Status == models.SaleLayaway {
+			return &approvalScope{Operation: models.ApprovalCancelSale, SaleID: sale.ID.Hex()}
 		}
-		log.Printf("Error fetching sale: %v", err)
-		http.Error(w, "Error fetching sale", http.StatusInternalServerError)
-		return
+		return nil
 	}
 
-	if sale.SellerID != claims["sub"].(string) {
-		http.Error(w, "Cannot delete this sale", http.StatusForbidden)
+	if err := h.sales.Delete(context.Background(), viewerFromRequest(r), saleID, effects); err != nil {
+		writeSaleError(w, err, "Error deleting sale")
 		return
 	}
 
-	_, err = h.collection.DeleteOne(context.Background(), bson.M{"_id": saleID})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListHeldSales lista los tickets en espera, opcionalmente de una caja
+func (h *SalesHandler) ListHeldSales(w http.ResponseWriter, r *http.Request) {
+	sales, err := h.sales.ListHeld(r.Context(), viewerFromRequest(r), r.URL.Query().Get("registerId"))
 	if err != nil {
-		log.Printf("Error deleting sale: %v", err)
-		http.Error(w, "Error deleting sale", http.StatusInternalServerError)
+		writeServiceError(w, err, "Error fetching sales")
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sales); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
 }
 
-func (h *SalesHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
-	token := r.Context().Value("token").(*jwt.Token)
-	claims := token.Claims.(jwt.MapClaims)
-	userRole := claims["role"].(string)
-
-	if userRole != "consultor" {
-		http.Error(w, "Only consultants can generate reports", http.StatusForbidden)
+// CompleteSale retoma un ticket en espera y lo cierra como venta completada,
+// descontando en ese momento las existencias.
+func (h *SalesHandler) CompleteSale(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	saleID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
 		return
 	}
 
-	// Get date parameters
-	startDateStr := r.URL.Query().Get("start")
-	endDateStr := r.URL.Query().Get("end")
-
-	var filter bson.M = bson.M{"status": "completed"}
-
-	// Date filtering
-	if startDateStr != "" && endDateStr != "" {
-		startDate, err := time.Parse("2006-01-02", startDateStr)
-		if err != nil {
-			http.Error(w, "Invalid start date format (use YYYY-MM-DD)", http.StatusBadRequest)
-			return
-		}
+	ctx := context.Background()
+	viewer := viewerFromRequest(r)
+	sale, err := h.sales.Held(ctx, viewer, saleID)
+	if err != nil {
+		writeServiceError(w, err, "Error fetching sale")
+		return
+	}
 
-		endDate, err := time.Parse("2006-01-02", endDateStr)
-		if err != nil {
-			http.Error(w, "Invalid end date format (use YYYY-MM-DD)", http.StatusBadRequest)
-			return
-		}
+	// Las formas de pago son opcionales al retomar el ticket
+	var req struct {
+		Payments []tenderRequest `json:"payments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
 
-		// Adjust end date to include entire day
-		endDate = endDate.Add(24 * time.Hour)
+	rules, err := loadLoyaltyRules(ctx, h.db)
+	if err != nil {
+		log.Printf("Error fetching loyalty rules: %v", err)
+		http.Error(w, "Error fetching loyalty rules", http.StatusInternalServerError)
+		return
+	}
+	redeemPoints, _, err := pointsToRedeem(rules, sale.CustomerID, 0, req.Payments)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-		filter["timestamp"] = bson.M{
-			"$gte": startDate.Unix(),
-			"$lt":  endDate.Unix(),
-		}
+	effects := h.newSaleEffects(r)
+	effects.rules = rules
+	effects.tenders = req.Payments
+	effects.redeemPoints = redeemPoints
+	if sale.CustomerID != nil {
+		effects.brands = saleBrands(ctx, h.catalog, rules, sale.Items)
 	}
 
-	cursor, err := h.collection.Find(context.Background(), filter)
+	sale, err = h.sales.Complete(ctx, viewer, saleID, effects)
 	if err != nil {
-		log.Printf("Error fetching sales for report: %v", err)
-		http.Error(w, "Error fetching sales", http.StatusInternalServerError)
+		writeSaleError(w, err, "Error completing sale")
 		return
 	}
-	defer cursor.Close(context.Background())
 
-	var sales []models.Sale
-	if err = cursor.All(context.Background(), &sales); err != nil {
-		log.Printf("Error reading sales data for report: %v", err)
-		http.Error(w, "Error reading sales data", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sale); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeSaleError responde el error de una operación de venta: las reglas del
+// servicio y los errores de la unidad de trabajo (existencias, puntos, formas
+// de pago, autorizaciones)
+func writeSaleError(w http.ResponseWriter, err error, message string) {
+	var serviceErr *services.Error
+	if errors.As(err, &serviceErr) {
+		writeServiceError(w, err, message)
 		return
 	}
+	writeUnitError(w, err, message)
+}
 
-	// Calculate totals
-	totalSales := len(sales)
-	totalAmount := 0.0
-	for _, sale := range sales {
-		totalAmount += sale.TotalAmount
+func (h *SalesHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
+	original, err := figuresParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Create response
-	response := struct {
-		TotalSales  int           `json:"totalSales"`
-		TotalAmount float64       `json:"totalAmount"`
-		Sales       []models.Sale `json:"sales"`
-	}{
-		TotalSales:  totalSales,
-		TotalAmount: totalAmount,
-		Sales:       sales,
+	report, err := h.sales.Report(r.Context(), viewerFromRequest(r), r.URL.Query().Get("start"), r.URL.Query().Get("end"), original)
+	if err != nil {
+		writeServiceError(w, err, "Error fetching sales")
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := json.NewEncoder(w).Encode(report); err != nil {
 		log.Printf("Error encoding report response: %v", err)
 	}
 }
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/services"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// salesFixture prepara roles y ventas de dos vendedores
+func salesFixture(t *testing.T) (*testEnv, *SalesHandler, map[string]models.Sale) {
+	t.Helper()
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addRole(t, "consultor")
+	env.addRole(t, "admin", models.PermissionViewSales)
+
+	day := func(date string) int64 {
+		d, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Add(12 * time.Hour).Unix()
+	}
+	sales := map[string]models.Sale{
+		"ana1": {ID: primitive.NewObjectID(), SellerID: "ana@example.com", StoreID: "centro", Status: models.SaleCompleted, TotalAmount: 100, Timestamp: day("2024-03-01")},
+		"ana2": {ID: primitive.NewObjectID(), SellerID: "ana@example.com", StoreID: "norte", Status: models.SaleCompleted, TotalAmount: 80, Timestamp: day("2024-03-05"),
+			Revision: 1, OriginalTotal: 120, OriginalItems: []models.SaleItem{{ProductID: "p1", Quantity: 3, UnitPrice: 40, Subtotal: 120}}},
+		"luis":  {ID: primitive.NewObjectID(), SellerID: "luis@example.com", StoreID: "centro", Status: models.SaleCompleted, TotalAmount: 50, Timestamp: day("2024-03-03")},
+		"held1": {ID: primitive.NewObjectID(), SellerID: "ana@example.com", RegisterID: "caja-1", Status: models.SaleHeld, TotalAmount: 10, Timestamp: day("2024-03-06")},
+		"held2": {ID: primitive.NewObjectID(), SellerID: "luis@example.com", RegisterID: "caja-2", Status: models.SaleHeld, TotalAmount: 20, Timestamp: day("2024-03-04")},
+	}
+	for _, sale := range sales {
+		env.store.AddSale(sale)
+	}
+	return env, NewSalesHandler(nil, env.store, env.sales, nil, ApprovalPolicy{}), sales
+}
+
+func saleIDs(sales []models.Sale) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, sale := range sales {
+		ids = append(ids, sale.ID)
+	}
+	return ids
+}
+
+func expectSales(t *testing.T, got []models.Sale, want ...models.Sale) {
+	t.Helper()
+	gotIDs, wantIDs := saleIDs(got), saleIDs(want)
+	if len(gotIDs) != len(wantIDs) {
+		t.Fatalf("sales = %v, want %v", gotIDs, wantIDs)
+	}
+	for i := range gotIDs {
+		if gotIDs[i] != wantIDs[i] {
+			t.Fatalf("sales = %v, want %v", gotIDs, wantIDs)
+		}
+	}
+}
+
+func TestGetSalesVisibility(t *testing.T) {
+	_, h, sales := salesFixture(t)
+
+	tests := []struct {
+		name  string
+		email string
+		role  string
+		query string
+		want  []models.Sale
+	}{
+		{"seller sees own sales", "ana@example.com", "vendedor", "", []models.Sale{sales["held1"], sales["ana2"], sales["ana1"]}},
+		{"seller cannot filter by another seller", "ana@example.com", "vendedor", "?sellerId=luis@example.com&status=completed", []models.Sale{sales["ana2"], sales["ana1"]}},
+		{"view_sales sees every seller", "jefe@example.com", "admin", "?status=completed", []models.Sale{sales["ana2"], sales["luis"], sales["ana1"]}},
+		{"view_sales filters by seller", "jefe@example.com", "admin", "?sellerId=luis@example.com", []models.Sale{sales["held2"], sales["luis"]}},
+		{"store filter", "jefe@example.com", "admin", "?storeId=centro", []models.Sale{sales["luis"], sales["ana1"]}},
+		{"date range includes end day", "jefe@example.com", "admin", "?start=2024-03-03&end=2024-03-05&status=completed", []models.Sale{sales["ana2"], sales["luis"]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := withToken(newRequest(t, "GET", "/api/sales"+tt.query, nil, nil), tt.email, tt.role)
+			w := serve(h.GetSales, r)
+			expectStatus(t, w, http.StatusOK)
+			var got []models.Sale
+			decodeBody(t, w, &got)
+			expectSales(t, got, tt.want...)
+		})
+	}
+}
+
+func TestGetSalesRejectsInvalidRequests(t *testing.T) {
+	_, h, _ := salesFixture(t)
+
+	w := serve(h.GetSales, withToken(newRequest(t, "GET", "/api/sales", nil, nil), "eva@example.com", "consultor"))
+	expectStatus(t, w, http.StatusForbidden)
+
+	w = serve(h.GetSales, withToken(newRequest(t, "GET", "/api/sales?start=03-01-2024", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = serve(h.GetSales, withToken(newRequest(t, "GET", "/api/sales?end=ayer", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestGetSale(t *testing.T) {
+	_, h, sales := salesFixture(t)
+	get := func(id, email, role string) int {
+		r := withToken(newRequest(t, "GET", "/api/sales/"+id, nil, map[string]string{"id": id}), email, role)
+		return serve(h.GetSale, r).Code
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		email  string
+		role   string
+		status int
+	}{
+		{"own sale", sales["ana1"].ID.Hex(), "ana@example.com", "vendedor", http.StatusOK},
+		{"another seller's sale", sales["luis"].ID.Hex(), "ana@example.com", "vendedor", http.StatusForbidden},
+		{"view_sales", sales["luis"].ID.Hex(), "jefe@example.com", "admin", http.StatusOK},
+		{"role without access", sales["ana1"].ID.Hex(), "eva@example.com", "consultor", http.StatusForbidden},
+		{"missing sale", primitive.NewObjectID().Hex(), "ana@example.com", "vendedor", http.StatusNotFound},
+		{"invalid id", "123", "ana@example.com", "vendedor", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := get(tt.id, tt.email, tt.role); status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestGetSaleRevisions(t *testing.T) {
+	env, h, sales := salesFixture(t)
+	saleID := sales["ana2"].ID
+	env.store.AddRevision(models.SaleRevision{ID: primitive.NewObjectID(), SaleID: saleID.Hex(), Revision: 2, EditedBy: "ana@example.com"})
+	env.store.AddRevision(models.SaleRevision{ID: primitive.NewObjectID(), SaleID: saleID.Hex(), Revision: 1, EditedBy: "ana@example.com"})
+	env.store.AddRevision(models.SaleRevision{ID: primitive.NewObjectID(), SaleID: sales["luis"].ID.Hex(), Revision: 1})
+	vars := map[string]string{"id": saleID.Hex()}
+
+	w := serve(h.GetSaleRevisions, withToken(newRequest(t, "GET", "/api/sales/"+saleID.Hex()+"/revisions", nil, vars), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusOK)
+	var revisions []models.SaleRevision
+	decodeBody(t, w, &revisions)
+	if len(revisions) != 2 || revisions[0].Revision != 1 || revisions[1].Revision != 2 {
+		t.Errorf("revisions = %+v", revisions)
+	}
+
+	w = serve(h.GetSaleRevisions, withToken(newRequest(t, "GET", "/api/sales/"+saleID.Hex()+"/revisions", nil, vars), "luis@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusForbidden)
+}
+
+func TestListHeldSales(t *testing.T) {
+	_, h, sales := salesFixture(t)
+
+	w := serve(h.ListHeldSales, withToken(newRequest(t, "GET", "/api/sales/held", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusOK)
+	var held []models.Sale
+	decodeBody(t, w, &held)
+	expectSales(t, held, sales["held2"], sales["held1"])
+
+	w = serve(h.ListHeldSales, withToken(newRequest(t, "GET", "/api/sales/held?registerId=caja-1", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &held)
+	expectSales(t, held, sales["held1"])
+
+	w = serve(h.ListHeldSales, withToken(newRequest(t, "GET", "/api/sales/held", nil, nil), "jefe@example.com", "admin"))
+	expectStatus(t, w, http.StatusForbidden)
+}
+
+func TestGetSalesReport(t *testing.T) {
+	_, h, sales := salesFixture(t)
+	report := func(query string) services.SalesReport {
+		t.Helper()
+		w := serve(h.GetSalesReport, withToken(newRequest(t, "GET", "/api/reports/sales"+query, nil, nil), "eva@example.com", "consultor"))
+		expectStatus(t, w, http.StatusOK)
+		var body services.SalesReport
+		decodeBody(t, w, &body)
+		return body
+	}
+
+	all := report("")
+	if all.TotalSales != 3 || all.TotalAmount != 230 {
+		t.Errorf("report = %d sales, %v total; want 3, 230", all.TotalSales, all.TotalAmount)
+	}
+
+	original := report("?figures=original")
+	if original.TotalAmount != 270 {
+		t.Errorf("original total = %v, want 270", original.TotalAmount)
+	}
+
+	ranged := report("?start=2024-03-04&end=2024-03-05")
+	expectSales(t, ranged.Sales, sales["ana2"])
+
+	w := serve(h.GetSalesReport, withToken(newRequest(t, "GET", "/api/reports/sales?figures=raw", nil, nil), "eva@example.com", "consultor"))
+	expectStatus(t, w, http.StatusBadRequest)
+
+	w = serve(h.GetSalesReport, withToken(newRequest(t, "GET", "/api/reports/sales", nil, nil), "ana@example.com", "vendedor"))
+	expectStatus(t, w, http.StatusForbidden)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"auth-service/services"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeServiceError responde el error de un servicio: las reglas de negocio
+// con el estado que corresponde a su tipo y el resto como 500 con message.
+func writeServiceError(w http.ResponseWriter, err error, message string) {
+	var serviceErr *services.Error
+	if !errors.As(err, &serviceErr) {
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch serviceErr.Kind {
+	case services.Unauthorized:
+		status = http.StatusUnauthorized
+	case services.Forbidden:
+		status = http.StatusForbidden
+	case services.NotFound:
+		status = http.StatusNotFound
+	case services.Conflict:
+		status = http.StatusConflict
+	}
+	http.Error(w, serviceErr.Message, status)
+}
+
+// viewerFromRequest toma el usuario y el rol del token de la solicitud
+func viewerFromRequest(r *http.Request) services.Viewer {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	return services.Viewer{Email: claims["sub"].(string), Role: claims["role"].(string)}
+}
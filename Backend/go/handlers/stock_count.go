@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/uow"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type StockCountHandler struct {
+	collection *mongo.Collection
+}
+
+func NewStockCountHandler(collection *mongo.Collection) *StockCountHandler {
+	return &StockCountHandler{collection: collection}
+}
+
+type stockCountEntryRequest struct {
+	ProductID string `json:"productId"`
+	Barcode   string `json:"barcode"`
+	Quantity  int    `json:"quantity"`
+}
+
+// stockCountVariance compara lo contado contra la existencia del sistema
+type stockCountVariance struct {
+	ProductID       string  `json:"productId"`
+	ProductName     string  `json:"productName"`
+	SystemQuantity  int     `json:"systemQuantity"`
+	CountedQuantity int     `json:"countedQuantity"`
+	Counted         bool    `json:"counted"`
+	Variance        int     `json:"variance"`
+	VarianceAmount  float64 `json:"varianceAmount"`
+}
+
+type stockCountResponse struct {
+	models.StockCount
+	Variances []stockCountVariance `json:"variances"`
+}
+
+// OpenStockCount abre un conteo físico para una ubicación o categoría
+func (h *StockCountHandler) OpenStockCount(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var req struct {
+		Location string `json:"location"`
+		Category string `json:"category"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Location == "" && req.Category == "" {
+		http.Error(w, "Location or category is required", http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{}
+	if req.Location != "" {
+		filter["location"] = req.Location
+	}
+	if req.Category != "" {
+		filter["category"] = req.Category
+	}
+
+	// Tomar la existencia actual de los productos incluidos
+	ctx := context.Background()
+	inventoryCollection := h.collection.Database().Collection("inventory")
+	cursor, err := inventoryCollection.Find(ctx, filter)
+	if err != nil {
+		log.Printf("Error fetching inventory for count: %v", err)
+		http.Error(w, "Error fetching inventory", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var items []models.InventoryItem
+	if err = cursor.All(ctx, &items); err != nil {
+		http.Error(w, "Error reading inventory", http.StatusInternalServerError)
+		return
+	}
+
+	if len(items) == 0 {
+		http.Error(w, "No products found for this location or category", http.StatusBadRequest)
+		return
+	}
+
+	count := models.StockCount{
+		ID:       primitive.NewObjectID(),
+		Location: req.Location,
+		Category: req.Category,
+		Status:   models.StockCountOpen,
+		Lines:    []models.StockCountLine{},
+		Entries:  []models.StockCountEntry{},
+		OpenedBy: claims["sub"].(string),
+		OpenedAt: time.Now().Unix(),
+	}
+	for _, item := range items {
+		count.Lines = append(count.Lines, models.StockCountLine{
+			ProductID:      item.ProductID,
+			ProductName:    item.ProductName,
+			Barcode:        item.Barcode,
+			SystemQuantity: item.Quantity,
+			UnitCost:       item.PrecioCompra,
+		})
+	}
+
+	if _, err := h.collection.InsertOne(ctx, count); err != nil {
+		log.Printf("Error inserting stock count: %v", err)
+		http.Error(w, "Error opening stock count", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(buildStockCountResponse(count))
+}
+
+// ListStockCounts lista los conteos, opcionalmente filtrados por estado
+func (h *StockCountHandler) ListStockCounts(w http.ResponseWriter, r *http.Request) {
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := h.collection.Find(context.Background(), filter)
+	if err != nil {
+		log.Printf("Error fetching stock counts: %v", err)
+		http.Error(w, "Error fetching stock counts", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	counts := []models.StockCount{}
+	if err = cursor.All(context.Background(), &counts); err != nil {
+		http.Error(w, "Error reading stock counts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// GetStockCount muestra el conteo con la diferencia contra el sistema
+func (h *StockCountHandler) GetStockCount(w http.ResponseWriter, r *http.Request) {
+	count, ok := h.findCount(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildStockCountResponse(count))
+}
+
+// SubmitCountEntries registra cantidades contadas; varios usuarios pueden
+// contar el mismo producto y sus cantidades se suman.
+func (h *StockCountHandler) SubmitCountEntries(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	count, ok := h.findCount(w, r)
+	if !ok {
+		return
+	}
+
+	if count.Status != models.StockCountOpen {
+		http.Error(w, "Stock count is not open", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Entries []stockCountEntryRequest `json:"entries"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Entries) == 0 {
+		http.Error(w, "At least one entry is required", http.StatusBadRequest)
+		return
+	}
+
+	byProduct := make(map[string]bool)
+	byBarcode := make(map[string]string)
+	for _, line := range count.Lines {
+		byProduct[line.ProductID] = true
+		if line.Barcode != "" {
+			byBarcode[line.Barcode] = line.ProductID
+		}
+	}
+
+	now := time.Now().Unix()
+	var entries []models.StockCountEntry
+	for _, e := range req.Entries {
+		productID := e.ProductID
+		if productID == "" && e.Barcode != "" {
+			productID = byBarcode[e.Barcode]
+		}
+		if productID == "" || !byProduct[productID] {
+			http.Error(w, "Product is not part of this stock count", http.StatusBadRequest)
+			return
+		}
+		if e.Quantity < 0 {
+			http.Error(w, "Quantity cannot be negative", http.StatusBadRequest)
+			return
+		}
+
+		entries = append(entries, models.StockCountEntry{
+			ProductID: productID,
+			Quantity:  e.Quantity,
+			CountedBy: claims["sub"].(string),
+			CountedAt: now,
+		})
+	}
+
+	result, err := h.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": count.ID, "status": models.StockCountOpen},
+		bson.M{"$push": bson.M{"entries": bson.M{"$each": entries}}},
+	)
+	if err != nil {
+		log.Printf("Error saving count entries: %v", err)
+		http.Error(w, "Error saving count entries", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		http.Error(w, "Stock count is not open", http.StatusConflict)
+		return
+	}
+
+	count.Entries = append(count.Entries, entries...)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildStockCountResponse(count))
+}
+
+// ApproveStockCount publica los ajustes de las diferencias encontradas en el
+// conteo. Cada ajuste queda en el historial de movimientos con su motivo.
+func (h *StockCountHandler) ApproveStockCount(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	count, ok := h.findCount(w, r)
+	if !ok {
+		return
+	}
+
+	if count.Status != models.StockCountOpen {
+		http.Error(w, "Stock count is not open", http.StatusConflict)
+		return
+	}
+
+	var req struct {
+		Reason  string            `json:"reason"`
+		Reasons map[string]string `json:"reasons"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	response := buildStockCountResponse(count)
+	for _, v := range response.Variances {
+		if v.Counted && v.Variance != 0 && req.Reason == "" && req.Reasons[v.ProductID] == "" {
+			http.Error(w, "A reason is required for every adjustment", http.StatusBadRequest)
+			return
+		}
+	}
+
+	approver := claims["sub"].(string)
+	now := time.Now().Unix()
+
+	// Cerrar el conteo y aplicar sus ajustes en una unidad de trabajo; el
+	// cierre va primero para que no se apruebe dos veces
+	ctx := context.Background()
+	db := h.collection.Database()
+	err := uow.Run(ctx, db, func(ctx context.Context) error {
+		result, err := h.collection.UpdateOne(
+			ctx,
+			bson.M{"_id": count.ID, "status": models.StockCountOpen},
+			bson.M{"$set": bson.M{
+				"status":     models.StockCountApproved,
+				"approvedBy": approver,
+				"approvedAt": now,
+			}},
+		)
+		if err != nil {
+			return err
+		}
+		if result.ModifiedCount == 0 {
+			return &requestError{status: http.StatusConflict, message: "Stock count is not open"}
+		}
+
+		for _, v := range response.Variances {
+			if !v.Counted || v.Variance == 0 {
+				continue
+			}
+
+			reason := req.Reasons[v.ProductID]
+			if reason == "" {
+				reason = req.Reason
+			}
+
+			_, err := applyMovement(ctx, db, models.InventoryMovement{
+				ProductID: v.ProductID,
+				Type:      models.MovementCount,
+				Quantity:  v.Variance,
+				Reason:    reason,
+				Reference: models.MovementReference{Type: "stock_count", ID: count.ID.Hex()},
+				UserID:    approver,
+				Timestamp: now,
+			}, false)
+			if err != nil {
+				return fmt.Errorf("product %s: %w", v.ProductID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error posting adjustments")
+		return
+	}
+
+	response.Status = models.StockCountApproved
+	response.ApprovedBy = approver
+	response.ApprovedAt = now
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CancelStockCount descarta un conteo abierto sin ajustar existencias
+func (h *StockCountHandler) CancelStockCount(w http.ResponseWriter, r *http.Request) {
+	count, ok := h.findCount(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := h.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": count.ID, "status": models.StockCountOpen},
+		bson.M{"$set": bson.M{"status": models.StockCountCanceled}},
+	)
+	if err != nil {
+		http.Error(w, "Error canceling stock count", http.StatusInternalServerError)
+		return
+	}
+	if result.ModifiedCount == 0 {
+		http.Error(w, "Stock count is not open", http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Stock count canceled"})
+}
+
+func (h *StockCountHandler) findCount(w http.ResponseWriter, r *http.Request) (models.StockCount, bool) {
+	var count models.StockCount
+
+	params := mux.Vars(r)
+	countID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return count, false
+	}
+
+	err = h.collection.FindOne(context.Background(), bson.M{"_id": countID}).Decode(&count)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Stock count not found", http.StatusNotFound)
+			return count, false
+		}
+		log.Printf("Error fetching stock count: %v", err)
+		http.Error(w, "Error fetching stock count", http.StatusInternalServerError)
+		return count, false
+	}
+
+	return count, true
+}
+
+// buildStockCountResponse suma las capturas de cada producto y calcula la diferencia
+func buildStockCountResponse(count models.StockCount) stockCountResponse {
+	counted := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, e := range count.Entries {
+		counted[e.ProductID] += e.Quantity
+		seen[e.ProductID] = true
+	}
+
+	response := stockCountResponse{StockCount: count, Variances: []stockCountVariance{}}
+	for _, line := range count.Lines {
+		v := stockCountVariance{
+			ProductID:      line.ProductID,
+			ProductName:    line.ProductName,
+			SystemQuantity: line.SystemQuantity,
+			Counted:        seen[line.ProductID],
+		}
+		if v.Counted {
+			v.CountedQuantity = counted[line.ProductID]
+			v.Variance = v.CountedQuantity - line.SystemQuantity
+			v.VarianceAmount = float64(v.Variance) * line.UnitCost
+		}
+		response.Variances = append(response.Variances, v)
+	}
+
+	return response
+}
@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/uow"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errStoredValueNotFound    = errors.New("gift card or store credit not found")
+	errStoredValueUnavailable = errors.New("gift card or store credit is voided or expired")
+	errInsufficientBalance    = errors.New("insufficient balance")
+)
+
+// StoredValueHandler maneja las tarjetas de regalo y los saldos a favor
+type StoredValueHandler struct {
+	collection   *mongo.Collection
+	validityDays int
+	approvals    ApprovalPolicy
+}
+
+func NewStoredValueHandler(collection *mongo.Collection, validityDays int, approvals ApprovalPolicy) *StoredValueHandler {
+	return &StoredValueHandler{collection: collection, validityDays: validityDays, approvals: approvals}
+}
+
+type storedValueRequest struct {
+	Type      string  `json:"type"`
+	Amount    float64 `json:"amount"`
+	ExpiresAt string  `json:"expiresAt,omitempty"` // YYYY-MM-DD
+	SaleID    string  `json:"saleId,omitempty"`
+}
+
+// tenderRequest es una forma de pago recibida al cobrar una venta
+type tenderRequest struct {
+	Method string  `json:"method"`
+	Amount float64 `json:"amount"`
+	Code   string  `json:"code,omitempty"` // requerido para tarjetas de regalo y saldo a favor
+}
+
+// IssueStoredValue emite una tarjeta de regalo o un saldo a favor con su código
+func (h *StoredValueHandler) IssueStoredValue(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var req storedValueRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Type != models.TenderGiftCard && req.Type != models.TenderStoreCredit {
+		http.Error(w, "Type must be gift_card or store_credit", http.StatusBadRequest)
+		return
+	}
+	amount := roundMoney(req.Amount)
+	if amount <= 0 {
+		http.Error(w, "Amount must be greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var expiresAt int64
+	if req.ExpiresAt != "" {
+		expiry, err := time.ParseInLocation("2006-01-02", req.ExpiresAt, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid expiresAt format (use YYYY-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		// Vigente durante todo el día de vencimiento
+		expiresAt = expiry.Add(24 * time.Hour).Unix()
+		if expiresAt <= now.Unix() {
+			http.Error(w, "Expiry date must be in the future", http.StatusBadRequest)
+			return
+		}
+	} else if h.validityDays > 0 {
+		expiresAt = now.AddDate(0, 0, h.validityDays).Unix()
+	}
+
+	ctx := context.Background()
+
+	// Una cuenta emitida a mano es dinero que no entró en caja: siempre
+	// necesita la autorización de un gerente
+	grant, err := h.approvals.authorize(ctx, r, h.collection.Database(), approvalScope{Operation: models.ApprovalIssueStoredValue, SaleID: req.SaleID, Amount: amount})
+	if err != nil {
+		writeUnitError(w, err, "Error checking approval")
+		return
+	}
+
+	account := models.StoredValueAccount{
+		Type:           req.Type,
+		Balance:        amount,
+		InitialBalance: amount,
+		ExpiresAt:      expiresAt,
+		Status:         models.StoredValueActive,
+		SaleID:         req.SaleID,
+		IssuedBy:       claims["sub"].(string),
+		IssuedAt:       now.Unix(),
+	}
+
+	// La cuenta y su emisión en la bitácora se registran juntas. El índice
+	// único sobre el código detecta colisiones; se reintenta con otro
+	for attempt := 0; attempt < 3; attempt++ {
+		account.ID = primitive.NewObjectID()
+		account.Code, err = generateStoredValueCode()
+		if err != nil {
+			break
+		}
+		err = uow.Run(ctx, h.collection.Database(), withApproval(h.collection.Database(), grant, func(ctx context.Context) error {
+			if _, err := h.collection.InsertOne(ctx, account); err != nil {
+				return err
+			}
+			_, err := h.collection.Database().Collection("stored_value_transactions").InsertOne(ctx, models.StoredValueTransaction{
+				ID:           primitive.NewObjectID(),
+				AccountID:    account.ID,
+				Code:         account.Code,
+				Type:         models.StoredValueIssue,
+				Amount:       amount,
+				BalanceAfter: amount,
+				SaleID:       req.SaleID,
+				UserID:       account.IssuedBy,
+				Timestamp:    account.IssuedAt,
+			})
+			return err
+		}))
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		writeUnitError(w, err, "Error issuing stored value account")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(account)
+}
+
+// GetStoredValue consulta el saldo de una cuenta junto con sus movimientos
+func (h *StoredValueHandler) GetStoredValue(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.findAccount(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := h.collection.Database().Collection("stored_value_transactions").Find(
+		ctx,
+		bson.M{"accountId": account.ID},
+		options.Find().SetSort(bson.M{"timestamp": 1}),
+	)
+	if err != nil {
+		log.Printf("Error fetching stored value transactions: %v", err)
+		http.Error(w, "Error fetching transactions", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []models.StoredValueTransaction{}
+	if err = cursor.All(ctx, &transactions); err != nil {
+		http.Error(w, "Error reading transactions", http.StatusInternalServerError)
+		return
+	}
+
+	// Saldos a favor emitidos con lo devuelto a la cuenta después de anularla
+	reissued := []models.StoredValueAccount{}
+	if account.Status == models.StoredValueVoided {
+		cursor, err := h.collection.Find(ctx, bson.M{"replacesCode": account.Code})
+		if err != nil {
+			http.Error(w, "Error fetching reissued accounts", http.StatusInternalServerError)
+			return
+		}
+		defer cursor.Close(ctx)
+		if err = cursor.All(ctx, &reissued); err != nil {
+			http.Error(w, "Error reading reissued accounts", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"account":      account,
+		"expired":      account.ExpiresAt != 0 && account.ExpiresAt <= time.Now().Unix(),
+		"transactions": transactions,
+		"reissued":     reissued,
+	})
+}
+
+// VoidStoredValue anula una cuenta y cancela el saldo restante
+func (h *StoredValueHandler) VoidStoredValue(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	account, ok := h.findAccount(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Reason == "" {
+		http.Error(w, "A reason is required to void an account", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	userID := claims["sub"].(string)
+	now := time.Now().Unix()
+
+	err := uow.Run(ctx, h.collection.Database(), func(ctx context.Context) error {
+		// Se toma el saldo en la misma operación para no perder redenciones simultáneas
+		var previous models.StoredValueAccount
+		err := h.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": account.ID, "status": models.StoredValueActive},
+			bson.M{"$set": bson.M{
+				"status":     models.StoredValueVoided,
+				"balance":    0.0,
+				"voidedBy":   userID,
+				"voidedAt":   now,
+				"voidReason": req.Reason,
+			}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&previous)
+		if err == mongo.ErrNoDocuments {
+			return &requestError{status: http.StatusConflict, message: "Account is already voided"}
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = h.collection.Database().Collection("stored_value_transactions").InsertOne(ctx, models.StoredValueTransaction{
+			ID:           primitive.NewObjectID(),
+			AccountID:    account.ID,
+			Code:         account.Code,
+			Type:         models.StoredValueVoid,
+			Amount:       -previous.Balance,
+			BalanceAfter: 0,
+			UserID:       userID,
+			Timestamp:    now,
+		})
+		return err
+	})
+	if err != nil {
+		writeUnitError(w, err, "Error voiding account")
+		return
+	}
+
+	account.Status = models.StoredValueVoided
+	account.Balance = 0
+	account.VoidedBy = userID
+	account.VoidedAt = now
+	account.VoidReason = req.Reason
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(account)
+}
+
+// findAccount obtiene la cuenta indicada por el código de la ruta
+func (h *StoredValueHandler) findAccount(w http.ResponseWriter, r *http.Request) (models.StoredValueAccount, bool) {
+	var account models.StoredValueAccount
+
+	code := normalizeStoredValueCode(mux.Vars(r)["code"])
+	err := h.collection.FindOne(context.Background(), bson.M{"code": code}).Decode(&account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Account not found", http.StatusNotFound)
+			return account, false
+		}
+		log.Printf("Error fetching stored value account: %v", err)
+		http.Error(w, "Error fetching account", http.StatusInternalServerError)
+		return account, false
+	}
+
+	return account, true
+}
+
+const storedValueAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// generateStoredValueCode genera un código de 16 caracteres sin letras
+// ambiguas, en grupos de cuatro (XXXX-XXXX-XXXX-XXXX).
+func generateStoredValueCode() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(storedValueAlphabet)))
+	for i := 0; i < 16; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(storedValueAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+func normalizeStoredValueCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func isStoredValueTender(method string) bool {
+	return method == models.TenderGiftCard || method == models.TenderStoreCredit
+}
+
+// validateTenders revisa que las formas de pago cubran el total y que lo
+// cargado a tarjetas de regalo, saldo a favor o puntos no lo exceda (no dan
+// cambio).
+func validateTenders(tenders []tenderRequest, total float64) error {
+	paid, storedValue := 0.0, 0.0
+	for _, tender := range tenders {
+		if tender.Method == "" {
+			return errors.New("Payment method is required")
+		}
+		if tender.Amount <= 0 {
+			return errors.New("Payment amount must be greater than 0")
+		}
+		if isStoredValueTender(tender.Method) {
+			if tender.Code == "" {
+				return errors.New("A code is required for gift card and store credit payments")
+			}
+			storedValue += tender.Amount
+		} else if tender.Method == models.TenderLoyaltyPoints {
+			storedValue += tender.Amount
+		}
+		paid += tender.Amount
+	}
+
+	if roundMoney(paid) < roundMoney(total) {
+		return errors.New("Payments do not cover the sale total")
+	}
+	if roundMoney(storedValue) > roundMoney(total) {
+		return errors.New("Gift card, store credit and points payments exceed the sale total")
+	}
+	return nil
+}
+
+// redeemTenders cobra las formas de pago de una venta. Si una cuenta no tiene
+// saldo suficiente se devuelve lo ya cargado a las demás.
+func redeemTenders(ctx context.Context, db *mongo.Database, saleID string, tenders []tenderRequest, userID string) ([]models.SalePayment, error) {
+	now := time.Now().Unix()
+	var payments []models.SalePayment
+
+	for _, tender := range tenders {
+		payment := models.SalePayment{
+			Amount:     roundMoney(tender.Amount),
+			Method:     tender.Method,
+			ReceivedBy: userID,
+			Timestamp:  now,
+		}
+
+		if isStoredValueTender(tender.Method) {
+			payment.Code = normalizeStoredValueCode(tender.Code)
+			if err := redeemStoredValue(ctx, db, payment.Code, tender.Method, payment.Amount, saleID, userID); err != nil {
+				if refundErr := refundTenders(ctx, db, saleID, payments, userID); refundErr != nil {
+					log.Printf("Error refunding tenders for sale %s: %v", saleID, refundErr)
+				}
+				return nil, fmt.Errorf("%s: %w", payment.Code, err)
+			}
+		}
+
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
+
+// refundTenders regresa a sus cuentas lo pagado con tarjetas de regalo o saldo
+// a favor, por ejemplo al eliminar la venta.
+func refundTenders(ctx context.Context, db *mongo.Database, saleID string, payments []models.SalePayment, userID string) error {
+	for _, payment := range payments {
+		if !isStoredValueTender(payment.Method) {
+			continue
+		}
+		if err := creditStoredValue(ctx, db, payment.Code, payment.Amount, saleID, userID); err != nil {
+			return fmt.Errorf("%s: %w", payment.Code, err)
+		}
+	}
+	return nil
+}
+
+// redeemStoredValue carga un monto a la cuenta. La validación de saldo,
+// vigencia y estado va en el filtro de la actualización, así dos ventas
+// simultáneas no pueden gastar el mismo saldo.
+func redeemStoredValue(ctx context.Context, db *mongo.Database, code, accountType string, amount float64, saleID, userID string) error {
+	// El saldo y su registro en la bitácora se escriben juntos
+	return uow.Run(ctx, db, func(ctx context.Context) error {
+		accounts := db.Collection("stored_value_accounts")
+		now := time.Now().Unix()
+
+		filter := bson.M{
+			"code":    code,
+			"type":    accountType,
+			"status":  models.StoredValueActive,
+			"balance": bson.M{"$gte": amount},
+			"$or": []bson.M{
+				{"expiresAt": bson.M{"$exists": false}},
+				{"expiresAt": bson.M{"$gt": now}},
+			},
+		}
+
+		var account models.StoredValueAccount
+		err := accounts.FindOneAndUpdate(
+			ctx,
+			filter,
+			balanceUpdate(-amount),
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&account)
+		if err == mongo.ErrNoDocuments {
+			// Distinguir el motivo del rechazo para el cajero
+			var current models.StoredValueAccount
+			findErr := accounts.FindOne(ctx, bson.M{"code": code, "type": accountType}).Decode(&current)
+			if findErr == mongo.ErrNoDocuments {
+				return errStoredValueNotFound
+			}
+			if findErr != nil {
+				return findErr
+			}
+			if current.Status != models.StoredValueActive || (current.ExpiresAt != 0 && current.ExpiresAt <= now) {
+				return errStoredValueUnavailable
+			}
+			return errInsufficientBalance
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := recordStoredValueTransaction(ctx, db, account, models.StoredValueRedeem, -amount, saleID, userID); err != nil {
+			return fmt.Errorf("recording redemption: %w", err)
+		}
+		return nil
+	})
+}
+
+// creditStoredValue abona un monto a una cuenta activa aunque haya vencido.
+// Si la cuenta se anuló después del cobro, el monto se emite en un saldo a
+// favor nuevo ligado a la cuenta anulada (ReplacesCode) para no perderlo.
+func creditStoredValue(ctx context.Context, db *mongo.Database, code string, amount float64, saleID, userID string) error {
+	// El saldo y su registro en la bitácora se escriben juntos
+	return uow.Run(ctx, db, func(ctx context.Context) error {
+		accounts := db.Collection("stored_value_accounts")
+
+		var account models.StoredValueAccount
+		err := accounts.FindOneAndUpdate(
+			ctx,
+			bson.M{"code": code, "status": models.StoredValueActive},
+			balanceUpdate(amount),
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&account)
+		if err == mongo.ErrNoDocuments {
+			var voided models.StoredValueAccount
+			findErr := accounts.FindOne(ctx, bson.M{"code": code}).Decode(&voided)
+			if findErr == mongo.ErrNoDocuments {
+				return errStoredValueNotFound
+			}
+			if findErr != nil {
+				return findErr
+			}
+			return reissueStoredValue(ctx, db, voided, amount, saleID, userID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := recordStoredValueTransaction(ctx, db, account, models.StoredValueRefund, amount, saleID, userID); err != nil {
+			return fmt.Errorf("recording refund: %w", err)
+		}
+		return nil
+	})
+}
+
+// reissueStoredValue emite un saldo a favor sin vencimiento con lo que se
+// devolvería a una cuenta anulada
+func reissueStoredValue(ctx context.Context, db *mongo.Database, voided models.StoredValueAccount, amount float64, saleID, userID string) error {
+	code, err := generateStoredValueCode()
+	if err != nil {
+		return err
+	}
+	account := models.StoredValueAccount{
+		ID:             primitive.NewObjectID(),
+		Code:           code,
+		Type:           models.TenderStoreCredit,
+		Balance:        amount,
+		InitialBalance: amount,
+		Status:         models.StoredValueActive,
+		SaleID:         saleID,
+		ReplacesCode:   voided.Code,
+		IssuedBy:       userID,
+		IssuedAt:       time.Now().Unix(),
+	}
+	if _, err := db.Collection("stored_value_accounts").InsertOne(ctx, account); err != nil {
+		return fmt.Errorf("reissuing %s: %w", voided.Code, err)
+	}
+	if err := recordStoredValueTransaction(ctx, db, account, models.StoredValueRefund, amount, saleID, userID); err != nil {
+		return fmt.Errorf("recording refund: %w", err)
+	}
+	log.Printf("Refund of %.2f to voided account %s issued as store credit %s", amount, voided.Code, code)
+	return nil
+}
+
+// balanceUpdate suma el monto al saldo redondeando a centavos en el servidor
+// para que los cargos sucesivos no acumulen error de punto flotante.
+func balanceUpdate(amount float64) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"balance": bson.M{"$round": bson.A{bson.M{"$add": bson.A{"$balance", amount}}, 2}},
+		}}},
+	}
+}
+
+func recordStoredValueTransaction(ctx context.Context, db *mongo.Database, account models.StoredValueAccount, transactionType string, amount float64, saleID, userID string) error {
+	transaction := models.StoredValueTransaction{
+		ID:           primitive.NewObjectID(),
+		AccountID:    account.ID,
+		Code:         account.Code,
+		Type:         transactionType,
+		Amount:       amount,
+		BalanceAfter: account.Balance,
+		SaleID:       saleID,
+		UserID:       userID,
+		Timestamp:    time.Now().Unix(),
+	}
+
+	_, err := db.Collection("stored_value_transactions").InsertOne(ctx, transaction)
+	return err
+}
+
+// writeTenderError traduce los errores de cobro a la respuesta HTTP
+func writeTenderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errStoredValueNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errStoredValueUnavailable), errors.Is(err, errInsufficientBalance):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error redeeming tenders: %v", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestIssueStoredValueRequiresApproval(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+
+	// Cliente sin conectar: la autorización se rechaza antes de tocar la base
+	client, err := mongo.NewClient(options.Client().ApplyURI("mongodb://localhost:1"))
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+	policy := ApprovalPolicy{Users: env.users, Roles: env.roles}
+	handler := NewStoredValueHandler(client.Database("test").Collection("stored_value_accounts"), 0, policy)
+
+	for _, accountType := range []string{models.TenderGiftCard, models.TenderStoreCredit} {
+		t.Run(accountType, func(t *testing.T) {
+			r := withToken(newRequest(t, http.MethodPost, "/stored-value", storedValueRequest{Type: accountType, Amount: 5}, nil), "ana@example.com", "vendedor")
+			w := serve(handler.IssueStoredValue, r)
+			expectStatus(t, w, http.StatusForbidden)
+			if !strings.Contains(w.Body.String(), "Manager approval required") {
+				t.Errorf("body = %q, want a manager approval error", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SupplierHandler struct {
+	collection *mongo.Collection
+}
+
+func NewSupplierHandler(collection *mongo.Collection) *SupplierHandler {
+	return &SupplierHandler{collection: collection}
+}
+
+// CreateSupplier maneja el alta de proveedores
+func (h *SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var supplier models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&supplier); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if supplier.Name == "" {
+		http.Error(w, "Supplier name is required", http.StatusBadRequest)
+		return
+	}
+
+	supplier.ID = primitive.NilObjectID
+	supplier.Active = true
+
+	result, err := h.collection.InsertOne(context.Background(), supplier)
+	if err != nil {
+		log.Printf("Error inserting supplier: %v", err)
+		http.Error(w, "Error creating supplier", http.StatusInternalServerError)
+		return
+	}
+
+	supplier.ID = result.InsertedID.(primitive.ObjectID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// ListSuppliers maneja la solicitud GET para listar proveedores
+func (h *SupplierHandler) ListSuppliers(w http.ResponseWriter, r *http.Request) {
+	cursor, err := h.collection.Find(context.Background(), bson.M{})
+	if err != nil {
+		log.Printf("Error fetching suppliers: %v", err)
+		http.Error(w, "Error fetching suppliers", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(context.Background())
+
+	var suppliers []models.Supplier
+	if err = cursor.All(context.Background(), &suppliers); err != nil {
+		http.Error(w, "Error reading suppliers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// GetSupplier maneja la solicitud GET para obtener un proveedor
+func (h *SupplierHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	supplierID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var supplier models.Supplier
+	err = h.collection.FindOne(context.Background(), bson.M{"_id": supplierID}).Decode(&supplier)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Supplier not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error fetching supplier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(supplier)
+}
+
+// UpdateSupplier maneja la actualización de proveedores
+func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	supplierID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var updated models.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if updated.Name == "" {
+		http.Error(w, "Supplier name is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": supplierID},
+		bson.M{"$set": bson.M{
+			"name":        updated.Name,
+			"contactName": updated.ContactName,
+			"email":       updated.Email,
+			"phone":       updated.Phone,
+			"rfc":         updated.RFC,
+			"address":     updated.Address,
+			"active":      updated.Active,
+		}},
+	)
+	if err != nil {
+		log.Printf("Error updating supplier: %v", err)
+		http.Error(w, "Error updating supplier", http.StatusInternalServerError)
+		return
+	}
+	if result.MatchedCount == 0 {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+
+	updated.ID = supplierID
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteSupplier elimina un proveedor sin órdenes de compra registradas
+func (h *SupplierHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	supplierID, err := primitive.ObjectIDFromHex(params["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	// Verificar si el proveedor tiene órdenes de compra
+	ordersCollection := h.collection.Database().Collection("purchase_orders")
+	count, err := ordersCollection.CountDocuments(context.Background(), bson.M{"supplierId": supplierID})
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if count > 0 {
+		http.Error(w, "Cannot delete supplier with purchase orders", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.collection.DeleteOne(context.Background(), bson.M{"_id": supplierID})
+	if err != nil {
+		http.Error(w, "Error deleting supplier", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/services"
+	"auth-service/store"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TargetHandler maneja las metas mensuales de venta y el tablero de vendedores
+type TargetHandler struct {
+	collection *mongo.Collection
+	store      store.Store
+}
+
+func NewTargetHandler(collection *mongo.Collection, s store.Store) *TargetHandler {
+	return &TargetHandler{collection: collection, store: s}
+}
+
+// salesTotals son las ventas completadas de un vendedor o tienda en el periodo
+type salesTotals struct {
+	ID      string  `json:"id" bson:"_id"`
+	Amount  float64 `json:"amount" bson:"amount"`
+	Units   int     `json:"units" bson:"units"`
+	Tickets int     `json:"tickets" bson:"tickets"`
+}
+
+type targetMetric struct {
+	Target    float64 `json:"target"`
+	Actual    float64 `json:"actual"`
+	Percent   float64 `json:"percent"`
+	Projected float64 `json:"projected"` // al ritmo actual, al cierre del periodo
+}
+
+type targetProgress struct {
+	Target  models.SalesTarget `json:"target"`
+	Amount  *targetMetric      `json:"amount,omitempty"`
+	Units   *targetMetric      `json:"units,omitempty"`
+	Tickets *targetMetric      `json:"tickets,omitempty"`
+}
+
+type leaderboardEntry struct {
+	Rank int `json:"rank"`
+	salesTotals
+}
+
+// SetTarget crea o reemplaza la meta de un vendedor o tienda para un mes
+func (h *TargetHandler) SetTarget(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var target models.SalesTarget
+	if err := json.NewDecoder(r.Body).Decode(&target); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if _, _, err := monthRange(target.Period); err != nil {
+		http.Error(w, "Invalid period format (use YYYY-MM)", http.StatusBadRequest)
+		return
+	}
+	if target.Scope != models.TargetSeller && target.Scope != models.TargetStore {
+		http.Error(w, "Scope must be seller or store", http.StatusBadRequest)
+		return
+	}
+	if target.ScopeID == "" {
+		http.Error(w, "Scope ID is required", http.StatusBadRequest)
+		return
+	}
+	if target.Amount < 0 || target.Units < 0 || target.Tickets < 0 {
+		http.Error(w, "Targets cannot be negative", http.StatusBadRequest)
+		return
+	}
+	if target.Amount == 0 && target.Units == 0 && target.Tickets == 0 {
+		http.Error(w, "At least one target is required", http.StatusBadRequest)
+		return
+	}
+
+	target.UpdatedBy = claims["sub"].(string)
+	target.UpdatedAt = time.Now().Unix()
+
+	var saved models.SalesTarget
+	err := h.collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"period": target.Period, "scope": target.Scope, "scopeId": target.ScopeID},
+		bson.M{"$set": bson.M{
+			"amount":    target.Amount,
+			"units":     target.Units,
+			"tickets":   target.Tickets,
+			"updatedBy": target.UpdatedBy,
+			"updatedAt": target.UpdatedAt,
+		}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		log.Printf("Error saving sales target: %v", err)
+		http.Error(w, "Error saving target", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// ListTargets lista las metas de un mes (?period=YYYY-MM, por defecto el actual)
+func (h *TargetHandler) ListTargets(w http.ResponseWriter, r *http.Request) {
+	period, _, _, ok := periodParam(w, r)
+	if !ok {
+		return
+	}
+
+	targets, err := h.findTargets(context.Background(), bson.M{"period": period})
+	if err != nil {
+		log.Printf("Error fetching sales targets: %v", err)
+		http.Error(w, "Error fetching targets", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(targets)
+}
+
+// DeleteTarget elimina una meta
+func (h *TargetHandler) DeleteTarget(w http.ResponseWriter, r *http.Request) {
+	targetID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.collection.DeleteOne(context.Background(), bson.M{"_id": targetID})
+	if err != nil {
+		log.Printf("Error deleting sales target: %v", err)
+		http.Error(w, "Error deleting target", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Target not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTargetsReport muestra el avance contra la meta en monto, unidades y
+// tickets, con la proyección al cierre del mes según el ritmo actual. Los
+// vendedores sólo ven su propia meta.
+func (h *TargetHandler) GetTargetsReport(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "consultor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	period, start, end, ok := periodParam(w, r)
+	if !ok {
+		return
+	}
+	original, err := figuresParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := bson.M{"period": period}
+	if userRole == "vendedor" {
+		filter["scope"] = models.TargetSeller
+		filter["scopeId"] = claims["sub"].(string)
+	}
+
+	ctx := context.Background()
+	targets, err := h.findTargets(ctx, filter)
+	if err != nil {
+		log.Printf("Error fetching sales targets: %v", err)
+		http.Error(w, "Error fetching targets", http.StatusInternalServerError)
+		return
+	}
+
+	sales, err := h.completedSales(ctx, start, end)
+	if err != nil {
+		log.Printf("Error fetching sales: %v", err)
+		http.Error(w, "Error calculating progress", http.StatusInternalServerError)
+		return
+	}
+	bySeller := salesTotalsBy(sales, func(sale models.Sale) string { return sale.SellerID }, original)
+	byStore := salesTotalsBy(sales, func(sale models.Sale) string { return sale.StoreID }, original)
+
+	// Fracción transcurrida del periodo para proyectar el cierre
+	elapsed := elapsedFraction(time.Now(), start, end)
+
+	progress := []targetProgress{}
+	for _, target := range targets {
+		totals := bySeller[target.ScopeID]
+		if target.Scope == models.TargetStore {
+			totals = byStore[target.ScopeID]
+		}
+
+		entry := targetProgress{Target: target}
+		if target.Amount > 0 {
+			entry.Amount = newTargetMetric(target.Amount, totals.Amount, elapsed)
+		}
+		if target.Units > 0 {
+			entry.Units = newTargetMetric(float64(target.Units), float64(totals.Units), elapsed)
+		}
+		if target.Tickets > 0 {
+			entry.Tickets = newTargetMetric(float64(target.Tickets), float64(totals.Tickets), elapsed)
+		}
+		progress = append(progress, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":         period,
+		"elapsedPercent": roundMoney(clampFraction(elapsed) * 100),
+		"targets":        progress,
+	})
+}
+
+// GetLeaderboard ordena a los vendedores por monto vendido en el mes. Un
+// vendedor sólo ve su propia posición.
+func (h *TargetHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+	userRole := claims["role"].(string)
+
+	if userRole != "vendedor" && userRole != "consultor" && userRole != "admin" {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	period, start, end, ok := periodParam(w, r)
+	if !ok {
+		return
+	}
+	original, err := figuresParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sales, err := h.completedSales(context.Background(), start, end)
+	if err != nil {
+		log.Printf("Error fetching sales: %v", err)
+		http.Error(w, "Error calculating leaderboard", http.StatusInternalServerError)
+		return
+	}
+	totals := salesTotalsBy(sales, func(sale models.Sale) string { return sale.SellerID }, original)
+
+	ranking := make([]leaderboardEntry, 0, len(totals))
+	for _, t := range totals {
+		ranking = append(ranking, leaderboardEntry{salesTotals: t})
+	}
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Amount != ranking[j].Amount {
+			return ranking[i].Amount > ranking[j].Amount
+		}
+		return ranking[i].ID < ranking[j].ID
+	})
+	for i := range ranking {
+		ranking[i].Rank = i + 1
+	}
+
+	if userRole == "vendedor" {
+		own := []leaderboardEntry{}
+		for _, entry := range ranking {
+			if entry.ID == claims["sub"].(string) {
+				own = append(own, entry)
+			}
+		}
+		ranking = own
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"period":  period,
+		"sellers": len(totals),
+		"ranking": ranking,
+	})
+}
+
+func (h *TargetHandler) findTargets(ctx context.Context, filter bson.M) ([]models.SalesTarget, error) {
+	cursor, err := h.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "scope", Value: 1}, {Key: "scopeId", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	targets := []models.SalesTarget{}
+	err = cursor.All(ctx, &targets)
+	return targets, err
+}
+
+// completedSales lista las ventas completadas del periodo
+func (h *TargetHandler) completedSales(ctx context.Context, start, end time.Time) ([]models.Sale, error) {
+	return h.store.Sales().List(ctx, store.SaleFilter{Status: models.SaleCompleted, From: start.Unix(), To: end.Unix()})
+}
+
+// salesTotalsBy suma las ventas agrupadas por la llave que regresa key (el
+// vendedor o la tienda). Con original se usan las cifras con que se
+// registraron las ventas, antes de editarlas.
+func salesTotalsBy(sales []models.Sale, key func(models.Sale) string, original bool) map[string]salesTotals {
+	totals := map[string]salesTotals{}
+	for _, sale := range sales {
+		id := key(sale)
+		if id == "" {
+			continue // ventas sin tienda asignada
+		}
+		if original {
+			sale = services.OriginalFigures(sale)
+		}
+
+		row := totals[id]
+		row.ID = id
+		row.Amount += sale.TotalAmount
+		for _, item := range sale.Items {
+			row.Units += item.Quantity
+		}
+		row.Tickets++
+		totals[id] = row
+	}
+	for id, row := range totals {
+		row.Amount = roundMoney(row.Amount)
+		totals[id] = row
+	}
+	return totals
+}
+
+func newTargetMetric(target, actual, elapsed float64) *targetMetric {
+	metric := &targetMetric{
+		Target:  target,
+		Actual:  actual,
+		Percent: roundMoney(actual / target * 100),
+	}
+	if elapsed > 0 {
+		metric.Projected = roundMoney(actual / clampFraction(elapsed))
+	}
+	return metric
+}
+
+// elapsedFraction es la parte del periodo [start, end) transcurrida en now;
+// 1 una vez cerrado
+func elapsedFraction(now, start, end time.Time) float64 {
+	if !now.Before(end) {
+		return 1
+	}
+	return now.Sub(start).Seconds() / end.Sub(start).Seconds()
+}
+
+func clampFraction(value float64) float64 {
+	if value > 1 {
+		return 1
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
+
+// periodParam lee el mes de la consulta (?period=YYYY-MM, por defecto el actual)
+func periodParam(w http.ResponseWriter, r *http.Request) (string, time.Time, time.Time, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = time.Now().Format("2006-01")
+	}
+
+	start, end, err := monthRange(period)
+	if err != nil {
+		http.Error(w, "Invalid period format (use YYYY-MM)", http.StatusBadRequest)
+		return "", time.Time{}, time.Time{}, false
+	}
+	return period, start, end, true
+}
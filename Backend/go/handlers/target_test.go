@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewTargetMetric(t *testing.T) {
+	tests := []struct {
+		name                     string
+		target, actual, elapsed  float64
+		wantPercent, wantProject float64
+	}{
+		{"half the period at half the target", 1000, 500, 0.5, 50, 1000},
+		{"ahead of pace", 1000, 600, 0.25, 60, 2400},
+		{"closed period projects the actual", 1000, 1200, 1, 120, 1200},
+		{"elapsed above one is clamped", 300, 100, 1.5, 33.33, 100},
+		{"nothing elapsed has no projection", 1000, 0, 0, 0, 0},
+		{"before the period has no projection", 1000, 0, -0.2, 0, 0},
+		{"rounded to cents", 3, 1, 0.3, 33.33, 3.33},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := newTargetMetric(tt.target, tt.actual, tt.elapsed)
+			if metric.Target != tt.target || metric.Actual != tt.actual {
+				t.Errorf("target, actual = %v, %v, want %v, %v", metric.Target, metric.Actual, tt.target, tt.actual)
+			}
+			if metric.Percent != tt.wantPercent {
+				t.Errorf("Percent = %v, want %v", metric.Percent, tt.wantPercent)
+			}
+			if metric.Projected != tt.wantProject {
+				t.Errorf("Projected = %v, want %v", metric.Projected, tt.wantProject)
+			}
+		})
+	}
+}
+
+func TestElapsedFraction(t *testing.T) {
+	start, end, err := monthRange("2024-04")
+	if err != nil {
+		t.Fatalf("monthRange() error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want float64
+	}{
+		{"start of the period", start, 0},
+		{"middle of the period", start.AddDate(0, 0, 15), 0.5},
+		{"end of the period", end, 1},
+		{"after the period", end.AddDate(0, 1, 0), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := elapsedFraction(tt.now, start, end); got != tt.want {
+				t.Errorf("elapsedFraction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Al 75% del mes con 600 vendidos la proyección es 800
+	now := start.Add(end.Sub(start) * 3 / 4)
+	if got := newTargetMetric(1000, 600, elapsedFraction(now, start, end)).Projected; got != 800 {
+		t.Errorf("Projected = %v, want 800", got)
+	}
+}
+
+func TestSalesTotalsBy(t *testing.T) {
+	sales := []models.Sale{
+		{SellerID: "ana", StoreID: "centro", TotalAmount: 10.25, Items: []models.SaleItem{{Quantity: 1}, {Quantity: 2}}},
+		{SellerID: "ana", StoreID: "norte", TotalAmount: 80, Items: []models.SaleItem{{Quantity: 1}},
+			Revision: 1, OriginalTotal: 120, OriginalItems: []models.SaleItem{{Quantity: 3}}},
+		{SellerID: "luis", TotalAmount: 50, Items: []models.SaleItem{{Quantity: 5}}},
+	}
+	bySeller := func(sale models.Sale) string { return sale.SellerID }
+	byStore := func(sale models.Sale) string { return sale.StoreID }
+
+	tests := []struct {
+		name     string
+		key      func(models.Sale) string
+		original bool
+		want     map[string]salesTotals
+	}{
+		{
+			name: "adjusted by seller",
+			key:  bySeller,
+			want: map[string]salesTotals{
+				"ana":  {ID: "ana", Amount: 90.25, Units: 4, Tickets: 2},
+				"luis": {ID: "luis", Amount: 50, Units: 5, Tickets: 1},
+			},
+		},
+		{
+			name:     "original by seller",
+			key:      bySeller,
+			original: true,
+			want: map[string]salesTotals{
+				"ana":  {ID: "ana", Amount: 130.25, Units: 6, Tickets: 2},
+				"luis": {ID: "luis", Amount: 50, Units: 5, Tickets: 1},
+			},
+		},
+		{
+			name: "sales without a store are left out",
+			key:  byStore,
+			want: map[string]salesTotals{
+				"centro": {ID: "centro", Amount: 10.25, Units: 3, Tickets: 1},
+				"norte":  {ID: "norte", Amount: 80, Units: 1, Tickets: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := salesTotalsBy(sales, tt.key, tt.original)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("salesTotalsBy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
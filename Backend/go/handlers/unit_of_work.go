@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"auth-service/uow"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// requestError es un error de validación detectado dentro de una unidad de
+// trabajo. La respuesta se escribe al salir de ella, porque un error
+// transitorio puede repetir la función.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string { return e.message }
+
+// compensate deshace a mano un paso ya aplicado cuando la unidad de trabajo
+// corre sin transacción (servidor standalone); con transacción basta con
+// abortarla.
+func compensate(ctx context.Context, step string, undo func() error) {
+	if uow.InTransaction(ctx) {
+		return
+	}
+	if err := undo(); err != nil {
+		log.Printf("Error %s: %v", step, err)
+	}
+}
+
+// writeUnitError responde el error con que terminó una unidad de trabajo. Los
+// errores conocidos de inventario, puntos y formas de pago llevan su propio
+// estado; el resto se registra y se responde como 500 con message.
+func writeUnitError(w http.ResponseWriter, err error, message string) {
+	var reqErr *requestError
+	switch {
+	case errors.As(err, &reqErr):
+		http.Error(w, reqErr.message, reqErr.status)
+	case err == errInsufficientStock:
+		http.Error(w, "Insufficient stock for one or more products", http.StatusConflict)
+	case err == errUntrackedProduct:
+		http.Error(w, "One or more products have no inventory record", http.StatusConflict)
+	case err == errCustomerNotFound, err == errInsufficientPoints:
+		writeLoyaltyError(w, err)
+	case errors.Is(err, errStoredValueNotFound), errors.Is(err, errStoredValueUnavailable), errors.Is(err, errInsufficientBalance):
+		writeTenderError(w, err)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"auth-service/services"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListUsersIncludesRoleNames(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	admin := env.addRole(t, "admin")
+	env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	env.addUser(t, "Eva", "eva@example.com", "secret", "admin")
+	env.store.Roles().Delete(context.Background(), admin.ID)
+	h := NewUserHandler(env.users)
+
+	w := serve(h.ListUsers, newRequest(t, "GET", "/admin/users", nil, nil))
+	expectStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("response exposes passwords: %s", w.Body.String())
+	}
+
+	var users []services.UserView
+	decodeBody(t, w, &users)
+	roles := map[string]string{}
+	for _, user := range users {
+		roles[user.Email] = user.Role
+	}
+	if roles["ana@example.com"] != "vendedor" || roles["eva@example.com"] != "unknown" {
+		t.Errorf("roles = %v", roles)
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	ana := env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewUserHandler(env.users)
+
+	w := serve(h.GetUser, newRequest(t, "GET", "/admin/users/"+ana.ID, nil, map[string]string{"id": ana.ID}))
+	expectStatus(t, w, http.StatusOK)
+	var user services.UserView
+	decodeBody(t, w, &user)
+	if user != ana {
+		t.Errorf("user = %+v, want %+v", user, ana)
+	}
+
+	missing := primitive.NewObjectID().Hex()
+	w = serve(h.GetUser, newRequest(t, "GET", "/admin/users/"+missing, nil, map[string]string{"id": missing}))
+	expectStatus(t, w, http.StatusNotFound)
+
+	w = serve(h.GetUser, newRequest(t, "GET", "/admin/users/bad", nil, map[string]string{"id": "bad"}))
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestCreateUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	h := NewUserHandler(env.users)
+
+	body := services.NewUser{Name: "Ana", Email: "ana@example.com", Password: "secret", RoleName: "vendedor"}
+	w := serve(h.CreateUser, newRequest(t, "POST", "/admin/users", body, nil))
+	expectStatus(t, w, http.StatusCreated)
+	var user services.UserView
+	decodeBody(t, w, &user)
+	if user.ID == "" || user.Email != "ana@example.com" || user.Role != "vendedor" {
+		t.Errorf("user = %+v", user)
+	}
+
+	w = serve(h.CreateUser, newRequest(t, "POST", "/admin/users", body, nil))
+	expectStatus(t, w, http.StatusConflict)
+
+	body.Email = "Ana@Example.com"
+	w = serve(h.CreateUser, newRequest(t, "POST", "/admin/users", body, nil))
+	expectStatus(t, w, http.StatusConflict)
+
+	body.Email, body.RoleName = "luis@example.com", ""
+	w = serve(h.CreateUser, newRequest(t, "POST", "/admin/users", body, nil))
+	expectStatus(t, w, http.StatusBadRequest)
+
+	body.Email, body.RoleName = "luis@", "vendedor"
+	w = serve(h.CreateUser, newRequest(t, "POST", "/admin/users", body, nil))
+	expectStatus(t, w, http.StatusBadRequest)
+}
+
+func TestUpdateUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	env.addRole(t, "consultor")
+	ana := env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewUserHandler(env.users)
+	vars := map[string]string{"id": ana.ID}
+
+	w := serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, services.UserUpdate{Name: "Ana M.", Email: "ana@example.com", RoleName: "consultor"}, vars))
+	expectStatus(t, w, http.StatusOK)
+	var user services.UserView
+	decodeBody(t, w, &user)
+	if user.Name != "Ana M." || user.Role != "consultor" {
+		t.Errorf("user = %+v", user)
+	}
+
+	// Sin rol conserva el que tiene
+	w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, services.UserUpdate{Name: "Ana", Email: "ana@example.com"}, vars))
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &user)
+	if user.Role != "consultor" {
+		t.Errorf("role = %q, want consultor", user.Role)
+	}
+
+	// Un rol inválido no aplica ningún cambio
+	w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, services.UserUpdate{Name: "Otro", Email: "otro@example.com", RoleName: "gerente"}, vars))
+	expectStatus(t, w, http.StatusBadRequest)
+	stored, err := env.users.Get(context.Background(), mustObjectID(t, ana.ID))
+	if err != nil || stored.Name != "Ana" || stored.Email != "ana@example.com" {
+		t.Errorf("user after failed update = %+v, %v", stored, err)
+	}
+
+	// El correo se normaliza y no puede ser el de otro usuario
+	env.addUser(t, "Eva", "eva@example.com", "secret", "vendedor")
+	w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, services.UserUpdate{Name: "Ana", Email: " EVA@example.com"}, vars))
+	expectStatus(t, w, http.StatusConflict)
+	w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, services.UserUpdate{Name: "Ana", Email: " ANA.M@Example.com "}, vars))
+	expectStatus(t, w, http.StatusOK)
+	decodeBody(t, w, &user)
+	if user.Email != "ana.m@example.com" {
+		t.Errorf("email = %q, want ana.m@example.com", user.Email)
+	}
+
+	// Nombre y correo válido son obligatorios, como en el alta
+	for _, update := range []services.UserUpdate{
+		{Name: "Ana", Email: ""},
+		{Name: "Ana", Email: "   "},
+		{Name: "Ana", Email: "no-es-correo"},
+		{Name: "Ana", Email: "Ana <ana@example.com>"},
+		{Name: "", Email: "ana@example.com"},
+	} {
+		w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+ana.ID, update, vars))
+		expectStatus(t, w, http.StatusBadRequest)
+	}
+	stored, err = env.users.Get(context.Background(), mustObjectID(t, ana.ID))
+	if err != nil || stored.Email != "ana.m@example.com" {
+		t.Errorf("user after invalid updates = %+v, %v", stored, err)
+	}
+
+	missing := primitive.NewObjectID().Hex()
+	w = serve(h.UpdateUser, newRequest(t, "PUT", "/admin/users/"+missing, services.UserUpdate{Name: "X", Email: "x@example.com"}, map[string]string{"id": missing}))
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func TestDeleteUser(t *testing.T) {
+	env := newTestEnv(t)
+	env.addRole(t, "vendedor")
+	ana := env.addUser(t, "Ana", "ana@example.com", "secret", "vendedor")
+	h := NewUserHandler(env.users)
+	vars := map[string]string{"id": ana.ID}
+
+	w := serve(h.DeleteUser, newRequest(t, "DELETE", "/admin/users/"+ana.ID, nil, vars))
+	expectStatus(t, w, http.StatusNoContent)
+
+	w = serve(h.DeleteUser, newRequest(t, "DELETE", "/admin/users/"+ana.ID, nil, vars))
+	expectStatus(t, w, http.StatusNotFound)
+}
+
+func mustObjectID(t *testing.T, hex string) primitive.ObjectID {
+	t.Helper()
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		t.Fatalf("invalid id %q: %v", hex, err)
+	}
+	return id
+}
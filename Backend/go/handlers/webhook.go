@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"auth-service/models"
+	"auth-service/webhooks"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebhookHandler administra las suscripciones de webhooks y su bitácora de entregas
+type WebhookHandler struct {
+	collection *mongo.Collection
+}
+
+func NewWebhookHandler(collection *mongo.Collection) *WebhookHandler {
+	return &WebhookHandler{collection: collection}
+}
+
+type webhookRequest struct {
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active,omitempty"`
+}
+
+func (req webhookRequest) validate() string {
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "URL must be an absolute http or https URL"
+	}
+	if len(req.Events) == 0 {
+		return "At least one event is required"
+	}
+	for _, event := range req.Events {
+		if !webhooks.IsEvent(event) {
+			return "Unknown event " + event + " (use " + strings.Join(webhooks.Events, ", ") + ")"
+		}
+	}
+	return ""
+}
+
+// CreateWebhook registra una suscripción. El secreto para verificar las firmas
+// sólo se devuelve en esta respuesta.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	token := r.Context().Value("token").(*jwt.Token)
+	claims := token.Claims.(jwt.MapClaims)
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("Error generating webhook secret: %v", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	subscription := models.WebhookSubscription{
+		ID:          primitive.NewObjectID(),
+		URL:         req.URL,
+		Events:      req.Events,
+		Secret:      hex.EncodeToString(secret),
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+		CreatedBy:   claims["sub"].(string),
+		CreatedAt:   time.Now().Unix(),
+	}
+	if _, err := h.collection.InsertOne(context.Background(), subscription); err != nil {
+		log.Printf("Error creating webhook: %v", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	// Es la única respuesta con el secreto: no debe quedar guardada para
+	// reintentos con Idempotency-Key
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// ListWebhooks lista las suscripciones sin sus secretos
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	cursor, err := h.collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		log.Printf("Error fetching webhooks: %v", err)
+		http.Error(w, "Error fetching webhooks", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	subscriptions := []models.WebhookSubscription{}
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		log.Printf("Error reading webhooks: %v", err)
+		http.Error(w, "Error reading webhooks", http.StatusInternalServerError)
+		return
+	}
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// UpdateWebhook cambia la URL, los eventos o si la suscripción está activa
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	set := bson.M{"url": req.URL, "events": req.Events, "description": req.Description}
+	if req.Active != nil {
+		set["active"] = *req.Active
+	}
+
+	var subscription models.WebhookSubscription
+	err = h.collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": id},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&subscription)
+	if err == mongo.ErrNoDocuments {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating webhook: %v", err)
+		http.Error(w, "Error updating webhook", http.StatusInternalServerError)
+		return
+	}
+	subscription.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// DeleteWebhook elimina la suscripción; sus entregas quedan en la bitácora
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.collection.DeleteOne(context.Background(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting webhook: %v", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	if result.DeletedCount == 0 {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries consulta la bitácora de entregas, filtrable por
+// ?subscriptionId=, ?event= y ?status=
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := bson.M{}
+	if subscriptionID := query.Get("subscriptionId"); subscriptionID != "" {
+		id, err := primitive.ObjectIDFromHex(subscriptionID)
+		if err != nil {
+			http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+			return
+		}
+		filter["subscriptionId"] = id
+	}
+	if event := query.Get("event"); event != "" {
+		filter["event"] = event
+	}
+	if status := query.Get("status"); status != "" {
+		filter["status"] = status
+	}
+
+	limit, err := queryInt(r, "limit", 100)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	deliveries := h.collection.Database().Collection("webhook_deliveries")
+	cursor, err := deliveries.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		log.Printf("Error fetching webhook deliveries: %v", err)
+		http.Error(w, "Error fetching deliveries", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	results := []models.WebhookDelivery{}
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Printf("Error reading webhook deliveries: %v", err)
+		http.Error(w, "Error reading deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// ReplayDelivery vuelve a enviar una entrega con el mismo contenido. Se crea
+// una entrega nueva para que la original quede intacta en la bitácora.
+func (h *WebhookHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	deliveries := h.collection.Database().Collection("webhook_deliveries")
+
+	var original models.WebhookDelivery
+	if err := deliveries.FindOne(ctx, bson.M{"_id": id}).Decode(&original); err != nil {
+		if err == mongo.ErrNoDocuments {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching webhook delivery: %v", err)
+		http.Error(w, "Error fetching delivery", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().Unix()
+	replay := models.WebhookDelivery{
+		ID:             primitive.NewObjectID(),
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		Event:          original.Event,
+		Payload:        original.Payload,
+		Status:         models.DeliveryPending,
+		NextAttemptAt:  now,
+		ReplayOf:       &original.ID,
+		CreatedAt:      now,
+	}
+	if _, err := deliveries.InsertOne(ctx, replay); err != nil {
+		log.Printf("Error replaying webhook delivery: %v", err)
+		http.Error(w, "Error replaying delivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(replay)
+}
+
+// enqueueWebhook publica un evento de dominio a los webhooks suscritos. Un
+// error no revierte la operación que lo generó; sólo se registra.
+func enqueueWebhook(db *mongo.Database, event string, data interface{}) {
+	if err := webhooks.Enqueue(context.Background(), db, event, data); err != nil {
+		log.Printf("Error enqueuing webhook %s: %v", event, err)
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"log"
+	"time"
+)
+
+// HeldSaleExpirer marca como vencidos los tickets en espera que llevan más
+// tiempo del permitido sin retomarse.
+type HeldSaleExpirer struct {
+	store    store.Store
+	ttl      time.Duration
+	interval time.Duration
+}
+
+func NewHeldSaleExpirer(s store.Store, ttl, interval time.Duration) *HeldSaleExpirer {
+	return &HeldSaleExpirer{store: s, ttl: ttl, interval: interval}
+}
+
+// Start ejecuta la limpieza en segundo plano hasta que se cancele el contexto
+func (e *HeldSaleExpirer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := e.Expire(ctx); err != nil {
+				log.Printf("Held sale expiry failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Expire cambia a "expired" los tickets en espera más viejos que el TTL. Un
+// ticket que se retomó mientras tanto (ErrConflict) se deja como quedó.
+func (e *HeldSaleExpirer) Expire(ctx context.Context) error {
+	cutoff := time.Now().Add(-e.ttl).Unix()
+	held, err := e.store.Sales().List(ctx, store.SaleFilter{Status: models.SaleHeld, To: cutoff})
+	if err != nil {
+		return err
+	}
+
+	expired := 0
+	for _, sale := range held {
+		updated := sale
+		updated.Status = models.SaleExpired
+		err := e.store.Sales().Update(ctx, updated, sale)
+		if err == store.ErrConflict {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		log.Printf("⌛ Expired %d held sales", expired)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHeldSaleExpirer(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	now := time.Now()
+
+	stale := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleHeld, Timestamp: now.Add(-5 * time.Hour).Unix(), TotalAmount: 10}
+	fresh := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleHeld, Timestamp: now.Add(-time.Hour).Unix()}
+	completed := models.Sale{ID: primitive.NewObjectID(), Status: models.SaleCompleted, Timestamp: now.Add(-5 * time.Hour).Unix()}
+	for _, sale := range []models.Sale{stale, fresh, completed} {
+		st.AddSale(sale)
+	}
+
+	if err := NewHeldSaleExpirer(st, 4*time.Hour, time.Minute).Expire(ctx); err != nil {
+		t.Fatalf("Expire() error: %v", err)
+	}
+
+	want := map[primitive.ObjectID]string{
+		stale.ID:     models.SaleExpired,
+		fresh.ID:     models.SaleHeld,
+		completed.ID: models.SaleCompleted,
+	}
+	for id, status := range want {
+		sale, err := st.Sales().Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get() error: %v", err)
+		}
+		if sale.Status != status {
+			t.Errorf("sale %s status = %q, want %q", id.Hex(), sale.Status, status)
+		}
+	}
+	if sale, _ := st.Sales().Get(ctx, stale.ID); sale.TotalAmount != 10 {
+		t.Errorf("expired sale total = %v, want it unchanged", sale.TotalAmount)
+	}
+}
@@ -0,0 +1,112 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"auth-service/webhooks"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// LowStockMonitor revisa periódicamente el inventario y abre una alerta por
+// cada producto que queda por debajo de su stock mínimo. Cada alerta nueva se
+// notifica a las suscripciones de webhooks del evento stock.low.
+type LowStockMonitor struct {
+	db       *mongo.Database
+	interval time.Duration
+}
+
+func NewLowStockMonitor(db *mongo.Database, interval time.Duration) *LowStockMonitor {
+	return &LowStockMonitor{db: db, interval: interval}
+}
+
+// Start ejecuta la revisión en segundo plano hasta que se cancele el contexto
+func (m *LowStockMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := m.Check(ctx); err != nil {
+				log.Printf("Low stock check failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Check abre alertas para productos bajo mínimo y resuelve las que ya se repusieron
+func (m *LowStockMonitor) Check(ctx context.Context) error {
+	inventory := m.db.Collection("inventory")
+	alerts := m.db.Collection("inventory_alerts")
+
+	cursor, err := inventory.Find(ctx, bson.M{"minStock": bson.M{"$gt": 0}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var items []models.InventoryItem
+	if err := cursor.All(ctx, &items); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, item := range items {
+		var open models.InventoryAlert
+		err := alerts.FindOne(ctx, bson.M{"productId": item.ProductID, "status": models.AlertOpen}).Decode(&open)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		hasOpen := err == nil
+
+		if item.Quantity >= item.MinStock {
+			if hasOpen {
+				_, err := alerts.UpdateOne(ctx, bson.M{"_id": open.ID}, bson.M{"$set": bson.M{
+					"status":     models.AlertResolved,
+					"quantity":   item.Quantity,
+					"resolvedAt": now,
+				}})
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if hasOpen {
+			// La alerta ya fue notificada; sólo se actualiza la existencia
+			if _, err := alerts.UpdateOne(ctx, bson.M{"_id": open.ID}, bson.M{"$set": bson.M{"quantity": item.Quantity}}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		alert := models.InventoryAlert{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			MinStock:    item.MinStock,
+			Status:      models.AlertOpen,
+			CreatedAt:   now,
+		}
+		if _, err := alerts.InsertOne(ctx, alert); err != nil {
+			return err
+		}
+
+		log.Printf("⚠️  Low stock: %s (%s) has %d units, minimum is %d", item.ProductName, item.ProductID, item.Quantity, item.MinStock)
+		if err := webhooks.Enqueue(ctx, m.db, webhooks.EventStockLow, alert); err != nil {
+			log.Printf("Error enqueuing low stock webhook: %v", err)
+		}
+	}
+
+	return nil
+}
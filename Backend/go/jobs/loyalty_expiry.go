@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PointsExpirer vence los lotes de puntos que cumplieron su vigencia y los
+// descuenta del saldo de cada cliente.
+type PointsExpirer struct {
+	db       *mongo.Database
+	interval time.Duration
+}
+
+func NewPointsExpirer(db *mongo.Database, interval time.Duration) *PointsExpirer {
+	return &PointsExpirer{db: db, interval: interval}
+}
+
+// Start ejecuta el vencimiento en segundo plano hasta que se cancele el contexto
+func (e *PointsExpirer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := e.Expire(ctx); err != nil {
+				log.Printf("Loyalty points expiry failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Expire vence el saldo restante de los lotes cuya fecha ya pasó
+func (e *PointsExpirer) Expire(ctx context.Context) error {
+	transactions := e.db.Collection("loyalty_transactions")
+	now := time.Now().Unix()
+
+	cursor, err := transactions.Find(ctx, bson.M{
+		"remaining": bson.M{"$gt": 0},
+		"expiresAt": bson.M{"$gt": 0, "$lte": now},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	expired := 0
+	for cursor.Next(ctx) {
+		var lot models.LoyaltyTransaction
+		if err := cursor.Decode(&lot); err != nil {
+			return err
+		}
+
+		// Tomar el remanente en la misma operación que lo pone en cero para no
+		// chocar con una redención simultánea
+		var before models.LoyaltyTransaction
+		err := transactions.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": lot.ID, "remaining": bson.M{"$gt": 0}},
+			bson.M{"$set": bson.M{"remaining": 0}},
+			options.FindOneAndUpdate().SetReturnDocument(options.Before),
+		).Decode(&before)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var customer models.Customer
+		err = e.db.Collection("customers").FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": lot.CustomerID},
+			bson.M{"$inc": bson.M{"pointsBalance": -before.Remaining}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&customer)
+		if err != nil {
+			return err
+		}
+
+		_, err = transactions.InsertOne(ctx, models.LoyaltyTransaction{
+			ID:           primitive.NewObjectID(),
+			CustomerID:   lot.CustomerID,
+			Type:         models.LoyaltyExpire,
+			Points:       -before.Remaining,
+			BalanceAfter: customer.PointsBalance,
+			SaleID:       lot.SaleID,
+			Timestamp:    now,
+		})
+		if err != nil {
+			return err
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		log.Printf("⌛ Expired %d loyalty point lots", expired)
+	}
+	return cursor.Err()
+}
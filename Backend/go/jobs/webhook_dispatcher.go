@@ -0,0 +1,165 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"auth-service/webhooks"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxWebhookBackoff limita la espera entre reintentos
+const maxWebhookBackoff = 6 * time.Hour
+
+// WebhookDispatcher envía las entregas de webhooks pendientes y reintenta las
+// fallidas con espera exponencial (backoff, 2×backoff, 4×backoff...).
+type WebhookDispatcher struct {
+	db          *mongo.Database
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+}
+
+func NewWebhookDispatcher(db *mongo.Database, interval time.Duration, maxAttempts int, backoff time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:          db,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Start ejecuta el envío en segundo plano hasta que se cancele el contexto
+func (d *WebhookDispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.Dispatch(ctx); err != nil {
+				log.Printf("Webhook dispatch failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Dispatch envía las entregas vencidas. Cada una se aparta primero moviendo
+// su siguiente intento, para que otra instancia no la envíe al mismo tiempo.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context) error {
+	deliveries := d.db.Collection("webhook_deliveries")
+
+	for {
+		now := time.Now()
+		var delivery models.WebhookDelivery
+		err := deliveries.FindOneAndUpdate(
+			ctx,
+			bson.M{"status": models.DeliveryPending, "nextAttemptAt": bson.M{"$lte": now.Unix()}},
+			bson.M{"$set": bson.M{"nextAttemptAt": now.Add(time.Minute).Unix()}},
+			options.FindOneAndUpdate().SetSort(bson.M{"nextAttemptAt": 1}),
+		).Decode(&delivery)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := d.deliver(ctx, delivery); err != nil {
+			return err
+		}
+	}
+}
+
+// deliver hace un intento de envío y registra el resultado
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery models.WebhookDelivery) error {
+	deliveries := d.db.Collection("webhook_deliveries")
+	now := time.Now()
+
+	var subscription models.WebhookSubscription
+	err := d.db.Collection("webhook_subscriptions").FindOne(ctx, bson.M{"_id": delivery.SubscriptionID}).Decode(&subscription)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err == mongo.ErrNoDocuments || !subscription.Active {
+		_, err := deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": bson.M{
+			"status":    models.DeliveryFailed,
+			"lastError": "Subscription deleted or inactive",
+		}})
+		return err
+	}
+
+	statusCode, sendErr := d.send(ctx, subscription, delivery, now)
+	set := d.outcome(delivery, subscription, statusCode, sendErr, now)
+
+	_, err = deliveries.UpdateOne(ctx, bson.M{"_id": delivery.ID}, bson.M{"$set": set})
+	return err
+}
+
+// outcome son los campos que quedan en la entrega tras un intento: entregada,
+// pendiente con el siguiente intento más espaciado o failed al agotar los
+// intentos
+func (d *WebhookDispatcher) outcome(delivery models.WebhookDelivery, subscription models.WebhookSubscription, statusCode int, sendErr error, now time.Time) bson.M {
+	attempts := delivery.Attempts + 1
+	set := bson.M{"attempts": attempts, "lastStatusCode": statusCode}
+	if sendErr == nil {
+		set["status"] = models.DeliveryDelivered
+		set["deliveredAt"] = now.Unix()
+		set["lastError"] = ""
+		return set
+	}
+
+	set["lastError"] = sendErr.Error()
+	if attempts >= d.maxAttempts {
+		set["status"] = models.DeliveryFailed
+		log.Printf("Webhook delivery %s (%s) to %s failed after %d attempts: %v", delivery.ID.Hex(), delivery.Event, subscription.URL, attempts, sendErr)
+	} else {
+		wait := d.backoff << (attempts - 1)
+		if wait <= 0 || wait > maxWebhookBackoff {
+			wait = maxWebhookBackoff
+		}
+		set["nextAttemptAt"] = now.Add(wait).Unix()
+	}
+	return set
+}
+
+// send hace el POST firmado; cualquier respuesta fuera de 2xx es un fallo
+func (d *WebhookDispatcher) send(ctx context.Context, subscription models.WebhookSubscription, delivery models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhooks.HeaderEvent, delivery.Event)
+	req.Header.Set(webhooks.HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(webhooks.HeaderTimestamp, fmt.Sprint(now.Unix()))
+	req.Header.Set(webhooks.HeaderSignature, webhooks.Sign(subscription.Secret, now.Unix(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
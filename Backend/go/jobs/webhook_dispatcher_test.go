@@ -0,0 +1,113 @@
+package jobs
+
+import (
+	"auth-service/models"
+	"auth-service/webhooks"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookOutcome(t *testing.T) {
+	d := &WebhookDispatcher{maxAttempts: 5, backoff: time.Minute}
+	now := time.Unix(1700000000, 0)
+	subscription := models.WebhookSubscription{URL: "https://example.com/hook"}
+	failed := errors.New("receiver responded with status 503")
+
+	tests := []struct {
+		name       string
+		attempts   int
+		statusCode int
+		err        error
+		want       bson.M
+	}{
+		{
+			name:       "delivered",
+			attempts:   1,
+			statusCode: 200,
+			want:       bson.M{"attempts": 2, "lastStatusCode": 200, "status": models.DeliveryDelivered, "deliveredAt": now.Unix(), "lastError": ""},
+		},
+		{
+			name:       "first failure waits the base backoff",
+			statusCode: 503,
+			err:        failed,
+			want:       bson.M{"attempts": 1, "lastStatusCode": 503, "lastError": failed.Error(), "nextAttemptAt": now.Add(time.Minute).Unix()},
+		},
+		{
+			name:     "wait doubles on each attempt",
+			attempts: 3,
+			err:      failed,
+			want:     bson.M{"attempts": 4, "lastStatusCode": 0, "lastError": failed.Error(), "nextAttemptAt": now.Add(8 * time.Minute).Unix()},
+		},
+		{
+			name:       "last attempt marks the delivery failed",
+			attempts:   4,
+			statusCode: 500,
+			err:        failed,
+			want:       bson.M{"attempts": 5, "lastStatusCode": 500, "lastError": failed.Error(), "status": models.DeliveryFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := models.WebhookDelivery{ID: primitive.NewObjectID(), Event: webhooks.EventSaleCompleted, Attempts: tt.attempts}
+			if got := d.outcome(delivery, subscription, tt.statusCode, tt.err, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outcome() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// La espera no pasa de maxWebhookBackoff
+	d = &WebhookDispatcher{maxAttempts: 100, backoff: time.Minute}
+	got := d.outcome(models.WebhookDelivery{Attempts: 30}, subscription, 0, failed, now)["nextAttemptAt"]
+	if got != now.Add(maxWebhookBackoff).Unix() {
+		t.Errorf("nextAttemptAt = %v, want %v", got, now.Add(maxWebhookBackoff).Unix())
+	}
+}
+
+func TestWebhookSend(t *testing.T) {
+	status := http.StatusNoContent
+	var received *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d := &WebhookDispatcher{client: server.Client()}
+	subscription := models.WebhookSubscription{URL: server.URL, Secret: "s3cr3t"}
+	delivery := models.WebhookDelivery{ID: primitive.NewObjectID(), Event: webhooks.EventSaleCompleted, Payload: `{"id":"1"}`}
+	now := time.Unix(1700000000, 0)
+
+	statusCode, err := d.send(context.Background(), subscription, delivery, now)
+	if err != nil || statusCode != http.StatusNoContent {
+		t.Fatalf("send() = %d, %v, want 204 and no error", statusCode, err)
+	}
+	if string(body) != delivery.Payload {
+		t.Errorf("body = %q, want %q", body, delivery.Payload)
+	}
+	if received.Header.Get(webhooks.HeaderEvent) != delivery.Event || received.Header.Get(webhooks.HeaderDelivery) != delivery.ID.Hex() {
+		t.Errorf("headers = %v", received.Header)
+	}
+	timestamp, _ := strconv.ParseInt(received.Header.Get(webhooks.HeaderTimestamp), 10, 64)
+	if timestamp != now.Unix() || !webhooks.Verify(subscription.Secret, timestamp, body, received.Header.Get(webhooks.HeaderSignature)) {
+		t.Errorf("signature does not verify with the subscription secret")
+	}
+
+	status = http.StatusServiceUnavailable
+	statusCode, err = d.send(context.Background(), subscription, delivery, now)
+	if err == nil || statusCode != http.StatusServiceUnavailable {
+		t.Errorf("send() to a failing receiver = %d, %v, want 503 and an error", statusCode, err)
+	}
+}
@@ -1,22 +1,31 @@
 package main
 
 import (
+	"auth-service/catalog"
+	"auth-service/cfdi"
+	"auth-service/events"
 	"auth-service/handlers"
+	"auth-service/jobs"
 	"auth-service/middleware"
-	"auth-service/models"
+	"auth-service/migrations"
+	"auth-service/outbox"
+	"auth-service/services"
+	"auth-service/store"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 	"github.com/rs/cors"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func main() {
@@ -47,16 +56,164 @@ func main() {
 
 	db := client.Database(os.Getenv("DB_NAME"))
 
-	// Initialize database (create collections and admin user)
-	if err := initDatabase(db); err != nil {
-		log.Fatal("Database initialization failed: ", err)
+	// Usuarios, roles y ventas en MongoDB o PostgreSQL según STORAGE_BACKEND
+	dataStore, sqlDB, err := newStore(db)
+	if err != nil {
+		log.Fatal("Storage initialization failed: ", err)
 	}
+	target := migrations.Target{DB: db, Store: dataStore}
+
+	// go run . migrate up|down [n]|status, o migrate postgres up|down [n]|status
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), target, sqlDB, os.Args[2:]); err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		return
+	}
+
+	// Aplicar las migraciones pendientes al arrancar (esquema de PostgreSQL,
+	// colecciones, índices, roles básicos y usuario admin), salvo
+	// MIGRATE_ON_START=false
+	if getEnv("MIGRATE_ON_START", "true") == "true" {
+		if err := migrateUp(context.Background(), target, sqlDB); err != nil {
+			log.Fatal("Database migration failed: ", err)
+		}
+	} else {
+		pending, err := pendingMigrations(context.Background(), db, sqlDB)
+		if err != nil {
+			log.Fatal("Error checking migrations: ", err)
+		}
+		if pending > 0 {
+			log.Printf("⚠️  %d pending migrations; run `migrate up`", pending)
+		}
+	}
+
+	roleService := services.NewRoleService(dataStore)
+	userService := services.NewUserService(dataStore)
+	saleService := services.NewSaleService(dataStore, roleService)
+
+	inviteTTL, err := time.ParseDuration(getEnv("INVITE_TTL", "72h"))
+	if err != nil || inviteTTL <= 0 {
+		log.Fatal("Invalid INVITE_TTL: ", getEnv("INVITE_TTL", "72h"))
+	}
+	inviteService := services.NewInviteService(dataStore, inviteTTL)
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db.Collection("users"))
-	salesHandler := handlers.NewSalesHandler(db.Collection("sales"))
-	roleHandler := handlers.NewRoleHandler(db.Collection("roles"))
-	userHandler := handlers.NewUserHandler(db.Collection("users")) // Nuevo handler
+	authHandler := handlers.NewAuthHandler(userService, loadRegistrationPolicy(roleService))
+	inviteHandler := handlers.NewInviteHandler(inviteService)
+	catalogClient := catalog.NewClient(getEnv("CATALOG_API_URL", "http://localhost:3000/api"))
+	approvalPolicy := loadApprovalPolicy(userService, roleService)
+
+	// Eventos de venta en tiempo real: change stream de MongoDB o, en un
+	// servidor standalone o con las ventas en PostgreSQL, los que publica el
+	// outbox
+	historySize, err := strconv.Atoi(getEnv("SALE_EVENTS_HISTORY", "1000"))
+	if err != nil || historySize <= 0 {
+		log.Fatal("Invalid SALE_EVENTS_HISTORY: ", getEnv("SALE_EVENTS_HISTORY", "1000"))
+	}
+	changeStreamRetry, err := time.ParseDuration(getEnv("SALE_EVENTS_RETRY", "5m"))
+	if err != nil {
+		log.Fatal("Invalid SALE_EVENTS_RETRY: ", err)
+	}
+	saleEvents := events.NewBroker(historySize)
+	if _, ok := dataStore.(*store.Mongo); ok {
+		saleEvents.WatchSales(context.Background(), db.Collection("sales"), changeStreamRetry)
+	}
+
+	salesHandler := handlers.NewSalesHandler(db, dataStore, saleService, catalogClient, approvalPolicy)
+	roleHandler := handlers.NewRoleHandler(roleService)
+	userHandler := handlers.NewUserHandler(userService) // Nuevo handler
+	supplierHandler := handlers.NewSupplierHandler(db.Collection("suppliers"))
+	purchaseOrderHandler := handlers.NewPurchaseOrderHandler(db.Collection("purchase_orders"), getEnv("INVENTORY_COSTING_METHOD", "weighted_average"))
+	inventoryHandler := handlers.NewInventoryHandler(db.Collection("inventory"), dataStore, catalogClient)
+	stockCountHandler := handlers.NewStockCountHandler(db.Collection("stock_counts"))
+
+	forfeitPercent, err := strconv.ParseFloat(getEnv("LAYAWAY_FORFEIT_PERCENT", "10"), 64)
+	if err != nil || forfeitPercent < 0 || forfeitPercent > 100 {
+		log.Fatal("Invalid LAYAWAY_FORFEIT_PERCENT: ", getEnv("LAYAWAY_FORFEIT_PERCENT", "10"))
+	}
+	layawayHandler := handlers.NewLayawayHandler(db, dataStore, forfeitPercent, approvalPolicy)
+	quoteHandler := handlers.NewQuoteHandler(db.Collection("quotes"), dataStore, catalogClient)
+	invoiceHandler := newInvoiceHandler(db, dataStore, catalogClient)
+
+	validityDays, err := strconv.Atoi(getEnv("STORED_VALUE_VALIDITY_DAYS", "365"))
+	if err != nil || validityDays < 0 {
+		log.Fatal("Invalid STORED_VALUE_VALIDITY_DAYS: ", getEnv("STORED_VALUE_VALIDITY_DAYS", "365"))
+	}
+	storedValueHandler := handlers.NewStoredValueHandler(db.Collection("stored_value_accounts"), validityDays, approvalPolicy)
+	customerHandler := handlers.NewCustomerHandler(db.Collection("customers"))
+	loyaltyHandler := handlers.NewLoyaltyHandler(db.Collection("loyalty_rules"))
+	commissionHandler := handlers.NewCommissionHandler(db, dataStore, catalogClient)
+	targetHandler := handlers.NewTargetHandler(db.Collection("sales_targets"), dataStore)
+	approvalHandler := handlers.NewApprovalHandler(db.Collection("sale_approvals"), approvalPolicy)
+	eventsHandler := handlers.NewEventsHandler(roleService, saleEvents)
+	webhookHandler := handlers.NewWebhookHandler(db.Collection("webhook_subscriptions"))
+	outboxHandler := handlers.NewOutboxHandler(db.Collection("outbox"))
+
+	// Revisión periódica de stock bajo
+	checkInterval, err := time.ParseDuration(getEnv("LOW_STOCK_CHECK_INTERVAL", "15m"))
+	if err != nil {
+		log.Fatal("Invalid LOW_STOCK_CHECK_INTERVAL: ", err)
+	}
+	lowStockMonitor := jobs.NewLowStockMonitor(db, checkInterval)
+	lowStockMonitor.Start(context.Background())
+
+	// Vencimiento de tickets en espera
+	heldSaleTTL, err := time.ParseDuration(getEnv("HELD_SALE_TTL", "4h"))
+	if err != nil {
+		log.Fatal("Invalid HELD_SALE_TTL: ", err)
+	}
+	heldSaleExpirer := jobs.NewHeldSaleExpirer(dataStore, heldSaleTTL, 5*time.Minute)
+	heldSaleExpirer.Start(context.Background())
+
+	// Vencimiento de puntos del programa de lealtad
+	pointsExpiryInterval, err := time.ParseDuration(getEnv("LOYALTY_EXPIRY_CHECK_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatal("Invalid LOYALTY_EXPIRY_CHECK_INTERVAL: ", err)
+	}
+	pointsExpirer := jobs.NewPointsExpirer(db, pointsExpiryInterval)
+	pointsExpirer.Start(context.Background())
+
+	// Envío de webhooks con reintentos
+	webhookInterval, err := time.ParseDuration(getEnv("WEBHOOK_DISPATCH_INTERVAL", "10s"))
+	if err != nil {
+		log.Fatal("Invalid WEBHOOK_DISPATCH_INTERVAL: ", err)
+	}
+	webhookAttempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || webhookAttempts <= 0 {
+		log.Fatal("Invalid WEBHOOK_MAX_ATTEMPTS: ", getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	}
+	webhookBackoff, err := time.ParseDuration(getEnv("WEBHOOK_BACKOFF", "30s"))
+	if err != nil || webhookBackoff <= 0 {
+		log.Fatal("Invalid WEBHOOK_BACKOFF: ", getEnv("WEBHOOK_BACKOFF", "30s"))
+	}
+	webhookDispatcher := jobs.NewWebhookDispatcher(db, webhookInterval, webhookAttempts, webhookBackoff)
+	webhookDispatcher.Start(context.Background())
+
+	// Outbox: publica los eventos guardados junto con las ventas
+	outboxInterval, err := time.ParseDuration(getEnv("OUTBOX_DISPATCH_INTERVAL", "1s"))
+	if err != nil {
+		log.Fatal("Invalid OUTBOX_DISPATCH_INTERVAL: ", err)
+	}
+	outboxAttempts, err := strconv.Atoi(getEnv("OUTBOX_MAX_ATTEMPTS", "10"))
+	if err != nil || outboxAttempts <= 0 {
+		log.Fatal("Invalid OUTBOX_MAX_ATTEMPTS: ", getEnv("OUTBOX_MAX_ATTEMPTS", "10"))
+	}
+	outboxBackoff, err := time.ParseDuration(getEnv("OUTBOX_BACKOFF", "5s"))
+	if err != nil || outboxBackoff <= 0 {
+		log.Fatal("Invalid OUTBOX_BACKOFF: ", getEnv("OUTBOX_BACKOFF", "5s"))
+	}
+	outboxSinks := []outbox.Sink{
+		handlers.NewLoyaltySink(db, dataStore),
+		handlers.NewCatalogCostSink(db, catalogClient),
+		outbox.NewWebhookSink(db),
+		outbox.NewBrokerSink(saleEvents),
+	}
+	if brokerURL := getEnv("OUTBOX_BROKER_URL", ""); brokerURL != "" {
+		outboxSinks = append(outboxSinks, outbox.NewHTTPSink(brokerURL))
+	}
+	outboxDispatcher := outbox.NewDispatcher(db, outboxInterval, outboxAttempts, outboxBackoff, outboxSinks...)
+	outboxDispatcher.Start(context.Background())
 
 	// Setup router
 	router := mux.NewRouter()
@@ -64,18 +221,74 @@ func main() {
 	// Public routes
 	router.HandleFunc("/login", authHandler.Login).Methods("POST", "OPTIONS")
 	router.HandleFunc("/register", authHandler.Register).Methods("POST", "OPTIONS")
+	router.HandleFunc("/invites/accept", inviteHandler.AcceptInvite).Methods("POST", "OPTIONS")
+
+	// Sale event stream (EventSource no envía encabezados: acepta ?access_token=)
+	router.Handle("/events/sales", middleware.TokenFromQuery(middleware.AuthMiddleware(http.HandlerFunc(eventsHandler.StreamSales)))).Methods("GET", "OPTIONS")
 
 	// Protected routes
 	authRouter := router.PathPrefix("/").Subrouter()
 	authRouter.Use(middleware.AuthMiddleware)
+	authRouter.Use(middleware.IdempotencyMiddleware(db.Collection("idempotency_keys")))
 
 	// Sales routes
 	authRouter.HandleFunc("/sales", salesHandler.CreateSale).Methods("POST", "OPTIONS")
 	authRouter.HandleFunc("/sales", salesHandler.GetSales).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/sales/held", salesHandler.ListHeldSales).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/sales/sync", salesHandler.SyncSales).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/sales/{id}/complete", salesHandler.CompleteSale).Methods("POST", "OPTIONS")
 	authRouter.HandleFunc("/sales/{id}", salesHandler.GetSale).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/sales/{id}/revisions", salesHandler.GetSaleRevisions).Methods("GET", "OPTIONS")
 	authRouter.HandleFunc("/sales/{id}", salesHandler.UpdateSale).Methods("PUT", "OPTIONS")
 	authRouter.HandleFunc("/sales/{id}", salesHandler.DeleteSale).Methods("DELETE", "OPTIONS")
 	authRouter.HandleFunc("/reports/sales", salesHandler.GetSalesReport).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/reports/commissions", commissionHandler.GetCommissionReport).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/reports/targets", targetHandler.GetTargetsReport).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/reports/leaderboard", targetHandler.GetLeaderboard).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/reports/layaways", layawayHandler.GetLayawayReport).Methods("GET", "OPTIONS")
+
+	// Quote routes
+	authRouter.HandleFunc("/quotes", quoteHandler.CreateQuote).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/quotes", quoteHandler.GetQuotes).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/quotes/{id}", quoteHandler.GetQuote).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/quotes/{id}/print", quoteHandler.PrintQuote).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/quotes/{id}/convert", quoteHandler.ConvertQuote).Methods("POST", "OPTIONS")
+
+	// Invoice routes
+	authRouter.HandleFunc("/sales/{id}/invoice", invoiceHandler.CreateInvoice).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/sales/{id}/invoice", invoiceHandler.GetInvoiceXML).Methods("GET", "OPTIONS")
+
+	// Gift card and store credit routes
+	authRouter.HandleFunc("/stored-value", storedValueHandler.IssueStoredValue).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/stored-value/{code}", storedValueHandler.GetStoredValue).Methods("GET", "OPTIONS")
+
+	// Customer and loyalty routes
+	authRouter.HandleFunc("/customers", customerHandler.CreateCustomer).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/customers", customerHandler.ListCustomers).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/customers/{id}", customerHandler.GetCustomer).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/customers/{id}/points", customerHandler.GetPointsLedger).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/loyalty/rules", loyaltyHandler.GetRules).Methods("GET", "OPTIONS")
+
+	// Manager approval routes
+	authRouter.HandleFunc("/approvals", approvalHandler.RequestApproval).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/approvals", approvalHandler.ListApprovals).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/approvals/{id}/approve", approvalHandler.ApproveRequest).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/approvals/{id}/reject", approvalHandler.RejectRequest).Methods("POST", "OPTIONS")
+
+	// Layaway routes
+	authRouter.HandleFunc("/layaways", layawayHandler.CreateLayaway).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/layaways/{id}/payments", layawayHandler.AddPayment).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/layaways/{id}/cancel", layawayHandler.CancelLayaway).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/reports/purchase-orders/open", purchaseOrderHandler.GetOpenPurchaseOrdersReport).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/reports/reorder-suggestions", inventoryHandler.GetReorderSuggestions).Methods("GET", "OPTIONS")
+
+	// Inventory routes
+	authRouter.HandleFunc("/inventory", inventoryHandler.ListInventory).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/inventory/alerts", inventoryHandler.GetAlerts).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/inventory/counts", stockCountHandler.ListStockCounts).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/inventory/counts/{id}", stockCountHandler.GetStockCount).Methods("GET", "OPTIONS")
+	authRouter.HandleFunc("/inventory/counts/{id}/entries", stockCountHandler.SubmitCountEntries).Methods("POST", "OPTIONS")
+	authRouter.HandleFunc("/inventory/{productId}/movements", inventoryHandler.GetMovements).Methods("GET", "OPTIONS")
 
 	// Admin routes
 	adminRouter := authRouter.PathPrefix("/admin").Subrouter()
@@ -90,6 +303,7 @@ func main() {
 	adminRouter.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET", "OPTIONS")
 	adminRouter.HandleFunc("/users/{id}", userHandler.UpdateUser).Methods("PUT", "OPTIONS")
 	adminRouter.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/invites", inviteHandler.CreateInvite).Methods("POST", "OPTIONS")
 
 	// Role management endpoints
 	adminRouter.HandleFunc("/roles", roleHandler.CreateRole).Methods("POST", "OPTIONS")
@@ -97,11 +311,67 @@ func main() {
 	adminRouter.HandleFunc("/roles/{id}", roleHandler.UpdateRole).Methods("PUT", "OPTIONS")
 	adminRouter.HandleFunc("/roles/{id}", roleHandler.DeleteRole).Methods("DELETE", "OPTIONS")
 
+	// Supplier endpoints
+	adminRouter.HandleFunc("/suppliers", supplierHandler.ListSuppliers).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/suppliers", supplierHandler.CreateSupplier).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/suppliers/{id}", supplierHandler.GetSupplier).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/suppliers/{id}", supplierHandler.UpdateSupplier).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/suppliers/{id}", supplierHandler.DeleteSupplier).Methods("DELETE", "OPTIONS")
+
+	// Purchase order endpoints
+	adminRouter.HandleFunc("/purchase-orders", purchaseOrderHandler.ListPurchaseOrders).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/purchase-orders", purchaseOrderHandler.CreatePurchaseOrder).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/purchase-orders/{id}", purchaseOrderHandler.GetPurchaseOrder).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/purchase-orders/{id}/approve", purchaseOrderHandler.ApprovePurchaseOrder).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/purchase-orders/{id}/receive", purchaseOrderHandler.ReceivePurchaseOrder).Methods("POST", "OPTIONS")
+
+	// Stock level endpoints
+	adminRouter.HandleFunc("/inventory/{productId}", inventoryHandler.UpdateInventoryItem).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/{productId}/levels", inventoryHandler.SetStockLevels).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/{productId}/adjustments", inventoryHandler.CreateAdjustment).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/reconcile", inventoryHandler.ReconcileInventory).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/import", inventoryHandler.ImportLegacyInventory).Methods("POST", "OPTIONS")
+
+	// Stock count endpoints
+	adminRouter.HandleFunc("/inventory/counts", stockCountHandler.OpenStockCount).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/counts/{id}/approve", stockCountHandler.ApproveStockCount).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/inventory/counts/{id}/cancel", stockCountHandler.CancelStockCount).Methods("POST", "OPTIONS")
+
+	// Loyalty program endpoints
+	adminRouter.HandleFunc("/loyalty/rules", loyaltyHandler.UpdateRules).Methods("PUT", "OPTIONS")
+
+	// Commission endpoints
+	adminRouter.HandleFunc("/commissions/rules", commissionHandler.GetRules).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/commissions/rules", commissionHandler.UpdateRules).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/commissions/{period}/close", commissionHandler.ClosePeriod).Methods("POST", "OPTIONS")
+
+	// Sales target endpoints
+	adminRouter.HandleFunc("/targets", targetHandler.SetTarget).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/targets", targetHandler.ListTargets).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/targets/{id}", targetHandler.DeleteTarget).Methods("DELETE", "OPTIONS")
+
+	// Stored value endpoints
+	adminRouter.HandleFunc("/stored-value/{code}/void", storedValueHandler.VoidStoredValue).Methods("POST", "OPTIONS")
+
+	// Webhook endpoints
+	adminRouter.HandleFunc("/webhooks", webhookHandler.CreateWebhook).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/webhooks", webhookHandler.ListWebhooks).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/webhooks/deliveries", webhookHandler.ListDeliveries).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/webhooks/deliveries/{id}/replay", webhookHandler.ReplayDelivery).Methods("POST", "OPTIONS")
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.UpdateWebhook).Methods("PUT", "OPTIONS")
+	adminRouter.HandleFunc("/webhooks/{id}", webhookHandler.DeleteWebhook).Methods("DELETE", "OPTIONS")
+	adminRouter.HandleFunc("/outbox", outboxHandler.ListEvents).Methods("GET", "OPTIONS")
+	adminRouter.HandleFunc("/outbox/{id}/retry", outboxHandler.RetryEvent).Methods("POST", "OPTIONS")
+
+	// Global invoice endpoint
+	adminRouter.HandleFunc("/invoices/global", invoiceHandler.CreateGlobalInvoice).Methods("POST", "OPTIONS")
+
 	// Configure CORS
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Approval-Id", "X-Manager-Email", "X-Manager-Password", "Idempotency-Key", "Last-Event-ID"},
+		ExposedHeaders:   []string{"Idempotent-Replayed"},
 		AllowCredentials: true,
 		Debug:            true,
 	})
@@ -112,19 +382,79 @@ func main() {
 	// Start server with clear URL information
 	log.Println("🚀 Server starting at http://" + serverAddress)
 	log.Printf("📌 Available endpoints:")
-	log.Printf("   - POST   http://%s/register", serverAddress)
+	log.Printf("   - POST   http://%s/register (Disabled unless SELF_REGISTRATION=true)", serverAddress)
+	log.Printf("   - POST   http://%s/invites/accept", serverAddress)
 	log.Printf("   - POST   http://%s/login", serverAddress)
 	log.Printf("   - POST   http://%s/sales (Requires VENDEDOR role)", serverAddress)
-	log.Printf("   - GET    http://%s/sales (Requires VENDEDOR role)", serverAddress)
-	log.Printf("   - GET    http://%s/sales/{id} (Requires VENDEDOR role)", serverAddress)
-	log.Printf("   - PUT    http://%s/sales/{id} (Requires VENDEDOR role)", serverAddress)
-	log.Printf("   - DELETE http://%s/sales/{id} (Requires VENDEDOR role)", serverAddress)
-	log.Printf("   - GET    http://%s/reports/sales (Requires CONSULTOR role)", serverAddress)
+	log.Printf("   - GET    http://%s/sales?sellerId=&storeId=&status=&start=&end= (VENDEDOR sees own, VIEW_SALES permission sees all)", serverAddress)
+	log.Printf("   - GET    http://%s/sales/held (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - GET    http://%s/events/sales?storeId=&sellerId= (SSE; VENDEDOR own sales, VIEW_SALES permission all)", serverAddress)
+	log.Printf("   - POST   http://%s/sales/sync (Requires VENDEDOR role; batch of offline sales)", serverAddress)
+	log.Printf("   - POST   http://%s/sales/{id}/complete (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - GET    http://%s/sales/{id} (VENDEDOR own sales, VIEW_SALES permission any sale)", serverAddress)
+	log.Printf("   - GET    http://%s/sales/{id}/revisions (VENDEDOR own sales, VIEW_SALES permission any sale)", serverAddress)
+	log.Printf("   - PUT    http://%s/sales/{id} (Requires VENDEDOR role; manager approval and reason if completed)", serverAddress)
+	log.Printf("   - DELETE http://%s/sales/{id} (Requires VENDEDOR role; manager approval if completed or layaway)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/sales?figures=original|adjusted (Requires CONSULTOR role)", serverAddress)
+	log.Printf("   - POST   http://%s/quotes (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - GET    http://%s/quotes/{id}/print (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - POST   http://%s/quotes/{id}/convert (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - POST   http://%s/sales/{id}/invoice (Requires VENDEDOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/sales/{id}/invoice (Requires VENDEDOR or ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/stored-value (Requires VENDEDOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/stored-value/{code} (Requires authentication)", serverAddress)
+	log.Printf("   - POST   http://%s/customers (Requires VENDEDOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/customers?q= (Requires authentication)", serverAddress)
+	log.Printf("   - GET    http://%s/customers/{id}/points (Requires authentication)", serverAddress)
+	log.Printf("   - GET    http://%s/loyalty/rules (Requires authentication)", serverAddress)
+	log.Printf("   - POST   http://%s/approvals (Requires authentication)", serverAddress)
+	log.Printf("   - GET    http://%s/approvals?status= (APPROVE_SALES permission sees all, others own)", serverAddress)
+	log.Printf("   - POST   http://%s/approvals/{id}/approve (Requires APPROVE_SALES permission)", serverAddress)
+	log.Printf("   - POST   http://%s/approvals/{id}/reject (Requires APPROVE_SALES permission)", serverAddress)
+	log.Printf("   - POST   http://%s/layaways (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - POST   http://%s/layaways/{id}/payments (Requires VENDEDOR role)", serverAddress)
+	log.Printf("   - POST   http://%s/layaways/{id}/cancel (Requires VENDEDOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/layaways (Requires CONSULTOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/commissions?period=YYYY-MM (VENDEDOR sees own, CONSULTOR/ADMIN see all)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/targets?period=YYYY-MM&figures=original|adjusted (VENDEDOR sees own, CONSULTOR/ADMIN see all)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/leaderboard?period=YYYY-MM&figures=original|adjusted (VENDEDOR sees own rank, CONSULTOR/ADMIN see all)", serverAddress)
 	log.Printf("   - GET    http://%s/admin/users (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/invites (Requires ADMIN role)", serverAddress)
 	log.Printf("   - POST   http://%s/admin/roles (Requires ADMIN role)", serverAddress)
 	log.Printf("   - GET    http://%s/admin/roles (Requires ADMIN role)", serverAddress)
 	log.Printf("   - PUT    http://%s/admin/roles/{id} (Requires ADMIN role)", serverAddress)
 	log.Printf("   - DELETE http://%s/admin/roles/{id} (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/suppliers (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/purchase-orders (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/purchase-orders/{id}/approve (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/purchase-orders/{id}/receive (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/purchase-orders/open (Requires CONSULTOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/reports/reorder-suggestions (Requires CONSULTOR or ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/inventory", serverAddress)
+	log.Printf("   - GET    http://%s/inventory/alerts (Requires CONSULTOR or ADMIN role)", serverAddress)
+	log.Printf("   - PUT    http://%s/admin/inventory/{productId}/levels (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/inventory/{productId}/movements (Requires CONSULTOR or ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/inventory/{productId}/adjustments (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/inventory/reconcile (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/inventory/import (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/inventory/counts (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/inventory/counts/{id}/entries", serverAddress)
+	log.Printf("   - POST   http://%s/admin/inventory/counts/{id}/approve (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/invoices/global (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/stored-value/{code}/void (Requires ADMIN role)", serverAddress)
+	log.Printf("   - PUT    http://%s/admin/loyalty/rules (Requires ADMIN role)", serverAddress)
+	log.Printf("   - PUT    http://%s/admin/commissions/rules (Requires ADMIN role)", serverAddress)
+	log.Printf("   - PUT    http://%s/admin/targets (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/targets?period=YYYY-MM (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/commissions/{period}/close (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/webhooks (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/webhooks (Requires ADMIN role)", serverAddress)
+	log.Printf("   - PUT    http://%s/admin/webhooks/{id} (Requires ADMIN role)", serverAddress)
+	log.Printf("   - DELETE http://%s/admin/webhooks/{id} (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/webhooks/deliveries?subscriptionId=&event=&status= (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/webhooks/deliveries/{id}/replay (Requires ADMIN role)", serverAddress)
+	log.Printf("   - GET    http://%s/admin/outbox?status=&type= (Requires ADMIN role)", serverAddress)
+	log.Printf("   - POST   http://%s/admin/outbox/{id}/retry (Requires ADMIN role)", serverAddress)
 	log.Println("🔒 Protected endpoints require JWT in Authorization header")
 
 	if err := http.ListenAndServe(serverAddress, handler); err != nil {
@@ -132,6 +462,55 @@ func main() {
 	}
 }
 
+// loadApprovalPolicy lee los umbrales de las operaciones que requieren
+// autorización de un gerente
+func loadApprovalPolicy(users *services.UserService, roles *services.RoleService) handlers.ApprovalPolicy {
+	refundThreshold, err := strconv.ParseFloat(getEnv("APPROVAL_REFUND_THRESHOLD", "1000"), 64)
+	if err != nil || refundThreshold < 0 {
+		log.Fatal("Invalid APPROVAL_REFUND_THRESHOLD: ", getEnv("APPROVAL_REFUND_THRESHOLD", "1000"))
+	}
+	discountPercent, err := strconv.ParseFloat(getEnv("APPROVAL_DISCOUNT_PERCENT", "20"), 64)
+	if err != nil || discountPercent < 0 || discountPercent > 100 {
+		log.Fatal("Invalid APPROVAL_DISCOUNT_PERCENT: ", getEnv("APPROVAL_DISCOUNT_PERCENT", "20"))
+	}
+	ttl, err := time.ParseDuration(getEnv("APPROVAL_TTL", "30m"))
+	if err != nil {
+		log.Fatal("Invalid APPROVAL_TTL: ", err)
+	}
+
+	return handlers.ApprovalPolicy{RefundThreshold: refundThreshold, DiscountPercent: discountPercent, TTL: ttl, Users: users, Roles: roles}
+}
+
+// loadRegistrationPolicy lee si /register está abierto y con qué rol. El rol
+// debe existir y no puede administrar usuarios.
+func loadRegistrationPolicy(roles *services.RoleService) handlers.RegistrationPolicy {
+	policy := handlers.RegistrationPolicy{
+		Open: getEnv("SELF_REGISTRATION", "false") == "true",
+		Role: getEnv("SELF_REGISTRATION_ROLE", "vendedor"),
+	}
+	if !policy.Open {
+		return policy
+	}
+
+	ctx := context.Background()
+	exists, err := roles.Exists(ctx, policy.Role)
+	if err != nil {
+		log.Fatal("Error checking SELF_REGISTRATION_ROLE: ", err)
+	}
+	if !exists {
+		log.Fatal("Invalid SELF_REGISTRATION_ROLE: role not found: ", policy.Role)
+	}
+	privileged, err := roles.HasPermission(ctx, policy.Role, "manage_users")
+	if err != nil {
+		log.Fatal("Error checking SELF_REGISTRATION_ROLE: ", err)
+	}
+	if privileged {
+		log.Fatal("Invalid SELF_REGISTRATION_ROLE: role can manage users: ", policy.Role)
+	}
+	log.Printf("⚠️  Self-registration is open with role %s", policy.Role)
+	return policy
+}
+
 // Helper function to get environment variables with default values
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -141,101 +520,214 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
-// Función para inicializar la base de datos
-func initDatabase(db *mongo.Database) error {
-	ctx := context.Background()
+// newInvoiceHandler configura la facturación electrónica. Sin certificado (CSD)
+// el servicio arranca, pero los endpoints de facturación responden 503.
+func newInvoiceHandler(db *mongo.Database, dataStore store.Store, catalogClient *catalog.Client) *handlers.InvoiceHandler {
+	issuer := cfdi.Issuer{
+		RFC:              getEnv("CFDI_EMISOR_RFC", ""),
+		Nombre:           getEnv("CFDI_EMISOR_NOMBRE", ""),
+		RegimenFiscal:    getEnv("CFDI_EMISOR_REGIMEN", "601"),
+		LugarExpedicion:  getEnv("CFDI_LUGAR_EXPEDICION", ""),
+		Serie:            getEnv("CFDI_SERIE", "A"),
+		ClaveProdServ:    getEnv("CFDI_CLAVE_PROD_SERV", "43191501"),
+		ClaveUnidad:      getEnv("CFDI_CLAVE_UNIDAD", "H87"),
+		PricesIncludeTax: getEnv("CFDI_PRICES_INCLUDE_TAX", "true") == "true",
+	}
 
-	// Crear colecciones si no existen
-	collections := []string{"users", "sales", "roles"}
-	for _, collName := range collections {
-		err := db.CreateCollection(ctx, collName)
+	defaultIVA, err := strconv.ParseFloat(getEnv("CFDI_DEFAULT_IVA", "16"), 64)
+	if err != nil || defaultIVA < 0 {
+		log.Fatal("Invalid CFDI_DEFAULT_IVA: ", getEnv("CFDI_DEFAULT_IVA", "16"))
+	}
+
+	pac, err := cfdi.NewPAC(getEnv("CFDI_PAC", "fake"))
+	if err != nil {
+		log.Fatal("Invalid CFDI_PAC: ", err)
+	}
+
+	var signer *cfdi.Signer
+	certPath, keyPath := getEnv("CFDI_CERT_PATH", ""), getEnv("CFDI_KEY_PATH", "")
+	if certPath != "" && keyPath != "" {
+		signer, err = cfdi.LoadSigner(certPath, keyPath, getEnv("CFDI_KEY_PASSWORD", ""))
 		if err != nil {
-			// Ignorar error si la colección ya existe (código 48)
-			if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 48 {
-				log.Printf("✅ Collection already exists: %s", collName)
-				continue
-			}
-			return err
+			log.Fatal("Error loading CFDI certificate: ", err)
 		}
-		log.Printf("✅ Created collection: %s", collName)
+	} else {
+		log.Println("CFDI_CERT_PATH/CFDI_KEY_PATH not set, electronic invoicing disabled")
 	}
 
-	rolesCollection := db.Collection("roles")
-	usersCollection := db.Collection("users")
+	return handlers.NewInvoiceHandler(db, dataStore, issuer, signer, pac, catalogClient, defaultIVA/100)
+}
 
-	// Insertar roles básicos si no existen
-	basicRoles := []models.Role{
-		{
-			Name:        "admin",
-			Permissions: []string{"manage_users", "view_reports", "create_sale"},
-		},
-		{
-			Name:        "vendedor",
-			Permissions: []string{"create_sale"},
-		},
-		{
-			Name:        "consultor",
-			Permissions: []string{"view_reports"},
-		},
+// newStore elige dónde viven usuarios, roles y ventas: STORAGE_BACKEND=mongo (por
+// defecto) o postgres, con la conexión en POSTGRES_URL. Con postgres también
+// devuelve la conexión para migrar su esquema; con mongo es nil.
+func newStore(db *mongo.Database) (store.Store, *sql.DB, error) {
+	mongoStore := store.NewMongo(db)
+
+	switch backend := getEnv("STORAGE_BACKEND", "mongo"); backend {
+	case "mongo":
+		return mongoStore, nil, nil
+	case "postgres":
+		sqlDB, err := sql.Open("postgres", os.Getenv("POSTGRES_URL"))
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := sqlDB.PingContext(context.Background()); err != nil {
+			return nil, nil, err
+		}
+		log.Println("✅ Connected to PostgreSQL! Users, roles and sales are stored there")
+		return store.NewPostgres(sqlDB, mongoStore), sqlDB, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORAGE_BACKEND %q (use mongo or postgres)", backend)
 	}
+}
 
-	rolesMap := make(map[string]primitive.ObjectID)
-	for _, role := range basicRoles {
-		var existingRole models.Role
-		err := rolesCollection.FindOne(ctx, bson.M{"name": role.Name}).Decode(&existingRole)
-
-		if err == mongo.ErrNoDocuments {
-			res, err := rolesCollection.InsertOne(ctx, role)
-			if err != nil {
-				return err
-			}
-			roleID := res.InsertedID.(primitive.ObjectID)
-			rolesMap[role.Name] = roleID
-			log.Printf("✅ Created role: %s", role.Name)
-		} else if err != nil {
+// migrateUp aplica las migraciones pendientes. El esquema de PostgreSQL va
+// primero porque las migraciones de MongoDB escriben usuarios y roles a
+// través del store. Al final, la primera vez que se usa PostgreSQL, se copian
+// ahí las ventas que ya había en MongoDB.
+func migrateUp(ctx context.Context, target migrations.Target, sqlDB *sql.DB) error {
+	if sqlDB != nil {
+		if err := store.MigratePostgres(ctx, sqlDB); err != nil {
 			return err
-		} else {
-			rolesMap[role.Name] = existingRole.ID
 		}
 	}
-
-	// Crear usuario admin si no existe
-	adminEmail := os.Getenv("ADMIN_EMAIL")
-	if adminEmail == "" {
-		adminEmail = "admin@system.com"
+	if err := migrations.Up(ctx, target); err != nil {
+		return err
 	}
 
-	adminPassword := os.Getenv("ADMIN_PASSWORD")
-	if adminPassword == "" {
-		adminPassword = "AdminPassword123"
+	if postgresStore, ok := target.Store.(*store.Postgres); ok {
+		copied, err := postgresStore.CopySales(ctx)
+		if err != nil {
+			return err
+		}
+		if copied > 0 {
+			log.Printf("✅ Copied %d sales from MongoDB to PostgreSQL", copied)
+		}
 	}
+	return nil
+}
 
-	var existingUser models.User
-	err := usersCollection.FindOne(ctx, bson.M{"email": adminEmail}).Decode(&existingUser)
+// runMigrate atiende el subcomando migrate: up aplica las pendientes, down [n]
+// revierte las últimas n (1 por omisión) y status lista su estado. up y
+// status incluyen el esquema de PostgreSQL si es el backend; down sólo
+// revierte las de MongoDB. migrate postgres up|down [n]|status actúa sólo
+// sobre el esquema de PostgreSQL.
+func runMigrate(ctx context.Context, target migrations.Target, sqlDB *sql.DB, args []string) error {
+	if len(args) > 0 && args[0] == "postgres" {
+		if sqlDB == nil {
+			return errors.New("migrate postgres requires STORAGE_BACKEND=postgres")
+		}
+		return runPostgresMigrate(ctx, sqlDB, args[1:])
+	}
+	if len(args) == 0 {
+		return errors.New("usage: migrate [postgres] up|down [n]|status")
+	}
 
-	if err == mongo.ErrNoDocuments {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, target, sqlDB)
+	case "down":
+		steps, err := migrateSteps(args[1:])
 		if err != nil {
 			return err
 		}
-
-		adminUser := models.User{
-			Name:     "System Admin",
-			Email:    adminEmail,
-			Password: string(hashedPassword),
-			RoleID:   rolesMap["admin"],
+		return migrations.Down(ctx, target, steps)
+	case "status":
+		if sqlDB != nil {
+			fmt.Println("PostgreSQL:")
+			if err := printPostgresMigrations(ctx, sqlDB); err != nil {
+				return err
+			}
+			fmt.Println("MongoDB:")
+		}
+		statuses, err := migrations.List(ctx, target.DB)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			printMigrationStatus(status.Version, status.Name, status.AppliedAt)
 		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (use up, down or status)", args[0])
+	}
+}
 
-		_, err = usersCollection.InsertOne(ctx, adminUser)
+func runPostgresMigrate(ctx context.Context, sqlDB *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate postgres up|down [n]|status")
+	}
+
+	switch args[0] {
+	case "up":
+		return store.MigratePostgres(ctx, sqlDB)
+	case "down":
+		steps, err := migrateSteps(args[1:])
 		if err != nil {
 			return err
 		}
-		log.Printf("✅ Created admin user: %s", adminEmail)
-	} else if err != nil {
-		return err
-	} else {
-		log.Printf("✅ Admin user already exists: %s", adminEmail)
+		return store.RollbackPostgres(ctx, sqlDB, steps)
+	case "status":
+		return printPostgresMigrations(ctx, sqlDB)
+	default:
+		return fmt.Errorf("unknown migrate command %q (use up, down or status)", args[0])
 	}
+}
+
+// migrateSteps lee cuántas migraciones revertir (1 por omisión)
+func migrateSteps(args []string) (int, error) {
+	if len(args) == 0 {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number of migrations to revert: %s", args[0])
+	}
+	return n, nil
+}
 
+func printPostgresMigrations(ctx context.Context, sqlDB *sql.DB) error {
+	statuses, err := store.PostgresMigrations(ctx, sqlDB)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		printMigrationStatus(status.Version, status.Name, status.AppliedAt)
+	}
 	return nil
+}
+
+func printMigrationStatus(version int, name string, appliedAt int64) {
+	state := "pending"
+	if appliedAt != 0 {
+		state = "applied " + time.Unix(appliedAt, 0).Format(time.RFC3339)
+	}
+	fmt.Printf("%04d_%-40s %s\n", version, name, state)
+}
+
+func pendingMigrations(ctx context.Context, db *mongo.Database, sqlDB *sql.DB) (int, error) {
+	statuses, err := migrations.List(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == 0 {
+			pending++
+		}
+	}
+
+	if sqlDB != nil {
+		postgresStatuses, err := store.PostgresMigrations(ctx, sqlDB)
+		if err != nil {
+			return 0, err
+		}
+		for _, status := range postgresStatuses {
+			if status.AppliedAt == 0 {
+				pending++
+			}
+		}
+	}
+	return pending, nil
 }
\ No newline at end of file
@@ -55,4 +55,17 @@ func RoleMiddleware(requiredRole string) func(http.Handler) http.Handler {
             next.ServeHTTP(w, r)
         })
     }
+}
+
+// TokenFromQuery acepta el JWT en ?access_token= para clientes que no pueden
+// enviar encabezados (EventSource). Sólo se usa en las rutas de streaming.
+func TokenFromQuery(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("Authorization") == "" {
+            if token := r.URL.Query().Get("access_token"); token != "" {
+                r.Header.Set("Authorization", "Bearer "+token)
+            }
+        }
+        next.ServeHTTP(w, r)
+    })
 }
\ No newline at end of file
@@ -0,0 +1,226 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	idempotencyInProgress = "in_progress"
+	idempotencyDone       = "done"
+)
+
+// idempotencyRecord guarda la respuesta de una solicitud con Idempotency-Key
+// para repetirla si el cliente reintenta
+type idempotencyRecord struct {
+	ID          string    `bson:"_id"` // usuario + llave
+	Method      string    `bson:"method"`
+	Path        string    `bson:"path"`
+	RequestHash string    `bson:"requestHash"`
+	Status      string    `bson:"status"`
+	StatusCode  int       `bson:"statusCode,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt"` // índice TTL
+}
+
+// responseRecorder copia la respuesta del handler mientras la envía
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	rec.statusCode = statusCode
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.statusCode == 0 {
+		rec.statusCode = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotencyKeys guarda las llaves y respuestas. Create devuelve
+// errKeyExists si la llave ya se usó.
+type idempotencyKeys interface {
+	Create(ctx context.Context, record idempotencyRecord) error
+	Get(ctx context.Context, id string) (idempotencyRecord, error)
+	Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, id string) error
+}
+
+var errKeyExists = errors.New("idempotency key already exists")
+
+// mongoKeys guarda las llaves en la colección idempotency_keys
+type mongoKeys struct {
+	collection *mongo.Collection
+}
+
+func (k mongoKeys) Create(ctx context.Context, record idempotencyRecord) error {
+	_, err := k.collection.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return errKeyExists
+	}
+	return err
+}
+
+func (k mongoKeys) Get(ctx context.Context, id string) (idempotencyRecord, error) {
+	var record idempotencyRecord
+	err := k.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	return record, err
+}
+
+func (k mongoKeys) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error {
+	_, err := k.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":      idempotencyDone,
+		"statusCode":  statusCode,
+		"contentType": contentType,
+		"body":        body,
+	}})
+	return err
+}
+
+func (k mongoKeys) Release(ctx context.Context, id string) error {
+	_, err := k.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// IdempotencyMiddleware respeta el encabezado Idempotency-Key en POST, PUT y
+// DELETE: la primera respuesta se guarda y los reintentos con la misma llave
+// la reciben de nuevo sin volver a ejecutar la operación. Las respuestas 5xx
+// no se guardan para que el cliente pueda reintentar, y si el handler entra en
+// pánico la llave se libera. Tampoco se guardan las marcadas con
+// Cache-Control: no-store (las que llevan secretos). Debe ir después de
+// AuthMiddleware: las llaves son por usuario.
+func IdempotencyMiddleware(collection *mongo.Collection) func(http.Handler) http.Handler {
+	return idempotency(mongoKeys{collection: collection})
+}
+
+func idempotency(keys idempotencyKeys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+
+			token := r.Context().Value("token").(*jwt.Token)
+			claims := token.Claims.(jwt.MapClaims)
+			userID, _ := claims["sub"].(string)
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := sha256.New()
+			hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+			hash.Write(body)
+
+			record := idempotencyRecord{
+				ID:          userID + ":" + key,
+				Method:      r.Method,
+				Path:        r.URL.RequestURI(),
+				RequestHash: hex.EncodeToString(hash.Sum(nil)),
+				Status:      idempotencyInProgress,
+				CreatedAt:   time.Now(),
+			}
+
+			ctx := context.Background()
+			err = keys.Create(ctx, record)
+			if err == errKeyExists {
+				replayResponse(ctx, w, keys, record)
+				return
+			}
+			if err != nil {
+				log.Printf("Error storing idempotency key: %v", err)
+				http.Error(w, "Error processing Idempotency-Key", http.StatusInternalServerError)
+				return
+			}
+
+			// Si el handler entra en pánico la llave no debe quedar en curso
+			// hasta que venza
+			defer func() {
+				if p := recover(); p != nil {
+					if err := keys.Release(ctx, record.ID); err != nil {
+						log.Printf("Error releasing idempotency key: %v", err)
+					}
+					panic(p)
+				}
+			}()
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.statusCode == 0 || rec.statusCode >= 500 || noStore(rec.Header()) {
+				if err := keys.Release(ctx, record.ID); err != nil {
+					log.Printf("Error releasing idempotency key: %v", err)
+				}
+				return
+			}
+
+			if err := keys.Complete(ctx, record.ID, rec.statusCode, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != nil {
+				log.Printf("Error storing idempotent response: %v", err)
+			}
+		})
+	}
+}
+
+// noStore indica si la respuesta no debe guardarse
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// replayResponse responde a un reintento con la respuesta guardada
+func replayResponse(ctx context.Context, w http.ResponseWriter, keys idempotencyKeys, request idempotencyRecord) {
+	stored, err := keys.Get(ctx, request.ID)
+	if err != nil {
+		log.Printf("Error fetching idempotency key: %v", err)
+		http.Error(w, "Error processing Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+
+	if stored.RequestHash != request.RequestHash {
+		http.Error(w, "Idempotency-Key was already used with a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if stored.Status != idempotencyDone {
+		http.Error(w, "A request with this Idempotency-Key is still being processed", http.StatusConflict)
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
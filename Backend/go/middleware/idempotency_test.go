@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryKeys guarda las llaves en memoria
+type memoryKeys map[string]idempotencyRecord
+
+func (k memoryKeys) Create(ctx context.Context, record idempotencyRecord) error {
+	if _, ok := k[record.ID]; ok {
+		return errKeyExists
+	}
+	k[record.ID] = record
+	return nil
+}
+
+func (k memoryKeys) Get(ctx context.Context, id string) (idempotencyRecord, error) {
+	record, ok := k[id]
+	if !ok {
+		return record, mongo.ErrNoDocuments
+	}
+	return record, nil
+}
+
+func (k memoryKeys) Complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error {
+	record := k[id]
+	record.Status = idempotencyDone
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = append([]byte(nil), body...)
+	k[id] = record
+	return nil
+}
+
+func (k memoryKeys) Release(ctx context.Context, id string) error {
+	delete(k, id)
+	return nil
+}
+
+func idempotentRequest(key, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/sales", strings.NewReader(body))
+	r.Header.Set("Idempotency-Key", key)
+	token := &jwt.Token{Claims: jwt.MapClaims{"sub": "ana@example.com", "role": "vendedor"}}
+	return r.WithContext(context.WithValue(r.Context(), "token", token))
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	keys := memoryKeys{}
+	calls := 0
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, idempotentRequest("k1", `{"total":10}`))
+		if w.Code != http.StatusCreated || w.Body.String() != `{"id":"1"}` {
+			t.Fatalf("attempt %d = %d %q, want the stored response", i+1, w.Code, w.Body.String())
+		}
+		if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != (i > 0) {
+			t.Errorf("attempt %d: Idempotent-Replayed = %v", i+1, replayed)
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("attempt %d: Content-Type = %q", i+1, w.Header().Get("Content-Type"))
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	keys := memoryKeys{}
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{"total":10}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("first request = %d, want 201", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{"total":20}`))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key with another body = %d, want 422", w.Code)
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	keys := memoryKeys{}
+	var retry *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// El reintento llega mientras la primera solicitud sigue en curso
+		if retry == nil {
+			retry = httptest.NewRecorder()
+			handler.ServeHTTP(retry, idempotentRequest("k1", `{"total":10}`))
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{"total":10}`))
+	if w.Code != http.StatusCreated {
+		t.Errorf("first request = %d, want 201", w.Code)
+	}
+	if retry.Code != http.StatusConflict {
+		t.Errorf("concurrent retry = %d, want 409", retry.Code)
+	}
+}
+
+func TestIdempotencyReleasesKey(t *testing.T) {
+	keys := memoryKeys{}
+	status := http.StatusServiceUnavailable
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	if len(keys) != 0 {
+		t.Errorf("a 5xx response kept the key: %+v", keys)
+	}
+
+	status = http.StatusOK
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after a 5xx = %d replayed=%q, want a fresh 200", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	keys := memoryKeys{}
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the handler panic", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest("k1", `{}`))
+	}()
+
+	if len(keys) != 0 {
+		t.Errorf("the key stayed after a panic: %+v", keys)
+	}
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	keys := memoryKeys{}
+	calls := 0
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), idempotentRequest("", `{}`))
+	}
+	if calls != 2 || len(keys) != 0 {
+		t.Errorf("calls = %d, keys = %d, want 2 calls and no keys", calls, len(keys))
+	}
+}
+
+func TestIdempotencyNoStore(t *testing.T) {
+	keys := memoryKeys{}
+	handler := idempotency(keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"secret":"s3cr3t"}`))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, idempotentRequest("k1", `{}`))
+	if w.Code != http.StatusCreated || w.Body.String() != `{"secret":"s3cr3t"}` {
+		t.Errorf("response = %d %q, want it sent to the client", w.Code, w.Body.String())
+	}
+	if len(keys) != 0 {
+		t.Errorf("a no-store response was kept: %+v", keys)
+	}
+}
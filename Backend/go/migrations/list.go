@@ -0,0 +1,505 @@
+package migrations
+
+import (
+	"auth-service/models"
+	"auth-service/services"
+	"auth-service/store"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// all son las migraciones en orden. Una migración ya publicada no se edita ni
+// cambia de número: los cambios van en una nueva al final de la lista.
+//
+// Las tres primeras reemplazan lo que hacía initDatabase en cada arranque, así
+// que deben poder correr sobre una base que ya tiene esas colecciones, índices
+// y datos.
+var all = []Migration{
+	{Version: 1, Name: "create_collections", Up: createCollections},
+	{Version: 2, Name: "initial_indexes", Up: createInitialIndexes, Down: dropInitialIndexes},
+	{Version: 3, Name: "seed_roles_and_admin", Up: seedAccounts},
+	{Version: 4, Name: "users_email_and_sales_indexes", Up: createUserAndSalesIndexes, Down: dropUserAndSalesIndexes},
+	{Version: 5, Name: "normalize_user_emails", Up: normalizeUserEmails},
+	{Version: 6, Name: "invites", Up: createInvites, Down: dropInvites},
+	{Version: 7, Name: "unique_inventory_product", Up: createInventoryProductIndex, Down: dropInventoryProductIndex},
+	{Version: 8, Name: "sales_change_stream_pre_images", Up: enableSalesPreImages, Down: disableSalesPreImages},
+	// La migración 5 primero sólo normalizaba users; ésta corrige las
+	// referencias en las bases que ya la habían aplicado
+	{Version: 9, Name: "normalize_email_references", Up: normalizeUserEmails},
+}
+
+func createCollections(ctx context.Context, t Target) error {
+	collections := []string{"users", "sales", "roles", "suppliers", "purchase_orders", "inventory", "inventory_alerts", "stock_counts", "inventory_movements", "quotes", "global_invoices", "counters", "stored_value_accounts", "stored_value_transactions", "customers", "loyalty_rules", "loyalty_transactions", "commission_rules", "commission_periods", "commission_adjustments", "sales_targets", "sale_approvals", "sale_revisions", "idempotency_keys", "webhook_subscriptions", "webhook_deliveries", "outbox"}
+	for _, collName := range collections {
+		err := t.DB.CreateCollection(ctx, collName)
+		if err != nil {
+			// Ignorar error si la colección ya existe (código 48)
+			if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 48 {
+				continue
+			}
+			return err
+		}
+		log.Printf("✅ Created collection: %s", collName)
+	}
+	return nil
+}
+
+// index es un índice de una colección; name es el nombre que MongoDB le da
+// por omisión, con el que se elimina al revertir
+type index struct {
+	collection string
+	name       string
+	model      mongo.IndexModel
+}
+
+func initialIndexes() ([]index, error) {
+	// Las respuestas guardadas por Idempotency-Key se borran al vencer
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil {
+		return nil, err
+	}
+
+	return []index{
+		// Los códigos de tarjetas de regalo y saldos a favor no se pueden repetir
+		{"stored_value_accounts", "code_1", mongo.IndexModel{
+			Keys:    bson.M{"code": 1},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Una venta sin conexión se registra una sola vez aunque la caja reenvíe el lote
+		{"sales", "clientId_1", mongo.IndexModel{
+			Keys:    bson.M{"clientId": 1},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"clientId": bson.M{"$exists": true}}),
+		}},
+		{"idempotency_keys", "createdAt_1", mongo.IndexModel{
+			Keys:    bson.M{"createdAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(int32(idempotencyTTL.Seconds())),
+		}},
+		// El despachador de webhooks busca las entregas pendientes por vencimiento
+		{"webhook_deliveries", "status_1_nextAttemptAt_1", mongo.IndexModel{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+		}},
+		// Un evento del outbox se encola una sola vez por suscripción (las
+		// repeticiones manuales quedan fuera)
+		{"webhook_deliveries", "eventId_1_subscriptionId_1", mongo.IndexModel{
+			Keys:    bson.D{{Key: "eventId", Value: 1}, {Key: "subscriptionId", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"replayOf": bson.M{"$exists": false}}),
+		}},
+		// El despachador del outbox busca los eventos pendientes por vencimiento
+		{"outbox", "status_1_nextAttemptAt_1", mongo.IndexModel{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}},
+		}},
+		// Cada revisión de una venta se registra una sola vez
+		{"sale_revisions", "saleId_1_revision_1", mongo.IndexModel{
+			Keys:    bson.D{{Key: "saleId", Value: 1}, {Key: "revision", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Una sola meta por mes para cada vendedor o tienda
+		{"sales_targets", "period_1_scope_1_scopeId_1", mongo.IndexModel{
+			Keys:    bson.D{{Key: "period", Value: 1}, {Key: "scope", Value: 1}, {Key: "scopeId", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+	}, nil
+}
+
+func createInitialIndexes(ctx context.Context, t Target) error {
+	indexes, err := initialIndexes()
+	if err != nil {
+		return err
+	}
+	return createIndexes(ctx, t.DB, indexes)
+}
+
+func dropInitialIndexes(ctx context.Context, t Target) error {
+	indexes, err := initialIndexes()
+	if err != nil {
+		return err
+	}
+	return dropIndexes(ctx, t.DB, indexes)
+}
+
+// seedAccounts crea los roles básicos y el usuario admin si no existen. Se
+// escriben a través del store, así que quedan en el backend configurado.
+func seedAccounts(ctx context.Context, t Target) error {
+	basicRoles := []models.Role{
+		{
+			Name:        "admin",
+			Permissions: []string{"manage_users", "view_reports", "create_sale", "view_sales", "approve_sales"},
+		},
+		{
+			Name:        "vendedor",
+			Permissions: []string{"create_sale"},
+		},
+		{
+			Name:        "consultor",
+			Permissions: []string{"view_reports", "view_sales"},
+		},
+	}
+
+	rolesMap := make(map[string]primitive.ObjectID)
+	for _, role := range basicRoles {
+		existingRole, err := t.Store.Roles().GetByName(ctx, role.Name)
+		if err == store.ErrNotFound {
+			role.ID = primitive.NewObjectID()
+			if err := t.Store.Roles().Insert(ctx, role); err != nil {
+				return err
+			}
+			rolesMap[role.Name] = role.ID
+			log.Printf("✅ Created role: %s", role.Name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Agregar a los roles existentes los permisos básicos que les falten
+		missing := false
+		for _, permission := range role.Permissions {
+			if !containsString(existingRole.Permissions, permission) {
+				existingRole.Permissions = append(existingRole.Permissions, permission)
+				missing = true
+			}
+		}
+		if missing {
+			if err := t.Store.Roles().Update(ctx, existingRole); err != nil {
+				return err
+			}
+		}
+		rolesMap[role.Name] = existingRole.ID
+	}
+
+	// Crear usuario admin si no existe; el correo se guarda como lo busca el login
+	adminEmail := services.NormalizeEmail(getEnv("ADMIN_EMAIL", "admin@system.com"))
+	adminPassword := getEnv("ADMIN_PASSWORD", "AdminPassword123")
+
+	_, err := t.Store.Users().GetByEmail(ctx, adminEmail)
+	if err == nil {
+		log.Printf("✅ Admin user already exists: %s", adminEmail)
+		return nil
+	}
+	if err != store.ErrNotFound {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(adminPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	adminUser := models.User{
+		ID:       primitive.NewObjectID(),
+		Name:     "System Admin",
+		Email:    adminEmail,
+		Password: string(hashedPassword),
+		RoleID:   rolesMap["admin"],
+	}
+	if err := t.Store.Users().Insert(ctx, adminUser); err != nil {
+		return err
+	}
+	log.Printf("✅ Created admin user: %s", adminEmail)
+	return nil
+}
+
+var userAndSalesIndexes = []index{
+	// Un correo identifica a un solo usuario
+	{"users", "email_1", mongo.IndexModel{
+		Keys:    bson.M{"email": 1},
+		Options: options.Index().SetUnique(true),
+	}},
+	// Ventas de un vendedor por fecha (lista de ventas, comisiones, metas)
+	{"sales", "sellerId_1_timestamp_-1", mongo.IndexModel{
+		Keys: bson.D{{Key: "sellerId", Value: 1}, {Key: "timestamp", Value: -1}},
+	}},
+	// Ventas por estado y fecha (reportes, tickets en espera)
+	{"sales", "status_1_timestamp_-1", mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "timestamp", Value: -1}},
+	}},
+}
+
+// createUserAndSalesIndexes normaliza primero los correos, y reporta los
+// repetidos, porque el índice único los necesita así. La migración 5 lo
+// repite para las bases que ya tenían el índice.
+func createUserAndSalesIndexes(ctx context.Context, t Target) error {
+	if err := normalizeUserEmails(ctx, t); err != nil {
+		return err
+	}
+	return createIndexes(ctx, t.DB, userAndSalesIndexes)
+}
+
+func dropUserAndSalesIndexes(ctx context.Context, t Target) error {
+	return dropIndexes(ctx, t.DB, userAndSalesIndexes)
+}
+
+// normalizeUserEmails guarda los correos sin espacios y en minúsculas, como
+// los escribe el servicio de usuarios, junto con los que los referencian
+// (vendedor de ventas, metas y comisiones, autor de revisiones y
+// aprobaciones), que de otro modo dejarían de coincidir con el usuario. Si
+// dos usuarios comparten el correo normalizado la migración falla sin cambiar
+// nada y los enumera: se deben fusionar o corregir a mano antes de volver a
+// correrla.
+func normalizeUserEmails(ctx context.Context, t Target) error {
+	users, err := t.Store.Users().List(ctx)
+	if err != nil {
+		return err
+	}
+
+	byEmail := map[string][]models.User{}
+	for _, user := range users {
+		email := services.NormalizeEmail(user.Email)
+		byEmail[email] = append(byEmail[email], user)
+	}
+
+	duplicates := []string{}
+	for email, matches := range byEmail {
+		if len(matches) < 2 {
+			continue
+		}
+		ids := make([]string, 0, len(matches))
+		for _, user := range matches {
+			ids = append(ids, user.ID.Hex())
+		}
+		sort.Strings(ids)
+		duplicates = append(duplicates, fmt.Sprintf("%s (%s)", email, strings.Join(ids, ", ")))
+	}
+	if len(duplicates) > 0 {
+		sort.Strings(duplicates)
+		for _, duplicate := range duplicates {
+			log.Printf("❌ Duplicate user email: %s", duplicate)
+		}
+		return fmt.Errorf("%d duplicate user emails: %s", len(duplicates), strings.Join(duplicates, "; "))
+	}
+
+	// Las referencias van antes que los usuarios: si algo falla, volver a
+	// correrla las corrige aunque los usuarios ya estén normalizados
+	if err := t.Store.Sales().NormalizeEmails(ctx); err != nil {
+		return fmt.Errorf("normalizing sale emails: %w", err)
+	}
+	if err := normalizeEmailReferences(ctx, t.DB); err != nil {
+		return err
+	}
+
+	for email, matches := range byEmail {
+		user := matches[0]
+		if user.Email == email {
+			continue
+		}
+		log.Printf("✅ Normalized user email: %q -> %q", user.Email, email)
+		user.Email = email
+		if err := t.Store.Users().Update(ctx, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emailReference es un campo con el correo de un usuario en una colección que
+// sólo vive en MongoDB
+type emailReference struct {
+	collection string
+	field      string
+	filter     bson.M
+}
+
+// unnormalizedEmail encuentra los correos con mayúsculas o espacios en los
+// extremos
+const unnormalizedEmail = `[A-Z]|^\s|\s$`
+
+var emailReferences = []emailReference{
+	{"sales_targets", "scopeId", bson.M{"scope": models.TargetSeller}},
+	{"commission_adjustments", "sellerId", nil},
+	{"sale_approvals", "requestedBy", nil},
+	{"sale_approvals", "decidedBy", nil},
+	{"quotes", "sellerId", nil},
+}
+
+// normalizeEmailReferences normaliza los correos de emailReferences y los de
+// los vendedores en los cierres de comisiones
+func normalizeEmailReferences(ctx context.Context, db *mongo.Database) error {
+	// Sin MongoDB (el store en memoria) no hay colecciones que corregir
+	if db == nil {
+		return nil
+	}
+
+	for _, ref := range emailReferences {
+		filter := bson.M{ref.field: bson.M{"$regex": unnormalizedEmail}}
+		for key, value := range ref.filter {
+			filter[key] = value
+		}
+		update := mongo.Pipeline{{{Key: "$set", Value: bson.M{ref.field: normalizedEmail("$" + ref.field)}}}}
+		result, err := db.Collection(ref.collection).UpdateMany(ctx, filter, update)
+		if err != nil {
+			return fmt.Errorf("normalizing %s.%s: %w", ref.collection, ref.field, err)
+		}
+		if result.ModifiedCount > 0 {
+			log.Printf("✅ Normalized %d emails in %s.%s", result.ModifiedCount, ref.collection, ref.field)
+		}
+	}
+
+	// Cada cierre guarda los vendedores con sus ajustes en un arreglo
+	adjustments := bson.M{"$map": bson.M{
+		"input": "$$seller.adjustments",
+		"as":    "adjustment",
+		"in":    bson.M{"$mergeObjects": bson.A{"$$adjustment", bson.M{"sellerId": normalizedEmail("$$adjustment.sellerId")}}},
+	}}
+	_, err := db.Collection("commission_periods").UpdateMany(ctx,
+		bson.M{"sellers.sellerId": bson.M{"$regex": unnormalizedEmail}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"sellers": bson.M{"$map": bson.M{
+			"input": "$sellers",
+			"as":    "seller",
+			"in": bson.M{"$mergeObjects": bson.A{"$$seller", bson.M{
+				"sellerId":    normalizedEmail("$$seller.sellerId"),
+				"adjustments": adjustments,
+			}}},
+		}}}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("normalizing commission_periods: %w", err)
+	}
+	return nil
+}
+
+// normalizedEmail es la expresión de agregación equivalente a
+// services.NormalizeEmail
+func normalizedEmail(expression string) bson.M {
+	return bson.M{"$toLower": bson.M{"$trim": bson.M{"input": expression}}}
+}
+
+var inviteIndexes = []index{
+	// La invitación se busca por el hash de su token, que no se repite
+	{"invites", "tokenHash_1", mongo.IndexModel{
+		Keys:    bson.M{"tokenHash": 1},
+		Options: options.Index().SetUnique(true),
+	}},
+}
+
+func createInvites(ctx context.Context, t Target) error {
+	if err := t.DB.CreateCollection(ctx, "invites"); err != nil {
+		// Ignorar error si la colección ya existe (código 48)
+		if cmdErr, ok := err.(mongo.CommandError); !ok || cmdErr.Code != 48 {
+			return err
+		}
+	}
+	return createIndexes(ctx, t.DB, inviteIndexes)
+}
+
+func dropInvites(ctx context.Context, t Target) error {
+	return t.DB.Collection("invites").Drop(ctx)
+}
+
+var inventoryProductIndexes = []index{
+	// Los movimientos crean el registro de inventario si no existe; cada
+	// producto tiene uno solo
+	{"inventory", "productId_1", mongo.IndexModel{
+		Keys:    bson.M{"productId": 1},
+		Options: options.Index().SetUnique(true),
+	}},
+}
+
+// createInventoryProductIndex crea el índice único del producto en el
+// inventario. Si un producto tiene más de un registro la migración falla y
+// los enumera: se deben fusionar a mano antes de volver a correrla.
+func createInventoryProductIndex(ctx context.Context, t Target) error {
+	cursor, err := t.DB.Collection("inventory").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$productId", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	var duplicates []struct {
+		ProductID string `bson:"_id"`
+		Count     int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		products := make([]string, 0, len(duplicates))
+		for _, duplicate := range duplicates {
+			log.Printf("❌ Duplicate inventory records: product %s has %d", duplicate.ProductID, duplicate.Count)
+			products = append(products, fmt.Sprintf("%s (%d)", duplicate.ProductID, duplicate.Count))
+		}
+		return fmt.Errorf("%d products with duplicate inventory records: %s", len(duplicates), strings.Join(products, "; "))
+	}
+
+	return createIndexes(ctx, t.DB, inventoryProductIndexes)
+}
+
+func dropInventoryProductIndex(ctx context.Context, t Target) error {
+	return dropIndexes(ctx, t.DB, inventoryProductIndexes)
+}
+
+// enableSalesPreImages guarda la imagen previa de las ventas para el change
+// stream: sin ella una venta eliminada llega sin vendedor ni tienda y el
+// stream de eventos no sabe a quién enviarla. Requiere MongoDB 6.0; en una
+// versión anterior se omite y las eliminaciones siguen llegando sin la venta.
+func enableSalesPreImages(ctx context.Context, t Target) error {
+	return setSalesPreImages(ctx, t.DB, true)
+}
+
+func disableSalesPreImages(ctx context.Context, t Target) error {
+	return setSalesPreImages(ctx, t.DB, false)
+}
+
+func setSalesPreImages(ctx context.Context, db *mongo.Database, enabled bool) error {
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: "sales"},
+		{Key: "changeStreamPreAndPostImages", Value: bson.M{"enabled": enabled}},
+	}).Err()
+	// Opción desconocida antes de MongoDB 6.0 (código 72)
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 72 {
+		log.Printf("⚠️  MongoDB does not support change stream pre-images, skipping: %v", err)
+		return nil
+	}
+	return err
+}
+
+func createIndexes(ctx context.Context, db *mongo.Database, indexes []index) error {
+	for _, idx := range indexes {
+		if _, err := db.Collection(idx.collection).Indexes().CreateOne(ctx, idx.model); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dropIndexes(ctx context.Context, db *mongo.Database, indexes []index) error {
+	for _, idx := range indexes {
+		_, err := db.Collection(idx.collection).Indexes().DropOne(ctx, idx.name)
+		// El índice ya no existe (código 27)
+		if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 27 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
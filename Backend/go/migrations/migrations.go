@@ -0,0 +1,221 @@
+// Package migrations versiona los cambios a la base de datos: colecciones,
+// índices y datos iniciales. Cada migración aplicada queda registrada en la
+// colección schema_migrations y se aplica una sola vez.
+package migrations
+
+import (
+	"auth-service/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Target es la base sobre la que corren las migraciones. Los datos de
+// usuarios y roles se escriben a través de Store, que puede vivir en
+// PostgreSQL (ver store.MigratePostgres para su esquema).
+type Target struct {
+	DB    *mongo.Database
+	Store store.Store
+}
+
+// Migration es un cambio numerado. Down deshace Up; una migración sin Down
+// no se puede revertir.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, t Target) error
+	Down    func(ctx context.Context, t Target) error
+}
+
+// Status es el estado de una migración; AppliedAt es 0 si está pendiente
+type Status struct {
+	Version   int
+	Name      string
+	AppliedAt int64
+}
+
+type record struct {
+	Version   int    `bson:"_id"`
+	Name      string `bson:"name"`
+	AppliedAt int64  `bson:"appliedAt"`
+}
+
+// ErrIrreversible indica que la migración a revertir no tiene Down
+var ErrIrreversible = errors.New("migration cannot be reverted")
+
+const (
+	// lockTimeout es lo que se espera a que otra instancia termine de migrar
+	lockTimeout = time.Minute
+	// staleLock es la edad a partir de la cual un candado se da por abandonado
+	staleLock = 10 * time.Minute
+)
+
+// Up aplica en orden las migraciones pendientes
+func Up(ctx context.Context, t Target) error {
+	return withLock(ctx, t.DB, func() error {
+		records, err := appliedRecords(ctx, t.DB)
+		if err != nil {
+			return err
+		}
+		migrations, err := pending(all, records)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if err := m.Up(ctx, t); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			_, err := t.DB.Collection("schema_migrations").InsertOne(ctx, record{Version: m.Version, Name: m.Name, AppliedAt: time.Now().Unix()})
+			if err != nil {
+				return err
+			}
+			log.Printf("✅ Applied migration %04d_%s", m.Version, m.Name)
+		}
+		return nil
+	})
+}
+
+// Down revierte las últimas steps migraciones aplicadas, de la más reciente a
+// la más antigua
+func Down(ctx context.Context, t Target, steps int) error {
+	return withLock(ctx, t.DB, func() error {
+		applied, err := appliedVersions(ctx, t.DB)
+		if err != nil {
+			return err
+		}
+
+		for i := len(all) - 1; i >= 0 && steps > 0; i-- {
+			m := all[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, ErrIrreversible)
+			}
+			if err := m.Down(ctx, t); err != nil {
+				return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := t.DB.Collection("schema_migrations").DeleteOne(ctx, bson.M{"_id": m.Version}); err != nil {
+				return err
+			}
+			log.Printf("✅ Reverted migration %04d_%s", m.Version, m.Name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// List regresa todas las migraciones conocidas con su estado
+func List(ctx context.Context, db *mongo.Database) ([]Status, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(all))
+	for _, m := range all {
+		statuses = append(statuses, Status{Version: m.Version, Name: m.Name, AppliedAt: applied[m.Version]})
+	}
+	return statuses, nil
+}
+
+// pending regresa las migraciones que faltan por aplicar. Una migración está
+// aplicada si su número quedó registrado con su nombre, o si su nombre quedó
+// registrado con otro número (las migraciones 4 y 5 se publicaron un tiempo
+// intercambiadas). Un número registrado con el nombre de otra migración
+// desconocida es un error: la base no corresponde a esta lista.
+func pending(migrations []Migration, records []record) ([]Migration, error) {
+	byVersion := make(map[int]string, len(records))
+	byName := make(map[string]bool, len(records))
+	for _, r := range records {
+		byVersion[r.Version] = r.Name
+		byName[r.Name] = true
+	}
+
+	var result []Migration
+	for _, m := range migrations {
+		name, ok := byVersion[m.Version]
+		if byName[m.Name] {
+			continue
+		}
+		if ok {
+			return nil, fmt.Errorf("migration %04d is recorded as %q, expected %q", m.Version, name, m.Name)
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func appliedRecords(ctx context.Context, db *mongo.Database) ([]record, error) {
+	cursor, err := db.Collection("schema_migrations").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func appliedVersions(ctx context.Context, db *mongo.Database) (map[int]int64, error) {
+	records, err := appliedRecords(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]int64, len(records))
+	for _, r := range records {
+		applied[r.Version] = r.AppliedAt
+	}
+	return applied, nil
+}
+
+// withLock ejecuta fn con el candado de migraciones, para que dos instancias
+// que arrancan a la vez no apliquen la misma migración. Un candado más viejo
+// que staleLock se toma aunque no se haya liberado.
+func withLock(ctx context.Context, db *mongo.Database, fn func() error) error {
+	locks := db.Collection("schema_migrations_lock")
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		now := time.Now()
+		_, err := locks.UpdateOne(
+			ctx,
+			bson.M{"_id": "migrations", "lockedAt": bson.M{"$lt": now.Add(-staleLock).Unix()}},
+			bson.M{"$set": bson.M{"lockedAt": now.Unix()}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		if now.After(deadline) {
+			return errors.New("timed out waiting for the migrations lock")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	defer func() {
+		if _, err := locks.DeleteOne(context.Background(), bson.M{"_id": "migrations"}); err != nil {
+			log.Printf("Error releasing migrations lock: %v", err)
+		}
+	}()
+	return fn()
+}
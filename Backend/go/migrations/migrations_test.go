@@ -0,0 +1,261 @@
+package migrations
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMigrationsAreConsecutive(t *testing.T) {
+	names := map[string]bool{}
+	for i, m := range all {
+		if m.Version != i+1 {
+			t.Errorf("migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		if m.Name == "" || m.Up == nil {
+			t.Errorf("migration %d needs a name and an Up function", m.Version)
+		}
+		if names[m.Name] {
+			t.Errorf("duplicate migration name %q", m.Name)
+		}
+		names[m.Name] = true
+	}
+}
+
+// published son los números con que salió cada migración; no cambian
+var published = map[int]string{
+	1: "create_collections",
+	2: "initial_indexes",
+	3: "seed_roles_and_admin",
+	4: "users_email_and_sales_indexes",
+	5: "normalize_user_emails",
+	6: "invites",
+	7: "unique_inventory_product",
+	8: "sales_change_stream_pre_images",
+}
+
+func TestPublishedMigrationsKeepTheirVersion(t *testing.T) {
+	versions := map[int]string{}
+	for _, m := range all {
+		versions[m.Version] = m.Name
+	}
+	for version, name := range published {
+		if versions[version] != name {
+			t.Errorf("migration %d = %q, want %q", version, versions[version], name)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	names := func(migrations []Migration) []string {
+		result := []string{}
+		for _, m := range migrations {
+			result = append(result, m.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name    string
+		records []record
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "fresh database",
+			want: names(all),
+		},
+		{
+			name:    "some applied",
+			records: []record{{Version: 1, Name: "create_collections"}, {Version: 2, Name: "initial_indexes"}, {Version: 3, Name: "seed_roles_and_admin"}},
+			want:    []string{"users_email_and_sales_indexes", "normalize_user_emails", "invites", "unique_inventory_product", "sales_change_stream_pre_images", "normalize_email_references"},
+		},
+		{
+			// Bases migradas mientras 4 y 5 estaban intercambiadas
+			name: "4 and 5 recorded swapped",
+			records: []record{
+				{Version: 1, Name: "create_collections"}, {Version: 2, Name: "initial_indexes"}, {Version: 3, Name: "seed_roles_and_admin"},
+				{Version: 4, Name: "normalize_user_emails"}, {Version: 5, Name: "users_email_and_sales_indexes"},
+			},
+			want: []string{"invites", "unique_inventory_product", "sales_change_stream_pre_images", "normalize_email_references"},
+		},
+		{
+			name:    "unknown migration in a used version",
+			records: []record{{Version: 1, Name: "something_else"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pending(all, tt.records)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("pending() = %v, want an error", names(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pending() error: %v", err)
+			}
+			if strings.Join(names(got), ",") != strings.Join(tt.want, ",") {
+				t.Errorf("pending() = %v, want %v", names(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestInitialIndexesHonorIdempotencyTTL(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "2h")
+	indexes, err := initialIndexes()
+	if err != nil {
+		t.Fatalf("initialIndexes() error: %v", err)
+	}
+	found := false
+	for _, idx := range indexes {
+		if idx.collection == "idempotency_keys" {
+			found = true
+			if ttl := idx.model.Options.ExpireAfterSeconds; ttl == nil || *ttl != 7200 {
+				t.Errorf("idempotency TTL = %v, want 7200", ttl)
+			}
+		}
+	}
+	if !found {
+		t.Error("missing idempotency_keys TTL index")
+	}
+
+	t.Setenv("IDEMPOTENCY_KEY_TTL", "soon")
+	if _, err := initialIndexes(); err == nil {
+		t.Error("initialIndexes() accepted an invalid TTL")
+	}
+}
+
+func TestNormalizeUserEmails(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	ana := models.User{ID: primitive.NewObjectID(), Email: " Ana@Example.com"}
+	eva := models.User{ID: primitive.NewObjectID(), Email: "eva@example.com"}
+	st.Users().Insert(ctx, ana)
+	st.Users().Insert(ctx, eva)
+
+	if err := normalizeUserEmails(ctx, Target{Store: st}); err != nil {
+		t.Fatalf("normalizeUserEmails() error: %v", err)
+	}
+	if user, err := st.Users().Get(ctx, ana.ID); err != nil || user.Email != "ana@example.com" {
+		t.Errorf("user = %+v, %v; want email ana@example.com", user, err)
+	}
+}
+
+func TestNormalizeUserEmailsRewritesSaleReferences(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	ana := models.User{ID: primitive.NewObjectID(), Email: "Ana@Example.com"}
+	st.Users().Insert(ctx, ana)
+	sale := models.Sale{ID: primitive.NewObjectID(), SellerID: "Ana@Example.com", Status: models.SaleCompleted}
+	st.Sales().Insert(ctx, sale)
+	st.Sales().InsertRevision(ctx, models.SaleRevision{ID: primitive.NewObjectID(), SaleID: sale.ID.Hex(), Revision: 1, EditedBy: "ANA@EXAMPLE.COM"})
+
+	if err := normalizeUserEmails(ctx, Target{Store: st}); err != nil {
+		t.Fatalf("normalizeUserEmails() error: %v", err)
+	}
+
+	// La venta sigue siendo de la usuaria con el correo normalizado
+	sales, err := st.Sales().List(ctx, store.SaleFilter{SellerID: "ana@example.com"})
+	if err != nil || len(sales) != 1 || sales[0].ID != sale.ID {
+		t.Errorf("sales of ana@example.com = %+v, %v; want the mixed-case sale", sales, err)
+	}
+	revisions, err := st.Sales().Revisions(ctx, sale.ID)
+	if err != nil || len(revisions) != 1 || revisions[0].EditedBy != "ana@example.com" {
+		t.Errorf("revisions = %+v, %v; want edited by ana@example.com", revisions, err)
+	}
+
+	// Una base donde los usuarios ya estaban normalizados (migración 9)
+	st.Sales().Insert(ctx, models.Sale{ID: primitive.NewObjectID(), SellerID: " ANA@example.com", Status: models.SaleCompleted})
+	if err := normalizeUserEmails(ctx, Target{Store: st}); err != nil {
+		t.Fatalf("normalizeUserEmails() second run error: %v", err)
+	}
+	if sales, _ := st.Sales().List(ctx, store.SaleFilter{SellerID: "ana@example.com"}); len(sales) != 2 {
+		t.Errorf("%d sales of ana@example.com, want 2", len(sales))
+	}
+}
+
+func TestNormalizeUserEmailsKeepsSalesWhenDuplicated(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	st.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"})
+	st.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ANA@example.com"})
+	sale := models.Sale{ID: primitive.NewObjectID(), SellerID: "ANA@example.com", Status: models.SaleCompleted}
+	st.Sales().Insert(ctx, sale)
+
+	if err := normalizeUserEmails(ctx, Target{Store: st}); err == nil {
+		t.Fatal("normalizeUserEmails() = nil, want the duplicates reported")
+	}
+	if got, _ := st.Sales().Get(ctx, sale.ID); got.SellerID != "ANA@example.com" {
+		t.Errorf("seller = %q, want it unchanged", got.SellerID)
+	}
+}
+
+func TestNormalizeUserEmailsReportsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	first := models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"}
+	second := models.User{ID: primitive.NewObjectID(), Email: "ANA@example.com"}
+	other := models.User{ID: primitive.NewObjectID(), Email: "Eva@example.com"}
+	for _, user := range []models.User{first, second, other} {
+		st.Users().Insert(ctx, user)
+	}
+
+	err := normalizeUserEmails(ctx, Target{Store: st})
+	if err == nil {
+		t.Fatal("normalizeUserEmails() = nil, want an error listing the duplicates")
+	}
+	for _, id := range []primitive.ObjectID{first.ID, second.ID} {
+		if !strings.Contains(err.Error(), id.Hex()) {
+			t.Errorf("error %q does not mention %s", err, id.Hex())
+		}
+	}
+	// Con duplicados no se normaliza ningún correo
+	if user, _ := st.Users().Get(ctx, other.ID); user.Email != "Eva@example.com" {
+		t.Errorf("email = %q, want it unchanged", user.Email)
+	}
+}
+
+func TestUserIndexesNormalizeEmailsFirst(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	st.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"})
+	st.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ANA@example.com"})
+
+	// Sin base de Mongo: si intentara crear el índice antes de revisar los
+	// correos entraría en pánico
+	err := createUserAndSalesIndexes(ctx, Target{Store: st})
+	if err == nil || !strings.Contains(err.Error(), "ana@example.com") {
+		t.Errorf("createUserAndSalesIndexes() = %v, want the duplicate email reported", err)
+	}
+}
+
+func TestSeedAccountsNormalizesAdminEmail(t *testing.T) {
+	t.Setenv("ADMIN_EMAIL", " Admin@Example.com ")
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	if err := seedAccounts(ctx, Target{Store: st}); err != nil {
+		t.Fatalf("seedAccounts() error: %v", err)
+	}
+	if _, err := st.Users().GetByEmail(ctx, "admin@example.com"); err != nil {
+		t.Errorf("admin not found by normalized email: %v", err)
+	}
+
+	// Volver a correrla no crea otro admin
+	if err := seedAccounts(ctx, Target{Store: st}); err != nil {
+		t.Fatalf("seedAccounts() second run error: %v", err)
+	}
+	users, _ := st.Users().List(ctx)
+	if len(users) != 1 {
+		t.Errorf("%d users after seeding twice, want 1", len(users))
+	}
+}
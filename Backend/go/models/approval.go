@@ -0,0 +1,45 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Operaciones de venta que requieren autorización de un gerente
+const (
+	ApprovalEditSale         = "edit_sale"          // modificar una venta completada
+	ApprovalCancelSale       = "cancel_sale"        // eliminar una venta completada o un apartado
+	ApprovalRefund           = "refund"             // devolución mayor al umbral configurado
+	ApprovalDiscount         = "discount"           // descuento mayor al porcentaje configurado
+	ApprovalIssueStoredValue = "issue_stored_value" // emitir una tarjeta de regalo o un saldo a favor
+)
+
+// Formas de autorizar
+const (
+	ApprovalModeInline = "inline" // credenciales del gerente en la misma solicitud
+	ApprovalModeQueued = "queued" // solicitud pendiente que el gerente aprueba después
+	ApprovalModeSelf   = "self"   // quien ejecuta ya tiene el permiso de aprobar
+)
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalUsed     = "used"
+)
+
+// SaleApproval es el registro de una autorización. Las aprobaciones en línea
+// se guardan ya usadas; las de la cola pasan por pending → approved → used.
+type SaleApproval struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Operation   string             `json:"operation" bson:"operation"`
+	SaleID      string             `json:"saleId,omitempty" bson:"saleId,omitempty"`
+	Amount      float64            `json:"amount,omitempty" bson:"amount,omitempty"` // monto devuelto o descontado
+	Reason      string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Mode        string             `json:"mode" bson:"mode"`
+	Status      string             `json:"status" bson:"status"`
+	RequestedBy string             `json:"requestedBy" bson:"requestedBy"`
+	RequestedAt int64              `json:"requestedAt" bson:"requestedAt"`
+	DecidedBy   string             `json:"decidedBy,omitempty" bson:"decidedBy,omitempty"`
+	DecidedAt   int64              `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+	Note        string             `json:"note,omitempty" bson:"note,omitempty"`
+	ExpiresAt   int64              `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	UsedAt      int64              `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
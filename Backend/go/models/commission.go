@@ -0,0 +1,71 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// CommissionTier agrega un porcentaje extra a todas las ventas del mes cuando
+// el volumen del vendedor alcanza MinVolume.
+type CommissionTier struct {
+	MinVolume    float64 `json:"minVolume" bson:"minVolume"`
+	BonusPercent float64 `json:"bonusPercent" bson:"bonusPercent"`
+}
+
+// CommissionRules son los porcentajes de comisión. Se aplica el más específico:
+// producto, luego marca, luego categoría y al final el porcentaje general.
+type CommissionRules struct {
+	ID               string             `json:"-" bson:"_id"`
+	DefaultPercent   float64            `json:"defaultPercent" bson:"defaultPercent"`
+	ProductPercents  map[string]float64 `json:"productPercents" bson:"productPercents"`
+	BrandPercents    map[string]float64 `json:"brandPercents" bson:"brandPercents"` // por id_marca del catálogo
+	CategoryPercents map[string]float64 `json:"categoryPercents" bson:"categoryPercents"`
+	Tiers            []CommissionTier   `json:"tiers" bson:"tiers"`
+	UpdatedBy        string             `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt        int64              `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// CommissionLine es la comisión de una venta, incluido el bono por volumen
+type CommissionLine struct {
+	SaleID     string  `json:"saleId" bson:"saleId"`
+	Timestamp  int64   `json:"timestamp" bson:"timestamp"`
+	Amount     float64 `json:"amount" bson:"amount"`
+	Commission float64 `json:"commission" bson:"commission"`
+}
+
+// CommissionAdjustment corrige la comisión ya pagada de una venta que se
+// devolvió o modificó después del cierre de su periodo (negativo si se
+// descuenta). Se aplica en el periodo en que se registra.
+type CommissionAdjustment struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SellerID     string             `json:"sellerId" bson:"sellerId"`
+	SaleID       string             `json:"saleId" bson:"saleId"`
+	Amount       float64            `json:"amount" bson:"amount"`
+	Reason       string             `json:"reason" bson:"reason"`
+	SourcePeriod string             `json:"sourcePeriod" bson:"sourcePeriod"`
+	CreatedBy    string             `json:"createdBy" bson:"createdBy"`
+	Timestamp    int64              `json:"timestamp" bson:"timestamp"`
+}
+
+// SellerCommission es la comisión de un vendedor en un periodo
+type SellerCommission struct {
+	SellerID     string                 `json:"sellerId" bson:"sellerId"`
+	SellerName   string                 `json:"sellerName" bson:"sellerName"`
+	SalesCount   int                    `json:"salesCount" bson:"salesCount"`
+	Volume       float64                `json:"volume" bson:"volume"`
+	BonusPercent float64                `json:"bonusPercent" bson:"bonusPercent"`
+	Commission   float64                `json:"commission" bson:"commission"`
+	Clawbacks    float64                `json:"clawbacks" bson:"clawbacks"`
+	Total        float64                `json:"total" bson:"total"`
+	Lines        []CommissionLine       `json:"lines,omitempty" bson:"lines"`
+	Adjustments  []CommissionAdjustment `json:"adjustments,omitempty" bson:"adjustments"`
+}
+
+// CommissionPeriod es el cierre de pago de un mes (ID = "YYYY-MM"). Una vez
+// cerrado el reporte del periodo ya no se recalcula.
+type CommissionPeriod struct {
+	ID       string             `json:"period" bson:"_id"`
+	Start    int64              `json:"start" bson:"start"`
+	End      int64              `json:"end" bson:"end"`
+	Sellers  []SellerCommission `json:"sellers" bson:"sellers"`
+	Total    float64            `json:"total" bson:"total"`
+	ClosedBy string             `json:"closedBy" bson:"closedBy"`
+	ClosedAt int64              `json:"closedAt" bson:"closedAt"`
+}
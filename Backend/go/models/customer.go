@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Customer es un cliente registrado en el programa de puntos
+type Customer struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name          string             `json:"name" bson:"name"`
+	Email         string             `json:"email,omitempty" bson:"email,omitempty"`
+	Phone         string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	PointsBalance int                `json:"pointsBalance" bson:"pointsBalance"`
+	CreatedAt     int64              `json:"createdAt" bson:"createdAt"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Métodos de costeo para el precio de compra al recibir mercancía
+const (
+	CostingWeightedAverage = "weighted_average"
+	CostingLastCost        = "last_cost"
+)
+
+type InventoryItem struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductID    string             `json:"productId" bson:"productId"`
+	ProductName  string             `json:"productName" bson:"productName"`
+	Quantity     int                `json:"quantity" bson:"quantity"`
+	Location     string             `json:"location" bson:"location"`
+	Category     string             `json:"category" bson:"category"`
+	Barcode      string             `json:"barcode" bson:"barcode"`
+	PrecioCompra float64            `json:"precioCompra" bson:"precioCompra"`
+	MinStock     int                `json:"minStock" bson:"minStock"`
+	MaxStock     int                `json:"maxStock" bson:"maxStock"`
+	UpdatedAt    int64              `json:"updatedAt" bson:"updatedAt"`
+}
+
+const (
+	AlertOpen     = "open"
+	AlertResolved = "resolved"
+)
+
+// InventoryAlert se abre cuando un producto cae por debajo de su stock mínimo
+type InventoryAlert struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductID   string             `json:"productId" bson:"productId"`
+	ProductName string             `json:"productName" bson:"productName"`
+	Quantity    int                `json:"quantity" bson:"quantity"`
+	MinStock    int                `json:"minStock" bson:"minStock"`
+	Status      string             `json:"status" bson:"status"`
+	CreatedAt   int64              `json:"createdAt" bson:"createdAt"`
+	ResolvedAt  int64              `json:"resolvedAt,omitempty" bson:"resolvedAt,omitempty"`
+}
+
+// Tipos de movimiento de inventario
+const (
+	MovementSale       = "sale"
+	MovementRefund     = "refund"
+	MovementReceipt    = "receipt"
+	MovementTransfer   = "transfer"
+	MovementAdjustment = "adjustment"
+	MovementCount      = "count"
+)
+
+type MovementReference struct {
+	Type string `json:"type" bson:"type"`
+	ID   string `json:"id" bson:"id"`
+}
+
+// InventoryMovement registra un cambio de existencias; nunca se modifica
+type InventoryMovement struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ProductID    string             `json:"productId" bson:"productId"`
+	Type         string             `json:"type" bson:"type"`
+	Quantity     int                `json:"quantity" bson:"quantity"`
+	BalanceAfter int                `json:"balanceAfter" bson:"balanceAfter"`
+	Reason       string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	Reference    MovementReference  `json:"reference" bson:"reference"`
+	UserID       string             `json:"userId" bson:"userId"`
+	Timestamp    int64              `json:"timestamp" bson:"timestamp"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Invite es una invitación para darse de alta con un correo y un rol fijos.
+// Sólo se guarda el hash del token; el token se entrega una vez al emitirla.
+type Invite struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TokenHash  string             `json:"-" bson:"tokenHash"`
+	Email      string             `json:"email" bson:"email"`
+	RoleID     primitive.ObjectID `json:"role_id" bson:"role_id"`
+	InvitedBy  string             `json:"invitedBy" bson:"invitedBy"`
+	CreatedAt  int64              `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  int64              `json:"expiresAt" bson:"expiresAt"`
+	AcceptedAt int64              `json:"acceptedAt,omitempty" bson:"acceptedAt,omitempty"`
+}
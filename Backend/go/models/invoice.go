@@ -0,0 +1,38 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	InvoicePending = "pending"
+	InvoiceStamped = "stamped"
+)
+
+// SaleInvoice es el CFDI timbrado de una venta. Las ventas incluidas en una
+// factura global sólo guardan el UUID y la referencia a la factura global.
+type SaleInvoice struct {
+	Status          string              `json:"status" bson:"status"`
+	UUID            string              `json:"uuid,omitempty" bson:"uuid,omitempty"`
+	Serie           string              `json:"serie,omitempty" bson:"serie,omitempty"`
+	Folio           string              `json:"folio,omitempty" bson:"folio,omitempty"`
+	ReceptorRFC     string              `json:"receptorRfc,omitempty" bson:"receptorRfc,omitempty"`
+	XML             string              `json:"-" bson:"xml,omitempty"`
+	Global          bool                `json:"global,omitempty" bson:"global,omitempty"`
+	GlobalInvoiceID *primitive.ObjectID `json:"globalInvoiceId,omitempty" bson:"globalInvoiceId,omitempty"`
+	StampedAt       int64               `json:"stampedAt,omitempty" bson:"stampedAt,omitempty"`
+}
+
+// GlobalInvoice es la factura global de ventas al público en general
+type GlobalInvoice struct {
+	ID           primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	UUID         string               `json:"uuid" bson:"uuid"`
+	Serie        string               `json:"serie" bson:"serie"`
+	Folio        string               `json:"folio" bson:"folio"`
+	XML          string               `json:"-" bson:"xml"`
+	Periodicidad string               `json:"periodicidad" bson:"periodicidad"`
+	Start        int64                `json:"start" bson:"start"`
+	End          int64                `json:"end" bson:"end"`
+	SaleIDs      []primitive.ObjectID `json:"saleIds" bson:"saleIds"`
+	Total        string               `json:"total" bson:"total"`
+	CreatedBy    string               `json:"createdBy" bson:"createdBy"`
+	StampedAt    int64                `json:"stampedAt" bson:"stampedAt"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Forma de pago con puntos del cliente
+const TenderLoyaltyPoints = "loyalty_points"
+
+// Tipos de movimiento de puntos
+const (
+	LoyaltyEarn           = "earn"
+	LoyaltyRedeem         = "redeem"
+	LoyaltyEarnReversal   = "earn_reversal"   // puntos ganados en una venta eliminada
+	LoyaltyRedeemReversal = "redeem_reversal" // puntos devueltos de una venta eliminada
+	LoyaltyExpire         = "expire"
+)
+
+// LoyaltyRules son las reglas del programa de puntos. Los multiplicadores por
+// producto tienen prioridad sobre los de marca.
+type LoyaltyRules struct {
+	ID                 string             `json:"-" bson:"_id"`
+	PointsPerUnit      float64            `json:"pointsPerUnit" bson:"pointsPerUnit"` // puntos por cada peso pagado
+	ProductMultipliers map[string]float64 `json:"productMultipliers" bson:"productMultipliers"`
+	BrandMultipliers   map[string]float64 `json:"brandMultipliers" bson:"brandMultipliers"` // por id_marca del catálogo
+	PointValue         float64            `json:"pointValue" bson:"pointValue"`             // pesos que vale un punto al redimirlo
+	ExpiryDays         int                `json:"expiryDays" bson:"expiryDays"`             // 0 = los puntos no vencen
+	UpdatedBy          string             `json:"updatedBy,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt          int64              `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+}
+
+// LoyaltyTransaction es un movimiento de puntos del cliente. Los abonos
+// (ganados o devueltos) forman lotes: Remaining indica cuántos puntos del lote
+// siguen disponibles y ExpiresAt cuándo vencen.
+type LoyaltyTransaction struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CustomerID   primitive.ObjectID `json:"customerId" bson:"customerId"`
+	Type         string             `json:"type" bson:"type"`
+	Points       int                `json:"points" bson:"points"`
+	BalanceAfter int                `json:"balanceAfter" bson:"balanceAfter"`
+	Remaining    int                `json:"remaining,omitempty" bson:"remaining,omitempty"`
+	ExpiresAt    int64              `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	SaleID       string             `json:"saleId,omitempty" bson:"saleId,omitempty"`
+	UserID       string             `json:"userId,omitempty" bson:"userId,omitempty"`
+	Timestamp    int64              `json:"timestamp" bson:"timestamp"`
+}
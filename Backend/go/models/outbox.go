@@ -0,0 +1,26 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	OutboxPending   = "pending"
+	OutboxPublished = "published"
+	OutboxFailed    = "failed" // se agotaron los reintentos; se reintenta a mano
+)
+
+// OutboxEvent es un evento de dominio guardado en la misma transacción que el
+// cambio que lo produjo. El despachador lo publica en cada destino al menos una
+// vez; ID sirve a los destinos para descartar repetidos.
+type OutboxEvent struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type          string             `json:"type" bson:"type"`
+	AggregateID   string             `json:"aggregateId" bson:"aggregateId"`
+	Payload       string             `json:"payload" bson:"payload"` // JSON
+	Status        string             `json:"status" bson:"status"`
+	PublishedTo   []string           `json:"publishedTo" bson:"publishedTo"` // destinos que ya lo recibieron
+	Attempts      int                `json:"attempts" bson:"attempts"`
+	NextAttemptAt int64              `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	LastError     string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	CreatedAt     int64              `json:"createdAt" bson:"createdAt"`
+	PublishedAt   int64              `json:"publishedAt,omitempty" bson:"publishedAt,omitempty"`
+}
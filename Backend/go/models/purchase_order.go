@@ -0,0 +1,45 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	PurchaseOrderDraft             = "draft"
+	PurchaseOrderApproved          = "approved"
+	PurchaseOrderPartiallyReceived = "partially_received"
+	PurchaseOrderReceived          = "received"
+)
+
+type PurchaseOrderItem struct {
+	ProductID        string  `json:"productId" bson:"productId"`
+	ProductName      string  `json:"productName" bson:"productName"`
+	QuantityOrdered  int     `json:"quantityOrdered" bson:"quantityOrdered"`
+	QuantityReceived int     `json:"quantityReceived" bson:"quantityReceived"`
+	UnitCost         float64 `json:"unitCost" bson:"unitCost"`
+}
+
+type GoodsReceiptItem struct {
+	ProductID string  `json:"productId" bson:"productId"`
+	Quantity  int     `json:"quantity" bson:"quantity"`
+	UnitCost  float64 `json:"unitCost" bson:"unitCost"`
+}
+
+type GoodsReceipt struct {
+	Items      []GoodsReceiptItem `json:"items" bson:"items"`
+	ReceivedBy string             `json:"receivedBy" bson:"receivedBy"`
+	ReceivedAt int64              `json:"receivedAt" bson:"receivedAt"`
+}
+
+type PurchaseOrder struct {
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	SupplierID   primitive.ObjectID  `json:"supplierId" bson:"supplierId"`
+	SupplierName string              `json:"supplierName" bson:"supplierName"`
+	Items        []PurchaseOrderItem `json:"items" bson:"items"`
+	TotalAmount  float64             `json:"totalAmount" bson:"totalAmount"`
+	Notes        string              `json:"notes" bson:"notes"`
+	Status       string              `json:"status" bson:"status"`
+	Receipts     []GoodsReceipt      `json:"receipts" bson:"receipts"`
+	CreatedBy    string              `json:"createdBy" bson:"createdBy"`
+	CreatedAt    int64               `json:"createdAt" bson:"createdAt"`
+	ApprovedBy   string              `json:"approvedBy,omitempty" bson:"approvedBy,omitempty"`
+	ApprovedAt   int64               `json:"approvedAt,omitempty" bson:"approvedAt,omitempty"`
+}
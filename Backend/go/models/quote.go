@@ -0,0 +1,25 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	QuoteOpen      = "open"
+	QuoteConverted = "converted"
+)
+
+// Quote es una cotización; comparte las partidas de la venta pero no afecta
+// existencias ni aparece en los reportes de ventas.
+type Quote struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	Items         []SaleItem          `json:"items" bson:"items"`
+	TotalAmount   float64             `json:"totalAmount" bson:"totalAmount"`
+	CustomerName  string              `json:"customerName" bson:"customerName"`
+	CustomerEmail string              `json:"customerEmail,omitempty" bson:"customerEmail,omitempty"`
+	Notes         string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	SellerID      string              `json:"sellerId" bson:"sellerId"`
+	SellerName    string              `json:"sellerName" bson:"sellerName"`
+	CreatedAt     int64               `json:"createdAt" bson:"createdAt"`
+	ValidUntil    int64               `json:"validUntil" bson:"validUntil"`
+	Status        string              `json:"status" bson:"status"`
+	SaleID        *primitive.ObjectID `json:"saleId,omitempty" bson:"saleId,omitempty"`
+}
@@ -2,6 +2,15 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Permisos que revisan los handlers
+const (
+    PermissionManageUsers  = "manage_users"
+    PermissionViewReports  = "view_reports"
+    PermissionCreateSale   = "create_sale"
+    PermissionViewSales    = "view_sales"    // consultar ventas de todos los vendedores
+    PermissionApproveSales = "approve_sales" // autorizar operaciones sensibles de venta
+)
+
 type Role struct {
     ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
     Name        string             `json:"name" bson:"name"`
@@ -2,6 +2,14 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+const (
+    SaleCompleted = "completed"
+    SaleHeld      = "held"    // ticket en espera, no afecta existencias ni reportes
+    SaleExpired   = "expired" // ticket en espera que nadie retomó
+    SaleLayaway   = "layaway" // apartado con saldo pendiente
+    SaleCanceled  = "canceled"
+)
+
 type SaleItem struct {
     ProductID   string  `json:"productId" bson:"productId"`
     ProductName string  `json:"productName" bson:"productName"`
@@ -10,6 +18,14 @@ type SaleItem struct {
     Subtotal    float64 `json:"subtotal" bson:"subtotal"`
 }
 
+type SalePayment struct {
+    Amount     float64 `json:"amount" bson:"amount"`
+    Method     string  `json:"method" bson:"method"`
+    Code       string  `json:"code,omitempty" bson:"code,omitempty"` // tarjeta de regalo o saldo a favor redimido
+    ReceivedBy string  `json:"receivedBy" bson:"receivedBy"`
+    Timestamp  int64   `json:"timestamp" bson:"timestamp"`
+}
+
 type Sale struct {
     ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
     Items       []SaleItem         `json:"items" bson:"items"`
@@ -18,4 +34,52 @@ type Sale struct {
     SellerName  string             `json:"sellerName" bson:"sellerName"`
     Timestamp   int64              `json:"timestamp" bson:"timestamp"`
     Status      string             `json:"status" bson:"status"` // "completed", "canceled", etc.
+    RegisterID  string             `json:"registerId,omitempty" bson:"registerId,omitempty"`
+    StoreID     string             `json:"storeId,omitempty" bson:"storeId,omitempty"`
+    // Cliente del programa de puntos
+    CustomerID     *primitive.ObjectID `json:"customerId,omitempty" bson:"customerId,omitempty"`
+    Discount       float64             `json:"discount,omitempty" bson:"discount,omitempty"` // descuento por puntos, ya restado del total
+    PointsEarned   int                 `json:"pointsEarned,omitempty" bson:"pointsEarned,omitempty"`
+    PointsRedeemed int                 `json:"pointsRedeemed,omitempty" bson:"pointsRedeemed,omitempty"`
+    // Formas de pago de la venta o abonos de un apartado
+    Payments     []SalePayment `json:"payments,omitempty" bson:"payments,omitempty"`
+    AmountPaid   float64       `json:"amountPaid,omitempty" bson:"amountPaid,omitempty"`
+    Balance      float64       `json:"balance,omitempty" bson:"balance,omitempty"`
+    Forfeited    float64       `json:"forfeited,omitempty" bson:"forfeited,omitempty"`
+    RefundAmount float64       `json:"refundAmount,omitempty" bson:"refundAmount,omitempty"`
+    Invoice      *SaleInvoice  `json:"invoice,omitempty" bson:"invoice,omitempty"`
+    // Ediciones: la venta conserva su fecha y las cifras originales
+    Revision      int        `json:"revision,omitempty" bson:"revision,omitempty"`
+    OriginalItems []SaleItem `json:"originalItems,omitempty" bson:"originalItems,omitempty"`
+    OriginalTotal float64    `json:"originalTotal,omitempty" bson:"originalTotal,omitempty"`
+    UpdatedAt     int64      `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+    // Ventas capturadas sin conexión y sincronizadas después
+    ClientID      string `json:"clientId,omitempty" bson:"clientId,omitempty"`
+    SyncedAt      int64  `json:"syncedAt,omitempty" bson:"syncedAt,omitempty"`
+    StockConflict bool   `json:"stockConflict,omitempty" bson:"stockConflict,omitempty"` // se vendió más de lo que había en existencia
+}
+
+// SaleItemChange es la diferencia de una partida entre dos revisiones
+type SaleItemChange struct {
+    ProductID       string  `json:"productId" bson:"productId"`
+    ProductName     string  `json:"productName" bson:"productName"`
+    QuantityBefore  int     `json:"quantityBefore" bson:"quantityBefore"`
+    QuantityAfter   int     `json:"quantityAfter" bson:"quantityAfter"`
+    UnitPriceBefore float64 `json:"unitPriceBefore" bson:"unitPriceBefore"`
+    UnitPriceAfter  float64 `json:"unitPriceAfter" bson:"unitPriceAfter"`
+}
+
+// SaleRevision registra una edición de la venta: quién, cuándo, por qué y qué cambió
+type SaleRevision struct {
+    ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+    SaleID        string             `json:"saleId" bson:"saleId"`
+    Revision      int                `json:"revision" bson:"revision"`
+    PreviousItems []SaleItem         `json:"previousItems" bson:"previousItems"`
+    Items         []SaleItem         `json:"items" bson:"items"`
+    PreviousTotal float64            `json:"previousTotal" bson:"previousTotal"`
+    TotalAmount   float64            `json:"totalAmount" bson:"totalAmount"`
+    Changes       []SaleItemChange   `json:"changes" bson:"changes"`
+    Reason        string             `json:"reason,omitempty" bson:"reason,omitempty"`
+    EditedBy      string             `json:"editedBy" bson:"editedBy"`
+    EditedAt      int64              `json:"editedAt" bson:"editedAt"`
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	StockCountOpen     = "open"
+	StockCountApproved = "approved"
+	StockCountCanceled = "canceled"
+)
+
+type StockCountEntry struct {
+	ProductID string `json:"productId" bson:"productId"`
+	Quantity  int    `json:"quantity" bson:"quantity"`
+	CountedBy string `json:"countedBy" bson:"countedBy"`
+	CountedAt int64  `json:"countedAt" bson:"countedAt"`
+}
+
+// StockCountLine guarda la existencia del sistema al abrir el conteo
+type StockCountLine struct {
+	ProductID      string  `json:"productId" bson:"productId"`
+	ProductName    string  `json:"productName" bson:"productName"`
+	Barcode        string  `json:"barcode" bson:"barcode"`
+	SystemQuantity int     `json:"systemQuantity" bson:"systemQuantity"`
+	UnitCost       float64 `json:"unitCost" bson:"unitCost"`
+}
+
+type StockCount struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Location   string             `json:"location,omitempty" bson:"location,omitempty"`
+	Category   string             `json:"category,omitempty" bson:"category,omitempty"`
+	Status     string             `json:"status" bson:"status"`
+	Lines      []StockCountLine   `json:"lines" bson:"lines"`
+	Entries    []StockCountEntry  `json:"entries" bson:"entries"`
+	OpenedBy   string             `json:"openedBy" bson:"openedBy"`
+	OpenedAt   int64              `json:"openedAt" bson:"openedAt"`
+	ApprovedBy string             `json:"approvedBy,omitempty" bson:"approvedBy,omitempty"`
+	ApprovedAt int64              `json:"approvedAt,omitempty" bson:"approvedAt,omitempty"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Tipos de cuenta de saldo; también son las formas de pago con que se redimen
+const (
+	TenderGiftCard    = "gift_card"
+	TenderStoreCredit = "store_credit"
+)
+
+const (
+	StoredValueActive = "active"
+	StoredValueVoided = "voided"
+)
+
+// Tipos de movimiento del saldo
+const (
+	StoredValueIssue  = "issue"
+	StoredValueRedeem = "redeem"
+	StoredValueRefund = "refund" // saldo devuelto al cancelar una venta pagada con la cuenta
+	StoredValueVoid   = "void"
+)
+
+// StoredValueAccount es una tarjeta de regalo o un saldo a favor del cliente
+type StoredValueAccount struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Code           string             `json:"code" bson:"code"`
+	Type           string             `json:"type" bson:"type"`
+	Balance        float64            `json:"balance" bson:"balance"`
+	InitialBalance float64            `json:"initialBalance" bson:"initialBalance"`
+	ExpiresAt      int64              `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"` // 0 = sin vencimiento
+	Status         string             `json:"status" bson:"status"`
+	SaleID         string             `json:"saleId,omitempty" bson:"saleId,omitempty"`             // venta que originó el saldo a favor
+	ReplacesCode   string             `json:"replacesCode,omitempty" bson:"replacesCode,omitempty"` // cuenta anulada cuyo reembolso se emitió aquí
+	IssuedBy       string             `json:"issuedBy" bson:"issuedBy"`
+	IssuedAt       int64              `json:"issuedAt" bson:"issuedAt"`
+	VoidedBy       string             `json:"voidedBy,omitempty" bson:"voidedBy,omitempty"`
+	VoidedAt       int64              `json:"voidedAt,omitempty" bson:"voidedAt,omitempty"`
+	VoidReason     string             `json:"voidReason,omitempty" bson:"voidReason,omitempty"`
+}
+
+// StoredValueTransaction es un movimiento del saldo de una cuenta. Amount es
+// positivo en abonos y negativo en cargos.
+type StoredValueTransaction struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	AccountID    primitive.ObjectID `json:"accountId" bson:"accountId"`
+	Code         string             `json:"code" bson:"code"`
+	Type         string             `json:"type" bson:"type"`
+	Amount       float64            `json:"amount" bson:"amount"`
+	BalanceAfter float64            `json:"balanceAfter" bson:"balanceAfter"`
+	SaleID       string             `json:"saleId,omitempty" bson:"saleId,omitempty"`
+	UserID       string             `json:"userId" bson:"userId"`
+	Timestamp    int64              `json:"timestamp" bson:"timestamp"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Supplier struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name        string             `json:"name" bson:"name"`
+	ContactName string             `json:"contactName" bson:"contactName"`
+	Email       string             `json:"email" bson:"email"`
+	Phone       string             `json:"phone" bson:"phone"`
+	RFC         string             `json:"rfc" bson:"rfc"`
+	Address     string             `json:"address" bson:"address"`
+	Active      bool               `json:"active" bson:"active"`
+}
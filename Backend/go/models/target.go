@@ -0,0 +1,22 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	TargetSeller = "seller"
+	TargetStore  = "store"
+)
+
+// SalesTarget es la meta mensual de un vendedor o de una tienda. Las metas en
+// cero no se evalúan.
+type SalesTarget struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Period    string             `json:"period" bson:"period"` // YYYY-MM
+	Scope     string             `json:"scope" bson:"scope"`   // "seller" o "store"
+	ScopeID   string             `json:"scopeId" bson:"scopeId"`
+	Amount    float64            `json:"amount" bson:"amount"`
+	Units     int                `json:"units" bson:"units"`
+	Tickets   int                `json:"tickets" bson:"tickets"`
+	UpdatedBy string             `json:"updatedBy" bson:"updatedBy"`
+	UpdatedAt int64              `json:"updatedAt" bson:"updatedAt"`
+}
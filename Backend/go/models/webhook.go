@@ -0,0 +1,40 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// WebhookSubscription envía los eventos indicados a una URL externa. El
+// secreto firma cada entrega (HMAC-SHA256) y sólo se muestra al crearla.
+type WebhookSubscription struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	URL         string             `json:"url" bson:"url"`
+	Events      []string           `json:"events" bson:"events"`
+	Secret      string             `json:"secret,omitempty" bson:"secret"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Active      bool               `json:"active" bson:"active"`
+	CreatedBy   string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt   int64              `json:"createdAt" bson:"createdAt"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // se agotaron los reintentos
+)
+
+// WebhookDelivery es el envío de un evento a una suscripción y su bitácora de
+// intentos. Payload es el JSON exacto que se firma y se envía.
+type WebhookDelivery struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	SubscriptionID primitive.ObjectID  `json:"subscriptionId" bson:"subscriptionId"`
+	EventID        string              `json:"eventId" bson:"eventId"`
+	Event          string              `json:"event" bson:"event"`
+	Payload        string              `json:"payload" bson:"payload"`
+	Status         string              `json:"status" bson:"status"`
+	Attempts       int                 `json:"attempts" bson:"attempts"`
+	NextAttemptAt  int64               `json:"nextAttemptAt,omitempty" bson:"nextAttemptAt"`
+	LastStatusCode int                 `json:"lastStatusCode,omitempty" bson:"lastStatusCode,omitempty"`
+	LastError      string              `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	ReplayOf       *primitive.ObjectID `json:"replayOf,omitempty" bson:"replayOf,omitempty"`
+	CreatedAt      int64               `json:"createdAt" bson:"createdAt"`
+	DeliveredAt    int64               `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+}
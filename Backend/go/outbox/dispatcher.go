@@ -0,0 +1,162 @@
+package outbox
+
+import (
+	"auth-service/models"
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBackoff limita la espera entre reintentos de un evento
+const maxBackoff = time.Hour
+
+// Sink es un destino de los eventos del outbox. Publish puede recibir el mismo
+// evento más de una vez (si el proceso cae antes de registrar la entrega), así
+// que cada destino descarta repetidos con event.ID.
+type Sink interface {
+	Name() string
+	Handles(eventType string) bool
+	Publish(ctx context.Context, event models.OutboxEvent) error
+}
+
+// Dispatcher publica los eventos pendientes del outbox en cada destino y
+// reintenta con espera exponencial los que fallan. Un evento queda publicado
+// cuando todos los destinos que lo manejan lo recibieron; tras maxAttempts
+// intentos fallidos queda como failed y deja de reintentarse.
+type Dispatcher struct {
+	collection  *mongo.Collection
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	sinks       []Sink
+}
+
+func NewDispatcher(db *mongo.Database, interval time.Duration, maxAttempts int, backoff time.Duration, sinks ...Sink) *Dispatcher {
+	return &Dispatcher{
+		collection:  db.Collection("outbox"),
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		sinks:       sinks,
+	}
+}
+
+// Start ejecuta la publicación en segundo plano hasta que se cancele el contexto
+func (d *Dispatcher) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := d.Dispatch(ctx); err != nil {
+				log.Printf("Outbox dispatch failed: %v", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Dispatch publica los eventos vencidos en orden de creación. Cada uno se
+// aparta primero moviendo su siguiente intento, para que otra instancia no lo
+// publique al mismo tiempo.
+func (d *Dispatcher) Dispatch(ctx context.Context) error {
+	for {
+		now := time.Now()
+		var event models.OutboxEvent
+		err := d.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"status": models.OutboxPending, "nextAttemptAt": bson.M{"$lte": now.Unix()}},
+			bson.M{"$set": bson.M{"nextAttemptAt": now.Add(time.Minute).Unix()}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "nextAttemptAt", Value: 1}, {Key: "_id", Value: 1}}),
+		).Decode(&event)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := d.publish(ctx, event); err != nil {
+			return err
+		}
+	}
+}
+
+// publish entrega el evento a los destinos que aún no lo tienen. Cada entrega
+// exitosa se registra de inmediato para no repetirla en el siguiente intento.
+func (d *Dispatcher) publish(ctx context.Context, event models.OutboxEvent) error {
+	failures, err := d.deliver(ctx, event, func(name string) error {
+		_, err := d.collection.UpdateOne(ctx, bson.M{"_id": event.ID}, bson.M{"$addToSet": bson.M{"publishedTo": name}})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = d.collection.UpdateOne(ctx, bson.M{"_id": event.ID}, bson.M{"$set": d.outcome(event, failures, time.Now())})
+	return err
+}
+
+// deliver publica el evento en cada destino que lo maneja y no lo tiene ya,
+// llamando a record tras cada entrega exitosa. Devuelve los fallos de los
+// destinos; el error sólo si no se pudo registrar una entrega.
+func (d *Dispatcher) deliver(ctx context.Context, event models.OutboxEvent, record func(name string) error) ([]string, error) {
+	published := make(map[string]bool, len(event.PublishedTo))
+	for _, name := range event.PublishedTo {
+		published[name] = true
+	}
+
+	var failures []string
+	for _, sink := range d.sinks {
+		if published[sink.Name()] || !sink.Handles(event.Type) {
+			continue
+		}
+		if err := sink.Publish(ctx, event); err != nil {
+			failures = append(failures, sink.Name()+": "+err.Error())
+			continue
+		}
+		if err := record(sink.Name()); err != nil {
+			return nil, err
+		}
+	}
+	return failures, nil
+}
+
+// outcome son los campos que quedan en el evento tras un intento: publicado
+// si no hubo fallos, pendiente con el siguiente intento más espaciado o failed
+// al agotar los intentos
+func (d *Dispatcher) outcome(event models.OutboxEvent, failures []string, now time.Time) bson.M {
+	if len(failures) == 0 {
+		return bson.M{
+			"status":      models.OutboxPublished,
+			"publishedAt": now.Unix(),
+			"lastError":   "",
+		}
+	}
+
+	attempts := event.Attempts + 1
+	lastError := strings.Join(failures, "; ")
+	set := bson.M{"attempts": attempts, "lastError": lastError}
+	if attempts >= d.maxAttempts {
+		set["status"] = models.OutboxFailed
+		log.Printf("Outbox event %s (%s) failed after %d attempts: %s", event.ID.Hex(), event.Type, attempts, lastError)
+	} else {
+		wait := d.backoff << (attempts - 1)
+		if wait <= 0 || wait > maxBackoff {
+			wait = maxBackoff
+		}
+		set["nextAttemptAt"] = now.Add(wait).Unix()
+		log.Printf("Outbox event %s (%s) attempt %d failed: %s", event.ID.Hex(), event.Type, attempts, lastError)
+	}
+	return set
+}
@@ -0,0 +1,138 @@
+package outbox
+
+import (
+	"auth-service/models"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeSink registra los eventos recibidos y falla con err si está definido
+type fakeSink struct {
+	name      string
+	types     []string
+	err       error
+	published []primitive.ObjectID
+}
+
+func (s *fakeSink) Name() string { return s.name }
+
+func (s *fakeSink) Handles(eventType string) bool {
+	for _, t := range s.types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *fakeSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.published = append(s.published, event.ID)
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	loyalty := &fakeSink{name: "loyalty", types: []string{"sale.completed"}}
+	webhooks := &fakeSink{name: "webhooks", types: []string{"sale.completed", "sale.cancelled"}}
+	broker := &fakeSink{name: "broker", types: []string{"sale.completed"}, err: errors.New("connection refused")}
+	catalog := &fakeSink{name: "catalog", types: []string{"purchase_order.received"}}
+	d := &Dispatcher{sinks: []Sink{loyalty, webhooks, broker, catalog}}
+
+	// loyalty ya lo recibió en un intento anterior
+	event := models.OutboxEvent{ID: primitive.NewObjectID(), Type: "sale.completed", PublishedTo: []string{"loyalty"}}
+	var recorded []string
+	failures, err := d.deliver(context.Background(), event, func(name string) error {
+		recorded = append(recorded, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("deliver() error: %v", err)
+	}
+
+	if len(loyalty.published) != 0 {
+		t.Errorf("loyalty received the event again")
+	}
+	if len(webhooks.published) != 1 || webhooks.published[0] != event.ID {
+		t.Errorf("webhooks received %v, want the event", webhooks.published)
+	}
+	if len(catalog.published) != 0 {
+		t.Errorf("catalog received an event it does not handle")
+	}
+	if !reflect.DeepEqual(recorded, []string{"webhooks"}) {
+		t.Errorf("recorded = %v, want [webhooks]", recorded)
+	}
+	if !reflect.DeepEqual(failures, []string{"broker: connection refused"}) {
+		t.Errorf("failures = %v, want the broker error", failures)
+	}
+
+	// Si no se puede registrar una entrega se detiene sin seguir publicando
+	webhooks.published, broker.err = nil, nil
+	_, err = d.deliver(context.Background(), event, func(name string) error {
+		return errors.New("write failed")
+	})
+	if err == nil {
+		t.Fatal("deliver() = nil error, want the record error")
+	}
+	if len(broker.published) != 0 {
+		t.Errorf("broker received the event after a record error")
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	d := &Dispatcher{maxAttempts: 4, backoff: time.Minute}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		attempts int
+		failures []string
+		want     bson.M
+	}{
+		{
+			name:     "all sinks delivered",
+			attempts: 2,
+			want:     bson.M{"status": models.OutboxPublished, "publishedAt": now.Unix(), "lastError": ""},
+		},
+		{
+			name:     "first failure waits the base backoff",
+			failures: []string{"broker: down"},
+			want:     bson.M{"attempts": 1, "lastError": "broker: down", "nextAttemptAt": now.Add(time.Minute).Unix()},
+		},
+		{
+			name:     "wait doubles on each attempt",
+			attempts: 2,
+			failures: []string{"broker: down", "webhooks: timeout"},
+			want:     bson.M{"attempts": 3, "lastError": "broker: down; webhooks: timeout", "nextAttemptAt": now.Add(4 * time.Minute).Unix()},
+		},
+		{
+			name:     "last attempt marks the event failed",
+			attempts: 3,
+			failures: []string{"broker: down"},
+			want:     bson.M{"attempts": 4, "lastError": "broker: down", "status": models.OutboxFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := models.OutboxEvent{ID: primitive.NewObjectID(), Type: "sale.completed", Attempts: tt.attempts}
+			if got := d.outcome(event, tt.failures, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("outcome() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// La espera no pasa de maxBackoff
+	d = &Dispatcher{maxAttempts: 100, backoff: time.Minute}
+	event := models.OutboxEvent{Attempts: 20}
+	if got := d.outcome(event, []string{"broker: down"}, now)["nextAttemptAt"]; got != now.Add(maxBackoff).Unix() {
+		t.Errorf("nextAttemptAt = %v, want %v", got, now.Add(maxBackoff).Unix())
+	}
+}
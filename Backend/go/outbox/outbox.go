@@ -0,0 +1,49 @@
+package outbox
+
+import (
+	"auth-service/events"
+	"auth-service/models"
+	"auth-service/webhooks"
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Eventos de venta que se guardan en el outbox: los cambios que recibe el
+// stream SSE y los eventos de webhook
+const (
+	SaleCreated   = events.SaleCreated
+	SaleUpdated   = events.SaleUpdated
+	SaleCancelled = events.SaleCancelled
+	SaleCompleted = webhooks.EventSaleCompleted
+	SaleRefunded  = webhooks.EventSaleRefunded
+)
+
+// ProductCostUpdated se guarda cuando una recepción cambia el costo de compra
+// de un producto, para llevarlo al catálogo
+const ProductCostUpdated = "product.cost_updated"
+
+// Write guarda un evento en el outbox. Debe llamarse con el contexto de la
+// unidad de trabajo que hace el cambio (ver uow.Run).
+func Write(ctx context.Context, db *mongo.Database, eventType, aggregateID string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	_, err = db.Collection("outbox").InsertOne(ctx, models.OutboxEvent{
+		ID:            primitive.NewObjectID(),
+		Type:          eventType,
+		AggregateID:   aggregateID,
+		Payload:       string(payload),
+		Status:        models.OutboxPending,
+		PublishedTo:   []string{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	return err
+}
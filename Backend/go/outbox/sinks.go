@@ -0,0 +1,109 @@
+package outbox
+
+import (
+	"auth-service/events"
+	"auth-service/models"
+	"auth-service/webhooks"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WebhookSink encola el evento para los webhooks suscritos, usando el ID del
+// evento como ID de la entrega para no duplicarla.
+type WebhookSink struct {
+	db *mongo.Database
+}
+
+func NewWebhookSink(db *mongo.Database) *WebhookSink {
+	return &WebhookSink{db: db}
+}
+
+func (s *WebhookSink) Name() string { return "webhooks" }
+
+func (s *WebhookSink) Handles(eventType string) bool { return webhooks.IsEvent(eventType) }
+
+func (s *WebhookSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	return webhooks.EnqueueEvent(ctx, s.db, event.ID.Hex(), event.Type, json.RawMessage(event.Payload))
+}
+
+// BrokerSink reenvía los cambios de venta a los suscriptores en proceso
+// (el stream SSE). Si el proceso cae antes de publicarlos, los suscriptores que
+// se reconectan los reciben al reanudar el despachador.
+type BrokerSink struct {
+	broker *events.Broker
+}
+
+func NewBrokerSink(broker *events.Broker) *BrokerSink {
+	return &BrokerSink{broker: broker}
+}
+
+func (s *BrokerSink) Name() string { return "broker" }
+
+func (s *BrokerSink) Handles(eventType string) bool {
+	return eventType == SaleCreated || eventType == SaleUpdated || eventType == SaleCancelled
+}
+
+func (s *BrokerSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	var sale models.Sale
+	if err := json.Unmarshal([]byte(event.Payload), &sale); err != nil {
+		return err
+	}
+	s.broker.Notify(event.Type, sale)
+	return nil
+}
+
+// HTTPSink publica cada evento en un broker de mensajes a través de su puerta
+// HTTP (Kafka REST Proxy, RabbitMQ, NATS...). El encabezado Message-Id lleva el
+// ID del evento para que el broker descarte los repetidos.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (s *HTTPSink) Name() string { return "message_broker" }
+
+func (s *HTTPSink) Handles(eventType string) bool { return true }
+
+func (s *HTTPSink) Publish(ctx context.Context, event models.OutboxEvent) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":          event.ID.Hex(),
+		"type":        event.Type,
+		"aggregateId": event.AggregateID,
+		"createdAt":   event.CreatedAt,
+		"data":        json.RawMessage(event.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Message-Id", event.ID.Hex())
+	req.Header.Set("Event-Type", event.Type)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("broker responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+// Package services contiene las reglas de negocio de usuarios, roles y
+// ventas. Los handlers traducen HTTP a llamadas de servicio y los servicios
+// leen y escriben a través de un store.Store.
+package services
+
+// Kind clasifica un error de negocio para que quien llama elija la respuesta
+type Kind int
+
+const (
+	Invalid Kind = iota + 1
+	Unauthorized
+	Forbidden
+	NotFound
+	Conflict
+)
+
+// Error es una regla de negocio que no se cumplió. Message se muestra tal
+// cual al usuario.
+type Error struct {
+	Kind    Kind
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func newError(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
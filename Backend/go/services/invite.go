@@ -0,0 +1,191 @@
+package services
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"auth-service/webhooks"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInviteFieldsRequired = newError(Invalid, "Email and role are required")
+	ErrAcceptFieldsRequired = newError(Invalid, "Token, name and password are required")
+	ErrInvalidInvite        = newError(NotFound, "Invalid or expired invite")
+)
+
+// NewInvite son los datos de una invitación: el correo y el rol con que se
+// dará de alta quien la acepte
+type NewInvite struct {
+	Email    string `json:"email"`
+	RoleName string `json:"role_name"`
+}
+
+// IssuedInvite es la invitación recién emitida. Token sólo se conoce en este
+// momento: se guarda su hash.
+type IssuedInvite struct {
+	ID        string `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// AcceptInvite son los datos con que el invitado completa su alta
+type AcceptInvite struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type InviteService struct {
+	store store.Store
+	ttl   time.Duration
+}
+
+// NewInviteService crea el servicio; ttl es la vigencia de cada invitación
+func NewInviteService(s store.Store, ttl time.Duration) *InviteService {
+	return &InviteService{store: s, ttl: ttl}
+}
+
+// Issue emite una invitación ligada al correo y al rol. invitedBy es el
+// correo de quien la emite.
+func (s *InviteService) Issue(ctx context.Context, input NewInvite, invitedBy string) (IssuedInvite, error) {
+	input.Email = NormalizeEmail(input.Email)
+	if input.Email == "" || input.RoleName == "" {
+		return IssuedInvite{}, ErrInviteFieldsRequired
+	}
+	if !validEmail(input.Email) {
+		return IssuedInvite{}, ErrInvalidEmail
+	}
+
+	role, err := s.store.Roles().GetByName(ctx, input.RoleName)
+	if err == store.ErrNotFound {
+		return IssuedInvite{}, ErrInvalidRole
+	}
+	if err != nil {
+		return IssuedInvite{}, err
+	}
+
+	_, err = s.store.Users().GetByEmail(ctx, input.Email)
+	if err == nil {
+		return IssuedInvite{}, ErrUserExists
+	}
+	if err != store.ErrNotFound {
+		return IssuedInvite{}, err
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return IssuedInvite{}, err
+	}
+
+	now := time.Now()
+	invite := models.Invite{
+		ID:        primitive.NewObjectID(),
+		TokenHash: hashInviteToken(token),
+		Email:     input.Email,
+		RoleID:    role.ID,
+		InvitedBy: invitedBy,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+	}
+	if err := s.store.Invites().Insert(ctx, invite); err != nil {
+		return IssuedInvite{}, err
+	}
+
+	return IssuedInvite{
+		ID:        invite.ID.Hex(),
+		Email:     invite.Email,
+		Role:      role.Name,
+		Token:     token,
+		ExpiresAt: invite.ExpiresAt,
+	}, nil
+}
+
+// Accept da de alta al invitado con el correo y el rol de la invitación. La
+// invitación se marca como usada en la misma unidad de trabajo que el alta,
+// así que un token sirve una sola vez.
+func (s *InviteService) Accept(ctx context.Context, input AcceptInvite) (UserView, error) {
+	if input.Token == "" || input.Name == "" || input.Password == "" {
+		return UserView{}, ErrAcceptFieldsRequired
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return UserView{}, err
+	}
+
+	var user models.User
+	var role models.Role
+	err = s.store.Atomic(ctx, func(ctx context.Context) error {
+		invite, err := s.store.Invites().GetByTokenHash(ctx, hashInviteToken(input.Token))
+		if err == store.ErrNotFound {
+			return ErrInvalidInvite
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now().Unix()
+		if invite.AcceptedAt != 0 || now >= invite.ExpiresAt {
+			return ErrInvalidInvite
+		}
+
+		// Si el rol se eliminó después de emitir la invitación ya no sirve
+		role, err = s.store.Roles().Get(ctx, invite.RoleID)
+		if err == store.ErrNotFound {
+			return ErrInvalidInvite
+		}
+		if err != nil {
+			return err
+		}
+
+		user = models.User{
+			ID:       primitive.NewObjectID(),
+			Name:     input.Name,
+			Email:    invite.Email,
+			Password: string(hashedPassword),
+			RoleID:   role.ID,
+		}
+		if err := s.store.Users().Insert(ctx, user); err != nil {
+			return err
+		}
+
+		err = s.store.Invites().MarkAccepted(ctx, invite.ID, now)
+		if err == store.ErrNotFound {
+			return ErrInvalidInvite
+		}
+		return err
+	})
+	if err == store.ErrDuplicate {
+		return UserView{}, ErrUserExists
+	}
+	if err != nil {
+		return UserView{}, err
+	}
+
+	view := userView(user, role.Name)
+	enqueueWebhook(ctx, s.store, webhooks.EventUserCreated, view)
+	return view, nil
+}
+
+// newInviteToken genera 32 bytes aleatorios codificados para usarse en un URL
+func newInviteToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashInviteToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
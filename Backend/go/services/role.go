@@ -0,0 +1,120 @@
+package services
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"auth-service/webhooks"
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrRoleNameRequired = newError(Invalid, "Role name is required")
+	ErrRoleNotFound     = newError(NotFound, "Role not found")
+	ErrRoleInUse        = newError(Invalid, "Cannot delete role assigned to users")
+)
+
+type RoleService struct {
+	store store.Store
+}
+
+func NewRoleService(s store.Store) *RoleService {
+	return &RoleService{store: s}
+}
+
+func (s *RoleService) Create(ctx context.Context, role models.Role) (models.Role, error) {
+	if role.Name == "" {
+		return role, ErrRoleNameRequired
+	}
+
+	role.ID = primitive.NewObjectID()
+	if err := s.store.Roles().Insert(ctx, role); err != nil {
+		return role, err
+	}
+	return role, nil
+}
+
+func (s *RoleService) List(ctx context.Context) ([]models.Role, error) {
+	return s.store.Roles().List(ctx)
+}
+
+func (s *RoleService) Update(ctx context.Context, id primitive.ObjectID, role models.Role) error {
+	role.ID = id
+	err := s.store.Roles().Update(ctx, role)
+	if err == store.ErrNotFound {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	enqueueWebhook(ctx, s.store, webhooks.EventRoleUpdated, map[string]interface{}{
+		"id":          id.Hex(),
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	})
+	return nil
+}
+
+// Delete elimina un rol que ningún usuario tenga asignado. La revisión y la
+// eliminación van en la misma unidad de trabajo: asignar el rol también
+// escribe su documento (ver store.RoleStore.Lock), así que una asignación
+// simultánea choca con la eliminación y se reintenta.
+func (s *RoleService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return s.store.Atomic(ctx, func(ctx context.Context) error {
+		count, err := s.store.Users().CountByRole(ctx, id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrRoleInUse
+		}
+
+		err = s.store.Roles().Delete(ctx, id)
+		switch err {
+		case store.ErrNotFound:
+			return ErrRoleNotFound
+		case store.ErrInUse:
+			return ErrRoleInUse
+		}
+		return err
+	})
+}
+
+// Exists indica si hay un rol con ese nombre
+func (s *RoleService) Exists(ctx context.Context, roleName string) (bool, error) {
+	_, err := s.store.Roles().GetByName(ctx, roleName)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// HasPermission indica si el rol tiene el permiso; un rol inexistente no
+// tiene ninguno
+func (s *RoleService) HasPermission(ctx context.Context, roleName, permission string) (bool, error) {
+	role, err := s.store.Roles().GetByName(ctx, roleName)
+	if err == store.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range role.Permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// enqueueWebhook encola el evento después de confirmar el cambio; un error al
+// encolar sólo se registra
+func enqueueWebhook(ctx context.Context, s store.Store, event string, data interface{}) {
+	if err := s.EnqueueWebhook(ctx, event, data); err != nil {
+		log.Printf("Error enqueuing webhook %s: %v", event, err)
+	}
+}
@@ -0,0 +1,568 @@
+package services
+
+import (
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSalesForbidden     = newError(Forbidden, "Only sellers can view sales")
+	ErrHeldSalesForbidden = newError(Forbidden, "Only sellers can view held sales")
+	ErrReportForbidden    = newError(Forbidden, "Only consultants can generate reports")
+	ErrSaleForbidden      = newError(Forbidden, "Cannot access this sale")
+	ErrSaleNotFound       = newError(NotFound, "Sale not found")
+	ErrInvalidStartDate   = newError(Invalid, "Invalid start date format (use YYYY-MM-DD)")
+	ErrInvalidEndDate     = newError(Invalid, "Invalid end date format (use YYYY-MM-DD)")
+
+	ErrCreateSaleForbidden   = newError(Forbidden, "Only sellers can create sales")
+	ErrUpdateSaleForbidden   = newError(Forbidden, "Only sellers can update sales")
+	ErrDeleteSaleForbidden   = newError(Forbidden, "Only sellers can delete sales")
+	ErrCompleteSaleForbidden = newError(Forbidden, "Only sellers can complete sales")
+	ErrUpdateSaleDenied      = newError(Forbidden, "Cannot update this sale")
+	ErrDeleteSaleDenied      = newError(Forbidden, "Cannot delete this sale")
+	ErrEmptySale             = newError(Invalid, "Sale must contain at least one item")
+	ErrInvalidSaleStatus     = newError(Invalid, "Invalid sale status")
+	ErrHeldSalePayment       = newError(Invalid, "Payments are taken when the held sale is completed")
+	ErrDiscountExceedsTotal  = newError(Invalid, "Points discount exceeds the sale total")
+	ErrEditReasonRequired    = newError(Invalid, "Reason is required to edit a completed sale")
+	ErrSaleNotHeld           = newError(Conflict, "Only held sales can be completed")
+	ErrSaleModified          = newError(Conflict, "Sale was modified by another request, reload and try again")
+)
+
+// Viewer es el usuario del token que consulta las ventas
+type Viewer struct {
+	Email string
+	Role  string
+}
+
+// SaleQuery son los filtros de la lista de ventas; las fechas van como YYYY-MM-DD
+type SaleQuery struct {
+	SellerID string
+	StoreID  string
+	Status   string
+	Start    string
+	End      string
+}
+
+// SalesReport resume las ventas completadas de un periodo
+type SalesReport struct {
+	TotalSales  int           `json:"totalSales"`
+	TotalAmount float64       `json:"totalAmount"`
+	Sales       []models.Sale `json:"sales"`
+}
+
+type SaleService struct {
+	store store.Store
+	roles *RoleService
+}
+
+func NewSaleService(s store.Store, roles *RoleService) *SaleService {
+	return &SaleService{store: s, roles: roles}
+}
+
+// canViewAll revisa que el usuario pueda consultar ventas: un vendedor ve las
+// suyas y un rol con view_sales las de todos
+func (s *SaleService) canViewAll(ctx context.Context, viewer Viewer) (bool, error) {
+	canViewAll, err := s.roles.HasPermission(ctx, viewer.Role, models.PermissionViewSales)
+	if err != nil {
+		return false, err
+	}
+	if viewer.Role != "vendedor" && !canViewAll {
+		return false, ErrSalesForbidden
+	}
+	return canViewAll, nil
+}
+
+// List regresa las ventas visibles para el usuario, las más recientes primero
+func (s *SaleService) List(ctx context.Context, viewer Viewer, query SaleQuery) ([]models.Sale, error) {
+	canViewAll, err := s.canViewAll(ctx, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := store.SaleFilter{StoreID: query.StoreID, Status: query.Status}
+	if canViewAll {
+		filter.SellerID = query.SellerID
+	} else {
+		filter.SellerID = viewer.Email
+	}
+
+	if query.Start != "" {
+		startDate, err := time.ParseInLocation("2006-01-02", query.Start, time.Local)
+		if err != nil {
+			return nil, ErrInvalidStartDate
+		}
+		filter.From = startDate.Unix()
+	}
+	if query.End != "" {
+		endDate, err := time.ParseInLocation("2006-01-02", query.End, time.Local)
+		if err != nil {
+			return nil, ErrInvalidEndDate
+		}
+		filter.To = endDate.Add(24 * time.Hour).Unix()
+	}
+
+	return s.store.Sales().List(ctx, filter)
+}
+
+// Get regresa una venta; un vendedor sin view_sales sólo puede ver las suyas
+func (s *SaleService) Get(ctx context.Context, viewer Viewer, id primitive.ObjectID) (models.Sale, error) {
+	canViewAll, err := s.canViewAll(ctx, viewer)
+	if err != nil {
+		return models.Sale{}, err
+	}
+
+	sale, err := s.store.Sales().Get(ctx, id)
+	if err == store.ErrNotFound {
+		return sale, ErrSaleNotFound
+	}
+	if err != nil {
+		return sale, err
+	}
+
+	if !canViewAll && sale.SellerID != viewer.Email {
+		return models.Sale{}, ErrSaleForbidden
+	}
+	return sale, nil
+}
+
+// Revisions lista las ediciones de una venta que el usuario puede ver
+func (s *SaleService) Revisions(ctx context.Context, viewer Viewer, id primitive.ObjectID) ([]models.SaleRevision, error) {
+	if _, err := s.Get(ctx, viewer, id); err != nil {
+		return nil, err
+	}
+	return s.store.Sales().Revisions(ctx, id)
+}
+
+// ListHeld lista los tickets en espera, opcionalmente de una caja, los más
+// antiguos primero
+func (s *SaleService) ListHeld(ctx context.Context, viewer Viewer, registerID string) ([]models.Sale, error) {
+	if viewer.Role != "vendedor" {
+		return nil, ErrHeldSalesForbidden
+	}
+	return s.store.Sales().List(ctx, store.SaleFilter{
+		Status:      models.SaleHeld,
+		RegisterID:  registerID,
+		OldestFirst: true,
+	})
+}
+
+// Report suma las ventas completadas entre start y end (YYYY-MM-DD, ambos
+// incluidos); sin las dos fechas incluye todas. Con original se reportan las
+// cifras con que se registró cada venta, antes de sus ediciones.
+func (s *SaleService) Report(ctx context.Context, viewer Viewer, start, end string, original bool) (SalesReport, error) {
+	if viewer.Role != "consultor" {
+		return SalesReport{}, ErrReportForbidden
+	}
+
+	filter := store.SaleFilter{Status: models.SaleCompleted}
+	if start != "" && end != "" {
+		startDate, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return SalesReport{}, ErrInvalidStartDate
+		}
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			return SalesReport{}, ErrInvalidEndDate
+		}
+		filter.From = startDate.Unix()
+		filter.To = endDate.Add(24 * time.Hour).Unix()
+	}
+
+	sales, err := s.store.Sales().List(ctx, filter)
+	if err != nil {
+		return SalesReport{}, err
+	}
+
+	report := SalesReport{TotalSales: len(sales), Sales: sales}
+	for i, sale := range sales {
+		if original {
+			sales[i] = OriginalFigures(sale)
+		}
+		report.TotalAmount += sales[i].TotalAmount
+	}
+	return report, nil
+}
+
+// OriginalFigures regresa la venta con las partidas y el total con que se
+// registró, antes de cualquier edición
+func OriginalFigures(sale models.Sale) models.Sale {
+	if sale.Revision > 0 {
+		sale.Items = sale.OriginalItems
+		sale.TotalAmount = sale.OriginalTotal
+	}
+	return sale
+}
+
+// SaleEffects aplica lo que una venta mueve fuera del store: existencias,
+// puntos, formas de pago, comisiones, autorizaciones y eventos. El servicio lo
+// llama dentro de la unidad de trabajo de cada operación, así que quien lo
+// implementa se construye por solicitud con lo que ésta trae (formas de pago,
+// reglas de puntos).
+type SaleEffects interface {
+	// Approve consume la autorización de gerente que la operación sobre la
+	// venta necesite; si no la necesita no hace nada
+	Approve(ctx context.Context, sale models.Sale) error
+	// Charge descuenta las existencias de la venta y la cobra. Llena Payments,
+	// AmountPaid, PointsRedeemed y PointsEarned.
+	Charge(ctx context.Context, sale *models.Sale) error
+	// Restock mueve las existencias de las partidas de before a las de after
+	Restock(ctx context.Context, before, after models.Sale) error
+	// Reprice ajusta la comisión ya pagada de una venta cuyo total cambió
+	Reprice(ctx context.Context, before, after models.Sale) error
+	// Reverse regresa lo que movió una venta eliminada: existencias, formas de
+	// pago, comisión y puntos
+	Reverse(ctx context.Context, sale models.Sale) error
+	// Undo deshace lo aplicado con Approve, Charge y Restock cuando la
+	// operación falla después, si la unidad de trabajo no lo deshace sola
+	Undo(ctx context.Context)
+	// Publish escribe los eventos de la venta en el outbox
+	Publish(ctx context.Context, sale models.Sale, eventTypes ...string) error
+}
+
+// NewSale es una venta por registrar. Las partidas ya vienen validadas; el
+// cliente y los puntos a redimir también.
+type NewSale struct {
+	Items          []models.SaleItem
+	Status         string // completed por omisión; held deja el ticket en espera
+	SellerName     string
+	RegisterID     string
+	StoreID        string
+	CustomerID     *primitive.ObjectID
+	Discount       float64 // descuento por puntos
+	PointsRedeemed int
+	Paid           bool // la solicitud trae formas de pago
+}
+
+// SaleEdit son las partidas nuevas de una venta y el motivo del cambio
+type SaleEdit struct {
+	Items  []models.SaleItem
+	Reason string
+}
+
+// run ejecuta fn como unidad de trabajo y llama a Undo si falla
+func (s *SaleService) run(ctx context.Context, effects SaleEffects, fn func(ctx context.Context) error) error {
+	return s.store.Atomic(ctx, func(ctx context.Context) error {
+		if err := fn(ctx); err != nil {
+			effects.Undo(ctx)
+			return err
+		}
+		return nil
+	})
+}
+
+// Create registra una venta del vendedor. Una venta completada descuenta
+// existencias y se cobra en la misma unidad de trabajo; un ticket en espera
+// no afecta nada hasta completarse.
+func (s *SaleService) Create(ctx context.Context, viewer Viewer, input NewSale, effects SaleEffects) (models.Sale, error) {
+	if viewer.Role != "vendedor" {
+		return models.Sale{}, ErrCreateSaleForbidden
+	}
+	if len(input.Items) == 0 {
+		return models.Sale{}, ErrEmptySale
+	}
+
+	status := models.SaleCompleted
+	if input.Status != "" {
+		if input.Status != models.SaleCompleted && input.Status != models.SaleHeld {
+			return models.Sale{}, ErrInvalidSaleStatus
+		}
+		status = input.Status
+	}
+	if status == models.SaleHeld && (input.Paid || input.PointsRedeemed > 0) {
+		return models.Sale{}, ErrHeldSalePayment
+	}
+
+	totalAmount := itemsTotal(input.Items)
+	if input.Discount > totalAmount {
+		return models.Sale{}, ErrDiscountExceedsTotal
+	}
+
+	sale := models.Sale{
+		ID:             primitive.NewObjectID(),
+		Items:          input.Items,
+		TotalAmount:    roundMoney(totalAmount - input.Discount),
+		SellerID:       viewer.Email,
+		SellerName:     input.SellerName,
+		Timestamp:      time.Now().Unix(),
+		Status:         status,
+		RegisterID:     input.RegisterID,
+		StoreID:        input.StoreID,
+		CustomerID:     input.CustomerID,
+		Discount:       input.Discount,
+		PointsRedeemed: input.PointsRedeemed,
+	}
+
+	eventTypes := []string{outbox.SaleCreated}
+	if sale.Status == models.SaleCompleted {
+		eventTypes = append(eventTypes, outbox.SaleCompleted)
+	}
+
+	err := s.run(ctx, effects, func(ctx context.Context) error {
+		sale.Payments, sale.AmountPaid, sale.PointsEarned = nil, 0, 0
+
+		if err := effects.Approve(ctx, sale); err != nil {
+			return err
+		}
+		if sale.Status == models.SaleCompleted {
+			if err := effects.Charge(ctx, &sale); err != nil {
+				return err
+			}
+		}
+		if err := s.store.Sales().Insert(ctx, sale); err != nil {
+			return err
+		}
+		return effects.Publish(ctx, sale, eventTypes...)
+	})
+	return sale, err
+}
+
+// Update reemplaza las partidas de una venta del vendedor. La venta conserva
+// su fecha y la edición queda como una nueva revisión; si la venta ya estaba
+// completada se ajustan sus existencias y la comisión pagada.
+func (s *SaleService) Update(ctx context.Context, viewer Viewer, id primitive.ObjectID, edit SaleEdit, effects SaleEffects) (models.Sale, error) {
+	if viewer.Role != "vendedor" {
+		return models.Sale{}, ErrUpdateSaleForbidden
+	}
+
+	existing, err := s.ownSale(ctx, viewer, id, ErrUpdateSaleDenied)
+	if err != nil {
+		return models.Sale{}, err
+	}
+	if existing.Status == models.SaleCompleted && strings.TrimSpace(edit.Reason) == "" {
+		return models.Sale{}, ErrEditReasonRequired
+	}
+
+	// El descuento por puntos ya cobrado se conserva
+	totalAmount := itemsTotal(edit.Items)
+	if existing.Discount > totalAmount {
+		return models.Sale{}, ErrDiscountExceedsTotal
+	}
+
+	now := time.Now().Unix()
+	updated := existing
+	if existing.Revision == 0 {
+		updated.OriginalItems = existing.Items
+		updated.OriginalTotal = existing.TotalAmount
+	}
+	updated.Items = edit.Items
+	updated.TotalAmount = roundMoney(totalAmount - existing.Discount)
+	updated.Revision++
+	updated.UpdatedAt = now
+
+	revision := models.SaleRevision{
+		ID:            primitive.NewObjectID(),
+		SaleID:        id.Hex(),
+		Revision:      updated.Revision,
+		PreviousItems: existing.Items,
+		Items:         updated.Items,
+		PreviousTotal: existing.TotalAmount,
+		TotalAmount:   updated.TotalAmount,
+		Changes:       SaleItemChanges(existing.Items, updated.Items),
+		Reason:        edit.Reason,
+		EditedBy:      viewer.Email,
+		EditedAt:      now,
+	}
+
+	// Un ticket en espera todavía no ha descontado nada ni pagado comisión
+	completed := existing.Status == models.SaleCompleted
+	err = s.run(ctx, effects, func(ctx context.Context) error {
+		if err := effects.Approve(ctx, existing); err != nil {
+			return err
+		}
+		if completed {
+			if err := effects.Restock(ctx, existing, updated); err != nil {
+				return err
+			}
+		}
+
+		// La revisión leída evita que dos ediciones simultáneas se pisen
+		err := s.store.Sales().Update(ctx, updated, existing)
+		if err == store.ErrConflict {
+			return ErrSaleModified
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.store.Sales().InsertRevision(ctx, revision); err != nil {
+			return err
+		}
+
+		if completed {
+			if err := effects.Reprice(ctx, existing, updated); err != nil {
+				return err
+			}
+		}
+		return effects.Publish(ctx, updated, outbox.SaleUpdated)
+	})
+	if err != nil {
+		return models.Sale{}, err
+	}
+	return updated, nil
+}
+
+// Delete elimina una venta del vendedor y regresa lo que movió. La venta se
+// elimina primero: si otra solicitud ya la eliminó, no se devuelve dos veces
+// el inventario ni el saldo.
+func (s *SaleService) Delete(ctx context.Context, viewer Viewer, id primitive.ObjectID, effects SaleEffects) error {
+	if viewer.Role != "vendedor" {
+		return ErrDeleteSaleForbidden
+	}
+
+	sale, err := s.ownSale(ctx, viewer, id, ErrDeleteSaleDenied)
+	if err != nil {
+		return err
+	}
+
+	eventTypes := []string{outbox.SaleCancelled}
+	if sale.Status == models.SaleCompleted || (sale.Status == models.SaleLayaway && sale.AmountPaid > 0) {
+		eventTypes = append(eventTypes, outbox.SaleRefunded)
+	}
+
+	return s.run(ctx, effects, func(ctx context.Context) error {
+		if err := effects.Approve(ctx, sale); err != nil {
+			return err
+		}
+
+		err := s.store.Sales().Delete(ctx, id)
+		if err == store.ErrNotFound {
+			return ErrSaleNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := effects.Reverse(ctx, sale); err != nil {
+			return err
+		}
+		return effects.Publish(ctx, sale, eventTypes...)
+	})
+}
+
+// Held regresa un ticket en espera para retomarlo
+func (s *SaleService) Held(ctx context.Context, viewer Viewer, id primitive.ObjectID) (models.Sale, error) {
+	if viewer.Role != "vendedor" {
+		return models.Sale{}, ErrCompleteSaleForbidden
+	}
+
+	sale, err := s.store.Sales().Get(ctx, id)
+	if err == store.ErrNotFound {
+		return sale, ErrSaleNotFound
+	}
+	if err != nil {
+		return sale, err
+	}
+	if sale.Status != models.SaleHeld {
+		return models.Sale{}, ErrSaleNotHeld
+	}
+	return sale, nil
+}
+
+// Complete retoma un ticket en espera y lo cierra como venta completada,
+// descontando en ese momento las existencias y cobrándolo. Si otra solicitud
+// lo completa primero, ésta falla con ErrSaleNotHeld y deshace su cobro.
+func (s *SaleService) Complete(ctx context.Context, viewer Viewer, id primitive.ObjectID, effects SaleEffects) (models.Sale, error) {
+	held, err := s.Held(ctx, viewer, id)
+	if err != nil {
+		return models.Sale{}, err
+	}
+
+	sale := held
+	sale.Status = models.SaleCompleted
+	sale.Timestamp = time.Now().Unix()
+
+	err = s.run(ctx, effects, func(ctx context.Context) error {
+		sale.Payments, sale.AmountPaid, sale.PointsRedeemed, sale.PointsEarned = nil, 0, 0, 0
+
+		if err := effects.Approve(ctx, held); err != nil {
+			return err
+		}
+		if err := effects.Charge(ctx, &sale); err != nil {
+			return err
+		}
+
+		err := s.store.Sales().Update(ctx, sale, held)
+		if err == store.ErrConflict {
+			return ErrSaleNotHeld
+		}
+		if err != nil {
+			return err
+		}
+		return effects.Publish(ctx, sale, outbox.SaleUpdated, outbox.SaleCompleted)
+	})
+	if err != nil {
+		return models.Sale{}, err
+	}
+	return sale, nil
+}
+
+// ownSale regresa una venta del vendedor que la va a modificar; denied si es
+// de otro vendedor
+func (s *SaleService) ownSale(ctx context.Context, viewer Viewer, id primitive.ObjectID, denied *Error) (models.Sale, error) {
+	sale, err := s.store.Sales().Get(ctx, id)
+	if err == store.ErrNotFound {
+		return sale, ErrSaleNotFound
+	}
+	if err != nil {
+		return sale, err
+	}
+	if sale.SellerID != viewer.Email {
+		return models.Sale{}, denied
+	}
+	return sale, nil
+}
+
+// SaleItemChanges compara las partidas por producto entre dos revisiones y
+// regresa sólo las que cambiaron
+func SaleItemChanges(before, after []models.SaleItem) []models.SaleItemChange {
+	changes := []models.SaleItemChange{}
+	index := map[string]int{}
+
+	entry := func(item models.SaleItem) *models.SaleItemChange {
+		i, ok := index[item.ProductID]
+		if !ok {
+			i = len(changes)
+			index[item.ProductID] = i
+			changes = append(changes, models.SaleItemChange{ProductID: item.ProductID, ProductName: item.ProductName})
+		}
+		return &changes[i]
+	}
+	for _, item := range before {
+		change := entry(item)
+		change.QuantityBefore += item.Quantity
+		change.UnitPriceBefore = item.UnitPrice
+	}
+	for _, item := range after {
+		change := entry(item)
+		change.QuantityAfter += item.Quantity
+		change.UnitPriceAfter = item.UnitPrice
+	}
+
+	diff := changes[:0]
+	for _, change := range changes {
+		if change.QuantityBefore != change.QuantityAfter || change.UnitPriceBefore != change.UnitPriceAfter {
+			diff = append(diff, change)
+		}
+	}
+	return diff
+}
+
+func itemsTotal(items []models.SaleItem) float64 {
+	total := 0.0
+	for _, item := range items {
+		total += item.Subtotal
+	}
+	return total
+}
+
+// roundMoney redondea un monto a centavos
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
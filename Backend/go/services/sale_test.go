@@ -0,0 +1,407 @@
+package services
+
+import (
+	"auth-service/models"
+	"auth-service/outbox"
+	"auth-service/store"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeEffects registra las llamadas del servicio en lugar de mover
+// existencias, puntos y formas de pago
+type fakeEffects struct {
+	calls []string
+	// failOn hace fallar la llamada con ese nombre
+	failOn string
+	// during corre dentro de la llamada con ese nombre, para simular otra
+	// solicitud que cambia la venta a mitad de la operación
+	during map[string]func()
+}
+
+var errEffect = errors.New("effect failed")
+
+func (f *fakeEffects) call(name string) error {
+	f.calls = append(f.calls, name)
+	if fn := f.during[name]; fn != nil {
+		fn()
+	}
+	if f.failOn == name {
+		return errEffect
+	}
+	return nil
+}
+
+func (f *fakeEffects) Approve(ctx context.Context, sale models.Sale) error {
+	return f.call("approve")
+}
+
+func (f *fakeEffects) Charge(ctx context.Context, sale *models.Sale) error {
+	if err := f.call("charge"); err != nil {
+		return err
+	}
+	sale.Payments = []models.SalePayment{{Amount: sale.TotalAmount, Method: "cash"}}
+	sale.AmountPaid = sale.TotalAmount
+	return nil
+}
+
+func (f *fakeEffects) Restock(ctx context.Context, before, after models.Sale) error {
+	return f.call("restock")
+}
+
+func (f *fakeEffects) Reprice(ctx context.Context, before, after models.Sale) error {
+	return f.call("reprice")
+}
+
+func (f *fakeEffects) Reverse(ctx context.Context, sale models.Sale) error {
+	return f.call("reverse")
+}
+
+func (f *fakeEffects) Undo(ctx context.Context) {
+	f.calls = append(f.calls, "undo")
+}
+
+func (f *fakeEffects) Publish(ctx context.Context, sale models.Sale, eventTypes ...string) error {
+	return f.call("publish " + strings.Join(eventTypes, ","))
+}
+
+func expectCalls(t *testing.T, effects *fakeEffects, want ...string) {
+	t.Helper()
+	if len(want) == 0 {
+		want = nil
+	}
+	if !reflect.DeepEqual(effects.calls, want) {
+		t.Fatalf("calls = %q, want %q", effects.calls, want)
+	}
+}
+
+func newSaleService(t *testing.T) (*store.Memory, *SaleService) {
+	t.Helper()
+	st := store.NewMemory()
+	return st, NewSaleService(st, NewRoleService(st))
+}
+
+var (
+	ana  = Viewer{Email: "ana@example.com", Role: "vendedor"}
+	luis = Viewer{Email: "luis@example.com", Role: "vendedor"}
+)
+
+func items(quantities ...int) []models.SaleItem {
+	var saleItems []models.SaleItem
+	for i, quantity := range quantities {
+		saleItems = append(saleItems, models.SaleItem{
+			ProductID: string(rune('a' + i)),
+			Quantity:  quantity,
+			UnitPrice: 10,
+			Subtotal:  float64(quantity) * 10,
+		})
+	}
+	return saleItems
+}
+
+func TestCreateSaleChargesAndStoresCompletedSale(t *testing.T) {
+	st, sales := newSaleService(t)
+	effects := &fakeEffects{}
+
+	sale, err := sales.Create(context.Background(), ana, NewSale{Items: items(2, 1), Discount: 5.5, PointsRedeemed: 55}, effects)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	expectCalls(t, effects, "approve", "charge", "publish "+outbox.SaleCreated+","+outbox.SaleCompleted)
+	if sale.Status != models.SaleCompleted || sale.SellerID != ana.Email || sale.TotalAmount != 24.5 || sale.AmountPaid != 24.5 {
+		t.Errorf("sale = %+v", sale)
+	}
+
+	stored, err := st.Sales().Get(context.Background(), sale.ID)
+	if err != nil {
+		t.Fatalf("stored sale: %v", err)
+	}
+	if !reflect.DeepEqual(stored, sale) {
+		t.Errorf("stored = %+v, want %+v", stored, sale)
+	}
+}
+
+func TestCreateHeldSaleIsNotCharged(t *testing.T) {
+	_, sales := newSaleService(t)
+	effects := &fakeEffects{}
+
+	sale, err := sales.Create(context.Background(), ana, NewSale{Items: items(1), Status: models.SaleHeld}, effects)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if sale.Status != models.SaleHeld {
+		t.Errorf("status = %q, want %q", sale.Status, models.SaleHeld)
+	}
+	expectCalls(t, effects, "approve", "publish "+outbox.SaleCreated)
+}
+
+func TestCreateSaleRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		viewer Viewer
+		input  NewSale
+		want   error
+	}{
+		{"only sellers", Viewer{Email: "jefe@example.com", Role: "admin"}, NewSale{Items: items(1)}, ErrCreateSaleForbidden},
+		{"empty sale", ana, NewSale{}, ErrEmptySale},
+		{"unknown status", ana, NewSale{Items: items(1), Status: models.SaleCanceled}, ErrInvalidSaleStatus},
+		{"held sale with payments", ana, NewSale{Items: items(1), Status: models.SaleHeld, Paid: true}, ErrHeldSalePayment},
+		{"held sale with points", ana, NewSale{Items: items(1), Status: models.SaleHeld, PointsRedeemed: 10}, ErrHeldSalePayment},
+		{"discount over total", ana, NewSale{Items: items(1), Discount: 10.01}, ErrDiscountExceedsTotal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, sales := newSaleService(t)
+			effects := &fakeEffects{}
+
+			if _, err := sales.Create(context.Background(), tt.viewer, tt.input, effects); err != tt.want {
+				t.Fatalf("Create() error = %v, want %v", err, tt.want)
+			}
+			expectCalls(t, effects)
+			if stored, _ := st.Sales().List(context.Background(), store.SaleFilter{}); len(stored) != 0 {
+				t.Errorf("stored sales = %+v, want none", stored)
+			}
+		})
+	}
+}
+
+func TestCreateSaleRollsBackWhenChargeFails(t *testing.T) {
+	st, sales := newSaleService(t)
+	effects := &fakeEffects{failOn: "charge"}
+
+	if _, err := sales.Create(context.Background(), ana, NewSale{Items: items(1)}, effects); err != errEffect {
+		t.Fatalf("Create() error = %v, want %v", err, errEffect)
+	}
+	expectCalls(t, effects, "approve", "charge", "undo")
+	if stored, _ := st.Sales().List(context.Background(), store.SaleFilter{}); len(stored) != 0 {
+		t.Errorf("stored sales = %+v, want none", stored)
+	}
+}
+
+func TestUpdateCompletedSaleRecordsRevision(t *testing.T) {
+	st, sales := newSaleService(t)
+	ctx := context.Background()
+	original := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleCompleted, Items: items(2), TotalAmount: 18, Discount: 2, Timestamp: 100}
+	st.AddSale(original)
+	effects := &fakeEffects{}
+
+	updated, err := sales.Update(ctx, ana, original.ID, SaleEdit{Items: items(3), Reason: "Faltó una pieza"}, effects)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	expectCalls(t, effects, "approve", "restock", "reprice", "publish "+outbox.SaleUpdated)
+
+	if updated.Revision != 1 || updated.TotalAmount != 28 || updated.Timestamp != 100 {
+		t.Errorf("updated = %+v", updated)
+	}
+	if updated.OriginalTotal != 18 || !reflect.DeepEqual(updated.OriginalItems, original.Items) {
+		t.Errorf("original figures = %v %+v, want %v %+v", updated.OriginalTotal, updated.OriginalItems, 18, original.Items)
+	}
+	if stored, _ := st.Sales().Get(ctx, original.ID); !reflect.DeepEqual(stored, updated) {
+		t.Errorf("stored = %+v, want %+v", stored, updated)
+	}
+
+	revisions, err := st.Sales().Revisions(ctx, original.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("revisions = %+v, %v; want one", revisions, err)
+	}
+	revision := revisions[0]
+	if revision.Revision != 1 || revision.Reason != "Faltó una pieza" || revision.EditedBy != ana.Email || revision.PreviousTotal != 18 || revision.TotalAmount != 28 {
+		t.Errorf("revision = %+v", revision)
+	}
+	want := []models.SaleItemChange{{ProductID: "a", QuantityBefore: 2, QuantityAfter: 3, UnitPriceBefore: 10, UnitPriceAfter: 10}}
+	if !reflect.DeepEqual(revision.Changes, want) {
+		t.Errorf("changes = %+v, want %+v", revision.Changes, want)
+	}
+
+	// La segunda edición conserva las cifras originales
+	again, err := sales.Update(ctx, ana, original.ID, SaleEdit{Items: items(1), Reason: "Devolvió dos"}, &fakeEffects{})
+	if err != nil {
+		t.Fatalf("second Update() error = %v", err)
+	}
+	if again.Revision != 2 || again.OriginalTotal != 18 || again.TotalAmount != 8 {
+		t.Errorf("second update = %+v", again)
+	}
+}
+
+func TestUpdateSaleRules(t *testing.T) {
+	st, sales := newSaleService(t)
+	completed := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleCompleted, Items: items(1), TotalAmount: 10}
+	held := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleHeld, Items: items(1), TotalAmount: 10}
+	discounted := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleHeld, Items: items(3), TotalAmount: 15, Discount: 15}
+	for _, sale := range []models.Sale{completed, held, discounted} {
+		st.AddSale(sale)
+	}
+
+	tests := []struct {
+		name   string
+		viewer Viewer
+		id     primitive.ObjectID
+		edit   SaleEdit
+		want   error
+	}{
+		{"only sellers", Viewer{Email: ana.Email, Role: "consultor"}, completed.ID, SaleEdit{Items: items(2), Reason: "x"}, ErrUpdateSaleForbidden},
+		{"missing sale", ana, primitive.NewObjectID(), SaleEdit{Items: items(2)}, ErrSaleNotFound},
+		{"another seller's sale", luis, completed.ID, SaleEdit{Items: items(2), Reason: "x"}, ErrUpdateSaleDenied},
+		{"completed sale needs a reason", ana, completed.ID, SaleEdit{Items: items(2), Reason: "  "}, ErrEditReasonRequired},
+		{"discount over new total", ana, discounted.ID, SaleEdit{Items: items(1)}, ErrDiscountExceedsTotal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effects := &fakeEffects{}
+			if _, err := sales.Update(context.Background(), tt.viewer, tt.id, tt.edit, effects); err != tt.want {
+				t.Fatalf("Update() error = %v, want %v", err, tt.want)
+			}
+			expectCalls(t, effects)
+		})
+	}
+
+	// Un ticket en espera se edita sin motivo y sin mover existencias
+	effects := &fakeEffects{}
+	if _, err := sales.Update(context.Background(), ana, held.ID, SaleEdit{Items: items(2)}, effects); err != nil {
+		t.Fatalf("Update() held sale error = %v", err)
+	}
+	expectCalls(t, effects, "approve", "publish "+outbox.SaleUpdated)
+}
+
+func TestUpdateSaleDetectsConcurrentEdit(t *testing.T) {
+	st, sales := newSaleService(t)
+	ctx := context.Background()
+	sale := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleCompleted, Items: items(1), TotalAmount: 10}
+	st.AddSale(sale)
+
+	// Otra edición se guarda mientras ésta mueve las existencias
+	concurrent := sale
+	concurrent.Revision = 1
+	effects := &fakeEffects{during: map[string]func(){"restock": func() { st.AddSale(concurrent) }}}
+
+	if _, err := sales.Update(ctx, ana, sale.ID, SaleEdit{Items: items(2), Reason: "x"}, effects); err != ErrSaleModified {
+		t.Fatalf("Update() error = %v, want %v", err, ErrSaleModified)
+	}
+	expectCalls(t, effects, "approve", "restock", "undo")
+	if revisions, _ := st.Sales().Revisions(ctx, sale.ID); len(revisions) != 0 {
+		t.Errorf("revisions = %+v, want none", revisions)
+	}
+}
+
+func TestCancelSale(t *testing.T) {
+	tests := []struct {
+		name   string
+		sale   models.Sale
+		events string
+	}{
+		{"completed sale is refunded", models.Sale{Status: models.SaleCompleted, TotalAmount: 10}, outbox.SaleCancelled + "," + outbox.SaleRefunded},
+		{"layaway with payments is refunded", models.Sale{Status: models.SaleLayaway, TotalAmount: 10, AmountPaid: 4}, outbox.SaleCancelled + "," + outbox.SaleRefunded},
+		{"held sale", models.Sale{Status: models.SaleHeld, TotalAmount: 10}, outbox.SaleCancelled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, sales := newSaleService(t)
+			sale := tt.sale
+			sale.ID, sale.SellerID, sale.Items = primitive.NewObjectID(), ana.Email, items(1)
+			st.AddSale(sale)
+			effects := &fakeEffects{}
+
+			if err := sales.Delete(context.Background(), ana, sale.ID, effects); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			expectCalls(t, effects, "approve", "reverse", "publish "+tt.events)
+			if _, err := st.Sales().Get(context.Background(), sale.ID); err != store.ErrNotFound {
+				t.Errorf("Get() after delete error = %v, want %v", err, store.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestCancelSaleRules(t *testing.T) {
+	st, sales := newSaleService(t)
+	sale := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleCompleted, Items: items(1), TotalAmount: 10}
+	st.AddSale(sale)
+
+	tests := []struct {
+		name   string
+		viewer Viewer
+		id     primitive.ObjectID
+		want   error
+	}{
+		{"only sellers", Viewer{Email: ana.Email, Role: "admin"}, sale.ID, ErrDeleteSaleForbidden},
+		{"missing sale", ana, primitive.NewObjectID(), ErrSaleNotFound},
+		{"another seller's sale", luis, sale.ID, ErrDeleteSaleDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effects := &fakeEffects{}
+			if err := sales.Delete(context.Background(), tt.viewer, tt.id, effects); err != tt.want {
+				t.Fatalf("Delete() error = %v, want %v", err, tt.want)
+			}
+			expectCalls(t, effects)
+		})
+	}
+
+	// Si no se pudo regresar lo cobrado la venta sigue registrada
+	effects := &fakeEffects{failOn: "reverse"}
+	if err := sales.Delete(context.Background(), ana, sale.ID, effects); err != errEffect {
+		t.Fatalf("Delete() error = %v, want %v", err, errEffect)
+	}
+	expectCalls(t, effects, "approve", "reverse", "undo")
+	if _, err := st.Sales().Get(context.Background(), sale.ID); err != nil {
+		t.Errorf("sale was deleted: %v", err)
+	}
+}
+
+func TestCompleteHeldSale(t *testing.T) {
+	st, sales := newSaleService(t)
+	ctx := context.Background()
+	held := models.Sale{ID: primitive.NewObjectID(), SellerID: luis.Email, Status: models.SaleHeld, Items: items(2), TotalAmount: 20, Timestamp: 100}
+	st.AddSale(held)
+	effects := &fakeEffects{}
+
+	// Cualquier vendedor retoma el ticket de la caja
+	sale, err := sales.Complete(ctx, ana, held.ID, effects)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	expectCalls(t, effects, "approve", "charge", "publish "+outbox.SaleUpdated+","+outbox.SaleCompleted)
+	if sale.Status != models.SaleCompleted || sale.AmountPaid != 20 || sale.Timestamp < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("sale = %+v", sale)
+	}
+	if stored, _ := st.Sales().Get(ctx, held.ID); !reflect.DeepEqual(stored, sale) {
+		t.Errorf("stored = %+v, want %+v", stored, sale)
+	}
+
+	// Ya no está en espera
+	effects = &fakeEffects{}
+	if _, err := sales.Complete(ctx, ana, held.ID, effects); err != ErrSaleNotHeld {
+		t.Fatalf("second Complete() error = %v, want %v", err, ErrSaleNotHeld)
+	}
+	expectCalls(t, effects)
+}
+
+func TestCompleteSaleRules(t *testing.T) {
+	st, sales := newSaleService(t)
+	held := models.Sale{ID: primitive.NewObjectID(), SellerID: ana.Email, Status: models.SaleHeld, Items: items(1), TotalAmount: 10}
+	st.AddSale(held)
+
+	if _, err := sales.Complete(context.Background(), Viewer{Email: ana.Email, Role: "admin"}, held.ID, &fakeEffects{}); err != ErrCompleteSaleForbidden {
+		t.Errorf("Complete() by admin error = %v, want %v", err, ErrCompleteSaleForbidden)
+	}
+	if _, err := sales.Complete(context.Background(), ana, primitive.NewObjectID(), &fakeEffects{}); err != ErrSaleNotFound {
+		t.Errorf("Complete() missing sale error = %v, want %v", err, ErrSaleNotFound)
+	}
+
+	// Otra solicitud completa el ticket mientras éste se cobra: el cobro se deshace
+	completed := held
+	completed.Status = models.SaleCompleted
+	effects := &fakeEffects{during: map[string]func(){"charge": func() { st.AddSale(completed) }}}
+	if _, err := sales.Complete(context.Background(), ana, held.ID, effects); err != ErrSaleNotHeld {
+		t.Fatalf("Complete() error = %v, want %v", err, ErrSaleNotHeld)
+	}
+	expectCalls(t, effects, "approve", "charge", "undo")
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"auth-service/models"
+	"auth-service/store"
+	"auth-service/webhooks"
+	"context"
+	"log"
+	"net/mail"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrUserFieldsRequired = newError(Invalid, "All fields are required")
+	ErrInvalidEmail       = newError(Invalid, "Invalid email")
+	ErrInvalidRole        = newError(Invalid, "Invalid role")
+	ErrUserExists         = newError(Conflict, "User already exists")
+	ErrUserNotFound       = newError(NotFound, "User not found")
+	ErrInvalidCredentials = newError(Unauthorized, "Invalid credentials")
+)
+
+// UserView es el usuario que se responde: sin contraseña y con el nombre del rol
+type UserView struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// NewUser son los datos para dar de alta un usuario
+type NewUser struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	RoleName string `json:"role_name"`
+}
+
+// UserUpdate son los datos editables de un usuario; sin RoleName conserva su rol
+type UserUpdate struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	RoleName string `json:"role_name"`
+}
+
+type UserService struct {
+	store store.Store
+}
+
+func NewUserService(s store.Store) *UserService {
+	return &UserService{store: s}
+}
+
+// NormalizeEmail regresa el correo como se guarda y se busca: sin espacios
+// alrededor y en minúsculas
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validEmail indica si el correo ya normalizado es una dirección simple
+// (usuario@dominio), sin nombre ni corchetes
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email && strings.Contains(email, "@")
+}
+
+// Create da de alta un usuario con el rol indicado. El rol, la revisión de
+// que el correo no exista y la inserción van en una unidad de trabajo, para
+// que el rol no se elimine mientras tanto. El índice único del correo cubre
+// las altas concurrentes que pasen la revisión a la vez.
+func (s *UserService) Create(ctx context.Context, input NewUser) (UserView, error) {
+	input.Email = NormalizeEmail(input.Email)
+	if input.Name == "" || input.Email == "" || input.Password == "" || input.RoleName == "" {
+		return UserView{}, ErrUserFieldsRequired
+	}
+	if !validEmail(input.Email) {
+		return UserView{}, ErrInvalidEmail
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return UserView{}, err
+	}
+
+	user := models.User{
+		ID:       primitive.NewObjectID(),
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: string(hashedPassword),
+	}
+
+	var role models.Role
+	err = s.store.Atomic(ctx, func(ctx context.Context) error {
+		var err error
+		role, err = s.lockRole(ctx, input.RoleName)
+		if err != nil {
+			return err
+		}
+		user.RoleID = role.ID
+
+		_, err = s.store.Users().GetByEmail(ctx, input.Email)
+		if err == nil {
+			return ErrUserExists
+		}
+		if err != store.ErrNotFound {
+			return err
+		}
+
+		return s.store.Users().Insert(ctx, user)
+	})
+	if err == store.ErrDuplicate {
+		return UserView{}, ErrUserExists
+	}
+	if err != nil {
+		return UserView{}, err
+	}
+
+	view := userView(user, role.Name)
+	enqueueWebhook(ctx, s.store, webhooks.EventUserCreated, view)
+	return view, nil
+}
+
+// List regresa los usuarios con el nombre de su rol
+func (s *UserService) List(ctx context.Context) ([]UserView, error) {
+	users, err := s.store.Users().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]UserView, 0, len(users))
+	for _, user := range users {
+		views = append(views, userView(user, s.roleName(ctx, user)))
+	}
+	return views, nil
+}
+
+func (s *UserService) Get(ctx context.Context, id primitive.ObjectID) (UserView, error) {
+	user, err := s.store.Users().Get(ctx, id)
+	if err == store.ErrNotFound {
+		return UserView{}, ErrUserNotFound
+	}
+	if err != nil {
+		return UserView{}, err
+	}
+	return userView(user, s.roleName(ctx, user)), nil
+}
+
+// Update cambia nombre, correo y, si se indica, el rol del usuario. El rol
+// nuevo se obtiene en la misma unidad de trabajo que la actualización. Un
+// correo que ya tiene otro usuario es ErrUserExists.
+func (s *UserService) Update(ctx context.Context, id primitive.ObjectID, input UserUpdate) (UserView, error) {
+	input.Email = NormalizeEmail(input.Email)
+	if input.Name == "" || input.Email == "" {
+		return UserView{}, ErrUserFieldsRequired
+	}
+	if !validEmail(input.Email) {
+		return UserView{}, ErrInvalidEmail
+	}
+
+	var user models.User
+	roleName := ""
+	err := s.store.Atomic(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.store.Users().Get(ctx, id)
+		if err == store.ErrNotFound {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if input.RoleName != "" {
+			role, err := s.lockRole(ctx, input.RoleName)
+			if err != nil {
+				return err
+			}
+			user.RoleID = role.ID
+			roleName = role.Name
+		}
+
+		user.Name = input.Name
+		user.Email = input.Email
+		return s.store.Users().Update(ctx, user)
+	})
+	if err == store.ErrDuplicate {
+		return UserView{}, ErrUserExists
+	}
+	if err != nil {
+		return UserView{}, err
+	}
+
+	if roleName == "" {
+		roleName = s.roleName(ctx, user)
+	}
+	return userView(user, roleName), nil
+}
+
+func (s *UserService) Delete(ctx context.Context, id primitive.ObjectID) error {
+	err := s.store.Users().Delete(ctx, id)
+	if err == store.ErrNotFound {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Authenticate valida las credenciales y regresa el usuario con su rol
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (models.User, models.Role, error) {
+	user, err := s.store.Users().GetByEmail(ctx, NormalizeEmail(email))
+	if err == store.ErrNotFound {
+		return user, models.Role{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return user, models.Role{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return user, models.Role{}, ErrInvalidCredentials
+	}
+
+	role, err := s.store.Roles().Get(ctx, user.RoleID)
+	return user, role, err
+}
+
+// lockRole obtiene el rol que se asignará; un rol inexistente es un error de
+// la solicitud
+func (s *UserService) lockRole(ctx context.Context, name string) (models.Role, error) {
+	role, err := s.store.Roles().Lock(ctx, name)
+	if err == store.ErrNotFound {
+		return role, ErrInvalidRole
+	}
+	return role, err
+}
+
+// roleName regresa el nombre del rol del usuario o "unknown" si no se encuentra
+func (s *UserService) roleName(ctx context.Context, user models.User) string {
+	role, err := s.store.Roles().Get(ctx, user.RoleID)
+	if err != nil {
+		log.Printf("Error getting role name for user %s: %v", user.Email, err)
+		return "unknown"
+	}
+	return role.Name
+}
+
+func userView(user models.User, roleName string) UserView {
+	return UserView{
+		ID:    user.ID.Hex(),
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  roleName,
+	}
+}
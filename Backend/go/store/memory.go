@@ -0,0 +1,500 @@
+package store
+
+import (
+	"auth-service/models"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Webhook es un evento encolado en el store en memoria
+type Webhook struct {
+	Event string
+	Data  interface{}
+}
+
+// Memory implementa Store en memoria. Sirve para probar los servicios y los
+// handlers sin un servidor de MongoDB.
+type Memory struct {
+	// tx serializa las unidades de trabajo; mu protege los datos
+	tx sync.Mutex
+	mu sync.Mutex
+
+	users     map[primitive.ObjectID]models.User
+	roles     map[primitive.ObjectID]models.Role
+	sales     map[primitive.ObjectID]models.Sale
+	invites   map[primitive.ObjectID]models.Invite
+	revisions []models.SaleRevision
+	webhooks  []Webhook
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:   map[primitive.ObjectID]models.User{},
+		roles:   map[primitive.ObjectID]models.Role{},
+		sales:   map[primitive.ObjectID]models.Sale{},
+		invites: map[primitive.ObjectID]models.Invite{},
+	}
+}
+
+func (s *Memory) Users() UserStore     { return memoryUsers{s} }
+func (s *Memory) Roles() RoleStore     { return memoryRoles{s} }
+func (s *Memory) Sales() SaleStore     { return memorySales{s} }
+func (s *Memory) Invites() InviteStore { return memoryInvites{s} }
+
+type atomicKey struct{}
+
+// Atomic guarda una copia de los datos y la restaura si fn falla
+func (s *Memory) Atomic(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(atomicKey{}) != nil {
+		return fn(ctx)
+	}
+
+	s.tx.Lock()
+	defer s.tx.Unlock()
+
+	s.mu.Lock()
+	users, roles, sales, invites := copyMap(s.users), copyMap(s.roles), copyMap(s.sales), copyMap(s.invites)
+	revisions, webhooks := len(s.revisions), len(s.webhooks)
+	s.mu.Unlock()
+
+	err := fn(context.WithValue(ctx, atomicKey{}, true))
+	if err != nil {
+		s.mu.Lock()
+		s.users, s.roles, s.sales, s.invites = users, roles, sales, invites
+		s.revisions, s.webhooks = s.revisions[:revisions], s.webhooks[:webhooks]
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *Memory) EnqueueWebhook(ctx context.Context, event string, data interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks = append(s.webhooks, Webhook{Event: event, Data: data})
+	return nil
+}
+
+// Webhooks regresa los eventos encolados hasta ahora
+func (s *Memory) Webhooks() []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Webhook{}, s.webhooks...)
+}
+
+// AddSale guarda una venta tal cual, para preparar escenarios de prueba
+func (s *Memory) AddSale(sale models.Sale) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sales[sale.ID] = sale
+}
+
+// AddRevision guarda una edición de venta, para preparar escenarios de prueba
+func (s *Memory) AddRevision(revision models.SaleRevision) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revisions = append(s.revisions, revision)
+}
+
+func copyMap[K comparable, V any](m map[K]V) map[K]V {
+	c := make(map[K]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+type memoryUsers struct{ s *Memory }
+
+func (m memoryUsers) List(ctx context.Context) ([]models.User, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	users := []models.User{}
+	for _, user := range m.s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.Hex() < users[j].ID.Hex() })
+	return users, nil
+}
+
+func (m memoryUsers) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	user, ok := m.s.users[id]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (m memoryUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, user := range m.s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (m memoryUsers) CountByRole(ctx context.Context, roleID primitive.ObjectID) (int64, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var count int64
+	for _, user := range m.s.users {
+		if user.RoleID == roleID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m memoryUsers) Insert(ctx context.Context, user models.User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if m.emailTaken(user) {
+		return ErrDuplicate
+	}
+	m.s.users[user.ID] = user
+	return nil
+}
+
+func (m memoryUsers) Update(ctx context.Context, user models.User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	current, ok := m.s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if m.emailTaken(user) {
+		return ErrDuplicate
+	}
+	current.Name, current.Email, current.RoleID = user.Name, user.Email, user.RoleID
+	m.s.users[user.ID] = current
+	return nil
+}
+
+// emailTaken indica si otro usuario ya tiene el correo, como el índice único
+// de las otras implementaciones
+func (m memoryUsers) emailTaken(user models.User) bool {
+	for id, other := range m.s.users {
+		if id != user.ID && other.Email == user.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.users, id)
+	return nil
+}
+
+type memoryRoles struct{ s *Memory }
+
+func (m memoryRoles) List(ctx context.Context) ([]models.Role, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	roles := []models.Role{}
+	for _, role := range m.s.roles {
+		roles = append(roles, copyRole(role))
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID.Hex() < roles[j].ID.Hex() })
+	return roles, nil
+}
+
+func (m memoryRoles) Get(ctx context.Context, id primitive.ObjectID) (models.Role, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	role, ok := m.s.roles[id]
+	if !ok {
+		return role, ErrNotFound
+	}
+	return copyRole(role), nil
+}
+
+func (m memoryRoles) GetByName(ctx context.Context, name string) (models.Role, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, role := range m.s.roles {
+		if role.Name == name {
+			return copyRole(role), nil
+		}
+	}
+	return models.Role{}, ErrNotFound
+}
+
+func (m memoryRoles) Insert(ctx context.Context, role models.Role) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	m.s.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+func (m memoryRoles) Update(ctx context.Context, role models.Role) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.roles[role.ID]; !ok {
+		return ErrNotFound
+	}
+	m.s.roles[role.ID] = copyRole(role)
+	return nil
+}
+
+func (m memoryRoles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.roles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.roles, id)
+	return nil
+}
+
+// Lock no necesita marcar el rol: las unidades de trabajo en memoria ya se
+// ejecutan una a la vez
+func (m memoryRoles) Lock(ctx context.Context, name string) (models.Role, error) {
+	return m.GetByName(ctx, name)
+}
+
+func copyRole(role models.Role) models.Role {
+	role.Permissions = append([]string(nil), role.Permissions...)
+	return role
+}
+
+type memorySales struct{ s *Memory }
+
+func (m memorySales) Get(ctx context.Context, id primitive.ObjectID) (models.Sale, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	sale, ok := m.s.sales[id]
+	if !ok {
+		return sale, ErrNotFound
+	}
+	return sale, nil
+}
+
+func (m memorySales) List(ctx context.Context, filter SaleFilter) ([]models.Sale, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	sales := []models.Sale{}
+	for _, sale := range m.s.sales {
+		switch {
+		case filter.SellerID != "" && sale.SellerID != filter.SellerID,
+			filter.StoreID != "" && sale.StoreID != filter.StoreID,
+			filter.RegisterID != "" && sale.RegisterID != filter.RegisterID,
+			filter.Status != "" && sale.Status != filter.Status,
+			filter.ClientID != "" && sale.ClientID != filter.ClientID,
+			filter.From != 0 && sale.Timestamp < filter.From,
+			filter.To != 0 && sale.Timestamp >= filter.To,
+			filter.Uninvoiced && sale.Invoice != nil:
+			continue
+		}
+		sales = append(sales, sale)
+	}
+
+	sort.Slice(sales, func(i, j int) bool {
+		if filter.OldestFirst {
+			return sales[i].Timestamp < sales[j].Timestamp
+		}
+		return sales[i].Timestamp > sales[j].Timestamp
+	})
+	return sales, nil
+}
+
+func (m memorySales) Revisions(ctx context.Context, saleID primitive.ObjectID) ([]models.SaleRevision, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	revisions := []models.SaleRevision{}
+	for _, revision := range m.s.revisions {
+		if revision.SaleID == saleID.Hex() {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+	return revisions, nil
+}
+
+func (m memorySales) Insert(ctx context.Context, sale models.Sale) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if sale.ID.IsZero() {
+		sale.ID = primitive.NewObjectID()
+	}
+	if _, ok := m.s.sales[sale.ID]; ok {
+		return ErrDuplicate
+	}
+	// El ID de la app sin conexión es único, como en el índice de las otras
+	// implementaciones
+	for _, other := range m.s.sales {
+		if sale.ClientID != "" && other.ClientID == sale.ClientID {
+			return ErrDuplicate
+		}
+	}
+	m.s.sales[sale.ID] = sale
+	return nil
+}
+
+func (m memorySales) Update(ctx context.Context, sale, previous models.Sale) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	current, ok := m.s.sales[sale.ID]
+	if !ok || current.Status != previous.Status || current.Revision != previous.Revision || current.AmountPaid != previous.AmountPaid {
+		return ErrConflict
+	}
+	current.Items, current.TotalAmount = sale.Items, sale.TotalAmount
+	current.Status, current.Timestamp = sale.Status, sale.Timestamp
+	current.Payments, current.AmountPaid = sale.Payments, sale.AmountPaid
+	current.Balance, current.Forfeited, current.RefundAmount = sale.Balance, sale.Forfeited, sale.RefundAmount
+	current.PointsRedeemed, current.PointsEarned = sale.PointsRedeemed, sale.PointsEarned
+	current.Revision, current.OriginalItems, current.OriginalTotal = sale.Revision, sale.OriginalItems, sale.OriginalTotal
+	current.UpdatedAt = sale.UpdatedAt
+	m.s.sales[sale.ID] = current
+	return nil
+}
+
+func (m memorySales) SetInvoice(ctx context.Context, id primitive.ObjectID, invoice, previous *models.SaleInvoice) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	current, ok := m.s.sales[id]
+	if !ok || !sameInvoice(current.Invoice, previous) {
+		return ErrConflict
+	}
+	if invoice != nil {
+		copied := *invoice
+		invoice = &copied
+	}
+	current.Invoice = invoice
+	m.s.sales[id] = current
+	return nil
+}
+
+// sameInvoice compara la factura como el filtro de SetInvoice: por estado y
+// factura global
+func sameInvoice(current, previous *models.SaleInvoice) bool {
+	if current == nil || previous == nil {
+		return current == nil && previous == nil
+	}
+	if current.Status != previous.Status {
+		return false
+	}
+	if current.GlobalInvoiceID == nil || previous.GlobalInvoiceID == nil {
+		return previous.GlobalInvoiceID == nil
+	}
+	return *current.GlobalInvoiceID == *previous.GlobalInvoiceID
+}
+
+func (m memorySales) Delete(ctx context.Context, id primitive.ObjectID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.sales[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.s.sales, id)
+	return nil
+}
+
+func (m memorySales) InsertRevision(ctx context.Context, revision models.SaleRevision) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.revisions = append(m.s.revisions, revision)
+	return nil
+}
+
+func (m memorySales) NormalizeEmails(ctx context.Context) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for id, sale := range m.s.sales {
+		sale.SellerID = normalizeEmail(sale.SellerID)
+		m.s.sales[id] = sale
+	}
+	for i := range m.s.revisions {
+		m.s.revisions[i].EditedBy = normalizeEmail(m.s.revisions[i].EditedBy)
+	}
+	return nil
+}
+
+// normalizeEmail escribe el correo como services.NormalizeEmail
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+type memoryInvites struct{ s *Memory }
+
+func (m memoryInvites) Insert(ctx context.Context, invite models.Invite) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if invite.ID.IsZero() {
+		invite.ID = primitive.NewObjectID()
+	}
+	for _, other := range m.s.invites {
+		if other.TokenHash == invite.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	m.s.invites[invite.ID] = invite
+	return nil
+}
+
+func (m memoryInvites) GetByTokenHash(ctx context.Context, tokenHash string) (models.Invite, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, invite := range m.s.invites {
+		if invite.TokenHash == tokenHash {
+			return invite, nil
+		}
+	}
+	return models.Invite{}, ErrNotFound
+}
+
+func (m memoryInvites) MarkAccepted(ctx context.Context, id primitive.ObjectID, acceptedAt int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	invite, ok := m.s.invites[id]
+	if !ok || invite.AcceptedAt != 0 {
+		return ErrNotFound
+	}
+	invite.AcceptedAt = acceptedAt
+	m.s.invites[id] = invite
+	return nil
+}
@@ -0,0 +1,105 @@
+package store
+
+import (
+	"auth-service/models"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryAtomicRollsBackOnError(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	role := models.Role{ID: primitive.NewObjectID(), Name: "vendedor"}
+	s.Roles().Insert(ctx, role)
+
+	failure := errors.New("failed")
+	err := s.Atomic(ctx, func(ctx context.Context) error {
+		s.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ana@example.com", RoleID: role.ID})
+		s.Roles().Delete(ctx, role.ID)
+		s.EnqueueWebhook(ctx, "user.created", nil)
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("Atomic() = %v, want %v", err, failure)
+	}
+
+	if _, err := s.Users().GetByEmail(ctx, "ana@example.com"); err != ErrNotFound {
+		t.Errorf("user insert was not rolled back: %v", err)
+	}
+	if _, err := s.Roles().Get(ctx, role.ID); err != nil {
+		t.Errorf("role delete was not rolled back: %v", err)
+	}
+	if hooks := s.Webhooks(); len(hooks) != 0 {
+		t.Errorf("webhooks = %+v, want none", hooks)
+	}
+}
+
+func TestMemoryAtomicNestedJoinsOuterUnit(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+
+	err := s.Atomic(ctx, func(ctx context.Context) error {
+		if err := s.Atomic(ctx, func(ctx context.Context) error {
+			return s.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"})
+		}); err != nil {
+			return err
+		}
+		return errors.New("outer failed")
+	})
+	if err == nil {
+		t.Fatal("Atomic() = nil, want the outer error")
+	}
+	if _, err := s.Users().GetByEmail(ctx, "ana@example.com"); err != ErrNotFound {
+		t.Errorf("inner insert survived the outer rollback: %v", err)
+	}
+}
+
+func TestMemoryUsersRejectDuplicateEmail(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	ana := models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"}
+	eva := models.User{ID: primitive.NewObjectID(), Email: "eva@example.com"}
+	if err := s.Users().Insert(ctx, ana); err != nil {
+		t.Fatalf("Insert() = %v", err)
+	}
+	if err := s.Users().Insert(ctx, eva); err != nil {
+		t.Fatalf("Insert() = %v", err)
+	}
+
+	if err := s.Users().Insert(ctx, models.User{ID: primitive.NewObjectID(), Email: "ana@example.com"}); err != ErrDuplicate {
+		t.Errorf("Insert() with a taken email = %v, want ErrDuplicate", err)
+	}
+	eva.Email = "ana@example.com"
+	if err := s.Users().Update(ctx, eva); err != ErrDuplicate {
+		t.Errorf("Update() with a taken email = %v, want ErrDuplicate", err)
+	}
+	if err := s.Users().Update(ctx, ana); err != nil {
+		t.Errorf("Update() keeping its own email = %v", err)
+	}
+}
+
+func TestMemorySaleFilter(t *testing.T) {
+	s := NewMemory()
+	ctx := context.Background()
+	sales := []models.Sale{
+		{ID: primitive.NewObjectID(), SellerID: "ana", Status: models.SaleCompleted, Timestamp: 100},
+		{ID: primitive.NewObjectID(), SellerID: "ana", Status: models.SaleHeld, Timestamp: 200},
+		{ID: primitive.NewObjectID(), SellerID: "luis", Status: models.SaleCompleted, Timestamp: 300},
+	}
+	for _, sale := range sales {
+		s.AddSale(sale)
+	}
+
+	got, _ := s.Sales().List(ctx, SaleFilter{Status: models.SaleCompleted})
+	if len(got) != 2 || got[0].ID != sales[2].ID || got[1].ID != sales[0].ID {
+		t.Errorf("completed sales = %+v, want newest first", got)
+	}
+
+	got, _ = s.Sales().List(ctx, SaleFilter{From: 100, To: 300, OldestFirst: true})
+	if len(got) != 2 || got[0].ID != sales[0].ID || got[1].ID != sales[1].ID {
+		t.Errorf("sales in [100, 300) = %+v", got)
+	}
+}
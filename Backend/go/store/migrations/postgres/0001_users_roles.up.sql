@@ -0,0 +1,20 @@
+-- Usuarios y roles. Los ids son los ObjectID en hexadecimal que ya circulan en
+-- los tokens, las ventas y las aprobaciones.
+CREATE TABLE roles (
+    id CHAR(24) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    permissions TEXT[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX roles_name_idx ON roles (name);
+
+CREATE TABLE users (
+    id CHAR(24) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    password TEXT NOT NULL,
+    role_id CHAR(24) NOT NULL REFERENCES roles (id)
+);
+
+CREATE INDEX users_email_idx ON users (email);
+CREATE INDEX users_role_id_idx ON users (role_id);
@@ -0,0 +1,2 @@
+DROP INDEX users_email_key;
+CREATE INDEX users_email_idx ON users (email);
@@ -0,0 +1,25 @@
+-- Los correos se guardan sin espacios y en minúsculas, y no se repiten. Si ya
+-- hay usuarios con el mismo correo normalizado la migración falla y los
+-- enumera: se deben fusionar o corregir a mano antes de volver a correrla.
+DO $$
+DECLARE
+    duplicates TEXT;
+BEGIN
+    SELECT string_agg(normalized || ' (' || ids || ')', '; ')
+    INTO duplicates
+    FROM (
+        SELECT lower(trim(email)) AS normalized, string_agg(id, ', ' ORDER BY id) AS ids
+        FROM users
+        GROUP BY lower(trim(email))
+        HAVING COUNT(*) > 1
+    ) d;
+
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'duplicate user emails: %', duplicates;
+    END IF;
+END $$;
+
+UPDATE users SET email = lower(trim(email)) WHERE email <> lower(trim(email));
+
+DROP INDEX users_email_idx;
+CREATE UNIQUE INDEX users_email_key ON users (email);
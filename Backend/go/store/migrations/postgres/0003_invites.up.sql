@@ -0,0 +1,14 @@
+-- Invitaciones para darse de alta con un correo y un rol fijos. Sólo se
+-- guarda el hash del token. Eliminar un rol descarta sus invitaciones.
+CREATE TABLE invites (
+    id CHAR(24) PRIMARY KEY,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    email VARCHAR(255) NOT NULL,
+    role_id CHAR(24) NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    invited_by VARCHAR(255) NOT NULL,
+    created_at BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL,
+    accepted_at BIGINT
+);
+
+CREATE INDEX invites_role_id_idx ON invites (role_id);
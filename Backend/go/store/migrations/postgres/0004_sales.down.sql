@@ -0,0 +1,3 @@
+DROP TABLE sale_revisions;
+DROP TABLE sale_items;
+DROP TABLE sales;
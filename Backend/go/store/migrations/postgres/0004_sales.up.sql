@@ -0,0 +1,66 @@
+-- Ventas. Las partidas van en su propia tabla para cruzarlas con productos e
+-- inventario; las formas de pago, las partidas originales de una venta
+-- editada y la factura se guardan como JSON porque sólo se leen completas.
+CREATE TABLE sales (
+    id CHAR(24) PRIMARY KEY,
+    seller_id VARCHAR(24) NOT NULL,
+    seller_name VARCHAR(100) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    timestamp BIGINT NOT NULL,
+    register_id VARCHAR(100) NOT NULL DEFAULT '',
+    store_id VARCHAR(100) NOT NULL DEFAULT '',
+    customer_id CHAR(24),
+    total_amount NUMERIC(14, 2) NOT NULL,
+    discount NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    points_earned INTEGER NOT NULL DEFAULT 0,
+    points_redeemed INTEGER NOT NULL DEFAULT 0,
+    payments JSONB NOT NULL DEFAULT '[]',
+    amount_paid NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    balance NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    forfeited NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    refund_amount NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    invoice JSONB,
+    revision INTEGER NOT NULL DEFAULT 0,
+    original_items JSONB NOT NULL DEFAULT '[]',
+    original_total NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    updated_at BIGINT NOT NULL DEFAULT 0,
+    client_id VARCHAR(100) NOT NULL DEFAULT '',
+    synced_at BIGINT NOT NULL DEFAULT 0,
+    stock_conflict BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX sales_timestamp_idx ON sales (timestamp);
+CREATE INDEX sales_seller_id_idx ON sales (seller_id, timestamp);
+CREATE INDEX sales_store_id_idx ON sales (store_id, timestamp);
+CREATE INDEX sales_register_id_idx ON sales (register_id, timestamp);
+CREATE INDEX sales_status_idx ON sales (status);
+
+CREATE TABLE sale_items (
+    sale_id CHAR(24) NOT NULL REFERENCES sales (id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    product_id VARCHAR(100) NOT NULL,
+    product_name VARCHAR(255) NOT NULL DEFAULT '',
+    quantity INTEGER NOT NULL,
+    unit_price NUMERIC(14, 2) NOT NULL,
+    subtotal NUMERIC(14, 2) NOT NULL,
+    PRIMARY KEY (sale_id, position)
+);
+
+CREATE INDEX sale_items_product_id_idx ON sale_items (product_id);
+
+-- Ediciones de una venta. Se conservan aunque la venta se elimine, como en
+-- MongoDB.
+CREATE TABLE sale_revisions (
+    id CHAR(24) PRIMARY KEY,
+    sale_id CHAR(24) NOT NULL,
+    revision INTEGER NOT NULL,
+    previous_items JSONB NOT NULL DEFAULT '[]',
+    items JSONB NOT NULL DEFAULT '[]',
+    previous_total NUMERIC(14, 2) NOT NULL,
+    total_amount NUMERIC(14, 2) NOT NULL,
+    changes JSONB NOT NULL DEFAULT '[]',
+    reason TEXT NOT NULL DEFAULT '',
+    edited_by VARCHAR(24) NOT NULL,
+    edited_at BIGINT NOT NULL,
+    UNIQUE (sale_id, revision)
+);
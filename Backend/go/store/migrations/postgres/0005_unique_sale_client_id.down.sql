@@ -0,0 +1 @@
+DROP INDEX sales_client_id_idx;
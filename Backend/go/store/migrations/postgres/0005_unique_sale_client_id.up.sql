@@ -0,0 +1,4 @@
+-- Una venta sincronizada sin conexión se registra una sola vez, como con el
+-- índice clientId_1 de MongoDB. Las ventas capturadas en línea no tienen ID
+-- de la app y quedan fuera del índice.
+CREATE UNIQUE INDEX sales_client_id_idx ON sales (client_id) WHERE client_id <> '';
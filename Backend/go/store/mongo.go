@@ -0,0 +1,372 @@
+package store
+
+import (
+	"auth-service/models"
+	"auth-service/uow"
+	"auth-service/webhooks"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo implementa Store sobre las colecciones de la base de datos
+type Mongo struct {
+	db      *mongo.Database
+	users   *mongoUsers
+	roles   *mongoRoles
+	sales   *mongoSales
+	invites *mongoInvites
+}
+
+func NewMongo(db *mongo.Database) *Mongo {
+	return &Mongo{
+		db:      db,
+		users:   &mongoUsers{collection: db.Collection("users")},
+		roles:   &mongoRoles{collection: db.Collection("roles")},
+		sales:   &mongoSales{collection: db.Collection("sales"), revisions: db.Collection("sale_revisions")},
+		invites: &mongoInvites{collection: db.Collection("invites")},
+	}
+}
+
+func (s *Mongo) Users() UserStore     { return s.users }
+func (s *Mongo) Roles() RoleStore     { return s.roles }
+func (s *Mongo) Sales() SaleStore     { return s.sales }
+func (s *Mongo) Invites() InviteStore { return s.invites }
+
+func (s *Mongo) Atomic(ctx context.Context, fn func(ctx context.Context) error) error {
+	return uow.Run(ctx, s.db, fn)
+}
+
+func (s *Mongo) EnqueueWebhook(ctx context.Context, event string, data interface{}) error {
+	return webhooks.Enqueue(ctx, s.db, event, data)
+}
+
+type mongoUsers struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoUsers) List(ctx context.Context) ([]models.User, error) {
+	users := []models.User{}
+	return users, findAll(ctx, s.collection, bson.M{}, nil, &users)
+}
+
+func (s *mongoUsers) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	return user, findOne(ctx, s.collection, bson.M{"_id": id}, &user)
+}
+
+func (s *mongoUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	return user, findOne(ctx, s.collection, bson.M{"email": email}, &user)
+}
+
+func (s *mongoUsers) CountByRole(ctx context.Context, roleID primitive.ObjectID) (int64, error) {
+	return s.collection.CountDocuments(ctx, bson.M{"role_id": roleID})
+}
+
+func (s *mongoUsers) Insert(ctx context.Context, user models.User) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	return duplicate(err)
+}
+
+func (s *mongoUsers) Update(ctx context.Context, user models.User) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"name":    user.Name,
+		"email":   user.Email,
+		"role_id": user.RoleID,
+	}})
+	if err != nil {
+		return duplicate(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.collection, id)
+}
+
+type mongoRoles struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoRoles) List(ctx context.Context) ([]models.Role, error) {
+	roles := []models.Role{}
+	return roles, findAll(ctx, s.collection, bson.M{}, nil, &roles)
+}
+
+func (s *mongoRoles) Get(ctx context.Context, id primitive.ObjectID) (models.Role, error) {
+	var role models.Role
+	return role, findOne(ctx, s.collection, bson.M{"_id": id}, &role)
+}
+
+func (s *mongoRoles) GetByName(ctx context.Context, name string) (models.Role, error) {
+	var role models.Role
+	return role, findOne(ctx, s.collection, bson.M{"name": name}, &role)
+}
+
+func (s *mongoRoles) Insert(ctx context.Context, role models.Role) error {
+	_, err := s.collection.InsertOne(ctx, role)
+	return err
+}
+
+func (s *mongoRoles) Update(ctx context.Context, role models.Role) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": role.ID}, bson.M{"$set": bson.M{
+		"name":        role.Name,
+		"permissions": role.Permissions,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoRoles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.collection, id)
+}
+
+func (s *mongoRoles) Lock(ctx context.Context, name string) (models.Role, error) {
+	var role models.Role
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"name": name},
+		bson.M{"$set": bson.M{"lock": primitive.NewObjectID()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&role)
+	if err == mongo.ErrNoDocuments {
+		return role, ErrNotFound
+	}
+	return role, err
+}
+
+type mongoSales struct {
+	collection *mongo.Collection
+	revisions  *mongo.Collection
+}
+
+func (s *mongoSales) Get(ctx context.Context, id primitive.ObjectID) (models.Sale, error) {
+	var sale models.Sale
+	return sale, findOne(ctx, s.collection, bson.M{"_id": id}, &sale)
+}
+
+func (s *mongoSales) List(ctx context.Context, filter SaleFilter) ([]models.Sale, error) {
+	query := bson.M{}
+	if filter.SellerID != "" {
+		query["sellerId"] = filter.SellerID
+	}
+	if filter.StoreID != "" {
+		query["storeId"] = filter.StoreID
+	}
+	if filter.RegisterID != "" {
+		query["registerId"] = filter.RegisterID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.ClientID != "" {
+		query["clientId"] = filter.ClientID
+	}
+	if filter.Uninvoiced {
+		query["invoice"] = bson.M{"$exists": false}
+	}
+	dateRange := bson.M{}
+	if filter.From != 0 {
+		dateRange["$gte"] = filter.From
+	}
+	if filter.To != 0 {
+		dateRange["$lt"] = filter.To
+	}
+	if len(dateRange) > 0 {
+		query["timestamp"] = dateRange
+	}
+
+	order := -1
+	if filter.OldestFirst {
+		order = 1
+	}
+
+	sales := []models.Sale{}
+	return sales, findAll(ctx, s.collection, query, options.Find().SetSort(bson.M{"timestamp": order}), &sales)
+}
+
+func (s *mongoSales) Revisions(ctx context.Context, saleID primitive.ObjectID) ([]models.SaleRevision, error) {
+	revisions := []models.SaleRevision{}
+	return revisions, findAll(ctx, s.revisions, bson.M{"saleId": saleID.Hex()}, options.Find().SetSort(bson.M{"revision": 1}), &revisions)
+}
+
+func (s *mongoSales) Insert(ctx context.Context, sale models.Sale) error {
+	_, err := s.collection.InsertOne(ctx, sale)
+	return duplicate(err)
+}
+
+func (s *mongoSales) Update(ctx context.Context, sale, previous models.Sale) error {
+	// Las ventas anteriores a las ediciones no tienen el campo revision
+	filter := bson.M{"_id": sale.ID, "status": previous.Status, "revision": previous.Revision}
+	if previous.Revision == 0 {
+		filter["revision"] = bson.M{"$exists": false}
+	}
+	// Lo abonado evita que dos pagos simultáneos a un apartado se pisen; sin
+	// pagos el campo no existe
+	filter["amountPaid"] = previous.AmountPaid
+	if previous.AmountPaid == 0 {
+		filter["amountPaid"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"items":          sale.Items,
+		"totalAmount":    sale.TotalAmount,
+		"status":         sale.Status,
+		"timestamp":      sale.Timestamp,
+		"payments":       sale.Payments,
+		"amountPaid":     sale.AmountPaid,
+		"balance":        sale.Balance,
+		"forfeited":      sale.Forfeited,
+		"refundAmount":   sale.RefundAmount,
+		"pointsRedeemed": sale.PointsRedeemed,
+		"pointsEarned":   sale.PointsEarned,
+		"revision":       sale.Revision,
+		"originalItems":  sale.OriginalItems,
+		"originalTotal":  sale.OriginalTotal,
+		"updatedAt":      sale.UpdatedAt,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *mongoSales) SetInvoice(ctx context.Context, id primitive.ObjectID, invoice, previous *models.SaleInvoice) error {
+	filter := bson.M{"_id": id}
+	if previous == nil {
+		filter["invoice"] = bson.M{"$exists": false}
+	} else {
+		filter["invoice.status"] = previous.Status
+		if previous.GlobalInvoiceID != nil {
+			filter["invoice.globalInvoiceId"] = *previous.GlobalInvoiceID
+		}
+	}
+
+	update := bson.M{"$set": bson.M{"invoice": invoice}}
+	if invoice == nil {
+		update = bson.M{"$unset": bson.M{"invoice": ""}}
+	}
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (s *mongoSales) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, s.collection, id)
+}
+
+func (s *mongoSales) InsertRevision(ctx context.Context, revision models.SaleRevision) error {
+	_, err := s.revisions.InsertOne(ctx, revision)
+	return err
+}
+
+func (s *mongoSales) NormalizeEmails(ctx context.Context) error {
+	if _, err := s.collection.UpdateMany(ctx, notNormalizedEmail("sellerId"), normalizeEmailUpdate("sellerId")); err != nil {
+		return err
+	}
+	_, err := s.revisions.UpdateMany(ctx, notNormalizedEmail("editedBy"), normalizeEmailUpdate("editedBy"))
+	return err
+}
+
+// notNormalizedEmail filtra los documentos cuyo campo de correo tiene
+// mayúsculas o espacios en los extremos
+func notNormalizedEmail(field string) bson.M {
+	return bson.M{field: bson.M{"$regex": `[A-Z]|^\s|\s$`}}
+}
+
+// normalizeEmailUpdate escribe el campo de correo sin espacios y en
+// minúsculas, como services.NormalizeEmail
+func normalizeEmailUpdate(field string) mongo.Pipeline {
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		field: bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$" + field}}},
+	}}}}
+}
+
+type mongoInvites struct {
+	collection *mongo.Collection
+}
+
+func (s *mongoInvites) Insert(ctx context.Context, invite models.Invite) error {
+	_, err := s.collection.InsertOne(ctx, invite)
+	return duplicate(err)
+}
+
+func (s *mongoInvites) GetByTokenHash(ctx context.Context, tokenHash string) (models.Invite, error) {
+	var invite models.Invite
+	return invite, findOne(ctx, s.collection, bson.M{"tokenHash": tokenHash}, &invite)
+}
+
+func (s *mongoInvites) MarkAccepted(ctx context.Context, id primitive.ObjectID, acceptedAt int64) error {
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "acceptedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"acceptedAt": acceptedAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// duplicate traduce la violación de un índice único a ErrDuplicate
+func duplicate(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// findOne decodifica el documento que cumple filter; ErrNotFound si no hay
+func findOne(ctx context.Context, collection *mongo.Collection, filter bson.M, result interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+func findAll(ctx context.Context, collection *mongo.Collection, filter bson.M, opts *options.FindOptions, results interface{}) error {
+	findOptions := []*options.FindOptions{}
+	if opts != nil {
+		findOptions = append(findOptions, opts)
+	}
+	cursor, err := collection.Find(ctx, filter, findOptions...)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, results)
+}
+
+func deleteOne(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) error {
+	result, err := collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
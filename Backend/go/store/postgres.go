@@ -0,0 +1,353 @@
+package store
+
+import (
+	"auth-service/models"
+	"auth-service/uow"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Postgres guarda usuarios, roles, invitaciones y ventas en PostgreSQL; las
+// ventas sólo viven aquí (CopySales las trae de MongoDB la primera vez). Cada
+// unidad de trabajo abre además una de MongoDB, donde siguen las existencias,
+// los puntos, las formas de pago y el outbox, para que una venta y sus efectos
+// se apliquen juntos. Los webhooks siguen en MongoDB porque su despachador lee
+// de ahí.
+type Postgres struct {
+	db      *sql.DB
+	users   *pgUsers
+	roles   *pgRoles
+	sales   *pgSales
+	invites *pgInvites
+	mongo   *Mongo
+}
+
+func NewPostgres(db *sql.DB, mongoStore *Mongo) *Postgres {
+	return &Postgres{
+		db:      db,
+		users:   &pgUsers{db: db},
+		roles:   &pgRoles{db: db},
+		sales:   &pgSales{db: db},
+		invites: &pgInvites{db: db},
+		mongo:   mongoStore,
+	}
+}
+
+func (s *Postgres) Users() UserStore     { return s.users }
+func (s *Postgres) Roles() RoleStore     { return s.roles }
+func (s *Postgres) Sales() SaleStore     { return s.sales }
+func (s *Postgres) Invites() InviteStore { return s.invites }
+
+func (s *Postgres) EnqueueWebhook(ctx context.Context, event string, data interface{}) error {
+	return s.mongo.EnqueueWebhook(ctx, event, data)
+}
+
+type txKey struct{}
+
+// Atomic ejecuta fn en una transacción de PostgreSQL dentro de una unidad de
+// trabajo de MongoDB (uow.Run). La de PostgreSQL se confirma primero: si falla,
+// la de MongoDB se aborta. Un deadlock o un conflicto de serialización repite
+// las dos desde el inicio, como uow.Run con los errores transitorios de
+// MongoDB; sin transacción propia en MongoDB no se repite, porque lo que fn
+// escribió ahí ya quedó aplicado. No hay commit en dos fases: si MongoDB falla
+// al confirmar después de PostgreSQL, lo de PostgreSQL queda aplicado y se
+// registra para revisarlo.
+func (s *Postgres) Atomic(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	joined := uow.InTransaction(ctx)
+	for attempt := 1; ; attempt++ {
+		transactional, committed := false, false
+		err := uow.Run(ctx, s.mongo.db, func(ctx context.Context) error {
+			transactional = uow.InTransaction(ctx)
+			err := s.runTx(ctx, fn)
+			committed = err == nil
+			return err
+		})
+		if err != nil && committed {
+			log.Printf("⚠️ PostgreSQL transaction committed but MongoDB's failed: %v", err)
+			return err
+		}
+		if err == nil || !retryable(err) || joined || !transactional || attempt == maxTxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(txRetryDelay << (attempt - 1)):
+		}
+	}
+}
+
+const (
+	maxTxAttempts = 5
+	txRetryDelay  = 10 * time.Millisecond
+)
+
+func (s *Postgres) runTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.Printf("Error rolling back transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// retryable indica un deadlock o un conflicto de serialización
+func retryable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "40001" || pqErr.Code == "40P01")
+}
+
+// querier es lo que comparten *sql.DB y *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// conn regresa la transacción de la unidad de trabajo del contexto, si la hay
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+type pgUsers struct {
+	db *sql.DB
+}
+
+const userColumns = "id, name, email, password, role_id"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (models.User, error) {
+	var user models.User
+	var id, roleID string
+	err := row.Scan(&id, &user.Name, &user.Email, &user.Password, &roleID)
+	if err == sql.ErrNoRows {
+		return user, ErrNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+	if user.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return user, err
+	}
+	user.RoleID, err = primitive.ObjectIDFromHex(roleID)
+	return user, err
+}
+
+func (s *pgUsers) List(ctx context.Context) ([]models.User, error) {
+	rows, err := conn(ctx, s.db).QueryContext(ctx, "SELECT "+userColumns+" FROM users ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *pgUsers) Get(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	return scanUser(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id.Hex()))
+}
+
+func (s *pgUsers) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	return scanUser(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1 LIMIT 1", email))
+}
+
+func (s *pgUsers) CountByRole(ctx context.Context, roleID primitive.ObjectID) (int64, error) {
+	var count int64
+	err := conn(ctx, s.db).QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role_id = $1", roleID.Hex()).Scan(&count)
+	return count, err
+}
+
+func (s *pgUsers) Insert(ctx context.Context, user models.User) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO users (id, name, email, password, role_id) VALUES ($1, $2, $3, $4, $5)",
+		user.ID.Hex(), user.Name, user.Email, user.Password, user.RoleID.Hex())
+	return pgDuplicate(err)
+}
+
+func (s *pgUsers) Update(ctx context.Context, user models.User) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx,
+		"UPDATE users SET name = $2, email = $3, role_id = $4 WHERE id = $1",
+		user.ID.Hex(), user.Name, user.Email, user.RoleID.Hex())
+	return affected(result, pgDuplicate(err))
+}
+
+func (s *pgUsers) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM users WHERE id = $1", id.Hex())
+	return affected(result, err)
+}
+
+type pgRoles struct {
+	db *sql.DB
+}
+
+const roleColumns = "id, name, permissions"
+
+func scanRole(row interface{ Scan(...interface{}) error }) (models.Role, error) {
+	var role models.Role
+	var id string
+	err := row.Scan(&id, &role.Name, pq.Array(&role.Permissions))
+	if err == sql.ErrNoRows {
+		return role, ErrNotFound
+	}
+	if err != nil {
+		return role, err
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	role.ID, err = primitive.ObjectIDFromHex(id)
+	return role, err
+}
+
+func (s *pgRoles) List(ctx context.Context) ([]models.Role, error) {
+	rows, err := conn(ctx, s.db).QueryContext(ctx, "SELECT "+roleColumns+" FROM roles ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *pgRoles) Get(ctx context.Context, id primitive.ObjectID) (models.Role, error) {
+	return scanRole(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+roleColumns+" FROM roles WHERE id = $1", id.Hex()))
+}
+
+func (s *pgRoles) GetByName(ctx context.Context, name string) (models.Role, error) {
+	return scanRole(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+roleColumns+" FROM roles WHERE name = $1 LIMIT 1", name))
+}
+
+func (s *pgRoles) Insert(ctx context.Context, role models.Role) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO roles (id, name, permissions) VALUES ($1, $2, $3)",
+		role.ID.Hex(), role.Name, pq.Array(nonNil(role.Permissions)))
+	return err
+}
+
+func (s *pgRoles) Update(ctx context.Context, role models.Role) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx,
+		"UPDATE roles SET name = $2, permissions = $3 WHERE id = $1",
+		role.ID.Hex(), role.Name, pq.Array(nonNil(role.Permissions)))
+	return affected(result, err)
+}
+
+// Delete falla con ErrInUse si un usuario aún tiene el rol: la llave foránea
+// lo impide aunque la asignación haya ocurrido en otra transacción
+func (s *pgRoles) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM roles WHERE id = $1", id.Hex())
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrInUse
+	}
+	return affected(result, err)
+}
+
+// Lock bloquea la fila del rol hasta el fin de la transacción
+func (s *pgRoles) Lock(ctx context.Context, name string) (models.Role, error) {
+	return scanRole(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+roleColumns+" FROM roles WHERE name = $1 LIMIT 1 FOR UPDATE", name))
+}
+
+type pgInvites struct {
+	db *sql.DB
+}
+
+func (s *pgInvites) Insert(ctx context.Context, invite models.Invite) error {
+	_, err := conn(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO invites (id, token_hash, email, role_id, invited_by, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		invite.ID.Hex(), invite.TokenHash, invite.Email, invite.RoleID.Hex(), invite.InvitedBy, invite.CreatedAt, invite.ExpiresAt)
+	return pgDuplicate(err)
+}
+
+func (s *pgInvites) GetByTokenHash(ctx context.Context, tokenHash string) (models.Invite, error) {
+	var invite models.Invite
+	var id, roleID string
+	var acceptedAt sql.NullInt64
+	err := conn(ctx, s.db).QueryRowContext(ctx,
+		"SELECT id, token_hash, email, role_id, invited_by, created_at, expires_at, accepted_at FROM invites WHERE token_hash = $1",
+		tokenHash,
+	).Scan(&id, &invite.TokenHash, &invite.Email, &roleID, &invite.InvitedBy, &invite.CreatedAt, &invite.ExpiresAt, &acceptedAt)
+	if err == sql.ErrNoRows {
+		return invite, ErrNotFound
+	}
+	if err != nil {
+		return invite, err
+	}
+	invite.AcceptedAt = acceptedAt.Int64
+	if invite.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return invite, err
+	}
+	invite.RoleID, err = primitive.ObjectIDFromHex(roleID)
+	return invite, err
+}
+
+func (s *pgInvites) MarkAccepted(ctx context.Context, id primitive.ObjectID, acceptedAt int64) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx,
+		"UPDATE invites SET accepted_at = $2 WHERE id = $1 AND accepted_at IS NULL",
+		id.Hex(), acceptedAt)
+	return affected(result, err)
+}
+
+// pgDuplicate traduce la violación de un índice único a ErrDuplicate
+func pgDuplicate(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicate
+	}
+	return err
+}
+
+// affected convierte en ErrNotFound un UPDATE o DELETE que no tocó filas
+func affected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
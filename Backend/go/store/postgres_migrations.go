@@ -0,0 +1,233 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// migrationLock es la llave del advisory lock que evita que dos instancias
+// apliquen migraciones a la vez
+const migrationLock = 72470047
+
+// PostgresMigrationStatus es el estado de una migración del esquema de
+// PostgreSQL; AppliedAt es 0 si está pendiente
+type PostgresMigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt int64
+}
+
+// MigratePostgres aplica, en orden y cada una en su transacción, las
+// migraciones de migrations/postgres que aún no estén en schema_migrations.
+// Los archivos se nombran NNNN_descripcion.up.sql y, para revertirlas,
+// NNNN_descripcion.down.sql.
+func MigratePostgres(ctx context.Context, db *sql.DB) error {
+	migrations, err := postgresSQLMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, db, func(session *sql.Conn) error {
+		applied, err := appliedPostgresMigrations(ctx, session)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			err := runPostgresMigration(ctx, session, m.up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)", m.version, m.name, time.Now().Unix())
+			if err != nil {
+				return err
+			}
+			log.Printf("✅ Applied migration %04d_%s", m.version, m.name)
+		}
+		return nil
+	})
+}
+
+// RollbackPostgres revierte, de la más reciente a la más antigua, las últimas
+// steps migraciones aplicadas
+func RollbackPostgres(ctx context.Context, db *sql.DB, steps int) error {
+	migrations, err := postgresSQLMigrations()
+	if err != nil {
+		return err
+	}
+
+	return withMigrationLock(ctx, db, func(session *sql.Conn) error {
+		applied, err := appliedPostgresMigrations(ctx, session)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.version]; !ok {
+				continue
+			}
+			if m.down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", m.version, m.name)
+			}
+			if err := runPostgresMigration(ctx, session, m.down, "DELETE FROM schema_migrations WHERE version = $1", m.version); err != nil {
+				return err
+			}
+			log.Printf("↩️  Reverted migration %04d_%s", m.version, m.name)
+			steps--
+		}
+		return nil
+	})
+}
+
+// PostgresMigrations lista las migraciones del esquema con su estado
+func PostgresMigrations(ctx context.Context, db *sql.DB) ([]PostgresMigrationStatus, error) {
+	migrations, err := postgresSQLMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if err := createSchemaMigrations(ctx, session); err != nil {
+		return nil, err
+	}
+	applied, err := appliedPostgresMigrations(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]PostgresMigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		statuses = append(statuses, PostgresMigrationStatus{Version: m.version, Name: m.name, AppliedAt: applied[m.version]})
+	}
+	return statuses, nil
+}
+
+// withMigrationLock corre fn con el advisory lock tomado. El lock pertenece a
+// la conexión, así que todo va en la misma.
+func withMigrationLock(ctx context.Context, db *sql.DB, fn func(session *sql.Conn) error) error {
+	session, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	if _, err := session.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return err
+	}
+	defer session.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	if err := createSchemaMigrations(ctx, session); err != nil {
+		return err
+	}
+	return fn(session)
+}
+
+func createSchemaMigrations(ctx context.Context, session *sql.Conn) error {
+	_, err := session.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`)
+	return err
+}
+
+// appliedPostgresMigrations devuelve la fecha de aplicación de cada versión
+func appliedPostgresMigrations(ctx context.Context, session *sql.Conn) (map[int]int64, error) {
+	rows, err := session.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]int64)
+	for rows.Next() {
+		var version int
+		var appliedAt int64
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// runPostgresMigration ejecuta el script y su registro en schema_migrations
+// en una misma transacción
+func runPostgresMigration(ctx context.Context, session *sql.Conn, file, record string, args ...interface{}) error {
+	script, err := postgresMigrations.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tx, err := session.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %s: %w", file, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+type sqlMigration struct {
+	version int
+	name    string
+	up      string
+	down    string // vacío si la migración no se puede revertir
+}
+
+func postgresSQLMigrations() ([]sqlMigration, error) {
+	files, err := postgresMigrations.ReadDir("migrations/postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	downs := make(map[string]string)
+	for _, file := range files {
+		if base := strings.TrimSuffix(file.Name(), ".down.sql"); base != file.Name() {
+			downs[base] = path.Join("migrations/postgres", file.Name())
+		}
+	}
+
+	migrations := []sqlMigration{}
+	for _, file := range files {
+		base := strings.TrimSuffix(file.Name(), ".up.sql")
+		if base == file.Name() {
+			continue
+		}
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", file.Name())
+		}
+		migrations = append(migrations, sqlMigration{
+			version: version,
+			name:    name,
+			up:      path.Join("migrations/postgres", file.Name()),
+			down:    downs[base],
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestPostgresMigrationsAreOrdered(t *testing.T) {
+	migrations, err := postgresSQLMigrations()
+	if err != nil {
+		t.Fatalf("postgresSQLMigrations() error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration %d has version %d; versions must be consecutive from 1", i, m.version)
+		}
+		if _, err := postgresMigrations.ReadFile(m.up); err != nil {
+			t.Errorf("reading %s: %v", m.up, err)
+		}
+		if m.down == "" {
+			t.Errorf("migration %04d_%s has no down script", m.version, m.name)
+		} else if _, err := postgresMigrations.ReadFile(m.down); err != nil {
+			t.Errorf("reading %s: %v", m.down, err)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package store
+
+import (
+	"auth-service/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pgSales guarda las ventas en PostgreSQL
+type pgSales struct {
+	db *sql.DB
+}
+
+const saleColumns = "id, seller_id, seller_name, status, timestamp, register_id, store_id, customer_id, " +
+	"total_amount, discount, points_earned, points_redeemed, payments, amount_paid, balance, forfeited, " +
+	"refund_amount, invoice, revision, original_items, original_total, updated_at, client_id, synced_at, stock_conflict"
+
+// storedInvoice es la factura como se guarda en la columna invoice: el JSON de
+// la API omite el XML, que aquí sí se conserva
+type storedInvoice struct {
+	models.SaleInvoice
+	XML string `json:"xml,omitempty"`
+}
+
+func invoiceValue(invoice *models.SaleInvoice) (sql.NullString, error) {
+	if invoice == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(storedInvoice{SaleInvoice: *invoice, XML: invoice.XML})
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// saleValues regresa los valores de la venta en el orden de saleColumns
+func saleValues(sale models.Sale) ([]interface{}, error) {
+	payments, err := json.Marshal(sale.Payments)
+	if err != nil {
+		return nil, err
+	}
+	originalItems, err := json.Marshal(sale.OriginalItems)
+	if err != nil {
+		return nil, err
+	}
+	invoice, err := invoiceValue(sale.Invoice)
+	if err != nil {
+		return nil, err
+	}
+	var customerID sql.NullString
+	if sale.CustomerID != nil {
+		customerID = sql.NullString{String: sale.CustomerID.Hex(), Valid: true}
+	}
+
+	return []interface{}{
+		sale.ID.Hex(), sale.SellerID, sale.SellerName, sale.Status, sale.Timestamp, sale.RegisterID, sale.StoreID, customerID,
+		sale.TotalAmount, sale.Discount, sale.PointsEarned, sale.PointsRedeemed, string(payments), sale.AmountPaid, sale.Balance, sale.Forfeited,
+		sale.RefundAmount, invoice, sale.Revision, string(originalItems), sale.OriginalTotal, sale.UpdatedAt, sale.ClientID, sale.SyncedAt, sale.StockConflict,
+	}, nil
+}
+
+func scanSale(row interface{ Scan(...interface{}) error }) (models.Sale, error) {
+	var sale models.Sale
+	var id string
+	var customerID, invoice sql.NullString
+	var payments, originalItems []byte
+	err := row.Scan(
+		&id, &sale.SellerID, &sale.SellerName, &sale.Status, &sale.Timestamp, &sale.RegisterID, &sale.StoreID, &customerID,
+		&sale.TotalAmount, &sale.Discount, &sale.PointsEarned, &sale.PointsRedeemed, &payments, &sale.AmountPaid, &sale.Balance, &sale.Forfeited,
+		&sale.RefundAmount, &invoice, &sale.Revision, &originalItems, &sale.OriginalTotal, &sale.UpdatedAt, &sale.ClientID, &sale.SyncedAt, &sale.StockConflict,
+	)
+	if err == sql.ErrNoRows {
+		return sale, ErrNotFound
+	}
+	if err != nil {
+		return sale, err
+	}
+
+	if sale.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+		return sale, err
+	}
+	if customerID.Valid {
+		customer, err := primitive.ObjectIDFromHex(customerID.String)
+		if err != nil {
+			return sale, err
+		}
+		sale.CustomerID = &customer
+	}
+	if invoice.Valid {
+		var stored storedInvoice
+		if err := json.Unmarshal([]byte(invoice.String), &stored); err != nil {
+			return sale, err
+		}
+		stored.SaleInvoice.XML = stored.XML
+		sale.Invoice = &stored.SaleInvoice
+	}
+	if err := json.Unmarshal(payments, &sale.Payments); err != nil {
+		return sale, err
+	}
+	return sale, json.Unmarshal(originalItems, &sale.OriginalItems)
+}
+
+// saleQuery arma el SELECT de List con los filtros que no están vacíos
+func saleQuery(filter SaleFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.SellerID != "" {
+		where("seller_id = $%d", filter.SellerID)
+	}
+	if filter.StoreID != "" {
+		where("store_id = $%d", filter.StoreID)
+	}
+	if filter.RegisterID != "" {
+		where("register_id = $%d", filter.RegisterID)
+	}
+	if filter.Status != "" {
+		where("status = $%d", filter.Status)
+	}
+	if filter.ClientID != "" {
+		where("client_id = $%d", filter.ClientID)
+	}
+	if filter.From != 0 {
+		where("timestamp >= $%d", filter.From)
+	}
+	if filter.To != 0 {
+		where("timestamp < $%d", filter.To)
+	}
+	if filter.Uninvoiced {
+		conditions = append(conditions, "invoice IS NULL")
+	}
+
+	query := "SELECT " + saleColumns + " FROM sales"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if filter.OldestFirst {
+		query += " ORDER BY timestamp, id"
+	} else {
+		query += " ORDER BY timestamp DESC, id DESC"
+	}
+	return query, args
+}
+
+func (s *pgSales) Get(ctx context.Context, id primitive.ObjectID) (models.Sale, error) {
+	sale, err := scanSale(conn(ctx, s.db).QueryRowContext(ctx, "SELECT "+saleColumns+" FROM sales WHERE id = $1", id.Hex()))
+	if err != nil {
+		return sale, err
+	}
+	sales := []models.Sale{sale}
+	if err := s.loadItems(ctx, sales); err != nil {
+		return sale, err
+	}
+	return sales[0], nil
+}
+
+func (s *pgSales) List(ctx context.Context, filter SaleFilter) ([]models.Sale, error) {
+	query, args := saleQuery(filter)
+	rows, err := conn(ctx, s.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := []models.Sale{}
+	for rows.Next() {
+		sale, err := scanSale(rows)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, sale)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sales, s.loadItems(ctx, sales)
+}
+
+// loadItems completa las partidas de las ventas con una sola consulta
+func (s *pgSales) loadItems(ctx context.Context, sales []models.Sale) error {
+	if len(sales) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(sales))
+	ids := make([]string, len(sales))
+	for i, sale := range sales {
+		ids[i] = sale.ID.Hex()
+		index[ids[i]] = i
+	}
+
+	rows, err := conn(ctx, s.db).QueryContext(ctx,
+		"SELECT sale_id, product_id, product_name, quantity, unit_price, subtotal FROM sale_items WHERE sale_id = ANY($1) ORDER BY sale_id, position",
+		pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var saleID string
+		var item models.SaleItem
+		if err := rows.Scan(&saleID, &item.ProductID, &item.ProductName, &item.Quantity, &item.UnitPrice, &item.Subtotal); err != nil {
+			return err
+		}
+		i := index[saleID]
+		sales[i].Items = append(sales[i].Items, item)
+	}
+	return rows.Err()
+}
+
+// saveItems reemplaza las partidas de la venta
+func (s *pgSales) saveItems(ctx context.Context, sale models.Sale) error {
+	db := conn(ctx, s.db)
+	if _, err := db.ExecContext(ctx, "DELETE FROM sale_items WHERE sale_id = $1", sale.ID.Hex()); err != nil {
+		return err
+	}
+	for position, item := range sale.Items {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO sale_items (sale_id, position, product_id, product_name, quantity, unit_price, subtotal) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			sale.ID.Hex(), position, item.ProductID, item.ProductName, item.Quantity, item.UnitPrice, item.Subtotal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *pgSales) Revisions(ctx context.Context, saleID primitive.ObjectID) ([]models.SaleRevision, error) {
+	rows, err := conn(ctx, s.db).QueryContext(ctx,
+		"SELECT id, sale_id, revision, previous_items, items, previous_total, total_amount, changes, reason, edited_by, edited_at FROM sale_revisions WHERE sale_id = $1 ORDER BY revision",
+		saleID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.SaleRevision{}
+	for rows.Next() {
+		var revision models.SaleRevision
+		var id string
+		var previousItems, items, changes []byte
+		err := rows.Scan(&id, &revision.SaleID, &revision.Revision, &previousItems, &items, &revision.PreviousTotal,
+			&revision.TotalAmount, &changes, &revision.Reason, &revision.EditedBy, &revision.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+		if revision.ID, err = primitive.ObjectIDFromHex(id); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(previousItems, &revision.PreviousItems); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(items, &revision.Items); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(changes, &revision.Changes); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+func (s *pgSales) Insert(ctx context.Context, sale models.Sale) error {
+	if sale.ID.IsZero() {
+		sale.ID = primitive.NewObjectID()
+	}
+	values, err := saleValues(sale)
+	if err != nil {
+		return err
+	}
+	if _, err := conn(ctx, s.db).ExecContext(ctx, "INSERT INTO sales ("+saleColumns+") VALUES ("+placeholders(len(values))+")", values...); err != nil {
+		return pgDuplicate(err)
+	}
+	return s.saveItems(ctx, sale)
+}
+
+// upsert guarda la venta completa, exista o no
+func (s *pgSales) upsert(ctx context.Context, sale models.Sale) error {
+	values, err := saleValues(sale)
+	if err != nil {
+		return err
+	}
+	columns := strings.Split(saleColumns, ", ")
+	assignments := make([]string, 0, len(columns)-1)
+	for _, column := range columns[1:] {
+		assignments = append(assignments, column+" = EXCLUDED."+column)
+	}
+
+	_, err = conn(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO sales ("+saleColumns+") VALUES ("+placeholders(len(values))+") ON CONFLICT (id) DO UPDATE SET "+strings.Join(assignments, ", "),
+		values...)
+	if err != nil {
+		return err
+	}
+	return s.saveItems(ctx, sale)
+}
+
+func (s *pgSales) Update(ctx context.Context, sale, previous models.Sale) error {
+	payments, err := json.Marshal(sale.Payments)
+	if err != nil {
+		return err
+	}
+	originalItems, err := json.Marshal(sale.OriginalItems)
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, s.db).ExecContext(ctx,
+		`UPDATE sales SET total_amount = $5, status = $6, timestamp = $7, payments = $8, amount_paid = $9,
+			balance = $10, forfeited = $11, refund_amount = $12, points_redeemed = $13, points_earned = $14,
+			revision = $15, original_items = $16, original_total = $17, updated_at = $18
+		WHERE id = $1 AND status = $2 AND revision = $3 AND amount_paid = $4`,
+		sale.ID.Hex(), previous.Status, previous.Revision, previous.AmountPaid,
+		sale.TotalAmount, sale.Status, sale.Timestamp, string(payments), sale.AmountPaid,
+		sale.Balance, sale.Forfeited, sale.RefundAmount, sale.PointsRedeemed, sale.PointsEarned,
+		sale.Revision, string(originalItems), sale.OriginalTotal, sale.UpdatedAt)
+	if err := affected(result, err); err == ErrNotFound {
+		return ErrConflict
+	} else if err != nil {
+		return err
+	}
+	return s.saveItems(ctx, sale)
+}
+
+func (s *pgSales) SetInvoice(ctx context.Context, id primitive.ObjectID, invoice, previous *models.SaleInvoice) error {
+	value, err := invoiceValue(invoice)
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE sales SET invoice = $2 WHERE id = $1 AND "
+	args := []interface{}{id.Hex(), value}
+	switch {
+	case previous == nil:
+		query += "invoice IS NULL"
+	case previous.GlobalInvoiceID == nil:
+		query += "invoice->>'status' = $3"
+		args = append(args, previous.Status)
+	default:
+		query += "invoice->>'status' = $3 AND invoice->>'globalInvoiceId' = $4"
+		args = append(args, previous.Status, previous.GlobalInvoiceID.Hex())
+	}
+
+	result, err := conn(ctx, s.db).ExecContext(ctx, query, args...)
+	if err = affected(result, err); err == ErrNotFound {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *pgSales) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := conn(ctx, s.db).ExecContext(ctx, "DELETE FROM sales WHERE id = $1", id.Hex())
+	return affected(result, err)
+}
+
+func (s *pgSales) InsertRevision(ctx context.Context, revision models.SaleRevision) error {
+	if revision.ID.IsZero() {
+		revision.ID = primitive.NewObjectID()
+	}
+	return s.insertRevision(ctx, revision, "")
+}
+
+func (s *pgSales) NormalizeEmails(ctx context.Context) error {
+	db := conn(ctx, s.db)
+	if _, err := db.ExecContext(ctx, "UPDATE sales SET seller_id = lower(btrim(seller_id)) WHERE seller_id <> lower(btrim(seller_id))"); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, "UPDATE sale_revisions SET edited_by = lower(btrim(edited_by)) WHERE edited_by <> lower(btrim(edited_by))")
+	return err
+}
+
+// insertRevision guarda la edición; suffix completa el INSERT (un ON
+// CONFLICT, por ejemplo)
+func (s *pgSales) insertRevision(ctx context.Context, revision models.SaleRevision, suffix string) error {
+	previousItems, err := json.Marshal(revision.PreviousItems)
+	if err != nil {
+		return err
+	}
+	items, err := json.Marshal(revision.Items)
+	if err != nil {
+		return err
+	}
+	changes, err := json.Marshal(revision.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, s.db).ExecContext(ctx,
+		"INSERT INTO sale_revisions (id, sale_id, revision, previous_items, items, previous_total, total_amount, changes, reason, edited_by, edited_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)"+suffix,
+		revision.ID.Hex(), revision.SaleID, revision.Revision, string(previousItems), string(items), revision.PreviousTotal,
+		revision.TotalAmount, string(changes), revision.Reason, revision.EditedBy, revision.EditedAt)
+	return pgDuplicate(err)
+}
+
+// placeholders regresa "$1, $2, ..., $n"
+func placeholders(n int) string {
+	params := make([]string, n)
+	for i := range params {
+		params[i] = fmt.Sprintf("$%d", i+1)
+	}
+	return strings.Join(params, ", ")
+}
+
+// CopySales copia a PostgreSQL las ventas y las ediciones que hay en MongoDB
+// si la tabla sales está vacía, es decir, la primera vez que se usa el
+// backend. Después de eso las ventas sólo se leen y escriben en PostgreSQL.
+// Regresa cuántas ventas copió.
+func (s *Postgres) CopySales(ctx context.Context) (int, error) {
+	copied := 0
+	err := s.runTx(ctx, func(ctx context.Context) error {
+		var exists bool
+		if err := conn(ctx, s.db).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM sales)").Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		cursor, err := s.mongo.sales.collection.Find(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var sale models.Sale
+			if err := cursor.Decode(&sale); err != nil {
+				return err
+			}
+			if err := s.sales.upsert(ctx, sale); err != nil {
+				return fmt.Errorf("copying sale %s: %w", sale.ID.Hex(), err)
+			}
+			copied++
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		revisions, err := s.mongo.sales.revisions.Find(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		defer revisions.Close(ctx)
+		for revisions.Next(ctx) {
+			var revision models.SaleRevision
+			if err := revisions.Decode(&revision); err != nil {
+				return err
+			}
+			if err := s.sales.insertRevision(ctx, revision, " ON CONFLICT DO NOTHING"); err != nil {
+				return fmt.Errorf("copying revision %s: %w", revision.ID.Hex(), err)
+			}
+		}
+		return revisions.Err()
+	})
+	return copied, err
+}
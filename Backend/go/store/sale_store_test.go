@@ -0,0 +1,187 @@
+package store
+
+import (
+	"auth-service/models"
+	"context"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemorySales(t *testing.T) {
+	testSaleStore(t, NewMemory().Sales())
+}
+
+// testSaleStore revisa lo que toda implementación de SaleStore debe cumplir;
+// sales debe empezar vacío
+func testSaleStore(t *testing.T, sales SaleStore) {
+	ctx := context.Background()
+
+	held := models.Sale{
+		ID:          primitive.NewObjectID(),
+		Items:       []models.SaleItem{{ProductID: "p1", ProductName: "Café", Quantity: 2, UnitPrice: 50, Subtotal: 100}},
+		TotalAmount: 100,
+		SellerID:    "seller",
+		Timestamp:   100,
+		Status:      models.SaleHeld,
+	}
+	older := models.Sale{ID: primitive.NewObjectID(), SellerID: "other", Timestamp: 50, Status: models.SaleCompleted, ClientID: "caja-1-7", SyncedAt: 60}
+	for _, sale := range []models.Sale{held, older} {
+		if err := sales.Insert(ctx, sale); err != nil {
+			t.Fatalf("Insert() error: %v", err)
+		}
+	}
+	if err := sales.Insert(ctx, held); err != ErrDuplicate {
+		t.Errorf("Insert() of an existing id = %v, want ErrDuplicate", err)
+	}
+	resynced := older
+	resynced.ID = primitive.NewObjectID()
+	if err := sales.Insert(ctx, resynced); err != ErrDuplicate {
+		t.Errorf("Insert() of an existing client ID = %v, want ErrDuplicate", err)
+	}
+
+	got, err := sales.Get(ctx, held.ID)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, held) {
+		t.Errorf("Get() = %+v, want %+v", got, held)
+	}
+
+	list, err := sales.List(ctx, SaleFilter{})
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != held.ID || list[1].ID != older.ID {
+		t.Errorf("List() = %+v, want the held sale first", list)
+	}
+	list, err = sales.List(ctx, SaleFilter{SellerID: "seller", Status: models.SaleHeld})
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(list) != 1 || len(list[0].Items) != 1 {
+		t.Errorf("List() by seller and status = %+v, want the held sale with its item", list)
+	}
+	list, err = sales.List(ctx, SaleFilter{ClientID: "caja-1-7"})
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != older.ID {
+		t.Errorf("List() by client ID = %+v, want the synced sale", list)
+	}
+
+	completed := held
+	completed.Status = models.SaleCompleted
+	completed.Items = []models.SaleItem{{ProductID: "p2", Quantity: 1, UnitPrice: 80, Subtotal: 80}}
+	completed.TotalAmount = 80
+	completed.Payments = []models.SalePayment{{Amount: 50, Method: "cash"}}
+	completed.AmountPaid, completed.Balance = 50, 30
+	completed.Revision = 1
+	if err := sales.Update(ctx, completed, held); err != nil {
+		t.Fatalf("Update() error: %v", err)
+	}
+	if err := sales.Update(ctx, completed, held); err != ErrConflict {
+		t.Errorf("Update() from a stale revision = %v, want ErrConflict", err)
+	}
+	got, err = sales.Get(ctx, held.ID)
+	if err != nil {
+		t.Fatalf("Get() error: %v", err)
+	}
+	if !reflect.DeepEqual(got, completed) {
+		t.Errorf("Get() after Update() = %+v, want %+v", got, completed)
+	}
+
+	// Dos pagos leídos con el mismo abono: el segundo choca
+	first, second := completed, completed
+	first.AmountPaid, first.Balance = 60, 20
+	second.AmountPaid, second.Balance = 70, 10
+	if err := sales.Update(ctx, first, completed); err != nil {
+		t.Fatalf("Update() error: %v", err)
+	}
+	if err := sales.Update(ctx, second, completed); err != ErrConflict {
+		t.Errorf("Update() from a stale payment = %v, want ErrConflict", err)
+	}
+
+	pending := &models.SaleInvoice{Status: models.InvoicePending}
+	stamped := &models.SaleInvoice{Status: models.InvoiceStamped, UUID: "uuid", XML: "<cfdi/>", StampedAt: 300}
+	if err := sales.SetInvoice(ctx, held.ID, pending, nil); err != nil {
+		t.Fatalf("SetInvoice() error: %v", err)
+	}
+	if err := sales.SetInvoice(ctx, held.ID, pending, nil); err != ErrConflict {
+		t.Errorf("SetInvoice() on an invoiced sale = %v, want ErrConflict", err)
+	}
+	list, err = sales.List(ctx, SaleFilter{Uninvoiced: true})
+	if err != nil {
+		t.Fatalf("List() error: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != older.ID {
+		t.Errorf("List() of uninvoiced sales = %+v, want only the synced sale", list)
+	}
+	if err := sales.SetInvoice(ctx, held.ID, stamped, pending); err != nil {
+		t.Fatalf("SetInvoice() error: %v", err)
+	}
+	if got, err := sales.Get(ctx, held.ID); err != nil || !reflect.DeepEqual(got.Invoice, stamped) {
+		t.Errorf("Get() invoice = %+v, %v; want %+v", got.Invoice, err, stamped)
+	}
+	if err := sales.SetInvoice(ctx, held.ID, nil, pending); err != ErrConflict {
+		t.Errorf("releasing a stamped invoice = %v, want ErrConflict", err)
+	}
+
+	// Las ventas de una factura global se apartan con su ID
+	globalID := primitive.NewObjectID()
+	global := &models.SaleInvoice{Status: models.InvoicePending, Global: true, GlobalInvoiceID: &globalID}
+	if err := sales.SetInvoice(ctx, older.ID, global, nil); err != nil {
+		t.Fatalf("SetInvoice() error: %v", err)
+	}
+	otherID := primitive.NewObjectID()
+	if err := sales.SetInvoice(ctx, older.ID, nil, &models.SaleInvoice{Status: models.InvoicePending, GlobalInvoiceID: &otherID}); err != ErrConflict {
+		t.Errorf("releasing another global invoice = %v, want ErrConflict", err)
+	}
+	if err := sales.SetInvoice(ctx, older.ID, nil, global); err != nil {
+		t.Fatalf("SetInvoice() release error: %v", err)
+	}
+	if got, err := sales.Get(ctx, older.ID); err != nil || got.Invoice != nil {
+		t.Errorf("Get() invoice = %+v, %v; want none", got.Invoice, err)
+	}
+
+	revision := models.SaleRevision{ID: primitive.NewObjectID(), SaleID: held.ID.Hex(), Revision: 1, Items: completed.Items, EditedBy: "seller", EditedAt: 200}
+	if err := sales.InsertRevision(ctx, revision); err != nil {
+		t.Fatalf("InsertRevision() error: %v", err)
+	}
+	revisions, err := sales.Revisions(ctx, held.ID)
+	if err != nil {
+		t.Fatalf("Revisions() error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].ID != revision.ID || len(revisions[0].Items) != 1 {
+		t.Errorf("Revisions() = %+v, want the inserted revision", revisions)
+	}
+
+	mixed := models.Sale{ID: primitive.NewObjectID(), SellerID: " Ana@Example.com", Timestamp: 300, Status: models.SaleCompleted}
+	if err := sales.Insert(ctx, mixed); err != nil {
+		t.Fatalf("Insert() error: %v", err)
+	}
+	edit := models.SaleRevision{ID: primitive.NewObjectID(), SaleID: mixed.ID.Hex(), Revision: 1, EditedBy: "ANA@example.com ", EditedAt: 300}
+	if err := sales.InsertRevision(ctx, edit); err != nil {
+		t.Fatalf("InsertRevision() error: %v", err)
+	}
+	if err := sales.NormalizeEmails(ctx); err != nil {
+		t.Fatalf("NormalizeEmails() error: %v", err)
+	}
+	if got, err := sales.Get(ctx, mixed.ID); err != nil || got.SellerID != "ana@example.com" {
+		t.Errorf("Get() seller = %q, %v; want ana@example.com", got.SellerID, err)
+	}
+	if revisions, err := sales.Revisions(ctx, mixed.ID); err != nil || len(revisions) != 1 || revisions[0].EditedBy != "ana@example.com" {
+		t.Errorf("Revisions() = %+v, %v; want edited by ana@example.com", revisions, err)
+	}
+	if got, _ := sales.Get(ctx, held.ID); got.SellerID != "seller" {
+		t.Errorf("Get() seller = %q, want it unchanged", got.SellerID)
+	}
+
+	if err := sales.Delete(ctx, held.ID); err != nil {
+		t.Fatalf("Delete() error: %v", err)
+	}
+	if err := sales.Delete(ctx, held.ID); err != ErrNotFound {
+		t.Errorf("Delete() twice = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package store define el acceso a datos que usan los servicios: una interfaz
+// por entidad, con una implementación sobre MongoDB y otra en memoria para
+// las pruebas.
+package store
+
+import (
+	"auth-service/models"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound indica que el documento buscado no existe
+	ErrNotFound = errors.New("not found")
+	// ErrInUse indica que otro registro aún hace referencia al que se elimina
+	ErrInUse = errors.New("still referenced")
+	// ErrDuplicate indica que el cambio repetiría un valor único (el correo de
+	// un usuario)
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrConflict indica que otra operación cambió el documento después de
+	// leerlo
+	ErrConflict = errors.New("modified concurrently")
+)
+
+// Store agrupa los stores de cada entidad
+type Store interface {
+	Users() UserStore
+	Roles() RoleStore
+	Sales() SaleStore
+	Invites() InviteStore
+
+	// Atomic ejecuta fn como unidad de trabajo: los cambios hechos con el
+	// contexto que recibe fn se aplican juntos o no se aplican. fn puede
+	// repetirse, así que no debe tener efectos fuera del store.
+	Atomic(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// EnqueueWebhook encola un evento para las suscripciones de webhooks
+	EnqueueWebhook(ctx context.Context, event string, data interface{}) error
+}
+
+type UserStore interface {
+	List(ctx context.Context) ([]models.User, error)
+	Get(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	CountByRole(ctx context.Context, roleID primitive.ObjectID) (int64, error)
+	Insert(ctx context.Context, user models.User) error
+	// Update reemplaza nombre, correo y rol del usuario
+	Update(ctx context.Context, user models.User) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type RoleStore interface {
+	List(ctx context.Context) ([]models.Role, error)
+	Get(ctx context.Context, id primitive.ObjectID) (models.Role, error)
+	GetByName(ctx context.Context, name string) (models.Role, error)
+	Insert(ctx context.Context, role models.Role) error
+	// Update reemplaza nombre y permisos del rol
+	Update(ctx context.Context, role models.Role) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+
+	// Lock busca el rol por nombre y escribe su documento dentro de la unidad
+	// de trabajo, para que una transacción simultánea sobre el mismo rol (otra
+	// asignación o su eliminación) choque en lugar de confirmar con lo que leyó
+	Lock(ctx context.Context, name string) (models.Role, error)
+}
+
+type InviteStore interface {
+	Insert(ctx context.Context, invite models.Invite) error
+	GetByTokenHash(ctx context.Context, tokenHash string) (models.Invite, error)
+	// MarkAccepted registra que la invitación se usó; ErrNotFound si no existe
+	// o ya se había usado
+	MarkAccepted(ctx context.Context, id primitive.ObjectID, acceptedAt int64) error
+}
+
+// SaleFilter selecciona ventas; los campos vacíos no filtran. From y To
+// limitan la fecha de la venta a [From, To) en segundos Unix.
+type SaleFilter struct {
+	SellerID   string
+	StoreID    string
+	RegisterID string
+	Status     string
+	// ClientID es el ID con que la app sin conexión registró la venta
+	ClientID string
+	From     int64
+	To       int64
+	// Uninvoiced deja sólo las ventas sin factura
+	Uninvoiced bool
+	// Por omisión las ventas más recientes van primero
+	OldestFirst bool
+}
+
+type SaleStore interface {
+	Get(ctx context.Context, id primitive.ObjectID) (models.Sale, error)
+	List(ctx context.Context, filter SaleFilter) ([]models.Sale, error)
+	// Revisions lista las ediciones de la venta en orden
+	Revisions(ctx context.Context, saleID primitive.ObjectID) ([]models.SaleRevision, error)
+	Insert(ctx context.Context, sale models.Sale) error
+	// Update guarda partidas, totales, estado, cobro y revisión de la venta si
+	// sigue en el estado, la revisión y con lo abonado de previous; si no,
+	// ErrConflict. Los demás campos (la factura, por ejemplo) no se tocan.
+	Update(ctx context.Context, sale, previous models.Sale) error
+	// SetInvoice reemplaza la factura de la venta (nil la quita) si la actual
+	// es previous: ninguna si previous es nil o, si no, una con el mismo
+	// estado y la misma factura global. Si no, ErrConflict.
+	SetInvoice(ctx context.Context, id primitive.ObjectID, invoice, previous *models.SaleInvoice) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	InsertRevision(ctx context.Context, revision models.SaleRevision) error
+	// NormalizeEmails guarda sin espacios y en minúsculas el correo del
+	// vendedor de las ventas y el de quien editó cada revisión
+	NormalizeEmails(ctx context.Context) error
+}
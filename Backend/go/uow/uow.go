@@ -0,0 +1,121 @@
+// Package uow agrupa varias operaciones de MongoDB en una unidad de trabajo:
+// una transacción que se confirma completa o no se aplica.
+package uow
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxAttempts limita los reintentos por errores transitorios
+const maxAttempts = 5
+
+// retryDelay es la espera antes del primer reintento; se duplica en cada uno
+const retryDelay = 10 * time.Millisecond
+
+var (
+	detectOnce    sync.Once
+	transactional = true
+)
+
+// Run ejecuta fn como una unidad de trabajo. Todas las operaciones hechas con
+// el contexto que recibe fn se confirman juntas; si fn devuelve un error la
+// transacción se aborta y el error se devuelve tal cual.
+//
+// Un error transitorio (un conflicto de escritura con otra transacción, una
+// elección en el replica set) repite fn desde el inicio, así que fn no debe
+// tener efectos fuera de la base de datos ni depender de lo que dejó un
+// intento anterior. Si el resultado del commit es incierto sólo se repite el
+// commit.
+//
+// Llamado con el contexto de otra unidad de trabajo, fn se une a ella. En un
+// servidor standalone, que no admite transacciones, fn se ejecuta sin
+// transacción.
+func Run(ctx context.Context, db *mongo.Database, fn func(ctx context.Context) error) error {
+	if InTransaction(ctx) {
+		return fn(ctx)
+	}
+	if !supportsTransactions(ctx, db) {
+		return fn(ctx)
+	}
+
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	for attempt := 1; ; attempt++ {
+		err = mongo.WithSession(ctx, session, func(sessCtx mongo.SessionContext) error {
+			if err := sessCtx.StartTransaction(); err != nil {
+				return err
+			}
+			if err := fn(sessCtx); err != nil {
+				if abortErr := sessCtx.AbortTransaction(context.Background()); abortErr != nil {
+					log.Printf("Error aborting transaction: %v", abortErr)
+				}
+				return err
+			}
+			return commit(sessCtx)
+		})
+		if err == nil || !hasErrorLabel(err, "TransientTransactionError") || attempt == maxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay << (attempt - 1)):
+		}
+	}
+}
+
+// InTransaction indica si ctx pertenece a una unidad de trabajo con
+// transacción. Sin ella, quien llama debe deshacer a mano los pasos ya
+// aplicados cuando uno posterior falla.
+func InTransaction(ctx context.Context) bool {
+	return mongo.SessionFromContext(ctx) != nil
+}
+
+// commit confirma la transacción y repite el commit mientras su resultado sea
+// incierto (el servidor pudo haberlo aplicado antes de perder la conexión)
+func commit(sessCtx mongo.SessionContext) error {
+	for attempt := 1; ; attempt++ {
+		err := sessCtx.CommitTransaction(sessCtx)
+		if err == nil || !hasErrorLabel(err, "UnknownTransactionCommitResult") || attempt == maxAttempts {
+			return err
+		}
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var serverErr mongo.ServerError
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel(label)
+}
+
+// supportsTransactions revisa una vez si el servidor es parte de un replica
+// set o un mongos. Si la consulta falla se asume que sí, y la transacción
+// reportará el error.
+func supportsTransactions(ctx context.Context, db *mongo.Database) bool {
+	detectOnce.Do(func() {
+		var reply struct {
+			SetName string `bson:"setName"`
+			Msg     string `bson:"msg"`
+		}
+		if err := db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&reply); err != nil {
+			log.Printf("Error checking transaction support: %v", err)
+			return
+		}
+		transactional = reply.SetName != "" || reply.Msg == "isdbgrid"
+		if !transactional {
+			log.Println("⚠️  MongoDB does not support transactions (standalone server); units of work run without a transaction")
+		}
+	})
+	return transactional
+}
@@ -0,0 +1,127 @@
+package webhooks
+
+import (
+	"auth-service/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Eventos a los que se puede suscribir un webhook
+const (
+	EventSaleCompleted = "sale.completed"
+	EventSaleRefunded  = "sale.refunded"
+	EventUserCreated   = "user.created"
+	EventStockLow      = "stock.low"
+	EventRoleUpdated   = "role.updated"
+)
+
+// Events lista los eventos disponibles
+var Events = []string{EventSaleCompleted, EventSaleRefunded, EventUserCreated, EventStockLow, EventRoleUpdated}
+
+// Encabezados de cada entrega
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// IsEvent indica si el nombre es un evento conocido
+func IsEvent(name string) bool {
+	for _, event := range Events {
+		if event == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope es el cuerpo que recibe el suscriptor
+type envelope struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt int64       `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// Enqueue deja una entrega pendiente del evento para cada suscripción activa
+// que lo escucha; el despachador las envía en segundo plano.
+func Enqueue(ctx context.Context, db *mongo.Database, event string, data interface{}) error {
+	return EnqueueEvent(ctx, db, primitive.NewObjectID().Hex(), event, data)
+}
+
+// EnqueueEvent es Enqueue con un ID de evento conocido. Encolar dos veces el
+// mismo ID no duplica entregas: el índice único (eventId, subscriptionId)
+// descarta las repetidas.
+func EnqueueEvent(ctx context.Context, db *mongo.Database, eventID, event string, data interface{}) error {
+	cursor, err := db.Collection("webhook_subscriptions").Find(ctx, bson.M{"active": true, "events": event})
+	if err != nil {
+		return err
+	}
+	var subscriptions []models.WebhookSubscription
+	if err := cursor.All(ctx, &subscriptions); err != nil {
+		return err
+	}
+	if len(subscriptions) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	payload, err := json.Marshal(envelope{ID: eventID, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]interface{}, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:             primitive.NewObjectID(),
+			SubscriptionID: subscription.ID,
+			EventID:        eventID,
+			Event:          event,
+			Payload:        string(payload),
+			Status:         models.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	_, err = db.Collection("webhook_deliveries").InsertMany(ctx, deliveries, options.InsertMany().SetOrdered(false))
+	if mongo.IsDuplicateKeyError(err) {
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) {
+			for _, writeErr := range bulkErr.WriteErrors {
+				if writeErr.Code != 11000 {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return err
+}
+
+// Sign calcula la firma de una entrega: HMAC-SHA256 con el secreto de la
+// suscripción sobre "<timestamp>.<cuerpo>", en hexadecimal con prefijo sha256=.
+// Incluir la hora permite al receptor rechazar entregas viejas repetidas.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify compara en tiempo constante la firma recibida con la esperada
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
@@ -0,0 +1,49 @@
+package webhooks
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	secret := "0123456789abcdef"
+	body := []byte(`{"id":"1","event":"sale.completed","createdAt":1700000000,"data":{"total":100}}`)
+	timestamp := int64(1700000000)
+
+	signature := Sign(secret, timestamp, body)
+	if !strings.HasPrefix(signature, "sha256=") || len(signature) != len("sha256=")+64 {
+		t.Fatalf("Sign() = %q, want sha256= and 64 hex digits", signature)
+	}
+	if Sign(secret, timestamp, body) != signature {
+		t.Error("Sign() is not deterministic")
+	}
+	if !Verify(secret, timestamp, body, signature) {
+		t.Error("Verify() rejected its own signature")
+	}
+
+	// Último dígito cambiado
+	last := "0"
+	if strings.HasSuffix(signature, "0") {
+		last = "1"
+	}
+	flipped := signature[:len(signature)-1] + last
+
+	tampered := map[string]struct {
+		secret    string
+		timestamp int64
+		body      []byte
+		signature string
+	}{
+		"body":      {secret, timestamp, []byte(strings.Replace(string(body), "100", "900", 1)), signature},
+		"timestamp": {secret, timestamp + 1, body, signature},
+		"secret":    {"another secret", timestamp, body, signature},
+		"signature": {secret, timestamp, body, flipped},
+		"no prefix": {secret, timestamp, body, strings.TrimPrefix(signature, "sha256=")},
+		"empty":     {secret, timestamp, body, ""},
+	}
+	for name, tt := range tampered {
+		if Verify(tt.secret, tt.timestamp, tt.body, tt.signature) {
+			t.Errorf("%s: Verify() accepted a tampered delivery", name)
+		}
+	}
+}
@@ -7,12 +7,7 @@ const Product = {
       SELECT 
         p.*, 
         m.nombre as marca_nombre, 
-        i.porcentaje as iva_porcentaje,
-        COALESCE((
-          SELECT SUM(cantidad) 
-          FROM inventario 
-          WHERE id_producto = p.id_producto
-        ), 0) as stock
+        i.porcentaje as iva_porcentaje
       FROM productos p
       LEFT JOIN marcas m ON p.id_marca = m.id_marca
       LEFT JOIN ivas i ON p.id_iva = i.id_iva
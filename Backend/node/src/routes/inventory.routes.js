@@ -2,9 +2,8 @@ const express = require('express');
 const router = express.Router();
 const inventoryController = require('../controllers/inventory.controller');
 
-router.post('/', inventoryController.createInventory);
+// Sólo lectura: el servicio Go importa estas existencias a su kárdex
+// (POST /admin/inventory/import) y desde entonces las lleva él
+router.get('/', inventoryController.getLegacyStock);
 
-router.put('/product/:id', inventoryController.updateInventoryByProduct);
-router.post('/update', inventoryController.createOrUpdateInventory);
-
-module.exports = router;
\ No newline at end of file
+module.exports = router;
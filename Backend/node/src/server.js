@@ -34,7 +34,7 @@ app.use('/api/brands', brandRoutes);
 const taxRoutes = require('./routes/tax.routes');
 app.use('/api/taxes', taxRoutes);
 
-// Rutas para Inventario
+// Existencias heredadas (sólo lectura; el inventario vive en el servicio Go)
 const inventoryRoutes = require('./routes/inventory.routes');
 app.use('/api/inventory', inventoryRoutes);
 
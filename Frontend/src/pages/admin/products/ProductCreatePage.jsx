@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
+import { inventoryAPI } from '../../../services/api';
 
 const ProductCreatePage = () => {
   const navigate = useNavigate();
@@ -108,21 +109,14 @@ const ProductCreatePage = () => {
 
       const productData = await response.json();
 
-      // Crear registro en inventario
-      const inventoryResponse = await fetch('http://localhost:3000/api/inventory', {
-        method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({
-          id_producto: productData.id_producto,
-          cantidad: payload.stock,
-          ubicacion: 'Almacén principal'
-        })
-      });
-
-      if (!inventoryResponse.ok) {
-        throw new Error('Producto creado pero falló registro en inventario');
+      // Registrar la existencia inicial como ajuste en el kárdex
+      if (payload.stock !== 0) {
+        try {
+          await inventoryAPI.adjust(productData.id_producto, payload.stock, 'Existencia inicial');
+        } catch (inventoryError) {
+          console.error('Error en inventario:', inventoryError.response?.data || inventoryError.message);
+          throw new Error('Producto creado pero falló registro en inventario');
+        }
       }
 
       navigate('/admin/products');
@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
+import { inventoryAPI } from '../../../services/api';
 
 const ProductEditPage = () => {
   const { id } = useParams();
@@ -8,6 +9,7 @@ const ProductEditPage = () => {
   const [error, setError] = useState(null);
   const [brands, setBrands] = useState([]);
   const [taxes, setTaxes] = useState([]);
+  const [currentStock, setCurrentStock] = useState(0);
   const [formData, setFormData] = useState({
     nombre: '',
     descripcion: '',
@@ -41,6 +43,11 @@ const ProductEditPage = () => {
         if (!productResponse.ok) throw new Error('Error cargando producto');
         const productData = await productResponse.json();
 
+        // Existencia actual según el inventario del servicio Go
+        const stock = await inventoryAPI.getStockByProduct();
+        const productStock = stock[String(id)] || 0;
+        setCurrentStock(productStock);
+
         setBrands(brandsData);
         setTaxes(taxesData);
 
@@ -55,7 +62,7 @@ const ProductEditPage = () => {
           codigo_barras: productData.codigo_barras || '',
           id_marca: productData.id_marca || brandsData[0]?.id_marca || '',
           id_iva: productData.id_iva || taxesData[0]?.id_iva || '',
-          stock: productData.stock || 0
+          stock: productStock
         });
       } catch (err) {
         console.error('Error:', err);
@@ -116,21 +123,15 @@ const ProductEditPage = () => {
         throw new Error(errorData.error || 'Error al actualizar producto');
       }
 
-      // 2. Actualizar el inventario
-      const inventoryResponse = await fetch(`http://localhost:3000/api/inventory/product/${id}`, {
-        method: 'PUT',
-        headers: {
-          'Content-Type': 'application/json',
-        },
-        body: JSON.stringify({
-          cantidad: parseInt(formData.stock) || 0
-        })
-      });
-
-      if (!inventoryResponse.ok) {
-        const errorData = await inventoryResponse.json();
-        console.error('Error en inventario:', errorData);
-        throw new Error('Producto actualizado pero hubo un problema con el inventario');
+      // 2. Registrar la diferencia de existencias como ajuste en el kárdex
+      const difference = (parseInt(formData.stock) || 0) - currentStock;
+      if (difference !== 0) {
+        try {
+          await inventoryAPI.adjust(id, difference, 'Ajuste desde la edición del producto');
+        } catch (inventoryError) {
+          console.error('Error en inventario:', inventoryError.response?.data || inventoryError.message);
+          throw new Error('Producto actualizado pero hubo un problema con el inventario');
+        }
       }
 
       navigate('/admin/products');
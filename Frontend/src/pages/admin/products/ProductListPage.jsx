@@ -1,5 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
+import { inventoryAPI } from '../../../services/api';
 
 const ProductListPage = () => {
   const [products, setProducts] = useState([]);
@@ -21,12 +22,15 @@ const ProductListPage = () => {
 
         const data = await response.json();
 
+        // Las existencias vienen del inventario del servicio Go
+        const stock = await inventoryAPI.getStockByProduct();
+
         // Procesamiento seguro de los datos
         const processedProducts = data.map(product => ({
           ...product,
           precio_compra: parseFloat(product.precio_compra) || 0,
           precio_venta: parseFloat(product.precio_venta) || 0,
-          stock: parseInt(product.stock) || 0  // Asegura que stock sea número
+          stock: stock[String(product.id_producto)] || 0
         }));
 
         setProducts(processedProducts);
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { salesAPI, nodeAPI } from '../../../services/api';
+import { salesAPI, nodeAPI, inventoryAPI } from '../../../services/api';
 import Select from 'react-select';
 
 const NewSalePage = () => {
@@ -14,8 +14,11 @@ const NewSalePage = () => {
     useEffect(() => {
         const fetchProducts = async () => {
             try {
-                const response = await nodeAPI.getProducts();
-                setProducts(response.data);
+                const [response, stock] = await Promise.all([
+                    nodeAPI.getProducts(),
+                    inventoryAPI.getStockByProduct()
+                ]);
+                setProducts(response.data.map(p => ({ ...p, stock: stock[String(p.id_producto)] || 0 })));
             } catch (err) {
                 setError('Error al cargar productos');
                 console.error('Error fetching products:', err);
@@ -79,4 +79,16 @@ export const nodeAPI = {
   getProductById: (id) => axios.get(`http://localhost:3000/api/products/${id}`)
 };
 
+// Existencias: se llevan en el servicio Go y cada cambio queda en su kárdex
+export const inventoryAPI = {
+  getAll: () => api.get('/inventory'),
+  // Mapa de id_producto a existencia; un producto sin registro no aparece
+  getStockByProduct: async () => {
+    const response = await api.get('/inventory');
+    return Object.fromEntries(response.data.map(item => [String(item.productId), item.quantity]));
+  },
+  adjust: (productId, quantity, reason) =>
+    api.post(`/admin/inventory/${productId}/adjustments`, { quantity, reason })
+};
+
 export default api;
\ No newline at end of file